@@ -3,6 +3,7 @@ package ast
 import (
 	"bytes"
 	"fmt"
+	"strconv"
 	"strings"
 	"token"
 )
@@ -10,6 +11,7 @@ import (
 type Node interface {
 	TokenLiteral() string
 	String() string
+	Pos() token.Position
 }
 
 type Statement interface {
@@ -34,6 +36,14 @@ func (p *Program) TokenLiteral() string {
 	}
 }
 
+func (p *Program) Pos() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[0].Pos()
+	} else {
+		return token.Position{}
+	}
+}
+
 func (p *Program) String() string {
 	if len(p.Statements) > 0 {
 		buf := bytes.Buffer{}
@@ -49,12 +59,21 @@ func (p *Program) String() string {
 type Identifier struct {
 	Token *token.Token
 	Name  string
+
+	// set by the resolver for names local to a function, match arm or catch clause:
+	// the name is slot Slot of the scope Depth levels up from where it appears
+	Resolved bool `json:"-"`
+	Depth    int  `json:"-"`
+	Slot     int  `json:"-"`
 }
 
 func (i *Identifier) expressionNode() {}
 func (i *Identifier) TokenLiteral() string {
 	return i.Token.Literal
 }
+func (i *Identifier) Pos() token.Position {
+	return i.Token.Pos
+}
 func (i *Identifier) String() string {
 	return i.Name
 }
@@ -68,6 +87,9 @@ func (il *IntegerLiteral) expressionNode() {}
 func (il *IntegerLiteral) TokenLiteral() string {
 	return il.Token.Literal
 }
+func (il *IntegerLiteral) Pos() token.Position {
+	return il.Token.Pos
+}
 func (il *IntegerLiteral) String() string {
 	return fmt.Sprintf("%d", il.IntValue)
 }
@@ -81,6 +103,9 @@ func (bl *BooleanLiteral) expressionNode() {}
 func (bl *BooleanLiteral) TokenLiteral() string {
 	return bl.Token.Literal
 }
+func (bl *BooleanLiteral) Pos() token.Position {
+	return bl.Token.Pos
+}
 func (bl *BooleanLiteral) String() string {
 	if bl.BoolValue {
 		return "true"
@@ -89,6 +114,21 @@ func (bl *BooleanLiteral) String() string {
 	}
 }
 
+type NullLiteral struct {
+	Token *token.Token
+}
+
+func (nl *NullLiteral) expressionNode() {}
+func (nl *NullLiteral) TokenLiteral() string {
+	return nl.Token.Literal
+}
+func (nl *NullLiteral) Pos() token.Position {
+	return nl.Token.Pos
+}
+func (nl *NullLiteral) String() string {
+	return "null"
+}
+
 type PrefixExpression struct {
 	Token      *token.Token
 	Operator   string
@@ -99,6 +139,9 @@ func (pr *PrefixExpression) expressionNode() {}
 func (pr *PrefixExpression) TokenLiteral() string {
 	return pr.Token.Literal
 }
+func (pr *PrefixExpression) Pos() token.Position {
+	return pr.Token.Pos
+}
 func (pr *PrefixExpression) String() string {
 	return fmt.Sprintf("(%s%s)", pr.Operator, pr.Expression.String())
 }
@@ -114,6 +157,9 @@ func (in *InfixExpression) expressionNode() {}
 func (in *InfixExpression) TokenLiteral() string {
 	return in.Token.Literal
 }
+func (in *InfixExpression) Pos() token.Position {
+	return in.Token.Pos
+}
 func (in *InfixExpression) String() string {
 	return fmt.Sprintf("(%s %s %s)", in.Left.String(), in.Operator, in.Right.String())
 }
@@ -129,6 +175,9 @@ func (ie *IfExpression) expressionNode() {}
 func (ie *IfExpression) TokenLiteral() string {
 	return ie.Token.Literal
 }
+func (ie *IfExpression) Pos() token.Position {
+	return ie.Token.Pos
+}
 func (ie *IfExpression) String() string {
 	if ie.Alternative == nil {
 		return fmt.Sprintf("%s %s %s", ie.TokenLiteral(), ie.Condition, ie.Consequence)
@@ -137,35 +186,93 @@ func (ie *IfExpression) String() string {
 }
 
 type FunctionExpression struct {
-	Token  *token.Token
-	Params []*Identifier
-	Body   *BlockStatement
+	Token    *token.Token
+	Params   []*Identifier
+	Defaults []Expression // default value of each of Params, nil if it has none
+	Rest     *Identifier  // collects the remaining arguments, nil if there is none
+	Body     *BlockStatement
+	Locals   []string `json:"-"` // names of the slots of its scope, set by the resolver
+
+	// optional annotations, nil when missing
+	ParamTypes []TypeExpr // type of each of Params
+	RestType   TypeExpr
+	ReturnType TypeExpr
 }
 
 func (fu *FunctionExpression) expressionNode() {}
 func (fu *FunctionExpression) TokenLiteral() string {
 	return fu.Token.Literal
 }
+func (fu *FunctionExpression) Pos() token.Position {
+	return fu.Token.Pos
+}
 func (fu *FunctionExpression) String() string {
+	return fmt.Sprintf("%s %s", fu.TokenLiteral(), fu.signatureAndBody())
+}
+
+// signatureAndBody is the function without the fn, as in `(x) {x;}`.
+func (fu *FunctionExpression) signatureAndBody() string {
 	names := []string{}
-	for _, par := range fu.Params {
-		names = append(names, par.Name)
+	for i, par := range fu.Params {
+		name := par.Name
+		if i < len(fu.ParamTypes) && fu.ParamTypes[i] != nil {
+			name += ": " + fu.ParamTypes[i].String()
+		}
+		if i < len(fu.Defaults) && fu.Defaults[i] != nil {
+			name += " = " + fu.Defaults[i].String()
+		}
+		names = append(names, name)
+	}
+	if fu.Rest != nil {
+		name := "..." + fu.Rest.Name
+		if fu.RestType != nil {
+			name += ": " + fu.RestType.String()
+		}
+		names = append(names, name)
 	}
 	paramsString := strings.Join(names, ", ")
 
-	return fmt.Sprintf("%s (%s) %s", fu.TokenLiteral(), paramsString, fu.Body)
+	if fu.ReturnType != nil {
+		return fmt.Sprintf("(%s) -> %s %s", paramsString, fu.ReturnType, fu.Body)
+	}
+	return fmt.Sprintf("(%s) %s", paramsString, fu.Body)
+}
+
+// FunctionStatement is `fn name(params) { ... }`. Unlike a let, it binds name before
+// any statement of its block or program runs, so functions can call the ones declared after them.
+// No other statement of the same block may declare the same name, see FunctionClash.
+type FunctionStatement struct {
+	Token    *token.Token // the fn
+	Name     *Identifier
+	Function *FunctionExpression
+}
+
+func (fs *FunctionStatement) statementNode() {}
+func (fs *FunctionStatement) TokenLiteral() string {
+	return fs.Token.Literal
+}
+func (fs *FunctionStatement) Pos() token.Position {
+	return fs.Token.Pos
+}
+func (fs *FunctionStatement) String() string {
+	return fmt.Sprintf("%s %s%s", fs.TokenLiteral(), fs.Name, fs.Function.signatureAndBody())
 }
 
 type CallExpression struct {
 	Token     *token.Token
 	Function  Expression
 	Arguments []Expression
+	Tail      bool `json:"-"` // the call is the last thing its function does, see MarkTailCalls
+	Grouped   bool // written in parentheses, which end its chain, see ChainLeft
 }
 
 func (ca *CallExpression) expressionNode() {}
 func (ca *CallExpression) TokenLiteral() string {
 	return ca.Token.Literal
 }
+func (ca *CallExpression) Pos() token.Position {
+	return ca.Function.Pos()
+}
 func (ca *CallExpression) String() string {
 	args := []string{}
 	for _, arg := range ca.Arguments {
@@ -176,15 +283,31 @@ func (ca *CallExpression) String() string {
 	return fmt.Sprintf("%s(%s)", ca.Function, argsString)
 }
 
+// CalleeName names the function called for stack traces, by how it was called.
+func (ca *CallExpression) CalleeName() string {
+	switch f := ca.Function.(type) {
+	case *Identifier:
+		return f.Name
+	case *FieldExpression:
+		return f.Field
+	}
+	return "<anonymous>"
+}
+
 type BlockStatement struct {
 	Token      *token.Token
 	Statements []Statement
+	Scoped     bool     // the block has a scope of its own, instead of binding in the enclosing one
+	Locals     []string `json:"-"` // names of the slots of its scope if Scoped, set by the resolver
 }
 
 func (bs *BlockStatement) statementNode() {}
 func (bs *BlockStatement) TokenLiteral() string {
 	return bs.Token.Literal
 }
+func (bs *BlockStatement) Pos() token.Position {
+	return bs.Token.Pos
+}
 func (bs *BlockStatement) String() string {
 	buf := bytes.Buffer{}
 	buf.WriteString("{")
@@ -196,17 +319,34 @@ func (bs *BlockStatement) String() string {
 	return buf.String()
 }
 
+// LetStatement binds either a single name, or destructures the value with Pattern, in which case Ident is nil.
 type LetStatement struct {
-	Token *token.Token
-	Ident *Identifier
-	Value Expression
+	Token   *token.Token
+	Ident   *Identifier
+	Pattern Pattern
+	Type    TypeExpr // optional annotation of Ident, nil when missing
+	Value   Expression
+}
+
+// IsConst tells whether the statement is a const, whose name cannot be bound again in the same scope.
+func (s *LetStatement) IsConst() bool {
+	return s.Token.Type == token.CONST
 }
 
 func (s *LetStatement) statementNode() {}
 func (s *LetStatement) TokenLiteral() string {
 	return s.Token.Literal
 }
+func (s *LetStatement) Pos() token.Position {
+	return s.Token.Pos
+}
 func (s *LetStatement) String() string {
+	if s.Pattern != nil {
+		return fmt.Sprintf("%s %s = %s", s.TokenLiteral(), s.Pattern, s.Value.String())
+	}
+	if s.Type != nil {
+		return fmt.Sprintf("%s %s: %s = %s", s.TokenLiteral(), s.Ident.Name, s.Type, s.Value.String())
+	}
 	return fmt.Sprintf("%s %s = %s", s.TokenLiteral(), s.Ident.Name, s.Value.String())
 }
 
@@ -219,6 +359,9 @@ func (s *ReturnStatement) statementNode() {}
 func (s *ReturnStatement) TokenLiteral() string {
 	return s.Token.Literal
 }
+func (s *ReturnStatement) Pos() token.Position {
+	return s.Token.Pos
+}
 func (s *ReturnStatement) String() string {
 	return fmt.Sprintf("%s %s", s.TokenLiteral(), s.Value.String())
 }
@@ -232,6 +375,332 @@ func (s *ExpressionStatement) statementNode() {}
 func (s *ExpressionStatement) TokenLiteral() string {
 	return s.Token.Literal
 }
+func (s *ExpressionStatement) Pos() token.Position {
+	return s.Token.Pos
+}
 func (s *ExpressionStatement) String() string {
 	return s.Expression.String()
 }
+
+type StringLiteral struct {
+	Token *token.Token
+	Value string
+}
+
+func (sl *StringLiteral) expressionNode() {}
+func (sl *StringLiteral) TokenLiteral() string {
+	return sl.Token.Literal
+}
+func (sl *StringLiteral) Pos() token.Position {
+	return sl.Token.Pos
+}
+func (sl *StringLiteral) String() string {
+	return strconv.Quote(sl.Value)
+}
+
+// TemplateLiteral is a string with interpolations, like "a ${b} c".
+// Parts are the strings around the interpolated expressions, so there is one more of them.
+type TemplateLiteral struct {
+	Token       *token.Token
+	Parts       []string
+	Expressions []Expression
+}
+
+func (tl *TemplateLiteral) expressionNode() {}
+func (tl *TemplateLiteral) TokenLiteral() string {
+	return tl.Token.Literal
+}
+func (tl *TemplateLiteral) Pos() token.Position {
+	return tl.Token.Pos
+}
+func (tl *TemplateLiteral) String() string {
+	quote := func(part string) string {
+		q := strconv.Quote(part)
+		return strings.Replace(q[1:len(q)-1], "${", `\${`, -1)
+	}
+	var out bytes.Buffer
+	out.WriteString(`"`)
+	for i, e := range tl.Expressions {
+		out.WriteString(quote(tl.Parts[i]))
+		out.WriteString("${")
+		out.WriteString(e.String())
+		out.WriteString("}")
+	}
+	out.WriteString(quote(tl.Parts[len(tl.Parts)-1]))
+	out.WriteString(`"`)
+	return out.String()
+}
+
+type ArrayLiteral struct {
+	Token    *token.Token
+	Elements []Expression
+}
+
+func (al *ArrayLiteral) expressionNode() {}
+func (al *ArrayLiteral) TokenLiteral() string {
+	return al.Token.Literal
+}
+func (al *ArrayLiteral) Pos() token.Position {
+	return al.Token.Pos
+}
+func (al *ArrayLiteral) String() string {
+	elements := []string{}
+	for _, el := range al.Elements {
+		elements = append(elements, el.String())
+	}
+	return fmt.Sprintf("[%s]", strings.Join(elements, ", "))
+}
+
+type IndexExpression struct {
+	Token   *token.Token
+	Left    Expression
+	Index   Expression
+	Grouped bool // written in parentheses, which end its chain, see ChainLeft
+}
+
+func (ie *IndexExpression) expressionNode() {}
+func (ie *IndexExpression) TokenLiteral() string {
+	return ie.Token.Literal
+}
+func (ie *IndexExpression) Pos() token.Position {
+	return ie.Token.Pos
+}
+func (ie *IndexExpression) String() string {
+	if ie.IsOptional() {
+		return fmt.Sprintf("(%s?[%s])", ie.Left, ie.Index)
+	}
+	return fmt.Sprintf("(%s[%s])", ie.Left, ie.Index)
+}
+
+// IsOptional tells whether the index is written ?[, which gives null when Left is null, see IsOptionalChain.
+func (ie *IndexExpression) IsOptional() bool {
+	return ie.Token.Type == token.OPTIONAL_LBRACKET
+}
+
+type TryExpression struct {
+	Token       *token.Token
+	Body        *BlockStatement
+	CatchParam  *Identifier // nil if there is no catch clause
+	Catch       *BlockStatement
+	CatchLocals []string `json:"-"` // names of the slots of the catch scope, set by the resolver
+	Finally     *BlockStatement
+}
+
+func (te *TryExpression) expressionNode() {}
+func (te *TryExpression) TokenLiteral() string {
+	return te.Token.Literal
+}
+func (te *TryExpression) Pos() token.Position {
+	return te.Token.Pos
+}
+func (te *TryExpression) String() string {
+	buf := bytes.Buffer{}
+	buf.WriteString(fmt.Sprintf("%s %s", te.TokenLiteral(), te.Body))
+	if te.Catch != nil {
+		buf.WriteString(fmt.Sprintf(" catch (%s) %s", te.CatchParam, te.Catch))
+	}
+	if te.Finally != nil {
+		buf.WriteString(fmt.Sprintf(" finally %s", te.Finally))
+	}
+	return buf.String()
+}
+
+type ThrowStatement struct {
+	Token *token.Token
+	Value Expression
+}
+
+func (s *ThrowStatement) statementNode() {}
+func (s *ThrowStatement) TokenLiteral() string {
+	return s.Token.Literal
+}
+func (s *ThrowStatement) Pos() token.Position {
+	return s.Token.Pos
+}
+func (s *ThrowStatement) String() string {
+	return fmt.Sprintf("%s %s", s.TokenLiteral(), s.Value.String())
+}
+
+type HashLiteral struct {
+	Token *token.Token
+	Pairs []*HashLiteralPair // in source order
+}
+
+type HashLiteralPair struct {
+	Key   Expression
+	Value Expression
+}
+
+func (hl *HashLiteral) expressionNode() {}
+func (hl *HashLiteral) TokenLiteral() string {
+	return hl.Token.Literal
+}
+func (hl *HashLiteral) Pos() token.Position {
+	return hl.Token.Pos
+}
+func (hl *HashLiteral) String() string {
+	pairs := []string{}
+	for _, pair := range hl.Pairs {
+		pairs = append(pairs, fmt.Sprintf("%s: %s", pair.Key, pair.Value))
+	}
+	return fmt.Sprintf("{%s}", strings.Join(pairs, ", "))
+}
+
+type MatchExpression struct {
+	Token   *token.Token
+	Subject Expression
+	Arms    []*MatchArm
+}
+
+// MatchArm is one `pattern if guard => body` of a match expression. Guard is nil if absent.
+type MatchArm struct {
+	Pattern Pattern
+	Guard   Expression
+	Body    Expression
+	Locals  []string `json:"-"` // names of the slots of the arm scope, set by the resolver
+}
+
+func (me *MatchExpression) expressionNode() {}
+func (me *MatchExpression) TokenLiteral() string {
+	return me.Token.Literal
+}
+func (me *MatchExpression) Pos() token.Position {
+	return me.Token.Pos
+}
+func (me *MatchExpression) String() string {
+	arms := []string{}
+	for _, arm := range me.Arms {
+		if arm.Guard != nil {
+			arms = append(arms, fmt.Sprintf("%s if %s => %s", arm.Pattern, arm.Guard, arm.Body))
+		} else {
+			arms = append(arms, fmt.Sprintf("%s => %s", arm.Pattern, arm.Body))
+		}
+	}
+	return fmt.Sprintf("%s (%s) {%s}", me.TokenLiteral(), me.Subject, strings.Join(arms, ", "))
+}
+
+// SpreadExpression is `...value` in a call or array literal, standing for all elements of the array value.
+type SpreadExpression struct {
+	Token *token.Token
+	Value Expression
+}
+
+func (se *SpreadExpression) expressionNode() {}
+func (se *SpreadExpression) TokenLiteral() string {
+	return se.Token.Literal
+}
+func (se *SpreadExpression) Pos() token.Position {
+	return se.Token.Pos
+}
+func (se *SpreadExpression) String() string {
+	return fmt.Sprintf("...%s", se.Value)
+}
+
+// NamedArgument is `name: value` in a call.
+type NamedArgument struct {
+	Token *token.Token
+	Name  *Identifier
+	Value Expression
+}
+
+func (na *NamedArgument) expressionNode() {}
+func (na *NamedArgument) TokenLiteral() string {
+	return na.Token.Literal
+}
+func (na *NamedArgument) Pos() token.Position {
+	return na.Token.Pos
+}
+func (na *NamedArgument) String() string {
+	return fmt.Sprintf("%s: %s", na.Name, na.Value)
+}
+
+// StructStatement is `struct Name { field, ... }`, which binds Name to a new struct type.
+type StructStatement struct {
+	Token  *token.Token
+	Name   *Identifier
+	Fields []string
+}
+
+func (s *StructStatement) statementNode() {}
+func (s *StructStatement) TokenLiteral() string {
+	return s.Token.Literal
+}
+func (s *StructStatement) Pos() token.Position {
+	return s.Token.Pos
+}
+func (s *StructStatement) String() string {
+	return fmt.Sprintf("%s %s {%s}", s.TokenLiteral(), s.Name, strings.Join(s.Fields, ", "))
+}
+
+// StructLiteral is `Type{field: value, ...}`, making a struct of the type Type evaluates to.
+type StructLiteral struct {
+	Token  *token.Token // the {
+	Type   Expression
+	Fields []*StructLiteralField // in source order
+}
+
+type StructLiteralField struct {
+	Token *token.Token // the name of the field
+	Name  string
+	Value Expression
+}
+
+func (sl *StructLiteral) expressionNode() {}
+func (sl *StructLiteral) TokenLiteral() string {
+	return sl.Token.Literal
+}
+func (sl *StructLiteral) Pos() token.Position {
+	return sl.Token.Pos
+}
+func (sl *StructLiteral) String() string {
+	fields := []string{}
+	for _, f := range sl.Fields {
+		fields = append(fields, fmt.Sprintf("%s: %s", f.Name, f.Value))
+	}
+	return fmt.Sprintf("%s{%s}", sl.Type, strings.Join(fields, ", "))
+}
+
+// FieldExpression is `left.field`.
+type FieldExpression struct {
+	Token   *token.Token // the .
+	Left    Expression
+	Field   string
+	Grouped bool // written in parentheses, which end its chain, see ChainLeft
+}
+
+func (fe *FieldExpression) expressionNode() {}
+func (fe *FieldExpression) TokenLiteral() string {
+	return fe.Token.Literal
+}
+func (fe *FieldExpression) Pos() token.Position {
+	return fe.Token.Pos
+}
+func (fe *FieldExpression) String() string {
+	if fe.IsOptional() {
+		return fmt.Sprintf("(%s?.%s)", fe.Left, fe.Field)
+	}
+	return fmt.Sprintf("(%s.%s)", fe.Left, fe.Field)
+}
+
+// IsOptional tells whether the field is written ?., which gives null when Left is null, see IsOptionalChain.
+func (fe *FieldExpression) IsOptional() bool {
+	return fe.Token.Type == token.OPTIONAL_DOT
+}
+
+// AssignStatement is `target = value`, which changes a field of a struct in place.
+type AssignStatement struct {
+	Token  *token.Token // the =
+	Target *FieldExpression
+	Value  Expression
+}
+
+func (s *AssignStatement) statementNode() {}
+func (s *AssignStatement) TokenLiteral() string {
+	return s.Token.Literal
+}
+func (s *AssignStatement) Pos() token.Position {
+	return s.Token.Pos
+}
+func (s *AssignStatement) String() string {
+	return fmt.Sprintf("%s = %s", s.Target, s.Value)
+}
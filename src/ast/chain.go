@@ -0,0 +1,54 @@
+package ast
+
+// A chain is a sequence of fields, indexes and calls applied one after the other, such as a.b[0](1).c.
+// When one of its fields or indexes is optional, written ?. or ?[, and what it applies to is null,
+// the rest of the chain is skipped and the whole chain is null: a?.b.c(1) is null when a is.
+// Parentheses end the chain in them: (a?.b).c is null.c when a is null, which fails.
+
+// ChainLeft returns what the field, index or call e applies to in the same chain,
+// or nil if e is none of them or applies to a chain in parentheses.
+func ChainLeft(e Expression) Expression {
+	var left Expression
+	switch e := e.(type) {
+	case *FieldExpression:
+		left = e.Left
+	case *IndexExpression:
+		left = e.Left
+	case *CallExpression:
+		left = e.Function
+	}
+	if IsGrouped(left) {
+		return nil
+	}
+	return left
+}
+
+// IsGrouped tells whether e is a field, index or call written in parentheses.
+func IsGrouped(e Expression) bool {
+	switch e := e.(type) {
+	case *FieldExpression:
+		return e.Grouped
+	case *IndexExpression:
+		return e.Grouped
+	case *CallExpression:
+		return e.Grouped
+	}
+	return false
+}
+
+// IsOptionalChain tells whether e is a field, index or call ending a chain with an optional field or index.
+func IsOptionalChain(e Expression) bool {
+	for ; e != nil; e = ChainLeft(e) {
+		switch e := e.(type) {
+		case *FieldExpression:
+			if e.IsOptional() {
+				return true
+			}
+		case *IndexExpression:
+			if e.IsOptional() {
+				return true
+			}
+		}
+	}
+	return false
+}
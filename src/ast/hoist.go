@@ -0,0 +1,50 @@
+package ast
+
+// FunctionClash returns the first fn statement of stmts whose name is also declared
+// by another statement of stmts, a let, const, struct or fn, or nil if there is none.
+// Since fn statements are bound before the others run, one of the two would silently
+// replace the other, so such a block is an error.
+func FunctionClash(stmts []Statement) *FunctionStatement {
+	counts := map[string]int{}
+	for _, s := range stmts {
+		for _, name := range declaredNames(s) {
+			counts[name]++
+		}
+	}
+	for _, s := range stmts {
+		if fs, ok := s.(*FunctionStatement); ok && counts[fs.Name.Name] > 1 {
+			return fs
+		}
+	}
+	return nil
+}
+
+// declaredNames returns the names s binds in the scope it is in.
+func declaredNames(s Statement) []string {
+	switch s := s.(type) {
+	case *LetStatement:
+		if s.Ident != nil {
+			return []string{s.Ident.Name}
+		}
+		var names []string
+		Inspect(s.Pattern, func(node Node) bool {
+			switch node := node.(type) {
+			case *BindingPattern:
+				names = append(names, node.Ident.Name)
+			case *ArrayPattern:
+				if node.Rest != nil {
+					names = append(names, node.Rest.Name)
+				}
+			}
+			// the defaults are expressions, binding nothing here
+			_, ok := node.(Pattern)
+			return ok
+		})
+		return names
+	case *StructStatement:
+		return []string{s.Name.Name}
+	case *FunctionStatement:
+		return []string{s.Name.Name}
+	}
+	return nil
+}
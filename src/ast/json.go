@@ -0,0 +1,313 @@
+package ast
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"token"
+	"unicode"
+)
+
+// The JSON form of a node is an object with its type in "node", followed by its fields
+// named in lower camel case, such as {"node": "InfixExpression", "token": {...}, "left": ...}.
+// Tokens keep their type, literal and position. Fields computed from the rest of the tree,
+// such as the slots set by the resolver, are left out and computed again when loading.
+
+// nodeTypes are the nodes that can appear in the JSON form, by name.
+var nodeTypes = map[string]reflect.Type{}
+
+func init() {
+	for _, n := range []Node{
+		&Program{}, &Identifier{}, &IntegerLiteral{}, &BooleanLiteral{}, &NullLiteral{}, &StringLiteral{}, &TemplateLiteral{},
+		&PrefixExpression{}, &InfixExpression{}, &IfExpression{}, &FunctionExpression{},
+		&CallExpression{}, &BlockStatement{}, &LetStatement{}, &ReturnStatement{},
+		&ExpressionStatement{}, &ArrayLiteral{}, &IndexExpression{}, &TryExpression{},
+		&ThrowStatement{}, &HashLiteral{}, &MatchExpression{}, &SpreadExpression{}, &NamedArgument{},
+		&StructStatement{}, &FunctionStatement{}, &StructLiteral{}, &FieldExpression{}, &AssignStatement{},
+		&WildcardPattern{}, &BindingPattern{}, &LiteralPattern{}, &ArrayPattern{}, &HashPattern{}, &DefaultPattern{},
+		&NamedType{}, &ArrayType{}, &HashType{}, &FunctionType{},
+	} {
+		t := reflect.TypeOf(n)
+		nodeTypes[t.Elem().Name()] = t
+	}
+}
+
+// fields that may be missing, by type and field name; for slices, their elements may be missing
+var optionalFields = map[string]bool{
+	"IfExpression.Alternative":      true,
+	"FunctionExpression.Defaults":   true,
+	"FunctionExpression.Rest":       true,
+	"FunctionExpression.ParamTypes": true,
+	"FunctionExpression.RestType":   true,
+	"FunctionExpression.ReturnType": true,
+	"LetStatement.Ident":            true,
+	"LetStatement.Pattern":          true,
+	"LetStatement.Type":             true,
+	"TryExpression.CatchParam":      true,
+	"TryExpression.Catch":           true,
+	"TryExpression.Finally":         true,
+	"MatchArm.Guard":                true,
+	"ArrayPattern.Rest":             true,
+}
+
+var (
+	nodeInterface  = reflect.TypeOf((*Node)(nil)).Elem()
+	tokenPointer   = reflect.TypeOf(&token.Token{})
+	stringSlice    = reflect.TypeOf([]string{})
+	emptyJSONArray = json.RawMessage("[]")
+)
+
+// ToJSON returns the JSON form of node.
+func ToJSON(node Node) ([]byte, error) {
+	return json.Marshal(toJSON(reflect.ValueOf(node)))
+}
+
+// FromJSON makes the node described by data, in the form given by ToJSON.
+// Tail calls are marked again, so the result can be evaluated as if it had been parsed.
+func FromJSON(data []byte) (Node, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	res, err := fromJSON(v, nodeInterface, "")
+	if err != nil {
+		return nil, err
+	}
+	if !res.IsValid() || res.IsNil() {
+		return nil, fmt.Errorf("missing node")
+	}
+
+	node := res.Interface().(Node)
+	Inspect(node, func(n Node) bool {
+		if fn, ok := n.(*FunctionExpression); ok {
+			MarkTailCalls(fn)
+		}
+		return true
+	})
+	return node, nil
+}
+
+// jsonObject is a JSON object whose keys keep their order.
+type jsonObject []jsonField
+
+type jsonField struct {
+	key   string
+	value interface{}
+}
+
+func (o jsonObject) MarshalJSON() ([]byte, error) {
+	buf := bytes.Buffer{}
+	buf.WriteByte('{')
+	for i, f := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(f.key)
+		buf.Write(key)
+		buf.WriteByte(':')
+		value, err := json.Marshal(f.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func toJSON(v reflect.Value) interface{} {
+	switch v.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		if v.Type() == tokenPointer || v.Kind() == reflect.Interface {
+			return toJSON(v.Elem())
+		}
+
+		res := jsonObject{}
+		if v.Type().Implements(nodeInterface) {
+			res = append(res, jsonField{"node", v.Elem().Type().Name()})
+		}
+		st := v.Elem().Type()
+		for i := 0; i < st.NumField(); i++ {
+			f := st.Field(i)
+			if f.PkgPath != "" || f.Tag.Get("json") == "-" {
+				continue
+			}
+			res = append(res, jsonField{fieldKey(f.Name), toJSON(v.Elem().Field(i))})
+		}
+		return res
+
+	case reflect.Slice:
+		if v.Len() == 0 {
+			if v.IsNil() {
+				return nil
+			}
+			return emptyJSONArray
+		}
+		res := make([]interface{}, v.Len())
+		for i := range res {
+			res[i] = toJSON(v.Index(i))
+		}
+		return res
+	}
+	return v.Interface()
+}
+
+func fieldKey(name string) string {
+	return string(unicode.ToLower(rune(name[0]))) + name[1:]
+}
+
+func fromJSON(v interface{}, t reflect.Type, path string) (reflect.Value, error) {
+	if v == nil {
+		return reflect.Zero(t), nil
+	}
+
+	switch {
+	case t == tokenPointer:
+		// the token has a plain JSON form
+		data, _ := json.Marshal(v)
+		tok := &token.Token{}
+		if err := json.Unmarshal(data, tok); err != nil {
+			return reflect.Value{}, fmt.Errorf("%s: %s", path, err)
+		}
+		return reflect.ValueOf(tok), nil
+
+	case t.Kind() == reflect.Interface || t.Kind() == reflect.Ptr:
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("%s: expected an object", path)
+		}
+
+		pt := t
+		if name, ok := obj["node"].(string); ok {
+			if pt, ok = nodeTypes[name]; !ok {
+				return reflect.Value{}, fmt.Errorf("%s: unknown node %s", path, name)
+			}
+			if !pt.AssignableTo(t) {
+				return reflect.Value{}, fmt.Errorf("%s: %s cannot be used here", path, name)
+			}
+		} else if t.Kind() == reflect.Interface || t.Implements(nodeInterface) {
+			return reflect.Value{}, fmt.Errorf("%s: missing node type", path)
+		}
+		return structFromJSON(obj, pt, path)
+
+	case t.Kind() == reflect.Slice:
+		arr, ok := v.([]interface{})
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("%s: expected an array", path)
+		}
+		res := reflect.MakeSlice(t, len(arr), len(arr))
+		for i, el := range arr {
+			ev, err := fromJSON(el, t.Elem(), fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			res.Index(i).Set(ev)
+		}
+		return res, nil
+
+	case t.Kind() == reflect.String:
+		if s, ok := v.(string); ok {
+			return reflect.ValueOf(s).Convert(t), nil
+		}
+		return reflect.Value{}, fmt.Errorf("%s: expected a string", path)
+
+	case t.Kind() == reflect.Bool:
+		if b, ok := v.(bool); ok {
+			return reflect.ValueOf(b), nil
+		}
+		return reflect.Value{}, fmt.Errorf("%s: expected a boolean", path)
+
+	case t.Kind() == reflect.Int64 || t.Kind() == reflect.Int:
+		if n, ok := v.(json.Number); ok {
+			if i, err := n.Int64(); err == nil {
+				return reflect.ValueOf(i).Convert(t), nil
+			}
+		}
+		return reflect.Value{}, fmt.Errorf("%s: expected an integer", path)
+	}
+
+	return reflect.Value{}, fmt.Errorf("%s: cannot load %s", path, t)
+}
+
+// structFromJSON makes the struct pointed to by t from the fields of obj.
+func structFromJSON(obj map[string]interface{}, t reflect.Type, path string) (reflect.Value, error) {
+	st := t.Elem()
+	res := reflect.New(st)
+
+	for i := 0; i < st.NumField(); i++ {
+		f := st.Field(i)
+		if f.PkgPath != "" || f.Tag.Get("json") == "-" {
+			continue
+		}
+		key := fieldKey(f.Name)
+		fieldPath := strings.TrimPrefix(path+"."+key, ".")
+
+		v, err := fromJSON(obj[key], f.Type, fieldPath)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+
+		if !optionalFields[st.Name()+"."+f.Name] {
+			if err := checkPresent(v, f.Type, fieldPath); err != nil {
+				return reflect.Value{}, err
+			}
+		}
+		res.Elem().Field(i).Set(v)
+	}
+
+	if tok := res.Elem().FieldByName("Token"); tok.IsValid() && tok.IsNil() {
+		// positions are not required from tools generating code
+		tok.Set(reflect.ValueOf(&token.Token{}))
+	}
+
+	if err := checkNode(res.Interface(), path); err != nil {
+		return reflect.Value{}, err
+	}
+	return res, nil
+}
+
+// checkPresent fails if v is a missing child, or has missing elements.
+func checkPresent(v reflect.Value, t reflect.Type, path string) error {
+	switch {
+	case t == tokenPointer || t == stringSlice:
+		return nil
+	case t.Kind() == reflect.Interface || t.Kind() == reflect.Ptr:
+		if v.IsNil() {
+			return fmt.Errorf("%s: missing", path)
+		}
+	case t.Kind() == reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			if err := checkPresent(v.Index(i), t.Elem(), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkNode fails for the combinations of fields that the parser never makes.
+func checkNode(n interface{}, path string) error {
+	switch n := n.(type) {
+	case *LetStatement:
+		if (n.Ident == nil) == (n.Pattern == nil) {
+			return fmt.Errorf("%s: a let must have either ident or pattern", path)
+		}
+	case *FunctionExpression:
+		if len(n.Defaults) > len(n.Params) || len(n.ParamTypes) > len(n.Params) {
+			return fmt.Errorf("%s: more defaults or parameter types than parameters", path)
+		}
+	case *TryExpression:
+		if (n.CatchParam == nil) != (n.Catch == nil) || (n.Catch == nil && n.Finally == nil) {
+			return fmt.Errorf("%s: a try must have a catch with its parameter, or a finally", path)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package ast_test
+
+import (
+	"ast"
+	"context"
+	"evaluator"
+	"lexer"
+	"object"
+	"parser"
+	"resolver"
+	"strings"
+	"testing"
+)
+
+func TestJSONRoundTrip(t *testing.T) {
+	inputs := []string{
+		"let x = 1 + 2 * -3; x",
+		`let f = fn(a: int, b = 2, ...r: [int]) -> int { if (a < b) { return a } else { f(a - 1) } }; f(10, c: 3)`,
+		`try { throw error("e", {"k": [1, true]}) } catch (e) { e["data"] } finally { 0 }`,
+		`match ([1, 2]) { [a, b = 3, ...r] if a => a, {k, "x": [_, -1]} => k, _ => "s" }`,
+		`let [a, {b}] = [1, {"b": 2}]; g(...[a], b)`,
+		"let h: {string: fn(int) -> bool} = {}",
+		"struct P { x, y }; let p = P{x: 1, y: [2]}; p.y = p.x",
+		`"a ${b} \${c} ${"d${e}"}"`,
+		"let n = null; [n ?? 1, n?.a.b(2), n?[0] == null]",
+		"fn even(n) { if (n == 0) { true } else { odd(n - 1) } }; fn odd(n) -> bool { !even(n) }; odd(3)",
+	}
+
+	for _, in := range inputs {
+		p := parser.New(lexer.New(in))
+		prog := p.Parse()
+		if len(p.Errors()) > 0 {
+			t.Fatalf("parse errors for %q: %v", in, p.Errors())
+		}
+
+		data, err := ast.ToJSON(prog)
+		if err != nil {
+			t.Fatalf("cannot encode %q: %s", in, err)
+		}
+		node, err := ast.FromJSON(data)
+		if err != nil {
+			t.Fatalf("cannot decode %q: %s", in, err)
+		}
+
+		if node.String() != prog.String() {
+			t.Errorf("wrong program for %q. expected: %s, got: %s", in, prog, node)
+		}
+		again, _ := ast.ToJSON(node)
+		if string(again) != string(data) {
+			t.Errorf("wrong JSON for %q. expected: %s, got: %s", in, data, again)
+		}
+	}
+}
+
+func TestJSONLoadedProgramsRun(t *testing.T) {
+	in := "let loop = fn(n) { if (n == 0) { \"done\" } else { loop(n - 1) } }; loop(100000)"
+	data, _ := ast.ToJSON(parser.New(lexer.New(in)).Parse())
+	node, err := ast.FromJSON(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the tail call has to be marked again, or the loop would exceed the depth
+	c := evaluator.NewContext(context.Background(), evaluator.Limits{MaxDepth: 100})
+	resolver.Resolve(node)
+	res, err := evaluator.EvalContext(c, node, object.NewEnvironment())
+	if err != nil || res.Inspect() != `"done"` {
+		t.Errorf("wrong result: %v, %v", res, err)
+	}
+
+	// tools may leave out the tokens
+	node, err = ast.FromJSON([]byte(`{"node": "Program", "statements": [{"node": "ExpressionStatement",
+		"expression": {"node": "InfixExpression", "operator": "+",
+			"left": {"node": "IntegerLiteral", "intValue": 1}, "right": {"node": "IntegerLiteral", "intValue": 2}}}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res := evaluator.Eval(node, object.NewEnvironment()); res.Inspect() != "3" {
+		t.Errorf("wrong result: %s", res.Inspect())
+	}
+}
+
+func TestJSONErrors(t *testing.T) {
+	tests := []struct {
+		in  string
+		err string
+	}{
+		{`[1]`, "expected an object"},
+		{`{"statements": []}`, "missing node type"},
+		{`{"node": "Nope"}`, "unknown node Nope"},
+		{`{"node": "Program", "statements": [{"node": "IntegerLiteral", "intValue": 1}]}`, "statements[0]: IntegerLiteral cannot be used here"},
+		{`{"node": "Program", "statements": [{"node": "ExpressionStatement"}]}`, "statements[0].expression: missing"},
+		{`{"node": "IntegerLiteral", "intValue": "1"}`, "intValue: expected an integer"},
+		{`{"node": "LetStatement", "value": {"node": "IntegerLiteral", "intValue": 1}}`, "a let must have either ident or pattern"},
+		{`{"node": "ArrayLiteral", "elements": [null]}`, "elements[0]: missing"},
+	}
+
+	for _, tt := range tests {
+		_, err := ast.FromJSON([]byte(tt.in))
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("wrong error for %s. expected: %s, got: %v", tt.in, tt.err, err)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package ast
+
+import (
+	"fmt"
+	"strings"
+	"token"
+)
+
+// Pattern describes the shape of a value, and the names its parts are bound to when it matches.
+type Pattern interface {
+	Node
+	patternNode()
+}
+
+// WildcardPattern is `_`, which matches anything without binding it.
+type WildcardPattern struct {
+	Token *token.Token
+}
+
+func (wp *WildcardPattern) patternNode() {}
+func (wp *WildcardPattern) TokenLiteral() string {
+	return wp.Token.Literal
+}
+func (wp *WildcardPattern) Pos() token.Position {
+	return wp.Token.Pos
+}
+func (wp *WildcardPattern) String() string {
+	return "_"
+}
+
+// BindingPattern matches anything and binds it to a name.
+type BindingPattern struct {
+	Token *token.Token
+	Ident *Identifier
+}
+
+func (bp *BindingPattern) patternNode() {}
+func (bp *BindingPattern) TokenLiteral() string {
+	return bp.Token.Literal
+}
+func (bp *BindingPattern) Pos() token.Position {
+	return bp.Token.Pos
+}
+func (bp *BindingPattern) String() string {
+	return bp.Ident.Name
+}
+
+// LiteralPattern matches values equal to an integer, string or boolean literal.
+type LiteralPattern struct {
+	Token *token.Token
+	Value Expression
+}
+
+func (lp *LiteralPattern) patternNode() {}
+func (lp *LiteralPattern) TokenLiteral() string {
+	return lp.Token.Literal
+}
+func (lp *LiteralPattern) Pos() token.Position {
+	return lp.Token.Pos
+}
+func (lp *LiteralPattern) String() string {
+	return lp.Value.String()
+}
+
+// ArrayPattern matches arrays element by element. Rest, if not nil, collects the remaining elements.
+type ArrayPattern struct {
+	Token    *token.Token
+	Elements []Pattern
+	Rest     *Identifier
+}
+
+func (ap *ArrayPattern) patternNode() {}
+func (ap *ArrayPattern) TokenLiteral() string {
+	return ap.Token.Literal
+}
+func (ap *ArrayPattern) Pos() token.Position {
+	return ap.Token.Pos
+}
+func (ap *ArrayPattern) String() string {
+	elements := []string{}
+	for _, el := range ap.Elements {
+		elements = append(elements, el.String())
+	}
+	if ap.Rest != nil {
+		elements = append(elements, "..."+ap.Rest.Name)
+	}
+	return fmt.Sprintf("[%s]", strings.Join(elements, ", "))
+}
+
+// HashPattern matches hashes having at least the given keys.
+type HashPattern struct {
+	Token *token.Token
+	Pairs []*HashPatternPair
+}
+
+type HashPatternPair struct {
+	Key   Expression // literal
+	Value Pattern
+}
+
+func (hp *HashPattern) patternNode() {}
+func (hp *HashPattern) TokenLiteral() string {
+	return hp.Token.Literal
+}
+func (hp *HashPattern) Pos() token.Position {
+	return hp.Token.Pos
+}
+func (hp *HashPattern) String() string {
+	pairs := []string{}
+	for _, pair := range hp.Pairs {
+		pairs = append(pairs, fmt.Sprintf("%s: %s", pair.Key, pair.Value))
+	}
+	return fmt.Sprintf("{%s}", strings.Join(pairs, ", "))
+}
+
+// DefaultPattern is an element of an array or hash pattern that may be missing,
+// in which case Default is evaluated and matched instead.
+type DefaultPattern struct {
+	Token   *token.Token
+	Pattern Pattern
+	Default Expression
+}
+
+func (dp *DefaultPattern) patternNode() {}
+func (dp *DefaultPattern) TokenLiteral() string {
+	return dp.Token.Literal
+}
+func (dp *DefaultPattern) Pos() token.Position {
+	return dp.Pattern.Pos()
+}
+func (dp *DefaultPattern) String() string {
+	return fmt.Sprintf("%s = %s", dp.Pattern, dp.Default)
+}
@@ -0,0 +1,45 @@
+package ast
+
+// MarkTailCalls sets Tail on the calls in the body of fn whose value is directly returned by fn,
+// so the evaluator can run them without growing the stack. Nested functions are not visited.
+//
+// Tail positions are the value of a return statement and the last expression of the body,
+// recursively through both branches of an if and the arms of a match.
+// Calls in a try are never tail calls, since the try has to see how they end.
+func MarkTailCalls(fn *FunctionExpression) {
+	markTailBlock(fn.Body, true)
+}
+
+func markTailBlock(block *BlockStatement, tail bool) {
+	if block == nil {
+		return
+	}
+
+	for i, s := range block.Statements {
+		switch s := s.(type) {
+		case *ReturnStatement:
+			// returns anywhere in the function are tail positions
+			markTailExpression(s.Value, true)
+		case *ExpressionStatement:
+			markTailExpression(s.Expression, tail && i == len(block.Statements)-1)
+		case *LetStatement:
+			markTailExpression(s.Value, false)
+		case *AssignStatement:
+			markTailExpression(s.Value, false)
+		}
+	}
+}
+
+func markTailExpression(exp Expression, tail bool) {
+	switch exp := exp.(type) {
+	case *CallExpression:
+		exp.Tail = tail
+	case *IfExpression:
+		markTailBlock(exp.Consequence, tail)
+		markTailBlock(exp.Alternative, tail)
+	case *MatchExpression:
+		for _, arm := range exp.Arms {
+			markTailExpression(arm.Body, tail)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package ast
+
+import (
+	"fmt"
+	"strings"
+	"token"
+)
+
+// TypeExpr is a type annotation. Annotations are only used by the type checker,
+// the evaluator ignores them.
+type TypeExpr interface {
+	Node
+	typeNode()
+}
+
+// NamedType is a basic type such as `int`, `bool`, `string`, `error` or `any`.
+type NamedType struct {
+	Token *token.Token
+	Name  string
+}
+
+func (nt *NamedType) typeNode() {}
+func (nt *NamedType) TokenLiteral() string {
+	return nt.Token.Literal
+}
+func (nt *NamedType) Pos() token.Position {
+	return nt.Token.Pos
+}
+func (nt *NamedType) String() string {
+	return nt.Name
+}
+
+// ArrayType is `[T]`, an array whose elements are all of type T.
+type ArrayType struct {
+	Token   *token.Token
+	Element TypeExpr
+}
+
+func (at *ArrayType) typeNode() {}
+func (at *ArrayType) TokenLiteral() string {
+	return at.Token.Literal
+}
+func (at *ArrayType) Pos() token.Position {
+	return at.Token.Pos
+}
+func (at *ArrayType) String() string {
+	return fmt.Sprintf("[%s]", at.Element)
+}
+
+// HashType is `{K: V}`, a hash with keys of type K and values of type V.
+type HashType struct {
+	Token *token.Token
+	Key   TypeExpr
+	Value TypeExpr
+}
+
+func (ht *HashType) typeNode() {}
+func (ht *HashType) TokenLiteral() string {
+	return ht.Token.Literal
+}
+func (ht *HashType) Pos() token.Position {
+	return ht.Token.Pos
+}
+func (ht *HashType) String() string {
+	return fmt.Sprintf("{%s: %s}", ht.Key, ht.Value)
+}
+
+// FunctionType is `fn(A, B) -> R`.
+type FunctionType struct {
+	Token  *token.Token
+	Params []TypeExpr
+	Result TypeExpr
+}
+
+func (ft *FunctionType) typeNode() {}
+func (ft *FunctionType) TokenLiteral() string {
+	return ft.Token.Literal
+}
+func (ft *FunctionType) Pos() token.Position {
+	return ft.Token.Pos
+}
+func (ft *FunctionType) String() string {
+	params := []string{}
+	for _, p := range ft.Params {
+		params = append(params, p.String())
+	}
+	return fmt.Sprintf("fn(%s) -> %s", strings.Join(params, ", "), ft.Result)
+}
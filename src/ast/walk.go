@@ -0,0 +1,145 @@
+package ast
+
+import "reflect"
+
+// Inspect traverses node depth-first, calling f for node and then for each of its children.
+// Children are skipped if f returns false. Missing (nil) children are not visited.
+func Inspect(node Node, f func(Node) bool) {
+	if isNil(node) || !f(node) {
+		return
+	}
+
+	switch node := node.(type) {
+	case *Program:
+		for _, s := range node.Statements {
+			Inspect(s, f)
+		}
+	case *BlockStatement:
+		for _, s := range node.Statements {
+			Inspect(s, f)
+		}
+	case *ExpressionStatement:
+		Inspect(node.Expression, f)
+	case *LetStatement:
+		Inspect(node.Ident, f)
+		Inspect(node.Pattern, f)
+		Inspect(node.Type, f)
+		Inspect(node.Value, f)
+	case *ReturnStatement:
+		Inspect(node.Value, f)
+	case *ThrowStatement:
+		Inspect(node.Value, f)
+	case *StructStatement:
+		Inspect(node.Name, f)
+	case *FunctionStatement:
+		Inspect(node.Name, f)
+		Inspect(node.Function, f)
+	case *AssignStatement:
+		Inspect(node.Target, f)
+		Inspect(node.Value, f)
+	case *PrefixExpression:
+		Inspect(node.Expression, f)
+	case *InfixExpression:
+		Inspect(node.Left, f)
+		Inspect(node.Right, f)
+	case *IfExpression:
+		Inspect(node.Condition, f)
+		Inspect(node.Consequence, f)
+		Inspect(node.Alternative, f)
+	case *FunctionExpression:
+		for _, p := range node.Params {
+			Inspect(p, f)
+		}
+		for _, d := range node.Defaults {
+			Inspect(d, f)
+		}
+		for _, t := range node.ParamTypes {
+			Inspect(t, f)
+		}
+		Inspect(node.Rest, f)
+		Inspect(node.RestType, f)
+		Inspect(node.ReturnType, f)
+		Inspect(node.Body, f)
+	case *CallExpression:
+		Inspect(node.Function, f)
+		for _, arg := range node.Arguments {
+			Inspect(arg, f)
+		}
+	case *TemplateLiteral:
+		for _, e := range node.Expressions {
+			Inspect(e, f)
+		}
+	case *ArrayLiteral:
+		for _, el := range node.Elements {
+			Inspect(el, f)
+		}
+	case *HashLiteral:
+		for _, pair := range node.Pairs {
+			Inspect(pair.Key, f)
+			Inspect(pair.Value, f)
+		}
+	case *IndexExpression:
+		Inspect(node.Left, f)
+		Inspect(node.Index, f)
+	case *StructLiteral:
+		Inspect(node.Type, f)
+		for _, field := range node.Fields {
+			Inspect(field.Value, f)
+		}
+	case *FieldExpression:
+		Inspect(node.Left, f)
+	case *TryExpression:
+		Inspect(node.Body, f)
+		Inspect(node.CatchParam, f)
+		Inspect(node.Catch, f)
+		Inspect(node.Finally, f)
+	case *MatchExpression:
+		Inspect(node.Subject, f)
+		for _, arm := range node.Arms {
+			Inspect(arm.Pattern, f)
+			Inspect(arm.Guard, f)
+			Inspect(arm.Body, f)
+		}
+	case *SpreadExpression:
+		Inspect(node.Value, f)
+	case *NamedArgument:
+		Inspect(node.Name, f)
+		Inspect(node.Value, f)
+	case *BindingPattern:
+		Inspect(node.Ident, f)
+	case *LiteralPattern:
+		Inspect(node.Value, f)
+	case *ArrayPattern:
+		for _, el := range node.Elements {
+			Inspect(el, f)
+		}
+		Inspect(node.Rest, f)
+	case *HashPattern:
+		for _, pair := range node.Pairs {
+			Inspect(pair.Key, f)
+			Inspect(pair.Value, f)
+		}
+	case *DefaultPattern:
+		Inspect(node.Pattern, f)
+		Inspect(node.Default, f)
+	case *ArrayType:
+		Inspect(node.Element, f)
+	case *HashType:
+		Inspect(node.Key, f)
+		Inspect(node.Value, f)
+	case *FunctionType:
+		for _, p := range node.Params {
+			Inspect(p, f)
+		}
+		Inspect(node.Result, f)
+	}
+}
+
+// isNil reports whether node is nil, including nil pointers of the node types.
+func isNil(node Node) bool {
+	if node == nil {
+		return true
+	}
+	v := reflect.ValueOf(node)
+	return v.Kind() == reflect.Ptr && v.IsNil()
+}
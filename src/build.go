@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"gocode"
+	"io/ioutil"
+	"jscode"
+	"lexer"
+	"optimize"
+	"os"
+	"parser"
+	"strings"
+)
+
+// build translates a program into a Go program, see package gocode. It is written
+// to the file given with -o, or to the standard output. When that file ends with .js,
+// the program is translated into JavaScript instead, see package jscode, and its
+// source map is written next to it.
+func build(args []string) int {
+	out := ""
+	if len(args) >= 2 && args[0] == "-o" {
+		out, args = args[1], args[2:]
+	}
+	if len(args) > 1 {
+		fmt.Fprintln(os.Stderr, "usage: monkey build [-o OUT.go|OUT.js] [FILE]")
+		return 2
+	}
+	src, ok := readSource("build", args)
+	if !ok {
+		return 2
+	}
+
+	file := "-"
+	if len(args) == 1 {
+		file = args[0]
+	}
+
+	p := parser.New(lexer.New(src))
+	prog := p.Parse()
+	if errors := p.Errors(); len(errors) > 0 {
+		printSyntaxErrors(os.Stderr, file, errors)
+		return 1
+	}
+
+	optimize.Program(prog)
+	if strings.HasSuffix(out, ".js") {
+		code, sourceMap := jscode.Generate(prog, file, out)
+		if err := ioutil.WriteFile(out, code, 0644); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if err := ioutil.WriteFile(out+".map", sourceMap, 0644); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		return 0
+	}
+
+	code, err := gocode.Generate(prog)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if out == "" {
+		os.Stdout.Write(code)
+		return 0
+	}
+	if err := ioutil.WriteFile(out, code, 0644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
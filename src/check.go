@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"lexer"
+	"os"
+	"parser"
+	"typecheck"
+)
+
+// check type checks the given files, printing the problems found,
+// and returns the exit status.
+func check(files []string) int {
+	if len(files) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: monkey check FILE...")
+		return 2
+	}
+
+	status := 0
+	for _, file := range files {
+		src, err := ioutil.ReadFile(file)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = 1
+			continue
+		}
+
+		p := parser.New(lexer.New(string(src)))
+		prog := p.Parse()
+		if errors := p.Errors(); len(errors) > 0 {
+			printSyntaxErrors(os.Stdout, file, errors)
+			status = 1
+			continue
+		}
+
+		_, errors := typecheck.Check(prog)
+		for _, err := range errors {
+			fmt.Printf("%s:%s\n", file, err)
+		}
+		if len(errors) > 0 {
+			status = 1
+		}
+	}
+	return status
+}
+
+// printSyntaxErrors prints the errors found by the parser in file, each with its hints.
+func printSyntaxErrors(w io.Writer, file string, errors []*parser.Error) {
+	for _, err := range errors {
+		fmt.Fprintf(w, "%s:%s\n", file, err)
+		for _, hint := range err.Hints {
+			fmt.Fprintf(w, "\thint: %s\n", hint)
+		}
+	}
+}
@@ -0,0 +1,355 @@
+// Package difftest holds the programs which the tests of the backends, packages gocode and jscode,
+// run both with the evaluator and as the code they generate, to check that they give the same results.
+package difftest
+
+// Programs returns the programs, each of which is run on its own.
+func Programs() []string {
+	res := append([]string{}, programs...)
+	for _, call := range describeCalls {
+		res = append(res, describe+call)
+	}
+	return res
+}
+
+// programs are the ones of the evaluator tests.
+var programs = []string{
+	"7",
+	"777",
+	"true",
+	"false",
+	"!true",
+	"!false",
+	"!!true",
+	"!!false",
+	"!7",
+	"!!7",
+	"-5",
+	"--7",
+	"5",
+	"10",
+	"-5",
+	"-10",
+	"5 + 5 + 5 + 5 - 10",
+	"2 * 2 * 2 * 2 * 2",
+	"-50 + 100 + -50",
+	"5 * 2 + 10",
+	"5 + 2 * 10",
+	"20 + 2 * -10",
+	"50 / 2 * 2 + 10",
+	"2 * (5 + 10)",
+	"3 * 3 * 3 + 10",
+	"3 * (3 * 3) + 10",
+	"(5 + 10 * 2 + 15 / 3) * 2 + -10",
+	"true",
+	"false",
+	"1 < 2",
+	"1 > 2",
+	"1 < 1",
+	"1 > 1",
+	"1 == 1",
+	"1 != 1",
+	"1 == 2",
+	"1 != 2",
+	"if (true) { 10 }",
+	"if (false) { 10 }",
+	"if (1) { 10 }",
+	"if (1 < 2) { 10 }",
+	"if (1 > 2) { 10 }",
+	"if (1 > 2) { 10 } else { true }",
+	"if (1 < 2) { 10 } else { 20 }",
+	"return 10;",
+	"return 10; 9;",
+	"return 2 * 5; 9;",
+	"9; return 2 * 5; 9;",
+	"if (true) { if (true) { return 10; } return 1; }",
+	"if (true) { if (false) { return 10; } return 1; }",
+	"if (false) { if (true) { return 10; } return 1; } 25",
+	"return false + 3;",
+	"false - 3;",
+	"3 * false;",
+	"false / true;",
+	"false < true",
+	"3 > true",
+	"if (true) { if (true) { return 3 > true } }",
+	"(1 != false) * 2",
+	"1 * (3 == true)",
+	"foo",
+	"let a = 5; a;",
+	"let a = 5 * 5; a;",
+	"let a = 5; let b = a; b;",
+	"let a = 5; let b = a; let c = a + b + 5; c;",
+	"let identity = fn(x) { x; }; identity(5);",
+	"let identity = fn(x) { return x; }; identity(5);",
+	"let double = fn(x) { x * 2; }; double(5);",
+	"let add = fn(x, y) { x + y; }; add(5, 5);",
+	"let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));",
+	"fn(x) { x; }(5)",
+	"let f = fn(x,y) { if (x>y) { return x } else {y}} let a = f(8,10) + f(11, 22)",
+	"\"foo\" + \"bar\"",
+	"\"foo\" == \"foo\"",
+	"\"foo\" != \"foo\"",
+	"[1, 2 * 2, \"x\"]",
+	"[1, 2, 3][1]",
+	"[1, 2, 3][3]",
+	"let a = [[1], [2, 3]]; a[1][0]",
+	"fn() {}()",
+	"try { throw \"oops\"; 1 } catch (e) { e[\"message\"] }",
+	"try { 1 } catch (e) { 2 }",
+	"try { foo } catch (e) { e[\"message\"] }",
+	"try { 1 + true } catch (e) { e[\"message\"] }",
+	"try { 1 / 0 } catch (e) { e[\"message\"] }",
+	"try { throw error(\"bad\", [1, 2]) } catch (e) { e[\"data\"][1] }",
+	"try { throw 42 } catch (e) { e[\"data\"] }",
+	"let e = error(\"later\"); e",
+	"try { throw error(\"x\") } catch (e) { e }",
+	"try { foo } catch (e) { e[\"position\"] }",
+	"let f = fn() {\n  throw \"x\"\n}\ntry { f() } catch (e) { e[\"stack\"] }",
+	"try { 7 } finally { 8 }",
+	"try { throw 1 } catch (e) { 2 } finally { 3 }",
+	"let f = fn() { try { return 1 } finally { 2 } }; f()",
+	"let f = fn() { try { throw 1 } finally { return 2 } }; f()",
+	"try { try { throw \"inner\" } finally { 1 } } catch (e) { e[\"message\"] }",
+	"try { try { throw \"a\" } catch (e) { throw e[\"message\"] + \"b\" } } catch (e) { e[\"message\"] }",
+	"throw \"oops\"",
+	"throw error(\"bad\")",
+	"try { throw 1 } catch (e) { throw e }",
+	"try { 1 } finally { foo }",
+	"error(1)",
+	"{\"a\": 1, \"b\": 2 * 2, 3: true, false: \"f\"}",
+	"{\"a\": 1, \"a\": 2}",
+	"let k = \"b\"; {\"a\": 1, \"b\": 2}[k]",
+	"{\"a\": 1}[\"c\"]",
+	"{1: \"one\"}[1]",
+	"{[1]: 2}",
+	"{}[fn(){}]",
+	"json_encode({\"a\": [1, true, {}[\"none\"], \"x\"], \"b\": {}})",
+	"json_encode({1: \"<one>\", true: -2})",
+	"json_encode([1, [2]], 2)",
+	"json_encode(fn(x) { x })",
+	"json_encode([1, error(\"e\")])",
+	"json_encode(1, -1)",
+	"json_decode(\"{\\\"b\\\": 1, \\\"a\\\": [true, null, \\\"s\\\"]}\")",
+	"json_decode(\"{\\\"a\\\": 1, \\\"a\\\": 2}\")[\"a\"]",
+	"json_decode(\" 12 \")",
+	"json_decode(\"[1.0, 2e3, -0.0]\")",
+	"json_decode(\"1.5\")",
+	"json_decode(\"-1.5\", \"truncate\")",
+	"json_decode(\"[1.5, 7]\", \"string\")",
+	"json_decode(\"1e30\", \"truncate\")",
+	"json_decode(\"1\", \"round\")",
+	"json_decode(\"[1, 2\")",
+	"json_decode(\"{} {}\")",
+	"json_decode(\"{'a': 1}\")",
+	"let v = {\"list\": [1, 2], \"name\": \"monkey\", \"ok\": false}; json_encode(json_decode(json_encode(v))) == json_encode(v)",
+	"let a = 1; match ([2, 3]) { [a, 4] => a, [b, c] => a }",
+	"let a = 1; match (5) { a => a }; a",
+	"let f = match (2) { n => fn(x) { x * n } }; f(21)",
+	"match (1) { 2 => \"two\" }",
+	"match ([1, 2]) { [a] => a, {a} => a }",
+	"try { match (\"x\") { 1 => 1 } } catch (e) { e[\"message\"] }",
+	"match (1) { x if y => 1 }",
+	"let [a, b] = [1, 2]; a + b",
+	"let [a, b, ...rest] = [1, 2, 3, 4]; rest",
+	"let [a, b, ...rest] = [1, 2]; rest",
+	"let [a, b = a * 10] = [1]; b",
+	"let [a, b = 10, ...rest] = [1]; [a, b, rest]",
+	"let [a, [b, c]] = [1, [2, 3]]; a + b + c",
+	"let [_, x] = [1, 2]; x",
+	"let {name, age} = {\"age\": 30, \"name\": \"ann\"}; name",
+	"let {name, age = 18} = {\"name\": \"bob\"}; age",
+	"let {\"address\": {city}} = {\"address\": {\"city\": \"Jakarta\"}}; city",
+	"let minmax = fn(a, b) { if (a < b) { return a, b } return b, a }; let [lo, hi] = minmax(5, 3); hi - lo",
+	"let f = fn() { return 1, 2 }; f()",
+	"let [a, b] = [1, 2, 3]",
+	"let [a, b] = [1]",
+	"let [a, b = 1] = [1, 2, 3]",
+	"let [a, b, ...c] = [1]",
+	"let [a] = 5",
+	"let [a, [b]] = [1, 2]",
+	"let {name} = {\"age\": 1}",
+	"let {a: [x]} = {\"a\": []}",
+	"let [a = foo] = []",
+	"let f = fn(a, b = 10) { a + b }; f(1)",
+	"let f = fn(a, b = 10) { a + b }; f(1, 2)",
+	"let f = fn(a, b = a * 2) { b }; f(4)",
+	"let n = 1; let f = fn(a = n) { a }; let n = 5; f()",
+	"let f = fn(a, ...rest) { rest }; f(1, 2, 3)",
+	"let f = fn(a, ...rest) { rest }; f(1)",
+	"let f = fn(a, b, c) { [a, b, c] }; let args = [1, 2]; f(...args, 3)",
+	"let f = fn(a, b, c) { [a, b, c] }; f(0, ...[1, 2])",
+	"let f = fn(a, b = 2, c = 3) { [a, b, c] }; f(1, c: 30)",
+	"let f = fn(a, b) { a - b }; f(b: 1, a: 10)",
+	"let f = fn(...xs) { xs }; f(...[1], ...[2, 3])",
+	"[0, ...[1, 2], 3]",
+	"let f = fn(a, b = 2) {}; f",
+	"let f = fn(a: int, b: int = 2, ...r: [int]) -> int { a + b }; let x: int = f(1); x",
+	"let f = fn(a, b) { a }; f(1, 2, 3)",
+	"let f = fn(a, b = 1, ...c) { a }; f()",
+	"let f = fn(a, b) { a }; f(1)",
+	"let f = fn(a) { a }; f(b: 1)",
+	"let f = fn(a) { a }; f(1, a: 1)",
+	"let f = fn(a) { a }; f(...1)",
+	"let f = fn(a = foo) { a }; f()",
+	"error(message: \"x\")",
+	"let loop = fn(n) { if (n == 0) { 0 } else { loop(n - 1) } }; loop(100000)",
+	"let sum = fn(n, acc) { if (n == 0) { return acc } return sum(n - 1, acc + n) }; sum(100000, 0)",
+	"let count = fn(n, acc = 0) { match (n) { 0 => acc, _ => count(n - 1, acc: acc + 1) } }; count(100000)",
+	"let isEven = fn(n) { if (n == 0) { true } else { isOdd(n - 1) } };\n\t\t  let isOdd = fn(n) { if (n == 0) { false } else { isEven(n - 1) } };\n\t\t  isEven(100001)",
+	"let f = fn(n) { try { if (n == 0) { throw \"done\" } else { f(n - 1) } } catch (e) { n } }; f(10)",
+	"let id = fn(x) { x }; let f = fn() { let x = id(1); id(x + 1) }; f()",
+	"fn(x, y) { x y + 5 }",
+	"let g = fn(x) {\n throw x\n}\nlet f = fn(x) { g(x) }\ntry { f(1) } catch (e) { e[\"stack\"] }",
+	"let x = 1; let f = fn() { let y = x; let x = 2; [x, y] }; f()",
+	"let x = 1; let f = fn(c) { if (c) { let x = 2 } x }; [f(true), f(false)]",
+	"let x = 1; let f = fn(c) { let g = fn() { x }; if (c) { let x = 2 } g() }; [f(true), f(false)]",
+	"let make = fn(n) { fn(m) { n + m } }; let addTwo = make(2); addTwo(3)",
+	"let f = fn(x) { match (x) { [a, ...r] => fn() { a + len(r) }, a => fn() { a } } }; let len = fn(xs) { 10 }; [f([1])(), f(7)()]",
+	"let f = fn() { try { throw 1 } catch (e) { let g = fn() { e[\"data\"] }; g() } }; f()",
+	"let f = fn(n) { if (n == 0) { 0 } else { let m = n - 1; f(m) } }; f(10)",
+	"let a = 5; match (1) { a => a }; a",
+	"struct Point { x, y }; let p = Point{y: 2, x: 1}; let q = p; q.x = 5; [p, p.x + p.y, Point]",
+	"struct Box { v }; let b = Box{v: Box{v: 1}}; b.v.v = 2; [b, b == Box{v: Box{v: 2}}, b != b]",
+	"struct A { v }; struct B { v }; [A{v: 1} == B{v: 1}, json_encode(A{v: [1, A{v: true}]})]",
+	"struct A { v }; A{v: 1} == A{v: \"a\"}",
+	"let f = fn(x) { struct P { v }; let p = P{v: x}; p.v = p.v + 1; p }; f(1)",
+	"struct Point { x, y }; let p = Point{x: 1, y: 2};\np.z",
+	"struct Point { x, y }; Point{x: 1, z: 2}",
+	"struct Point { x, y }; Point{x: 1, x: 2}",
+	"struct Point { x, y }; Point{x: 1}",
+	"let h = {}; h{x: 1}",
+	"[1].x",
+	"let s = \"a\"; s.x = 1",
+	"\"héllo\".len()",
+	"\"Hello\".upper() + \"Hello\".lower()",
+	"[\"  a b \".trim().split(\" \"), \"a,b,,c\".split(\",\"), \"héllo\".split(\"\"), \"\".split(\",\")]",
+	"let s = \"monkey\"; [s.contains(\"key\"), s.starts_with(\"mon\"), s.ends_with(\"mon\"), s.repeat(2)]",
+	"\"ab\".repeat(-1)",
+	"\"ab\".split(1)",
+	"\"ab\".upper(1)",
+	"let up = \"ab\".upper; [up, up()]",
+	"[[1, 2, 3].len(), [1, 2, 3].first(), [1, 2, 3].last(), [].first(), [1, 2, 3].rest(), [].rest()]",
+	"let a = [1]; let b = a.push(2); [a, b, b.concat([3, 4]).reverse()]",
+	"[1, \"a\", true, [\"b\"]].join(\", \")",
+	"[[1, 2].contains(2), [1, 2].contains(3), [1, \"2\"].contains(\"2\"), [[1]].contains([1])]",
+	"[1].concat(2)",
+	"let h = {\"a\": 1, \"b\": 2}; [h.len(), h.keys(), h.values(), h.has(\"a\"), h.has(\"c\")]",
+	"let h = {\"a\": 1}; [h.get(\"a\"), h.get(\"b\"), h.get(\"b\", 0), h.set(\"b\", 2), h.set(\"a\", 3), h.delete(\"a\"), h]",
+	"{}.get([1])",
+	"{}.get()",
+	"struct P { v, f }; let p = P{v: 2, f: fn(x) { x * 10 }}; p.f(p.v)",
+	"struct P { f }; let p = P{f: fn() { throw \"x\" }}; try { p.f() } catch (e) { e[\"stack\"] }",
+	"1.len()",
+	"\"a\".size()",
+	"\"a\".upper(case: 1)",
+	"let name = \"Ann\"; let n = 2; \"Hello ${name}, you have ${n + 1} items\"",
+	"\"${1}${true}${[1, \"a\"]}${{\"k\": \"v\"}} ${fn(x) { x }} ${error(\"e\")}\"",
+	"let f = fn(x) { \"<${x}>\" }; \"${f(\"${f(1)}\")}\"",
+	"\"${ {\"k\": \"}\"}[\"k\"] } \\${x} a${\"\"}b\"",
+	"let x = 1; \"a ${x + true} b\"",
+	"const x = 5; x * 2",
+	"const x = 5;\nlet x = 6",
+	"const x = 5; const x = 6",
+	"const x = 5; let [a, x] = [1, 2]",
+	"const x = 5; let [a, ...x] = [1, 2]",
+	"const P = 5; struct P { v }",
+	"let x = 1; const x = 2; x",
+	"const x = 1; let f = fn() { let x = 2; x }; [f(), x]",
+	"const x = 1; let f = fn(x) { x }; [f(3), match (2) { x => x }]",
+	"let f = fn() { const y = 1; if (true) { let y = 2 } y }; f()",
+	"let f = fn() { const y = 1; y }; [f(), f()]",
+	"const x = 1; try { let x = 2 } catch (e) { [e[\"message\"], x] }",
+	"struct P { v }; let p = freeze(P{v: 1}); p.v = 2",
+	"struct P { v }; let p = P{v: P{v: 1}}; freeze([{\"k\": p}]); p.v.v = 2",
+	"struct P { v }; let p = P{v: 1}; p.v = p; freeze(p); p.v.v = 2",
+	"struct P { v }; let p = P{v: 1}; let q = P{v: p}; freeze(p); q.v = 2; q",
+	"[freeze([1, \"a\", {1: true}]), freeze()]",
+	"let x = 1; let y = if (true) { let x = 2; x }; [x, y]",
+	"let f = fn(c) { if (c) { let x = 2 } x }; let x = 1; [f(true), f(false)]",
+	"let x = 1; if (true) { let x = x + 1; if (x > 1) { let x = x * 10; x } }",
+	"let make = fn(n) { if (n > 0) { let k = n * 10; fn() { k } } else { fn() { 0 } } }; let a = make(1); let b = make(2); [a(), b(), make(0)()]",
+	"let collect = fn(n, acc) { if (n == 0) { acc } else { let m = n; collect(n - 1, acc.push(fn() { m })) } }; let fs = collect(3, []); [fs[0](), fs[1](), fs[2]()]",
+	"let r = try { let t = 1; t } finally { let t = 2 }; [r, try { t } catch (e) { e[\"message\"] }]",
+	"const c = 1; [if (true) { const c = 2; c }, c]",
+	"[null, null == null, null != null, 1 == null, null != [1], if (false) { 1 } == null]",
+	`[null ?? 1, 2 ?? missing, false ?? 3, "" ?? 4]`,
+	`let h = {"a": null}; h["a"] ?? h["b"] ?? 5`,
+	"let a = null; [a?.b.c(1)[2], a?[missing()], a?.b ?? 1, a?.b.c + 1]",
+	`let h = {"a": null}; [h["a"]?.len(), h?["a"], "ab"?.len(), [1, 2]?[1], h?["a"]?.x?.y]`,
+	`let h = {"a": null}; h["a"].len()`,
+	"let f = fn(x) { x?.len() }; [f(null), f(\"abc\"), f([1])]",
+	"let f = fn(x, i) { [x?[i]?[i], x?[i ?? 0]] }; [f(null, 0), f([[1]], 0), f([[1]], null)]",
+	"struct P { next }; let p = P{next: null}; [p.next?.next, p?.next, P{next: p}.next?.next]",
+	"[match (null) { null => 1, _ => 2 }, match (0) { null => 1, _ => 2 }]",
+	"isEven(10); fn isEven(n) { if (n == 0) { true } else { isOdd(n - 1) } }; fn isOdd(n) { if (n == 0) { false } else { isEven(n - 1) } }; [isEven(7), isOdd(7)]",
+	"let f = fn(x) { let r = g(x); fn g(y) { y * 2 } r }; [f(4), if (true) { fn h() { 1 } h() }]",
+	"fn f() { 1 }; let g = f; fn f() { 2 }; [g(), f]",
+	"let x = if (true) { h(); fn h() { 1 } } else { 0 }; [x, h]",
+	"[map([1, 2, 3], fn(x) { x * 2 }), filter(range(10), fn(x) { x > 6 }), reduce(range(1, 6), fn(acc, x) { acc * x }, 1)]",
+	`[sort([3, 1, 2]), sort(["b", "ab", "a", "é", "z"]), sort([[2, "a"], [1, "b"], [2, "c"], [1, "d"]], fn(a, b) { a[0] < b[0] })]`,
+	"struct Log { calls }; let log = Log{calls: []}; let r = sort([5, 3, 8, 1, 9, 2], fn(a, b) { log.calls = log.calls.push([a, b]); a < b }); [r, log.calls]",
+	`[zip([1, 2, 3], ["a", "b"]), range(4), range(2, 5), range(10, 0, -3), range(3, 1), map([["a"]], freeze)]`,
+	"struct C { n }; let c = C{n: 0}; [any([1, 2, 3], fn(x) { c.n = c.n + 1; x == 2 }), all([1, 2], fn(x) { x > 1 }), each([1, 2], fn(x) { c.n = c.n + x }), c.n]",
+	"let m = map; [m([1], fn(x) { -x }), reduce(range(20000), fn(acc, x) { acc + x }, 0)]",
+	"try { map([1], fn(x) { throw x }) } catch (e) { [e[\"message\"], e[\"stack\"]] }",
+	"map([1], fn(x, y) { x })",
+	"filter([1], fn(x) { \"yes\" })",
+	`sort([1, "a"])`,
+	"[range(1, 2, 0)]",
+	"all([1], 2)",
+	`"ab".repeat(5000000000000000000)`,
+	`["é".repeat(33554433), "".repeat(9223372036854775807)]`,
+	"struct P { x }; let p = P{x: 1}; p.x = [p, {\"k\": p}]; [p, p.x]",
+	"struct P { x, y }; let p = P{x: 1, y: 1}; p.x = p; let q = P{x: 1, y: 1}; q.x = q; let r = P{x: 1, y: 2}; r.x = r; [p == q, p == r, p != q]",
+	"const f = fn() { 1 }; fn f() { 2 }; f()",
+	"let f = 1; let g = fn() { fn f() { 2 } f() }; [f, g(), fn() { let [a, f] = [1, 2]; fn f() { 3 } }()]",
+	"(null?.x).y",
+	"let a = null; [(a?.b), (a?[0]) ?? 2, (a?.b)?.c, (a?.b.c(1)), ((a?.b))]",
+	"let a = null; (a?.f)()",
+	"let a = null; (a?.b.c)[0]",
+	"let a = null; (a?.b).c = 1",
+	`json_encode({1: "a", "1": "b"})`,
+	`json_encode([{"true": 1, true: 2}], 2)`,
+	`json_encode({"a": {1: "x"}, "b": {"1": "y"}})`,
+	`sort(["😀", "～", "b", "ab", "a", "", "é"])`,
+	`["é😀".repeat(3), "😀".repeat(16777217)]`,
+	"struct P { x }; P{x: [1]} == P{x: [1]}",
+	`struct P { x, y }; let f = fn() { 1 }; [P{x: 1, y: [1]} == P{x: 2, y: [1]}, try { P{x: 1, y: {}} != P{x: 1, y: {}} } catch (e) { e["message"] }, try { P{x: P{x: f, y: 1}, y: 1} == P{x: P{x: f, y: 1}, y: 1} } catch (e) { e["message"] }]`,
+}
+
+// describe matches its argument with patterns of every kind. It is run with each of describeCalls.
+var describe = `let describe = fn(x) {
+	match (x) {
+		0 => "zero",
+		"hi" => "greeting",
+		true => "yes",
+		-1 => "minus one",
+		[] => "empty",
+		[a] => "one element",
+		[0, ...rest] => rest,
+		[n, "big"] if n > 100 => "big",
+		[a, b] if a == b => "pair of equals",
+		[a, b] => "pair",
+		{"kind": "circle", r} => r * r * 3,
+		{"kind": "square", "side": [s]} => s * s,
+		_ => "something else"
+	}
+}; `
+
+var describeCalls = []string{
+	"describe(0)",
+	"describe(\"hi\")",
+	"describe(true)",
+	"describe(-1)",
+	"describe([])",
+	"describe([5])",
+	"describe([0, 1, 2])",
+	"describe([0, 1])",
+	"describe([3, 3])",
+	"describe([3, 4])",
+	"describe({\"kind\": \"circle\", \"r\": 2})",
+	"describe({\"r\": 2, \"kind\": \"square\", \"side\": [3]})",
+	"describe({\"kind\": \"square\", \"side\": 3})",
+	"describe([101, \"big\"])",
+	"describe(false)",
+	"describe(fn(x) { x })",
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"ast"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"lexer"
+	"os"
+	"parser"
+	"token"
+)
+
+// readSource reads the only file in args, or the standard input if there is none.
+func readSource(command string, args []string) (string, bool) {
+	var src []byte
+	var err error
+	switch len(args) {
+	case 0:
+		src, err = ioutil.ReadAll(os.Stdin)
+	case 1:
+		src, err = ioutil.ReadFile(args[0])
+	default:
+		fmt.Fprintf(os.Stderr, "usage: monkey %s [FILE]\n", command)
+		return "", false
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return "", false
+	}
+	return string(src), true
+}
+
+// dumpTokens prints the tokens of the source as a JSON array.
+func dumpTokens(args []string) int {
+	src, ok := readSource("tokens", args)
+	if !ok {
+		return 2
+	}
+
+	tokens := []token.Token{}
+	lx := lexer.New(src)
+	for {
+		tok := lx.NextToken()
+		tokens = append(tokens, tok)
+		if tok.Type == token.EOF {
+			break
+		}
+	}
+
+	out, err := json.Marshal(tokens)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Println(string(out))
+	return 0
+}
+
+// dumpAST prints the program in the source as JSON, see ast.ToJSON.
+func dumpAST(args []string) int {
+	src, ok := readSource("ast", args)
+	if !ok {
+		return 2
+	}
+
+	p := parser.New(lexer.New(src))
+	prog := p.Parse()
+	if errors := p.Errors(); len(errors) > 0 {
+		file := "-"
+		if len(args) == 1 {
+			file = args[0]
+		}
+		printSyntaxErrors(os.Stderr, file, errors)
+		return 1
+	}
+
+	out, err := ast.ToJSON(prog)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Println(string(out))
+	return 0
+}
@@ -0,0 +1,122 @@
+package evaluator
+
+import (
+	"ast"
+	"fmt"
+	"object"
+	"token"
+)
+
+// tailCall is a call in tail position that is yet to be made.
+// It is returned as the result of the function making it, for its caller to run.
+type tailCall struct {
+	function *object.Function
+	args     []object.Object
+	named    []namedArgument
+	name     string
+	pos      token.Position
+}
+
+func (tc *tailCall) Inspect() string {
+	return fmt.Sprintf("tail call to %s", tc.name)
+}
+func (tc *tailCall) Type() object.Type {
+	return object.TYPE_TAIL_CALL
+}
+
+type namedArgument struct {
+	name  string
+	value object.Object
+}
+
+// evalArguments evaluates the arguments of a call or the elements of an array literal,
+// expanding the spread ones.
+func evalArguments(c *Context, exps []ast.Expression, env *object.Environment) (positional []object.Object, named []namedArgument, err object.Object) {
+	positional = []object.Object{}
+
+	for _, exp := range exps {
+		switch exp := exp.(type) {
+		case *ast.SpreadExpression:
+			value := eval(c, exp.Value, env)
+			if value.Type() == object.TYPE_ERROR {
+				return nil, nil, value
+			}
+			array, ok := value.(*object.Array)
+			if !ok {
+				return nil, nil, newError("cannot spread %s, only arrays", value.Type())
+			}
+			positional = append(positional, array.Elements...)
+
+		case *ast.NamedArgument:
+			value := eval(c, exp.Value, env)
+			if value.Type() == object.TYPE_ERROR {
+				return nil, nil, value
+			}
+			named = append(named, namedArgument{name: exp.Name.Name, value: value})
+
+		default:
+			value := eval(c, exp, env)
+			if value.Type() == object.TYPE_ERROR {
+				return nil, nil, value
+			}
+			positional = append(positional, value)
+		}
+	}
+
+	return positional, named, nil
+}
+
+// bindArguments sets the parameters of f in env. Parameters without an argument
+// get their default value, which is evaluated in env so it can refer to the parameters before it.
+func bindArguments(c *Context, f *object.Function, args []object.Object, named []namedArgument, env *object.Environment) object.Object {
+	if len(args) > len(f.Params) && f.Rest == "" {
+		return newError("too many arguments for %s: expected %d, got %d", f.Signature(), len(f.Params), len(args))
+	}
+
+	given := make([]object.Object, len(f.Params))
+	copy(given, args)
+
+	for _, na := range named {
+		i := paramIndex(f, na.name)
+		if i < 0 {
+			return newError("unknown parameter %s for %s", na.name, f.Signature())
+		}
+		if given[i] != nil {
+			return newError("parameter %s of %s is given twice", na.name, f.Signature())
+		}
+		given[i] = na.value
+	}
+
+	for i, name := range f.Params {
+		if given[i] == nil {
+			if i >= len(f.Defaults) || f.Defaults[i] == nil {
+				return newError("missing argument %s for %s", name, f.Signature())
+			}
+			def := eval(c, f.Defaults[i], env)
+			if def.Type() == object.TYPE_ERROR {
+				return def
+			}
+			given[i] = def
+		}
+		env.Set(name, given[i])
+	}
+
+	if f.Rest != "" {
+		rest := []object.Object{}
+		if len(args) > len(f.Params) {
+			rest = append(rest, args[len(f.Params):]...)
+		}
+		env.Set(f.Rest, c.alloc(&object.Array{Elements: rest}))
+	}
+
+	return nil
+}
+
+func paramIndex(f *object.Function, name string) int {
+	for i, p := range f.Params {
+		if p == name {
+			return i
+		}
+	}
+	return -1
+}
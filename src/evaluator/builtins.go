@@ -0,0 +1,94 @@
+package evaluator
+
+import (
+	"context"
+	"object"
+)
+
+// builtins are each an *object.Builtin, or a *contextBuiltin for those needing the Context.
+var builtins = map[string]object.Object{
+	"error":       &object.Builtin{Name: "error", Fn: builtinError},
+	"json_encode": &object.Builtin{Name: "json_encode", Fn: builtinJSONEncode},
+	"json_decode": newContextBuiltin("json_decode", builtinJSONDecode),
+	"freeze":      &object.Builtin{Name: "freeze", Fn: builtinFreeze},
+}
+
+// contextBuiltin is a builtin needing the Context of the evaluation calling it, like methods and natives.
+// It is given the one of each call, as the builtin may be kept in the environment and called by a later
+// evaluation, with other limits. Fn, for callers outside the evaluator, runs it without limits.
+type contextBuiltin struct {
+	object.Builtin
+	call func(c *Context, args []object.Object) object.Object
+}
+
+func newContextBuiltin(name string, call func(c *Context, args []object.Object) object.Object) *contextBuiltin {
+	b := &contextBuiltin{Builtin: object.Builtin{Name: name}, call: call}
+	b.Fn = func(args ...object.Object) object.Object {
+		return call(NewContext(context.Background(), Limits{}), args)
+	}
+	return b
+}
+
+// error(message, data) makes an error value that can be thrown.
+func builtinError(args ...object.Object) object.Object {
+	if len(args) < 1 || len(args) > 2 {
+		return newError("wrong number of arguments for error: expected 1 or 2, got %d", len(args))
+	}
+
+	message, ok := args[0].(*object.String)
+	if !ok {
+		return newError("first argument of error must be a string, got %s", args[0].Type())
+	}
+
+	err := &object.Error{Message: message.Value}
+	if len(args) == 2 {
+		err.Data = args[1]
+	}
+	return &object.ErrorValue{Err: err}
+}
+
+// freeze(value) makes the structs in value unable to change, looking into arrays, hashes and fields,
+// so that nothing in it can change anymore, as other values never do. It returns value.
+func builtinFreeze(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments for freeze: expected 1, got %d", len(args))
+	}
+	freeze(args[0])
+	return args[0]
+}
+
+func freeze(value object.Object) {
+	switch value := value.(type) {
+	case *object.Array:
+		for _, el := range value.Elements {
+			freeze(el)
+		}
+	case *object.Hash:
+		for _, pair := range value.Pairs {
+			freeze(pair.Value)
+		}
+	case *object.Struct:
+		if value.Frozen {
+			return
+		}
+		value.Frozen = true
+		for _, f := range value.Fields {
+			freeze(f)
+		}
+	case *object.ErrorValue:
+		if value.Err.Data != nil {
+			freeze(value.Err.Data)
+		}
+	}
+}
+
+// LookupBuiltin returns the builtin function called name, for other ways of running programs.
+func LookupBuiltin(name string) (*object.Builtin, bool) {
+	switch b := builtins[name].(type) {
+	case *object.Builtin:
+		return b, true
+	case *contextBuiltin:
+		return &b.Builtin, true
+	}
+	return nil, false
+}
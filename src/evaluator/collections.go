@@ -0,0 +1,309 @@
+package evaluator
+
+import (
+	"bytes"
+	"context"
+	"object"
+	"token"
+)
+
+// caller calls a function given to a native builtin, which may be a monkey function or a builtin.
+// It returns what the function returns, or an *object.Error.
+type caller func(f object.Object, args ...object.Object) object.Object
+
+// native is a builtin which calls the functions it is given, with call.
+type native func(c *Context, call caller, args []object.Object) object.Object
+
+// natives are the builtins working on arrays with functions, done in Go so they neither
+// take one call per element nor nest deeper as the array grows. Each element still takes
+// a step, so that the limits of the Context hold inside them.
+var natives = map[string]native{
+	"map":    builtinMap,
+	"filter": builtinFilter,
+	"reduce": builtinReduce,
+	"each":   builtinEach,
+	"sort":   builtinSort,
+	"zip":    builtinZip,
+	"range":  builtinRange,
+	"any":    builtinAny,
+	"all":    builtinAll,
+}
+
+// bindNative makes the native n a builtin, whose calls are made from pos, where its name is looked up.
+func bindNative(name string, n native, pos token.Position) *contextBuiltin {
+	return newContextBuiltin(name, func(c *Context, args []object.Object) object.Object {
+		call := func(f object.Object, args ...object.Object) object.Object {
+			return apply(c, f, args, nil, "<anonymous>", pos)
+		}
+		return n(c, call, args)
+	})
+}
+
+// LookupNative returns the builtin name which calls functions, making its calls with call,
+// for other ways of running programs.
+func LookupNative(name string, call func(f object.Object, args ...object.Object) object.Object) (*object.Builtin, bool) {
+	n, ok := natives[name]
+	if !ok {
+		return nil, false
+	}
+	c := NewContext(context.Background(), Limits{})
+	return &object.Builtin{Name: name, Fn: func(args ...object.Object) object.Object {
+		return n(c, call, args)
+	}}, true
+}
+
+// map(array, f) is the array of f(el) for each element el of array.
+func builtinMap(c *Context, call caller, args []object.Object) object.Object {
+	els, err := arrayAndFunction("map", args, 2, 2)
+	if err != nil {
+		return err
+	}
+	res := make([]object.Object, len(els))
+	for i, el := range els {
+		c.step()
+		value := call(args[1], el)
+		if value.Type() == object.TYPE_ERROR {
+			return value
+		}
+		res[i] = value
+	}
+	return &object.Array{Elements: res}
+}
+
+// filter(array, f) is the array of the elements el of array for which f(el) is true.
+func builtinFilter(c *Context, call caller, args []object.Object) object.Object {
+	els, err := arrayAndFunction("filter", args, 2, 2)
+	if err != nil {
+		return err
+	}
+	res := []object.Object{}
+	for _, el := range els {
+		c.step()
+		keep, err := predicate(call, args[1], el)
+		if err != nil {
+			return err
+		}
+		if keep {
+			res = append(res, el)
+		}
+	}
+	return &object.Array{Elements: res}
+}
+
+// reduce(array, f, initial) combines the elements of array from the first one with f(acc, el),
+// acc being initial at first and then what the previous call returned. It returns the last acc.
+func builtinReduce(c *Context, call caller, args []object.Object) object.Object {
+	els, err := arrayAndFunction("reduce", args, 3, 3)
+	if err != nil {
+		return err
+	}
+	acc := args[2]
+	for _, el := range els {
+		c.step()
+		acc = call(args[1], acc, el)
+		if acc.Type() == object.TYPE_ERROR {
+			return acc
+		}
+	}
+	return acc
+}
+
+// each(array, f) calls f(el) for each element el of array, and returns null.
+func builtinEach(c *Context, call caller, args []object.Object) object.Object {
+	els, err := arrayAndFunction("each", args, 2, 2)
+	if err != nil {
+		return err
+	}
+	for _, el := range els {
+		c.step()
+		if value := call(args[1], el); value.Type() == object.TYPE_ERROR {
+			return value
+		}
+	}
+	return object.NULL
+}
+
+// sort(array, less) is array sorted so that less(a, b) is true when a comes before b.
+// Elements which are in order either way keep their order. Without less,
+// array must hold only integers or only strings, which are sorted in increasing order.
+func builtinSort(c *Context, call caller, args []object.Object) object.Object {
+	els, err := arrayAndFunction("sort", args, 1, 2)
+	if err != nil {
+		return err
+	}
+	less := func(a object.Object, b object.Object) (bool, *object.Error) {
+		c.step()
+		if len(args) == 2 {
+			return predicate(call, args[1], a, b)
+		}
+		return naturalLess(a, b)
+	}
+
+	res := append([]object.Object{}, els...)
+	if err := mergeSort(res, make([]object.Object, len(res)), less); err != nil {
+		return err
+	}
+	return &object.Array{Elements: res}
+}
+
+// mergeSort sorts els stably, using tmp, which is as long, as space.
+// The runtime of JavaScript sorts the same way, so that less is called in the same order.
+func mergeSort(els []object.Object, tmp []object.Object, less func(object.Object, object.Object) (bool, *object.Error)) *object.Error {
+	if len(els) < 2 {
+		return nil
+	}
+	mid := len(els) / 2
+	if err := mergeSort(els[:mid], tmp[:mid], less); err != nil {
+		return err
+	}
+	if err := mergeSort(els[mid:], tmp[mid:], less); err != nil {
+		return err
+	}
+
+	copy(tmp, els)
+	i, j, k := 0, mid, 0
+	for ; i < mid && j < len(els); k++ {
+		// the right one goes first only if it is strictly less
+		before, err := less(tmp[j], tmp[i])
+		if err != nil {
+			return err
+		}
+		if before {
+			els[k] = tmp[j]
+			j++
+		} else {
+			els[k] = tmp[i]
+			i++
+		}
+	}
+	copy(els[k:], tmp[i:mid])
+	return nil
+}
+
+func naturalLess(a object.Object, b object.Object) (bool, *object.Error) {
+	switch a := a.(type) {
+	case *object.Integer:
+		if b, ok := b.(*object.Integer); ok {
+			return a.Value < b.Value, nil
+		}
+	case *object.String:
+		if b, ok := b.(*object.String); ok {
+			return bytes.Compare([]byte(a.Value), []byte(b.Value)) < 0, nil
+		}
+	}
+	return false, newError("cannot sort %s and %s without a function to compare them", a.Type(), b.Type())
+}
+
+// zip(a, b) is the array of the pairs [a[i], b[i]], as long as the shortest of a and b.
+func builtinZip(c *Context, call caller, args []object.Object) object.Object {
+	if err := checkArgs("zip", args, 2, 2); err != nil {
+		return err
+	}
+	a, ok := args[0].(*object.Array)
+	if !ok {
+		return newError("first argument of zip must be an array, got %s", args[0].Type())
+	}
+	b, ok := args[1].(*object.Array)
+	if !ok {
+		return newError("second argument of zip must be an array, got %s", args[1].Type())
+	}
+	n := len(a.Elements)
+	if len(b.Elements) < n {
+		n = len(b.Elements)
+	}
+	res := make([]object.Object, n)
+	for i := range res {
+		c.step()
+		res[i] = c.alloc(&object.Array{Elements: []object.Object{a.Elements[i], b.Elements[i]}})
+	}
+	return &object.Array{Elements: res}
+}
+
+// range(end), range(start, end) and range(start, end, step) are the array of the integers
+// from start, 0 if not given, up to end excluded, going by step, 1 if not given.
+// A negative step goes down to end.
+func builtinRange(c *Context, call caller, args []object.Object) object.Object {
+	if err := checkArgs("range", args, 1, 3); err != nil {
+		return err
+	}
+	bounds := []int64{0, 0, 1}
+	for i, arg := range args {
+		n, ok := arg.(*object.Integer)
+		if !ok {
+			return newError("arguments of range must be integers, got %s", arg.Type())
+		}
+		bounds[i] = n.Value
+	}
+	if len(args) == 1 {
+		bounds[0], bounds[1] = 0, bounds[0]
+	}
+	start, end, step := bounds[0], bounds[1], bounds[2]
+	if step == 0 {
+		return newError("step of range cannot be 0")
+	}
+
+	res := []object.Object{}
+	for n := start; (step > 0 && n < end) || (step < 0 && n > end); n += step {
+		c.step()
+		res = append(res, c.alloc(&object.Integer{Value: n}))
+		if (step > 0 && n > end-step) || (step < 0 && n < end-step) {
+			// the next one would overflow, or is past end anyway
+			break
+		}
+	}
+	return &object.Array{Elements: res}
+}
+
+// any(array, f) tells whether f(el) is true for some element el of array, calling f only until it is.
+func builtinAny(c *Context, call caller, args []object.Object) object.Object {
+	return search(c, call, "any", args, true)
+}
+
+// all(array, f) tells whether f(el) is true for every element el of array, calling f only until it is not.
+func builtinAll(c *Context, call caller, args []object.Object) object.Object {
+	return search(c, call, "all", args, false)
+}
+
+// search is any if want is true, or all if it is false: it looks for an element for which f gives want.
+func search(c *Context, call caller, name string, args []object.Object, want bool) object.Object {
+	els, err := arrayAndFunction(name, args, 2, 2)
+	if err != nil {
+		return err
+	}
+	for _, el := range els {
+		c.step()
+		got, err := predicate(call, args[1], el)
+		if err != nil {
+			return err
+		}
+		if got == want {
+			return object.NativeBool(want)
+		}
+	}
+	return object.NativeBool(!want)
+}
+
+// arrayAndFunction checks the arguments of the native name, which are an array,
+// then a function if there are at least 2, and returns the elements of the array.
+func arrayAndFunction(name string, args []object.Object, min int, max int) ([]object.Object, *object.Error) {
+	if err := checkArgs(name, args, min, max); err != nil {
+		return nil, err
+	}
+	a, ok := args[0].(*object.Array)
+	if !ok {
+		return nil, newError("first argument of %s must be an array, got %s", name, args[0].Type())
+	}
+	if len(args) > 1 && args[1].Type() != object.TYPE_FUNCTION && args[1].Type() != object.TYPE_BUILTIN {
+		return nil, newError("second argument of %s must be a function, got %s", name, args[1].Type())
+	}
+	return a.Elements, nil
+}
+
+// predicate calls f with args, which must give a truth value.
+func predicate(call caller, f object.Object, args ...object.Object) (bool, *object.Error) {
+	value := call(f, args...)
+	if err, ok := value.(*object.Error); ok {
+		return false, err
+	}
+	return ToBool(value)
+}
@@ -0,0 +1,153 @@
+package evaluator
+
+import (
+	"ast"
+	"context"
+	"fmt"
+	"object"
+	"token"
+)
+
+// how many steps are taken between two checks of the context.Context,
+// since asking it every single step is comparatively expensive
+const cancelCheckInterval = 256
+
+// Limits bounds the resources an evaluation may use. A zero value means unlimited.
+type Limits struct {
+	MaxSteps   int // number of nodes evaluated
+	MaxDepth   int // number of nested function calls
+	MaxObjects int // number of objects allocated
+}
+
+// Context carries the cancellation and resource limits of an evaluation.
+// Counters are reset every time it is passed to EvalContext.
+type Context struct {
+	ctx    context.Context
+	limits Limits
+
+	steps   int
+	objects int
+	frames  []frame
+}
+
+// frame is a function call in progress.
+type frame struct {
+	name    string
+	callPos token.Position
+}
+
+func NewContext(ctx context.Context, limits Limits) *Context {
+	return &Context{ctx: ctx, limits: limits}
+}
+
+// CanceledError is returned when the context.Context is canceled or its deadline is exceeded.
+type CanceledError struct {
+	Err error
+}
+
+func (e *CanceledError) Error() string {
+	return fmt.Sprintf("evaluation canceled: %s", e.Err)
+}
+func (e *CanceledError) Unwrap() error {
+	return e.Err
+}
+
+type StepLimitError struct {
+	Limit int
+}
+
+func (e *StepLimitError) Error() string {
+	return fmt.Sprintf("evaluation exceeded the limit of %d steps", e.Limit)
+}
+
+type DepthLimitError struct {
+	Limit int
+}
+
+func (e *DepthLimitError) Error() string {
+	return fmt.Sprintf("evaluation exceeded the maximum call depth of %d", e.Limit)
+}
+
+type ObjectLimitError struct {
+	Limit int
+}
+
+func (e *ObjectLimitError) Error() string {
+	return fmt.Sprintf("evaluation exceeded the limit of %d allocated objects", e.Limit)
+}
+
+// abort is used as a panic value to unwind the whole evaluation once a limit is hit,
+// so that scripts have no chance to observe or swallow it.
+type abort struct {
+	err error
+}
+
+// EvalContext is like Eval, but stops as soon as one of the limits of c is exceeded.
+// In that case the returned error is one of *CanceledError, *StepLimitError,
+// *DepthLimitError or *ObjectLimitError. Errors raised by the script itself
+// are still returned as *object.Error values.
+func EvalContext(c *Context, node ast.Node, env *object.Environment) (result object.Object, err error) {
+	c.steps = 0
+	c.objects = 0
+	c.frames = nil
+
+	defer func() {
+		if r := recover(); r != nil {
+			if a, ok := r.(abort); ok {
+				result, err = nil, a.err
+				return
+			}
+			panic(r)
+		}
+	}()
+
+	if c.ctx != nil {
+		if err := c.ctx.Err(); err != nil {
+			return nil, &CanceledError{Err: err}
+		}
+	}
+
+	return eval(c, node, env), nil
+}
+
+func (c *Context) step() {
+	c.steps++
+	if c.limits.MaxSteps > 0 && c.steps > c.limits.MaxSteps {
+		panic(abort{&StepLimitError{Limit: c.limits.MaxSteps}})
+	}
+	if c.ctx != nil && c.steps%cancelCheckInterval == 0 {
+		if err := c.ctx.Err(); err != nil {
+			panic(abort{&CanceledError{Err: err}})
+		}
+	}
+}
+
+func (c *Context) enter(name string, callPos token.Position) {
+	if c.limits.MaxDepth > 0 && len(c.frames) >= c.limits.MaxDepth {
+		panic(abort{&DepthLimitError{Limit: c.limits.MaxDepth}})
+	}
+	c.frames = append(c.frames, frame{name: name, callPos: callPos})
+}
+
+func (c *Context) leave() {
+	c.frames = c.frames[:len(c.frames)-1]
+}
+
+// stackTrace describes the calls in progress, given the position currently being evaluated.
+func (c *Context) stackTrace(pos token.Position) []string {
+	res := []string{}
+	for i := len(c.frames) - 1; i >= 0; i-- {
+		res = append(res, fmt.Sprintf("%s (%s)", c.frames[i].name, pos))
+		pos = c.frames[i].callPos
+	}
+	return append(res, fmt.Sprintf("<program> (%s)", pos))
+}
+
+// alloc records that obj has just been allocated and returns it as is.
+func (c *Context) alloc(obj object.Object) object.Object {
+	c.objects++
+	if c.limits.MaxObjects > 0 && c.objects > c.limits.MaxObjects {
+		panic(abort{&ObjectLimitError{Limit: c.limits.MaxObjects}})
+	}
+	return obj
+}
@@ -2,132 +2,416 @@ package evaluator
 
 import (
 	"ast"
+	"bytes"
 	"fmt"
 	"object"
+	"token"
 )
 
+// Eval evaluates node without any limits. See EvalContext for running untrusted code.
 func Eval(node ast.Node, env *object.Environment) object.Object {
+	return eval(&Context{}, node, env)
+}
+
+// EvalEach evaluates prog like Eval, binding its fn statements first, but goes on when one of its
+// other statements fails: each is called with every one of them and its value, in order.
+// The error returned, if any, is the one binding the fn statements, before any other statement runs.
+func EvalEach(prog *ast.Program, env *object.Environment, each func(s ast.Statement, value object.Object)) *object.Error {
+	c := &Context{}
+	if err := hoistFunctions(c, prog.Statements, env); err != nil {
+		return err
+	}
+	for _, s := range prog.Statements {
+		if _, ok := s.(*ast.FunctionStatement); ok {
+			continue
+		}
+		res := eval(c, s, env)
+		if ret, ok := res.(*object.Return); ok {
+			res = ret.Value
+		}
+		each(s, res)
+	}
+	return nil
+}
+
+func eval(c *Context, node ast.Node, env *object.Environment) object.Object {
+	res := evalLink(c, node, env)
+	if res == skipped {
+		// the end of a chain skipped by an optional field or index
+		return object.NULL
+	}
+	return res
+}
+
+// evalLink evaluates node, which may be a link of a chain: unlike eval, it returns skipped
+// when an optional field or index in the chain found null, so that the rest of the chain is skipped too.
+// See ast.IsOptionalChain.
+func evalLink(c *Context, node ast.Node, env *object.Environment) object.Object {
+	c.step()
+
+	res := evalNode(c, node, env)
+	if res == skipped {
+		if e, ok := node.(ast.Expression); ok && ast.IsGrouped(e) {
+			// the chain ends at the parentheses
+			res = object.NULL
+		}
+	}
+
+	// the innermost node where an error surfaces is where it happened
+	if err, ok := res.(*object.Error); ok && !err.Position.IsValid() {
+		err.Position = node.Pos()
+		err.Stack = c.stackTrace(err.Position)
+	}
+
+	return res
+}
+
+func evalNode(c *Context, node ast.Node, env *object.Environment) object.Object {
 	switch node := node.(type) {
 	case *ast.Program:
 		// special case for Program, need to unwrap Return
-		res := evalStatements(node.Statements, env)
+		res := evalStatements(c, node.Statements, env)
 		if res.Type() == object.TYPE_RETURN {
 			return res.(*object.Return).Value
 		} else {
 			return res
 		}
 	case *ast.ExpressionStatement:
-		return Eval(node.Expression, env)
+		return eval(c, node.Expression, env)
 	case *ast.IntegerLiteral:
-		return &object.Integer{Value: node.IntValue}
+		return c.alloc(&object.Integer{Value: node.IntValue})
 	case *ast.BooleanLiteral:
-		return &object.Boolean{Value: node.BoolValue}
+		return object.NativeBool(node.BoolValue)
+	case *ast.NullLiteral:
+		return object.NULL
+	case *ast.StringLiteral:
+		return c.alloc(&object.String{Value: node.Value})
+	case *ast.TemplateLiteral:
+		return evalTemplate(c, node, env)
+	case *ast.ArrayLiteral:
+		elements, _, err := evalArguments(c, node.Elements, env)
+		if err != nil {
+			return err
+		}
+		return c.alloc(&object.Array{Elements: elements})
+	case *ast.SpreadExpression:
+		return newError("... can only be used in calls and array literals")
+	case *ast.NamedArgument:
+		return newError("named argument %s can only be used in calls", node.Name)
+	case *ast.HashLiteral:
+		hash := object.NewHash()
+		for _, pair := range node.Pairs {
+			key := eval(c, pair.Key, env)
+			if key.Type() == object.TYPE_ERROR {
+				return key
+			}
+			hashable, ok := key.(object.Hashable)
+			if !ok {
+				return newError("unusable as hash key: %s", key.Type())
+			}
+			value := eval(c, pair.Value, env)
+			if value.Type() == object.TYPE_ERROR {
+				return value
+			}
+			hash.Set(hashable, value)
+		}
+		return c.alloc(hash)
+	case *ast.MatchExpression:
+		return evalMatch(c, node, env)
+	case *ast.IndexExpression:
+		left := evalLink(c, node.Left, env)
+		if left.Type() == object.TYPE_ERROR || left == skipped {
+			return left
+		}
+		if node.IsOptional() && left == object.NULL {
+			return skipped
+		}
+		index := eval(c, node.Index, env)
+		if index.Type() == object.TYPE_ERROR {
+			return index
+		}
+		return evalIndex(c, left, index)
 	case *ast.PrefixExpression:
-		right := Eval(node.Expression, env)
-		return evalPrefix(node.Operator, right, env)
+		right := eval(c, node.Expression, env)
+		return evalPrefix(c, node.Operator, right, env)
 	case *ast.InfixExpression:
-		left := Eval(node.Left, env)
-		right := Eval(node.Right, env)
-		return evalInfix(node.Operator, left, right, env)
+		if node.Operator == "??" {
+			return evalCoalesce(c, node, env)
+		}
+		left := eval(c, node.Left, env)
+		right := eval(c, node.Right, env)
+		return evalInfix(c, node.Operator, left, right, env)
 	case *ast.IfExpression:
-		condition := Eval(node.Condition, env)
+		condition := eval(c, node.Condition, env)
 
-		pred, err := convertToBool(condition)
+		pred, err := ToBool(condition)
 		if err != nil {
 			return err
 		}
 
 		if pred {
-			return Eval(node.Consequence, env)
+			return eval(c, node.Consequence, env)
 		} else {
 			if node.Alternative == nil {
-				return &object.Null{}
+				return object.NULL
 			} else {
-				return Eval(node.Alternative, env)
+				return eval(c, node.Alternative, env)
 			}
 		}
 	case *ast.BlockStatement:
-		return evalStatements(node.Statements, env)
+		if node.Scoped {
+			// closures made in the block keep this scope, as a new one is made every time it runs
+			env = env.NewFrame(node.Locals)
+		}
+		return evalStatements(c, node.Statements, env)
 	case *ast.ReturnStatement:
-		return &object.Return{Value: Eval(node.Value, env)}
+		value := eval(c, node.Value, env)
+		if value.Type() == object.TYPE_ERROR {
+			return value
+		}
+		return &object.Return{Value: value}
+	case *ast.ThrowStatement:
+		value := eval(c, node.Value, env)
+		if value.Type() == object.TYPE_ERROR {
+			return value
+		}
+		return throw(value)
+	case *ast.TryExpression:
+		return evalTry(c, node, env)
+	case *ast.StructStatement:
+		return evalStructStatement(c, node, env)
+	case *ast.StructLiteral:
+		return evalStructLiteral(c, node, env)
+	case *ast.FieldExpression:
+		left := evalLink(c, node.Left, env)
+		if left.Type() == object.TYPE_ERROR || left == skipped {
+			return left
+		}
+		if node.IsOptional() && left == object.NULL {
+			return skipped
+		}
+		return evalMember(c, left, node.Field)
+	case *ast.AssignStatement:
+		return evalAssign(c, node, env)
 	case *ast.LetStatement:
-		value := Eval(node.Value, env)
+		value := eval(c, node.Value, env)
+		if value.Type() == object.TYPE_ERROR {
+			return value
+		}
+		if node.Pattern != nil {
+			mismatch, err := matchPattern(c, node.Pattern, value, env)
+			if err != nil {
+				return err
+			}
+			if mismatch != "" {
+				return newError("cannot destructure %s with %s: %s", value.Inspect(), node.Pattern, mismatch)
+			}
+			return value
+		}
+		if err := bind(env, node.Ident, value); err != nil {
+			return err
+		}
+		if node.IsConst() {
+			env.SetConst(node.Ident.Name)
+		}
+		return value
+	case *ast.FunctionStatement:
+		value := eval(c, node.Function, env)
 		if value.Type() == object.TYPE_ERROR {
 			return value
 		}
-		env.Set(node.Ident.Name, value)
+		if err := bind(env, node.Name, value); err != nil {
+			return err
+		}
 		return value
 	case *ast.Identifier:
-		if value, ok := env.Get(node.Name); !ok {
-			return newError("unknown identifier: %s", node.Name)
-		} else {
+		if node.Resolved {
+			if value, ok := env.GetSlot(node.Depth, node.Slot, node.Name); ok {
+				return value
+			}
+		} else if value, ok := env.Get(node.Name); ok {
 			return value
 		}
+		if builtin, ok := builtins[node.Name]; ok {
+			return builtin
+		}
+		if n, ok := natives[node.Name]; ok {
+			return c.alloc(bindNative(node.Name, n, node.Pos()))
+		}
+		return newError("unknown identifier: %s", node.Name)
 	case *ast.FunctionExpression:
 		params := []string{}
 		for _, p := range node.Params {
 			params = append(params, p.Name)
 		}
-		return &object.Function{Params: params, Body: node.Body, Env: env}
+		f := &object.Function{Params: params, Defaults: node.Defaults, Body: node.Body, Env: env, Locals: node.Locals}
+		if node.Rest != nil {
+			f.Rest = node.Rest.Name
+		}
+		return c.alloc(f)
 	case *ast.CallExpression:
-		c := Eval(node.Function, env)
-		if c.Type() == object.TYPE_ERROR {
-			return c
+		callee := evalLink(c, node.Function, env)
+		if callee.Type() == object.TYPE_ERROR || callee == skipped {
+			return callee
 		}
-		if c.Type() != object.TYPE_FUNCTION {
-			return newError("non callable object is used: %s", c.Inspect())
+		if callee.Type() != object.TYPE_FUNCTION && callee.Type() != object.TYPE_BUILTIN {
+			return newError("non callable object is used: %s", callee.Inspect())
 		}
 
-		f := c.(*object.Function)
-		e2 := f.Env.NewLinkedEnvironment()
-		for i, arg := range node.Arguments {
-			actual := Eval(arg, env)
-			if actual.Type() == object.TYPE_ERROR {
-				return actual
-			}
+		args, named, err := evalArguments(c, node.Arguments, env)
+		if err != nil {
+			return err
+		}
+
+		if f, ok := callee.(*object.Function); ok && node.Tail && len(c.frames) > 0 {
+			// let the call that is running the current function make this call, see apply
+			return &tailCall{function: f, args: args, named: named, name: node.CalleeName(), pos: node.Pos()}
+		}
+		return apply(c, callee, args, named, node.CalleeName(), node.Pos())
+	default:
+		return newError("unhandled case %T", node)
+	}
+}
+
+// apply calls callee, a function or a builtin, with args and named, as a call to name at pos does.
+func apply(c *Context, callee object.Object, args []object.Object, named []namedArgument, name string, pos token.Position) object.Object {
+	switch builtin := callee.(type) {
+	case *object.Builtin:
+		if len(named) > 0 {
+			return newError("builtin %s does not take named arguments", builtin.Name)
+		}
+		return c.alloc(builtin.Fn(args...))
+	case *contextBuiltin:
+		if len(named) > 0 {
+			return newError("builtin %s does not take named arguments", builtin.Name)
+		}
+		return c.alloc(builtin.call(c, args))
+	}
+
+	// tail calls made by f are run in this loop, instead of nesting deeper and deeper.
+	// They replace the frame of the function making them, as if called from here.
+	f, callPos := callee.(*object.Function), pos
+	for {
+		e2 := f.Env.NewFrame(f.Locals)
 
-			e2.Set(f.Params[i], actual)
+		c.enter(name, callPos)
+		if err := bindArguments(c, f, args, named, e2); err != nil {
+			c.leave()
+			if err, ok := err.(*object.Error); ok && !err.Position.IsValid() {
+				err.Position = pos
+				err.Stack = c.stackTrace(pos)
+			}
+			return err
 		}
+		value := eval(c, f.Body, e2)
+		c.leave()
 
-		value := Eval(f.Body, e2)
 		if value.Type() == object.TYPE_RETURN {
-			return value.(*object.Return).Value
-		} else {
+			value = value.(*object.Return).Value
+		}
+
+		tc, ok := value.(*tailCall)
+		if !ok {
 			return value
 		}
-	default:
-		return newError("unhandled case %T", node)
+		f, args, named, name, pos = tc.function, tc.args, tc.named, tc.name, tc.pos
+	}
+}
+
+// hoistFunctions binds the functions of the fn statements in ss before anything else runs,
+// so they can call each other. None of them may share its name with another declaration of ss.
+func hoistFunctions(c *Context, ss []ast.Statement, env *object.Environment) *object.Error {
+	if fs := ast.FunctionClash(ss); fs != nil {
+		err := newError("fn %s clashes with another declaration of %s in its block", fs.Name.Name, fs.Name.Name)
+		err.Position = fs.Pos()
+		err.Stack = c.stackTrace(err.Position)
+		return err
+	}
+
+	for _, s := range ss {
+		if s, ok := s.(*ast.FunctionStatement); ok {
+			if res := eval(c, s, env); res.Type() == object.TYPE_ERROR {
+				return res.(*object.Error)
+			}
+		}
 	}
+	return nil
+}
+
+// bind binds value to the name of id in env, which must be the scope id is declared in.
+// Names bound by const in env cannot be bound again.
+func bind(env *object.Environment, id *ast.Identifier, value object.Object) *object.Error {
+	if env.IsConst(id.Name) {
+		return newError("cannot rebind const %s", id.Name)
+	}
+	if id.Resolved {
+		env.SetSlot(id.Slot, value)
+	} else {
+		env.Set(id.Name, value)
+	}
+	return nil
+}
+
+// skipped is what evalLink gives for the links of a chain after an optional field or index found null.
+var skipped object.Object = &skippedChain{}
+
+type skippedChain struct {
+	object.Null
+}
+
+// evalCoalesce evaluates left ?? right, which is right only when left is null.
+func evalCoalesce(c *Context, node *ast.InfixExpression, env *object.Environment) object.Object {
+	left := eval(c, node.Left, env)
+	if left != object.NULL {
+		return left
+	}
+	return eval(c, node.Right, env)
 }
 
 func newError(format string, args ...interface{}) *object.Error {
 	return &object.Error{Message: fmt.Sprintf(format, args...)}
 }
 
-func evalPrefix(operator string, operand object.Object, env *object.Environment) object.Object {
+// evalTemplate puts together the parts of a template string and the values of its interpolations.
+func evalTemplate(c *Context, node *ast.TemplateLiteral, env *object.Environment) object.Object {
+	var out bytes.Buffer
+	for i, e := range node.Expressions {
+		out.WriteString(node.Parts[i])
+		value := eval(c, e, env)
+		if value.Type() == object.TYPE_ERROR {
+			return value
+		}
+		out.WriteString(object.Display(value))
+	}
+	out.WriteString(node.Parts[len(node.Parts)-1])
+	return c.alloc(&object.String{Value: out.String()})
+}
+
+func evalPrefix(c *Context, operator string, operand object.Object, env *object.Environment) object.Object {
 	if operand.Type() == object.TYPE_ERROR {
 		return operand
 	}
 
 	switch operator {
 	case "!":
-		val, err := convertToBool(operand)
+		val, err := ToBool(operand)
 		if err != nil {
 			return err
 		}
-		return &object.Boolean{Value: !val}
+		return object.NativeBool(!val)
 	case "-":
-		val, err := convertToInteger(operand)
+		val, err := ToInteger(operand)
 		if err != nil {
 			return err
 		}
-		return &object.Integer{Value: -val}
+		return c.alloc(&object.Integer{Value: -val})
 	}
 
 	return newError("unhandled operator %s", operator)
 }
 
-func convertToInteger(obj object.Object) (result int64, err *object.Error) {
+// ToInteger converts obj to an integer, as the arithmetic operators do.
+func ToInteger(obj object.Object) (result int64, err *object.Error) {
 	switch obj := obj.(type) {
 	case *object.Boolean:
 		if obj.Value {
@@ -145,7 +429,8 @@ func convertToInteger(obj object.Object) (result int64, err *object.Error) {
 	return
 }
 
-func convertToBool(obj object.Object) (result bool, err *object.Error) {
+// ToBool converts obj to a truth value, as conditions do.
+func ToBool(obj object.Object) (result bool, err *object.Error) {
 	switch obj := obj.(type) {
 	case *object.Boolean:
 		result = obj.Value
@@ -159,7 +444,18 @@ func convertToBool(obj object.Object) (result bool, err *object.Error) {
 	return
 }
 
-func evalInfix(operator string, left object.Object, right object.Object, env *object.Environment) object.Object {
+// Prefix applies the prefix operator to operand, for other ways of running programs.
+func Prefix(operator string, operand object.Object) object.Object {
+	return evalPrefix(&Context{}, operator, operand, nil)
+}
+
+// Infix applies the infix operator to left and right, for other ways of running programs.
+// As with ==, structs are compared field by field.
+func Infix(operator string, left object.Object, right object.Object) object.Object {
+	return evalInfix(&Context{}, operator, left, right, nil)
+}
+
+func evalInfix(c *Context, operator string, left object.Object, right object.Object, env *object.Environment) object.Object {
 	if left.Type() == object.TYPE_ERROR {
 		return left
 	}
@@ -167,6 +463,27 @@ func evalInfix(operator string, left object.Object, right object.Object, env *ob
 		return right
 	}
 
+	if left, ok := left.(*object.String); ok {
+		if right, ok := right.(*object.String); ok {
+			return evalStringInfix(c, operator, left, right)
+		}
+	}
+
+	if (left == object.NULL || right == object.NULL) && (operator == "==" || operator == "!=") {
+		// null is only equal to itself
+		return object.NativeBool((left == right) == (operator == "=="))
+	}
+
+	if left, ok := left.(*object.Struct); ok {
+		if right, ok := right.(*object.Struct); ok && (operator == "==" || operator == "!=") {
+			equal, err := structEquals(c, left, right)
+			if err != nil {
+				return err
+			}
+			return object.NativeBool(equal == (operator == "=="))
+		}
+	}
+
 	switch operator {
 	// these operators return integer
 	case "+":
@@ -184,25 +501,28 @@ func evalInfix(operator string, left object.Object, right object.Object, env *ob
 			return newError("second operand of %s cannot be boolean", operator)
 		}
 
-		leftint, err := convertToInteger(left)
+		leftint, err := ToInteger(left)
 		if err != nil {
 			return err
 		}
 
-		rightint, err := convertToInteger(right)
+		rightint, err := ToInteger(right)
 		if err != nil {
 			return err
 		}
 
 		switch operator {
 		case "+":
-			return &object.Integer{Value: leftint + rightint}
+			return c.alloc(&object.Integer{Value: leftint + rightint})
 		case "-":
-			return &object.Integer{Value: leftint - rightint}
+			return c.alloc(&object.Integer{Value: leftint - rightint})
 		case "*":
-			return &object.Integer{Value: leftint * rightint}
+			return c.alloc(&object.Integer{Value: leftint * rightint})
 		case "/":
-			return &object.Integer{Value: leftint / rightint}
+			if rightint == 0 {
+				return newError("division by zero")
+			}
+			return c.alloc(&object.Integer{Value: leftint / rightint})
 		}
 
 		// these operators return boolean:
@@ -234,35 +554,84 @@ func evalInfix(operator string, left object.Object, right object.Object, env *ob
 			}
 		}
 
-		leftint, err := convertToInteger(left)
+		leftint, err := ToInteger(left)
 		if err != nil {
 			return err
 		}
-		rightint, err := convertToInteger(right)
+		rightint, err := ToInteger(right)
 		if err != nil {
 			return err
 		}
 
 		switch operator {
 		case ">":
-			return &object.Boolean{Value: leftint > rightint}
+			return object.NativeBool(leftint > rightint)
 		case "<":
-			return &object.Boolean{Value: leftint < rightint}
+			return object.NativeBool(leftint < rightint)
 		case "==":
-			return &object.Boolean{Value: leftint == rightint}
+			return object.NativeBool(leftint == rightint)
 		case "!=":
-			return &object.Boolean{Value: leftint != rightint}
+			return object.NativeBool(leftint != rightint)
 		}
 	}
 
 	return newError("unhandled operator %s", operator)
 }
 
-func evalStatements(ss []ast.Statement, env *object.Environment) object.Object {
+func evalStringInfix(c *Context, operator string, left *object.String, right *object.String) object.Object {
+	switch operator {
+	case "+":
+		return c.alloc(&object.String{Value: left.Value + right.Value})
+	case "==":
+		return object.NativeBool(left.Value == right.Value)
+	case "!=":
+		return object.NativeBool(left.Value != right.Value)
+	}
+
+	return newError("unhandled operator %s for strings", operator)
+}
+
+func evalIndex(c *Context, left object.Object, index object.Object) object.Object {
+	switch left := left.(type) {
+	case *object.Array:
+		if i, ok := index.(*object.Integer); ok {
+			if i.Value < 0 || i.Value >= int64(len(left.Elements)) {
+				return object.NULL
+			}
+			return left.Elements[i.Value]
+		}
+	case *object.Hash:
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", index.Type())
+		}
+		if value, ok := left.Get(key); ok {
+			return value
+		}
+		return object.NULL
+	case *object.ErrorValue:
+		if key, ok := index.(*object.String); ok {
+			return errorField(c, left.Err, key.Value)
+		}
+	}
+
+	return newError("cannot index %s with %s", left.Type(), index.Type())
+}
+
+func evalStatements(c *Context, ss []ast.Statement, env *object.Environment) object.Object {
 	var res object.Object
 
+	if err := hoistFunctions(c, ss, env); err != nil {
+		return err
+	}
+
 	for _, s := range ss {
-		res = Eval(s, env)
+		if s, ok := s.(*ast.FunctionStatement); ok {
+			// already bound, so it only gives the function
+			res = eval(c, s.Name, env)
+			continue
+		}
+		res = eval(c, s, env)
 
 		// if res is a Return or an Error, stop evaluating and return it immediately
 		if res.Type() == object.TYPE_RETURN || res.Type() == object.TYPE_ERROR {
@@ -270,5 +639,9 @@ func evalStatements(ss []ast.Statement, env *object.Environment) object.Object {
 		}
 	}
 
+	if res == nil {
+		// empty block
+		return object.NULL
+	}
 	return res
 }
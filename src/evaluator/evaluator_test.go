@@ -1,16 +1,21 @@
 package evaluator
 
 import (
+	"context"
+	"errors"
 	"lexer"
 	"object"
 	"parser"
+	"resolver"
 	"testing"
+	"time"
 )
 
 func testEval(in string) object.Object {
 	lx := lexer.New(in)
 	p := parser.New(lx)
 	prog := p.Parse()
+	resolver.Resolve(prog)
 	env := object.NewEnvironment()
 	return Eval(prog, env)
 }
@@ -310,3 +315,916 @@ func TestFunctionCall(t *testing.T) {
 		testIntegerObject(t, testEval(tt.in), tt.out)
 	}
 }
+
+func testEvalContext(c *Context, in string) (object.Object, error) {
+	prog := parser.New(lexer.New(in)).Parse()
+	resolver.Resolve(prog)
+	return EvalContext(c, prog, object.NewEnvironment())
+}
+
+func TestLimits(t *testing.T) {
+	forever := "let f = fn(x) { f(x + 1) }; f(0)"
+	deeper := "let f = fn(x) { 1 + f(x + 1) }; f(0)"
+	fib := "let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(40)"
+
+	_, err := testEvalContext(NewContext(context.Background(), Limits{MaxSteps: 1000}), forever)
+	if e, ok := err.(*StepLimitError); !ok || e.Limit != 1000 {
+		t.Errorf("expected step limit error. got: %v", err)
+	}
+
+	_, err = testEvalContext(NewContext(context.Background(), Limits{MaxDepth: 50}), deeper)
+	if e, ok := err.(*DepthLimitError); !ok || e.Limit != 50 {
+		t.Errorf("expected depth limit error. got: %v", err)
+	}
+
+	_, err = testEvalContext(NewContext(context.Background(), Limits{MaxObjects: 100}), forever)
+	if e, ok := err.(*ObjectLimitError); !ok || e.Limit != 100 {
+		t.Errorf("expected object limit error. got: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = testEvalContext(NewContext(ctx, Limits{}), "1 + 2")
+	if _, ok := err.(*CanceledError); !ok || !errors.Is(err, context.Canceled) {
+		t.Errorf("expected canceled error. got: %v", err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = testEvalContext(NewContext(ctx, Limits{}), fib)
+	if _, ok := err.(*CanceledError); !ok || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded error. got: %v", err)
+	}
+}
+
+func TestLimitsOfKeptBuiltins(t *testing.T) {
+	// builtins got in one evaluation and called in another must be held to the limits of the latter
+	env := object.NewEnvironment()
+	run := func(c *Context, in string) (object.Object, error) {
+		prog := parser.New(lexer.New(in)).Parse()
+		resolver.Resolve(prog)
+		return EvalContext(c, prog, env)
+	}
+
+	if _, err := run(NewContext(context.Background(), Limits{}), `let m = map; let split = "a,b,c,d".split`); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	_, err := run(NewContext(context.Background(), Limits{MaxSteps: 1000}), "let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; m([1], fn(x) { f(5000) })")
+	if e, ok := err.(*StepLimitError); !ok || e.Limit != 1000 {
+		t.Errorf("expected step limit error. got: %v", err)
+	}
+
+	_, err = run(NewContext(context.Background(), Limits{MaxObjects: 3}), `split(",")`)
+	if e, ok := err.(*ObjectLimitError); !ok || e.Limit != 3 {
+		t.Errorf("expected object limit error. got: %v", err)
+	}
+}
+
+func TestLimitsInNatives(t *testing.T) {
+	// natives take a step per element, even when they call no function
+	env := object.NewEnvironment()
+	run := func(c *Context, in string) (object.Object, error) {
+		prog := parser.New(lexer.New(in)).Parse()
+		resolver.Resolve(prog)
+		return EvalContext(c, prog, env)
+	}
+
+	if _, err := run(NewContext(context.Background(), Limits{}), "let r = range(5000)"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, in := range []string{"range(50000000).len()", "sort(r)", "zip(r, r)", "map(r, fn(x) { x })", "any(r, fn(x) { false })"} {
+		_, err := run(NewContext(context.Background(), Limits{MaxSteps: 1000}), in)
+		if e, ok := err.(*StepLimitError); !ok || e.Limit != 1000 {
+			t.Errorf("expected step limit error for %q. got: %v", in, err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := run(NewContext(ctx, Limits{}), "range(50000000).len()")
+	if _, ok := err.(*CanceledError); !ok || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded error. got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected range to stop at the deadline, it ran for %s", elapsed)
+	}
+}
+
+func TestLimitsInJSONDecode(t *testing.T) {
+	// the values decoded are allocated by the evaluation calling json_decode
+	env := object.NewEnvironment()
+	run := func(c *Context, in string) (object.Object, error) {
+		prog := parser.New(lexer.New(in)).Parse()
+		resolver.Resolve(prog)
+		return EvalContext(c, prog, env)
+	}
+
+	if _, err := run(NewContext(context.Background(), Limits{}), `let text = "[" + "[1, {\"k\": 2}], ".repeat(1000) + "0]"`); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	_, err := run(NewContext(context.Background(), Limits{MaxObjects: 1000}), "json_decode(text)")
+	if e, ok := err.(*ObjectLimitError); !ok || e.Limit != 1000 {
+		t.Errorf("expected object limit error. got: %v", err)
+	}
+	_, err = run(NewContext(context.Background(), Limits{MaxSteps: 1000}), "json_decode(text)")
+	if e, ok := err.(*StepLimitError); !ok || e.Limit != 1000 {
+		t.Errorf("expected step limit error. got: %v", err)
+	}
+	res, err := run(NewContext(context.Background(), Limits{MaxObjects: 10000}), "json_decode(text).len()")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	testIntegerObject(t, res, 1001)
+}
+
+func TestLimitsNotExceeded(t *testing.T) {
+	c := NewContext(context.Background(), Limits{MaxSteps: 1000, MaxDepth: 10, MaxObjects: 1000})
+
+	res, err := testEvalContext(c, "let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	testIntegerObject(t, res, 20)
+
+	// script errors are not limit errors
+	res, err = testEvalContext(c, "foo")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, ok := res.(*object.Error); !ok {
+		t.Errorf("result is not error. got: %v", res)
+	}
+}
+
+func TestStringsAndArrays(t *testing.T) {
+	tests := []struct {
+		in  string
+		out string
+	}{
+		{`"foo" + "bar"`, `"foobar"`},
+		{`"foo" == "foo"`, "true"},
+		{`"foo" != "foo"`, "false"},
+		{`[1, 2 * 2, "x"]`, `[1, 4, "x"]`},
+		{"[1, 2, 3][1]", "2"},
+		{"[1, 2, 3][3]", "null"},
+		{"let a = [[1], [2, 3]]; a[1][0]", "2"},
+		{"fn() {}()", "null"},
+	}
+
+	for _, tt := range tests {
+		eval := testEval(tt.in)
+		if eval.Inspect() != tt.out {
+			t.Errorf("wrong result for %q. expected: %s, got: %s", tt.in, tt.out, eval.Inspect())
+		}
+	}
+}
+
+func TestExceptions(t *testing.T) {
+	tests := []struct {
+		in  string
+		out string
+	}{
+		{`try { throw "oops"; 1 } catch (e) { e["message"] }`, `"oops"`},
+		{`try { 1 } catch (e) { 2 }`, "1"},
+		{`try { foo } catch (e) { e["message"] }`, `"unknown identifier: foo"`},
+		{`try { 1 + true } catch (e) { e["message"] }`, `"second operand of + cannot be boolean"`},
+		{`try { 1 / 0 } catch (e) { e["message"] }`, `"division by zero"`},
+		{`try { throw error("bad", [1, 2]) } catch (e) { e["data"][1] }`, "2"},
+		{`try { throw 42 } catch (e) { e["data"] }`, "42"},
+		{`let e = error("later"); e`, `error("later")`},
+		{`try { throw error("x") } catch (e) { e }`, `error("x")`},
+		{`try { foo } catch (e) { e["position"] }`, `"1:7"`},
+		{"let f = fn() {\n  throw \"x\"\n}\ntry { f() } catch (e) { e[\"stack\"] }", `["f (2:3)", "<program> (4:7)"]`},
+		{`try { 7 } finally { 8 }`, "7"},
+		{`try { throw 1 } catch (e) { 2 } finally { 3 }`, "2"},
+		{`let f = fn() { try { return 1 } finally { 2 } }; f()`, "1"},
+		{`let f = fn() { try { throw 1 } finally { return 2 } }; f()`, "2"},
+		{`try { try { throw "inner" } finally { 1 } } catch (e) { e["message"] }`, `"inner"`},
+		{`try { try { throw "a" } catch (e) { throw e["message"] + "b" } } catch (e) { e["message"] }`, `"ab"`},
+	}
+
+	for _, tt := range tests {
+		eval := testEval(tt.in)
+		if eval.Inspect() != tt.out {
+			t.Errorf("wrong result for %q. expected: %s, got: %s", tt.in, tt.out, eval.Inspect())
+		}
+	}
+}
+
+func TestUncaughtExceptions(t *testing.T) {
+	tests := []struct {
+		in       string
+		msg      string
+		position string
+	}{
+		{`throw "oops"`, "oops", "1:1"},
+		{`throw error("bad")`, "bad", "1:1"},
+		{`try { throw 1 } catch (e) { throw e }`, "1", "1:7"},
+		{`try { 1 } finally { foo }`, "unknown identifier: foo", "1:21"},
+		{`error(1)`, "first argument of error must be a string, got integer", "1:1"},
+	}
+
+	for _, tt := range tests {
+		eval := testEval(tt.in)
+		if e, ok := eval.(*object.Error); !ok {
+			t.Errorf("result is not error. got: %v", eval)
+		} else {
+			if e.Message != tt.msg {
+				t.Errorf("error message is wrong. expected: %q, got: %q", tt.msg, e.Message)
+			}
+			if e.Position.String() != tt.position {
+				t.Errorf("error position is wrong. expected: %s, got: %s", tt.position, e.Position)
+			}
+		}
+	}
+}
+
+func TestHashes(t *testing.T) {
+	tests := []struct {
+		in  string
+		out string
+	}{
+		{`{"a": 1, "b": 2 * 2, 3: true, false: "f"}`, `{"a": 1, "b": 4, 3: true, false: "f"}`},
+		{`{"a": 1, "a": 2}`, `{"a": 2}`},
+		{`let k = "b"; {"a": 1, "b": 2}[k]`, "2"},
+		{`{"a": 1}["c"]`, "null"},
+		{`{1: "one"}[1]`, `"one"`},
+		{`{[1]: 2}`, `ERROR("unusable as hash key: array") at 1:1`},
+		{`{}[fn(){}]`, `ERROR("unusable as hash key: function") at 1:3`},
+	}
+
+	for _, tt := range tests {
+		eval := testEval(tt.in)
+		if eval.Inspect() != tt.out {
+			t.Errorf("wrong result for %q. expected: %s, got: %s", tt.in, tt.out, eval.Inspect())
+		}
+	}
+}
+
+func TestTemplateStrings(t *testing.T) {
+	tests := []struct {
+		in  string
+		out string
+	}{
+		{`let name = "Ann"; let n = 2; "Hello ${name}, you have ${n + 1} items"`, `"Hello Ann, you have 3 items"`},
+		{`"${1}${true}${[1, "a"]}${{"k": "v"}}"`, `"1true[1, \"a\"]{\"k\": \"v\"}"`},
+		{`let f = fn(x) { "<${x}>" }; "${f("${f(1)}")}"`, `"<<1>>"`},
+		{`"${ {"k": "}"}["k"] }"`, `"}"`},
+		{`"\${x}"`, `"${x}"`},
+		{`"a${""}b"`, `"ab"`},
+		{`"${error("e")} ${fn(x) { x }}"`, `"error(\"e\") fn (x) {x;}"`},
+		{`let x = 1; "a ${x + true} b"`, `ERROR("second operand of + cannot be boolean") at 1:19`},
+		{`"a ${y}"`, `ERROR("unknown identifier: y") at 1:6`},
+	}
+
+	for _, tt := range tests {
+		eval := testEval(tt.in)
+		if eval.Inspect() != tt.out {
+			t.Errorf("wrong result for %q. expected: %s, got: %s", tt.in, tt.out, eval.Inspect())
+		}
+	}
+}
+
+func TestConst(t *testing.T) {
+	tests := []struct {
+		in  string
+		out string
+	}{
+		{"const x = 5; x * 2", "10"},
+		{"const x = 5;\nlet x = 6", `ERROR("cannot rebind const x") at 2:1`},
+		{"const x = 5; const x = 6", `ERROR("cannot rebind const x") at 1:14`},
+		{"const x = 5; let [a, x] = [1, 2]", `ERROR("cannot rebind const x") at 1:14`},
+		{"const x = 5; let [a, ...x] = [1, 2]", `ERROR("cannot rebind const x") at 1:14`},
+		{"const P = 5; struct P { v }", `ERROR("cannot rebind const P") at 1:14`},
+		{"let x = 1; const x = 2; x", "2"},
+		{"const x = 1; let f = fn() { let x = 2; x }; [f(), x]", "[2, 1]"},
+		{"const x = 1; let f = fn(x) { x }; f(3)", "3"},
+		{"const x = 1; match (2) { x => x }", "2"},
+		{"let f = fn() { const y = 1; if (true) { let y = 2 } y }; f()", "1"},
+		{"let f = fn() { const y = 1; if (true) { const z = 2 } let z = 3; let y = 2 }; f()", `ERROR("cannot rebind const y") at 1:66`},
+		{"let f = fn() { const y = 1; y }; [f(), f()]", "[1, 1]"},
+		{"const x = 1; try { let x = 2; x } catch (e) { e[\"message\"] }", "2"},
+	}
+
+	for _, tt := range tests {
+		eval := testEval(tt.in)
+		if eval.Inspect() != tt.out {
+			t.Errorf("wrong result for %q. expected: %s, got: %s", tt.in, tt.out, eval.Inspect())
+		}
+	}
+}
+
+func TestFreeze(t *testing.T) {
+	tests := []struct {
+		in  string
+		out string
+	}{
+		{"struct P { v }; let p = freeze(P{v: 1}); p.v = 2", `ERROR("cannot set field v of frozen struct P") at 1:46`},
+		{"struct P { v }; let p = P{v: 1}; freeze(p); p.v", "1"},
+		{"struct P { v }; let p = P{v: P{v: 1}}; freeze([{\"k\": p}]); p.v.v = 2", `ERROR("cannot set field v of frozen struct P") at 1:66`},
+		{"struct P { v }; let p = P{v: 1}; p.v = p; freeze(p); p.v.v = 2", `ERROR("cannot set field v of frozen struct P") at 1:60`},
+		{"struct P { v }; let p = P{v: 1}; let q = P{v: p}; freeze(p); q.v = 2; q", "P{v: 2}"},
+		{"freeze([1, \"a\", {1: true}])", `[1, "a", {1: true}]`},
+		{"freeze()", `ERROR("wrong number of arguments for freeze: expected 1, got 0") at 1:1`},
+	}
+
+	for _, tt := range tests {
+		eval := testEval(tt.in)
+		if eval.Inspect() != tt.out {
+			t.Errorf("wrong result for %q. expected: %s, got: %s", tt.in, tt.out, eval.Inspect())
+		}
+	}
+}
+
+func TestCollectionBuiltins(t *testing.T) {
+	tests := []struct {
+		in  string
+		out string
+	}{
+		{"map([1, 2, 3], fn(x) { x * 2 })", "[2, 4, 6]"},
+		{`map(["a", "bc"], fn(s) { s.len() })`, "[1, 2]"},
+		{"filter(range(10), fn(x) { x > 6 })", "[7, 8, 9]"},
+		{"reduce(range(1, 6), fn(acc, x) { acc * x }, 1)", "120"},
+		{"reduce([], fn(acc, x) { acc + x }, 0)", "0"},
+		{"struct Box { v }; let b = Box{v: 0}; [each([1, 2, 3], fn(x) { b.v = b.v + x }), b.v]", "[null, 6]"},
+		{`[sort([3, 1, 2]), sort(["b", "ab", "a"]), sort([])]`, `[[1, 2, 3], ["a", "ab", "b"], []]`},
+		{`sort([[2, "a"], [1, "b"], [2, "c"], [1, "d"]], fn(a, b) { a[0] < b[0] })`, `[[1, "b"], [1, "d"], [2, "a"], [2, "c"]]`},
+		{"sort([1, 3, 2], fn(a, b) { a > b })", "[3, 2, 1]"},
+		{"let xs = [2, 1]; sort(xs); xs", "[2, 1]"},
+		{`zip([1, 2, 3], ["a", "b"])`, `[[1, "a"], [2, "b"]]`},
+		{"[range(4), range(2, 5), range(10, 0, -3), range(3, 1)]", "[[0, 1, 2, 3], [2, 3, 4], [10, 7, 4, 1], []]"},
+		{"[any([1, 2], fn(x) { x > 1 }), all([1, 2], fn(x) { x > 1 }), any([], fn(x) { true }), all([], fn(x) { false })]", "[true, false, false, true]"},
+		{"struct C { n }; let c = C{n: 0}; any([1, 2, 3], fn(x) { c.n = c.n + 1; x == 2 }); c.n", "2"},
+		{"map([1, 2], fn(x) { map([x], fn(y) { y + 1 }) })", "[[2], [3]]"},
+		{"map([[1], [2, 3]], len)", `ERROR("unknown identifier: len") at 1:20`},
+		{`map([["a"]], freeze)`, `[["a"]]`},
+		{"reduce(range(100000), fn(acc, x) { acc + x }, 0)", "4999950000"},
+		{"let m = map; m([1], fn(x) { -x })", "[-1]"},
+		{"map([1], fn(x) {\n  throw \"boom\"\n})", `ERROR("boom") at 2:3`},
+		{"map([1], fn(x, y) { x })", `ERROR("missing argument y for fn(x, y)") at 1:1`},
+		{"map([1])", `ERROR("wrong number of arguments for map: expected 2, got 1") at 1:1`},
+		{"filter(1, fn(x) { x })", `ERROR("first argument of filter must be an array, got integer") at 1:1`},
+		{"all([1], 2)", `ERROR("second argument of all must be a function, got integer") at 1:1`},
+		{`filter([1], fn(x) { "yes" })`, `ERROR("unhandled type for bool conversion *object.String") at 1:1`},
+		{`sort([1, "a"])`, `ERROR("cannot sort string and integer without a function to compare them") at 1:1`},
+		{`range(1, "a")`, `ERROR("arguments of range must be integers, got string") at 1:1`},
+		{"range(1, 2, 0)", `ERROR("step of range cannot be 0") at 1:1`},
+		{"try { map([1], fn(x) { throw x }) } catch (e) { e[\"stack\"] }", `["<anonymous> (1:24)", "<program> (1:7)"]`},
+	}
+
+	for _, tt := range tests {
+		eval := testEval(tt.in)
+		if eval.Inspect() != tt.out {
+			t.Errorf("wrong result for %q. expected: %s, got: %s", tt.in, tt.out, eval.Inspect())
+		}
+	}
+
+	// the calls they make are not nested, so the depth does not grow with the array
+	c := NewContext(context.Background(), Limits{MaxDepth: 10})
+	res, err := testEvalContext(c, "reduce(map(range(1000), fn(x) { x * 2 }), fn(acc, x) { acc + x }, 0)")
+	if err != nil || res.Inspect() != "999000" {
+		t.Errorf("expected 999000. got: %v, %v", res, err)
+	}
+
+	c = NewContext(context.Background(), Limits{MaxObjects: 1000})
+	if _, err := testEvalContext(c, "range(1000000)"); err == nil {
+		t.Errorf("expected object limit error for a big range")
+	}
+}
+
+func TestStructs(t *testing.T) {
+	tests := []struct {
+		in  string
+		out string
+	}{
+		{"struct Point { x, y }", "struct Point {x, y}"},
+		{"struct Point { x, y }; Point{y: 2, x: 1}", "Point{x: 1, y: 2}"},
+		{"struct Point { x, y }; let p = Point{x: 1, y: 2}; p.x + p.y", "3"},
+		{"struct Point { x, y }; let p = Point{x: 1, y: 2}; let q = p; q.x = 5; [p.x, q.x]", "[5, 5]"},
+		{"struct Point { x, y }; let p = Point{x: 1, y: 2}; p.y = p.y * 10", "20"},
+		{"struct Box { v }; let b = Box{v: Box{v: 1}}; b.v.v = 2; b", "Box{v: Box{v: 2}}"},
+		{"struct Point { x, y }; Point{x: 1, y: 2} == Point{x: 1, y: 2}", "true"},
+		{"struct Point { x, y }; Point{x: 1, y: 2} != Point{x: 1, y: 3}", "true"},
+		{"struct Box { v }; Box{v: Box{v: \"a\"}} == Box{v: Box{v: \"a\"}}", "true"},
+		{"struct A { v }; struct B { v }; A{v: 1} == B{v: 1}", "false"},
+		{"struct A { v }; A{v: 1} == A{v: \"a\"}", `ERROR("cannot do == of different types") at 1:25`},
+		{"struct A { v }; A{v: 1} == 1", `ERROR("cannot do == of different types") at 1:25`},
+		{"struct P { x }; P{x: [1]} == P{x: [1]}", `ERROR("field x of struct P is not comparable") at 1:27`},
+		{"struct P { x, y }; P{x: 1, y: {}} != P{x: 1, y: {}}", `ERROR("field y of struct P is not comparable") at 1:35`},
+		{"struct P { x, y }; P{x: 1, y: [1]} == P{x: 2, y: [1]}", "false"},
+		{"struct P { x }; let f = fn() { 1 }; P{x: P{x: f}} == P{x: P{x: f}}", `ERROR("field x of struct P is not comparable") at 1:51`},
+		{"struct A { v }; json_encode(A{v: [1, A{v: true}]})", `"{\"v\":[1,{\"v\":true}]}"`},
+		{"let f = fn() { struct P { v }; P }; let P = f(); P{v: 1}", "P{v: 1}"},
+		{"struct Point { x, y }; let p = Point{x: 1, y: 2};\np.z", `ERROR("struct Point has no field z") at 2:2`},
+		{"struct Point { x, y }; Point{x: 1, z: 2}", `ERROR("struct Point has no field z") at 1:29`},
+		{"struct Point { x, y }; Point{x: 1, x: 2}", `ERROR("field x of struct Point is given twice") at 1:29`},
+		{"struct Point { x, y }; Point{x: 1}", `ERROR("missing field y of struct Point") at 1:29`},
+		{"let h = {}; h{x: 1}", `ERROR("h is not a struct type, but hash") at 1:14`},
+		{"[1].x", `ERROR("array has no member x") at 1:4`},
+		{"let s = \"a\"; s.x = 1", `ERROR("cannot set field x of string") at 1:18`},
+		{"struct P { v }; let p = P{v: 1}; p.w = 1", `ERROR("struct P has no field w") at 1:38`},
+		{"struct P { x }; let p = P{x: 1}; p.x = p; p", "P{x: <cycle>}"},
+		{"struct P { x }; let p = P{x: 1}; p.x = [p, {\"k\": p}]; [p, p.x]", `[P{x: [<cycle>, {"k": <cycle>}]}, [P{x: [<cycle>, {"k": <cycle>}]}, {"k": P{x: [<cycle>, {"k": <cycle>}]}}]]`},
+		{"struct P { x }; let p = P{x: 1}; let q = P{x: p}; [q, q]", "[P{x: P{x: 1}}, P{x: P{x: 1}}]"},
+		{"struct P { x }; let p = P{x: 1}; p.x = p; let q = P{x: 1}; q.x = q; [p == q, p != q]", "[true, false]"},
+		{"struct P { x, y }; let p = P{x: 1, y: 1}; p.x = p; let q = P{x: 1, y: 2}; q.x = q; p == q", "false"},
+		{"struct P { x }; let p = P{x: 1}; let q = P{x: p}; p.x = q; p == q", "true"},
+		{"struct P { x }; let p = P{x: 1}; p.x = p; try { throw error(\"e\", p) } catch (e) { e }", `error("e", P{x: <cycle>})`},
+	}
+
+	for _, tt := range tests {
+		eval := testEval(tt.in)
+		if eval.Inspect() != tt.out {
+			t.Errorf("wrong result for %q. expected: %s, got: %s", tt.in, tt.out, eval.Inspect())
+		}
+	}
+}
+
+func TestMethods(t *testing.T) {
+	tests := []struct {
+		in  string
+		out string
+	}{
+		{`"héllo".len()`, "5"},
+		{`"Hello".upper() + "Hello".lower()`, `"HELLOhello"`},
+		{`"  a b ".trim().split(" ")`, `["a", "b"]`},
+		{`"a,b,,c".split(",")`, `["a", "b", "", "c"]`},
+		{`let s = "monkey"; [s.contains("key"), s.starts_with("mon"), s.ends_with("mon")]`, "[true, true, false]"},
+		{`"ab".repeat(3)`, `"ababab"`},
+		{`"ab".repeat(-1)`, `ERROR("argument of repeat must be a non-negative integer, got -1") at 1:5`},
+		{`"ab".repeat(5000000000000000000)`, `ERROR("result of repeat would be longer than 67108864 bytes") at 1:5`},
+		{`"é".repeat(33554433)`, `ERROR("result of repeat would be longer than 67108864 bytes") at 1:5`},
+		{`["".repeat(9223372036854775807), "é".repeat(2)]`, `["", "éé"]`},
+		{`"ab".split(1)`, `ERROR("argument of split must be a string, got integer") at 1:5`},
+		{`"ab".upper(1)`, `ERROR("wrong number of arguments for upper: expected 0, got 1") at 1:5`},
+		{`"ab".upper`, "builtin upper"},
+		{`let up = "ab".upper; up()`, `"AB"`},
+		{"[1, 2, 3].len()", "3"},
+		{"[[1, 2, 3].first(), [1, 2, 3].last(), [].first(), [1, 2, 3].rest(), [].rest()]", "[1, 3, null, [2, 3], []]"},
+		{"let a = [1]; let b = a.push(2); [a, b, b.concat([3, 4]).reverse()]", "[[1], [1, 2], [4, 3, 2, 1]]"},
+		{`[1, "a", true].join(", ")`, `"1, a, true"`},
+		{`[[1, 2].contains(2), [1, 2].contains(3), [1, "2"].contains("2"), [[1]].contains([1])]`, "[true, false, true, false]"},
+		{"[1].concat(2)", `ERROR("argument of concat must be an array, got integer") at 1:4`},
+		{`let h = {"a": 1, "b": 2}; [h.len(), h.keys(), h.values(), h.has("a"), h.has("c")]`, `[2, ["a", "b"], [1, 2], true, false]`},
+		{`let h = {"a": 1}; [h.get("a"), h.get("b"), h.get("b", 0)]`, "[1, null, 0]"},
+		{`let h = {"a": 1}; [h.set("b", 2), h.set("a", 3), h.delete("a"), h]`, `[{"a": 1, "b": 2}, {"a": 3}, {}, {"a": 1}]`},
+		{`{}.get([1])`, `ERROR("unusable as hash key: array") at 1:3`},
+		{`{}.get()`, `ERROR("wrong number of arguments for get: expected 1 or 2, got 0") at 1:3`},
+		{"struct P { v, f }; let p = P{v: 2, f: fn(x) { x * 10 }}; p.f(p.v)", "20"},
+		{"1.len()", `ERROR("integer has no member len") at 1:2`},
+		{`"a".size()`, `ERROR("string has no member size") at 1:4`},
+		{`"a".upper(case: 1)`, `ERROR("builtin upper does not take named arguments") at 1:4`},
+		{"let f = fn(s) { s.trim().upper() }; f(\" x \")", `"X"`},
+	}
+
+	for _, tt := range tests {
+		eval := testEval(tt.in)
+		if eval.Inspect() != tt.out {
+			t.Errorf("wrong result for %q. expected: %s, got: %s", tt.in, tt.out, eval.Inspect())
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	tests := []struct {
+		in  string
+		out string
+	}{
+		{`json_encode({"a": [1, true, {}["none"], "x"], "b": {}})`, `"{\"a\":[1,true,null,\"x\"],\"b\":{}}"`},
+		{`json_encode({1: "<one>", true: -2})`, `"{\"1\":\"<one>\",\"true\":-2}"`},
+		{`json_encode({1: "a", "1": "b"})`, `ERROR("hash keys 1 and \"1\" both become the JSON key \"1\"") at 1:1`},
+		{`json_encode([{"true": 1, true: 2}])`, `ERROR("hash keys \"true\" and true both become the JSON key \"true\"") at 1:1`},
+		{`json_encode([1, [2]], 2)`, `"[\n  1,\n  [\n    2\n  ]\n]"`},
+		{`json_encode(fn(x) { x })`, `ERROR("cannot encode function as JSON") at 1:1`},
+		{`json_encode([1, error("e")])`, `ERROR("cannot encode error value as JSON") at 1:1`},
+		{`json_encode(1, -1)`, `ERROR("second argument of json_encode must be a non-negative integer, got -1") at 1:1`},
+
+		{`json_decode("{\"b\": 1, \"a\": [true, null, \"s\"]}")`, `{"b": 1, "a": [true, null, "s"]}`},
+		{`json_decode("{\"a\": 1, \"a\": 2}")["a"]`, "2"},
+		{`json_decode(" 12 ")`, "12"},
+		{`json_decode("[1.0, 2e3, -0.0]")`, "[1, 2000, 0]"},
+		{`json_decode("1.5")`, `ERROR("JSON number 1.5 is not an integer") at 1:1`},
+		{`json_decode("-1.5", "truncate")`, "-1"},
+		{`json_decode("[1.5, 7]", "string")`, `["1.5", 7]`},
+		{`json_decode("1e30", "truncate")`, `ERROR("JSON number 1e30 is out of the range of integers") at 1:1`},
+		{`json_decode("1", "round")`, `ERROR("second argument of json_decode must be \"error\", \"truncate\" or \"string\", got \"round\"") at 1:1`},
+		{`json_decode("[1, 2")`, `ERROR("invalid JSON: unexpected end of JSON input") at 1:1`},
+		{`json_decode("{} {}")`, `ERROR("invalid JSON: unexpected data after the value") at 1:1`},
+		{`json_decode("{'a': 1}")`, `ERROR("invalid JSON: invalid character '\\'' looking for beginning of value") at 1:1`},
+
+		{`let v = {"list": [1, 2], "name": "monkey", "ok": false}; json_encode(json_decode(json_encode(v))) == json_encode(v)`, "true"},
+	}
+
+	for _, tt := range tests {
+		eval := testEval(tt.in)
+		if eval.Inspect() != tt.out {
+			t.Errorf("wrong result for %q. expected: %s, got: %s", tt.in, tt.out, eval.Inspect())
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	describe := `let describe = fn(x) {
+		match (x) {
+			0 => "zero",
+			"hi" => "greeting",
+			true => "yes",
+			-1 => "minus one",
+			[] => "empty",
+			[a] => "one element",
+			[0, ...rest] => rest,
+			[n, "big"] if n > 100 => "big",
+			[a, b] if a == b => "pair of equals",
+			[a, b] => "pair",
+			{"kind": "circle", r} => r * r * 3,
+			{"kind": "square", "side": [s]} => s * s,
+			_ => "something else"
+		}
+	}; `
+
+	tests := []struct {
+		in  string
+		out string
+	}{
+		{`describe(0)`, `"zero"`},
+		{`describe("hi")`, `"greeting"`},
+		{`describe(true)`, `"yes"`},
+		{`describe(-1)`, `"minus one"`},
+		{`describe([])`, `"empty"`},
+		{`describe([5])`, `"one element"`},
+		{`describe([0, 1, 2])`, "[1, 2]"},
+		{`describe([0, 1])`, "[1]"},
+		{`describe([3, 3])`, `"pair of equals"`},
+		{`describe([3, 4])`, `"pair"`},
+		{`describe({"kind": "circle", "r": 2})`, "12"},
+		{`describe({"r": 2, "kind": "square", "side": [3]})`, "9"},
+		{`describe({"kind": "square", "side": 3})`, `"something else"`},
+		{`describe([101, "big"])`, `"big"`},
+		{`describe(false)`, `"something else"`},
+		{`describe(fn(x) { x })`, `"something else"`},
+	}
+
+	for _, tt := range tests {
+		eval := testEval(describe + tt.in)
+		if eval.Inspect() != tt.out {
+			t.Errorf("wrong result for %q. expected: %s, got: %s", tt.in, tt.out, eval.Inspect())
+		}
+	}
+}
+
+func TestMatchScopes(t *testing.T) {
+	tests := []struct {
+		in  string
+		out string
+	}{
+		// bindings don't leak out of the arm, not even from arms that failed
+		{`let a = 1; match ([2, 3]) { [a, 4] => a, [b, c] => a }`, "1"},
+		{`let a = 1; match (5) { a => a }; a`, "1"},
+		{`let f = match (2) { n => fn(x) { x * n } }; f(21)`, "42"},
+		{`match (1) { 2 => "two" }`, `ERROR("no match arm matches 1") at 1:1`},
+		{`match ([1, 2]) { [a] => a, {a} => a }`, `ERROR("no match arm matches [1, 2]") at 1:1`},
+		{`try { match ("x") { 1 => 1 } } catch (e) { e["message"] }`, `"no match arm matches \"x\""`},
+		{`match (1) { x if y => 1 }`, `ERROR("unknown identifier: y") at 1:18`},
+	}
+
+	for _, tt := range tests {
+		eval := testEval(tt.in)
+		if eval.Inspect() != tt.out {
+			t.Errorf("wrong result for %q. expected: %s, got: %s", tt.in, tt.out, eval.Inspect())
+		}
+	}
+}
+
+func TestDestructuring(t *testing.T) {
+	tests := []struct {
+		in  string
+		out string
+	}{
+		{"let [a, b] = [1, 2]; a + b", "3"},
+		{"let [a, b, ...rest] = [1, 2, 3, 4]; rest", "[3, 4]"},
+		{"let [a, b, ...rest] = [1, 2]; rest", "[]"},
+		{"let [a, b = a * 10] = [1]; b", "10"},
+		{"let [a, b = 10, ...rest] = [1]; [a, b, rest]", "[1, 10, []]"},
+		{"let [a, [b, c]] = [1, [2, 3]]; a + b + c", "6"},
+		{"let [_, x] = [1, 2]; x", "2"},
+		{`let {name, age} = {"age": 30, "name": "ann"}; name`, `"ann"`},
+		{`let {name, age = 18} = {"name": "bob"}; age`, "18"},
+		{`let {"address": {city}} = {"address": {"city": "Jakarta"}}; city`, `"Jakarta"`},
+		{"let minmax = fn(a, b) { if (a < b) { return a, b } return b, a }; let [lo, hi] = minmax(5, 3); hi - lo", "2"},
+		{"let f = fn() { return 1, 2 }; f()", "[1, 2]"},
+	}
+
+	for _, tt := range tests {
+		eval := testEval(tt.in)
+		if eval.Inspect() != tt.out {
+			t.Errorf("wrong result for %q. expected: %s, got: %s", tt.in, tt.out, eval.Inspect())
+		}
+	}
+}
+
+func TestDestructuringErrors(t *testing.T) {
+	tests := []struct {
+		in  string
+		msg string
+	}{
+		{"let [a, b] = [1, 2, 3]", "cannot destructure [1, 2, 3] with [a, b]: expected an array of 2 elements, got 3"},
+		{"let [a, b] = [1]", "cannot destructure [1] with [a, b]: expected an array of 2 elements, got 1"},
+		{"let [a, b = 1] = [1, 2, 3]", "cannot destructure [1, 2, 3] with [a, b = 1]: expected an array of at most 2 elements, got 3"},
+		{"let [a, b, ...c] = [1]", "cannot destructure [1] with [a, b, ...c]: expected an array of at least 2 elements, got 1"},
+		{"let [a] = 5", "cannot destructure 5 with [a]: expected an array, got integer"},
+		{"let [a, [b]] = [1, 2]", "cannot destructure [1, 2] with [a, [b]]: element 1: expected an array, got integer"},
+		{`let {name} = {"age": 1}`, `cannot destructure {"age": 1} with {"name": name}: missing key "name"`},
+		{`let {a: [x]} = {"a": []}`, `cannot destructure {"a": []} with {"a": [x]}: key "a": expected an array of 1 elements, got 0`},
+		{"let [a = foo] = []", "unknown identifier: foo"},
+	}
+
+	for _, tt := range tests {
+		eval := testEval(tt.in)
+		if e, ok := eval.(*object.Error); !ok {
+			t.Errorf("result is not error. got: %v", eval)
+		} else {
+			if e.Message != tt.msg {
+				t.Errorf("error message is wrong. expected: %q, got: %q", tt.msg, e.Message)
+			}
+		}
+	}
+}
+
+func TestParameters(t *testing.T) {
+	tests := []struct {
+		in  string
+		out string
+	}{
+		{"let f = fn(a, b = 10) { a + b }; f(1)", "11"},
+		{"let f = fn(a, b = 10) { a + b }; f(1, 2)", "3"},
+		{"let f = fn(a, b = a * 2) { b }; f(4)", "8"},
+		{"let n = 1; let f = fn(a = n) { a }; let n = 5; f()", "5"},
+		{"let f = fn(a, ...rest) { rest }; f(1, 2, 3)", "[2, 3]"},
+		{"let f = fn(a, ...rest) { rest }; f(1)", "[]"},
+		{"let f = fn(a, b, c) { [a, b, c] }; let args = [1, 2]; f(...args, 3)", "[1, 2, 3]"},
+		{"let f = fn(a, b, c) { [a, b, c] }; f(0, ...[1, 2])", "[0, 1, 2]"},
+		{"let f = fn(a, b = 2, c = 3) { [a, b, c] }; f(1, c: 30)", "[1, 2, 30]"},
+		{"let f = fn(a, b) { a - b }; f(b: 1, a: 10)", "9"},
+		{"let f = fn(...xs) { xs }; f(...[1], ...[2, 3])", "[1, 2, 3]"},
+		{"[0, ...[1, 2], 3]", "[0, 1, 2, 3]"},
+		{`let f = fn(a, b = 2) {}; f`, "fn (a, b = 2) {}"},
+		// annotations are left to the type checker
+		{"let f = fn(a: int, b: int = 2, ...r: [int]) -> int { a + b }; let x: int = f(1); x", "3"},
+	}
+
+	for _, tt := range tests {
+		eval := testEval(tt.in)
+		if eval.Inspect() != tt.out {
+			t.Errorf("wrong result for %q. expected: %s, got: %s", tt.in, tt.out, eval.Inspect())
+		}
+	}
+}
+
+func TestArityErrors(t *testing.T) {
+	tests := []struct {
+		in  string
+		msg string
+	}{
+		{"let f = fn(a, b) { a }; f(1, 2, 3)", "too many arguments for fn(a, b): expected 2, got 3"},
+		{"let f = fn(a, b = 1, ...c) { a }; f()", "missing argument a for fn(a, b = 1, ...c)"},
+		{"let f = fn(a, b) { a }; f(1)", "missing argument b for fn(a, b)"},
+		{"let f = fn(a) { a }; f(b: 1)", "unknown parameter b for fn(a)"},
+		{"let f = fn(a) { a }; f(1, a: 1)", "parameter a of fn(a) is given twice"},
+		{"let f = fn(a) { a }; f(...1)", "cannot spread integer, only arrays"},
+		{"let f = fn(a = foo) { a }; f()", "unknown identifier: foo"},
+		{`error(message: "x")`, "builtin error does not take named arguments"},
+	}
+
+	for _, tt := range tests {
+		eval := testEval(tt.in)
+		if e, ok := eval.(*object.Error); !ok {
+			t.Errorf("result is not error. got: %v", eval)
+		} else {
+			if e.Message != tt.msg {
+				t.Errorf("error message is wrong. expected: %q, got: %q", tt.msg, e.Message)
+			}
+		}
+	}
+}
+
+func TestTailCalls(t *testing.T) {
+	tests := []struct {
+		in  string
+		out string
+	}{
+		{"let loop = fn(n) { if (n == 0) { 0 } else { loop(n - 1) } }; loop(100000)", "0"},
+		{"let sum = fn(n, acc) { if (n == 0) { return acc } return sum(n - 1, acc + n) }; sum(100000, 0)", "5000050000"},
+		{"let count = fn(n, acc = 0) { match (n) { 0 => acc, _ => count(n - 1, acc: acc + 1) } }; count(100000)", "100000"},
+		{`let isEven = fn(n) { if (n == 0) { true } else { isOdd(n - 1) } };
+		  let isOdd = fn(n) { if (n == 0) { false } else { isEven(n - 1) } };
+		  isEven(100001)`, "false"},
+		{"let f = fn(n) { try { if (n == 0) { throw \"done\" } else { f(n - 1) } } catch (e) { n } }; f(10)", "0"},
+		{"let id = fn(x) { x }; let f = fn() { let x = id(1); id(x + 1) }; f()", "2"},
+	}
+
+	for _, tt := range tests {
+		// the depth limit makes sure the tail calls don't pile up
+		c := NewContext(context.Background(), Limits{MaxDepth: 100})
+		eval, err := testEvalContext(c, tt.in)
+		if err != nil {
+			t.Errorf("unexpected error for %q: %s", tt.in, err)
+			continue
+		}
+		if eval.Inspect() != tt.out {
+			t.Errorf("wrong result for %q. expected: %s, got: %s", tt.in, tt.out, eval.Inspect())
+		}
+	}
+}
+
+func TestTailCallStack(t *testing.T) {
+	in := "let g = fn(x) {\n throw x\n}\nlet f = fn(x) { g(x) }\ntry { f(1) } catch (e) { e[\"stack\"] }"
+
+	eval := testEval(in)
+	if eval.Inspect() != `["g (2:2)", "<program> (5:7)"]` {
+		t.Errorf("wrong stack. got: %s", eval.Inspect())
+	}
+}
+
+func TestNull(t *testing.T) {
+	tests := []struct {
+		in  string
+		out string
+	}{
+		{"null", "null"},
+		{"[null == null, null != null, 1 == null, null != [1], if (false) { 1 } == null]", "[true, false, false, true, true]"},
+		{`[null ?? 1, 2 ?? missing, false ?? 3, "" ?? 4]`, `[1, 2, false, ""]`},
+		{`let h = {"a": null}; h["a"] ?? h["b"] ?? 5`, "5"},
+		{"let a = null; a?.b.c(1)[2]", "null"},
+		{"let a = null; [a?[missing()], a?.b ?? 1]", "[null, 1]"},
+		{`let h = {"a": null}; [h["a"]?.len(), h?["a"], "ab"?.len(), [1, 2]?[1]]`, "[null, null, 2, 2]"},
+		{`let h = {"a": null}; h["a"].len()`, `ERROR("null has no member len") at 1:28`},
+		{"let a = null; a?.b.c + 1", "1"},
+		{"struct P { next }; let p = P{next: null}; [p.next?.next, p?.next]", "[null, null]"},
+		{"(null?.x).y", `ERROR("null has no member y") at 1:10`},
+		{"let a = null; [(a?.b), (a?[0]) ?? 2, (a?.b)?.c, (a?.b.c(1))]", "[null, 2, null, null]"},
+		{"let a = null; (a?.f)()", `ERROR("non callable object is used: null") at 1:17`},
+		{"let a = null; (a?.b.c)[0]", `ERROR("cannot index null with integer") at 1:23`},
+		{"match (null) { null => 1, _ => 2 }", "1"},
+		{"match (0) { null => 1, _ => 2 }", "2"},
+	}
+
+	for _, tt := range tests {
+		eval := testEval(tt.in)
+		if eval.Inspect() != tt.out {
+			t.Errorf("wrong result for %q. expected: %s, got: %s", tt.in, tt.out, eval.Inspect())
+		}
+	}
+}
+
+func TestBlockScope(t *testing.T) {
+	tests := []struct {
+		in            string
+		out           string
+		functionScope string // the result with parser.Parser.FunctionScope set
+	}{
+		{"let x = 1; if (true) { let x = 2 }; x", "1", "2"},
+		{"if (true) { let y = 2 }; y", `ERROR("unknown identifier: y") at 1:26`, "2"},
+		{"let f = fn(c) { if (c) { let x = 2 } else { let x = 3 } x }; let x = 1; [f(true), f(false)]", "[1, 1]", "[2, 3]"},
+		{"let x = 1; if (true) { let x = x + 1; if (x > 1) { let x = x * 10; [x] } }", "[20]", "[20]"},
+		{"let x = 1; try { let x = 2; throw x } catch (e) { x }", "1", "2"},
+		{"let x = 1; try { 0 } finally { let x = 2 }; x", "1", "2"},
+		{"let f = fn() { let g = if (true) { let x = 1; fn() { x } }; let x = 2; g() }; f()", "1", "2"},
+		{"let collect = fn(n, acc) { if (n == 0) { acc } else { let m = n; collect(n - 1, acc.push(fn() { m })) } }; let fs = collect(3, []); [fs[0](), fs[1](), fs[2]()]", "[3, 2, 1]", "[3, 2, 1]"},
+		{"let f = fn() { if (true) { let g = fn() { h() }; let h = fn() { 5 }; g() } }; f()", "5", "5"},
+	}
+
+	for _, tt := range tests {
+		for _, functionScope := range []bool{false, true} {
+			p := parser.New(lexer.New(tt.in))
+			p.FunctionScope = functionScope
+			prog := p.Parse()
+			resolver.Resolve(prog)
+			want := tt.out
+			if functionScope {
+				want = tt.functionScope
+			}
+			if got := Eval(prog, object.NewEnvironment()).Inspect(); got != want {
+				t.Errorf("wrong result for %q with FunctionScope %t. expected: %s, got: %s", tt.in, functionScope, want, got)
+			}
+		}
+	}
+}
+
+func TestFunctionStatements(t *testing.T) {
+	tests := []struct {
+		in  string
+		out string
+	}{
+		{"isEven(10); fn isEven(n) { if (n == 0) { true } else { isOdd(n - 1) } }; fn isOdd(n) { if (n == 0) { false } else { isEven(n - 1) } }; [isEven(7), isOdd(7)]", "[false, true]"},
+		{"fn add(a, b) { a + b }", "fn (a, b) {(a + b);}"},
+		{"let f = fn(x) { let r = g(x); fn g(y) { y * 2 } r }; f(4)", "8"},
+		{"let x = if (true) { h() ; fn h() { 1 } } else { 0 }; [x, h]", `ERROR("unknown identifier: h") at 1:58`},
+		{"fn f() { 1 }; let g = f; fn f() { 2 }; g()", `ERROR("fn f clashes with another declaration of f in its block") at 1:1`},
+		{"fn f() { 1 }; let f = 3; f", `ERROR("fn f clashes with another declaration of f in its block") at 1:1`},
+		{"const f = fn() { 1 }; fn f() { 2 }; f()", `ERROR("fn f clashes with another declaration of f in its block") at 1:23`},
+		{"1; struct f { x }; fn f() { 2 }", `ERROR("fn f clashes with another declaration of f in its block") at 1:20`},
+		{"let g = fn() { let [a, ...f] = [1]; fn f() { 2 } }; g()", `ERROR("fn f clashes with another declaration of f in its block") at 1:37`},
+		{"let f = 1; let g = if (true) { fn f() { 2 } f() }; [f, g]", "[1, 2]"},
+		{"fn f() { fail }; 1", "1"},
+	}
+
+	for _, tt := range tests {
+		eval := testEval(tt.in)
+		if eval.Inspect() != tt.out {
+			t.Errorf("wrong result for %q. expected: %s, got: %s", tt.in, tt.out, eval.Inspect())
+		}
+	}
+
+	// names bound by const earlier, as in the REPL, cannot be taken by a fn statement
+	env := object.NewEnvironment()
+	for _, in := range []string{"const f = 1", "fn f() { 2 }"} {
+		prog := parser.New(lexer.New(in)).Parse()
+		resolver.Resolve(prog)
+		if res := Eval(prog, env); in == "fn f() { 2 }" && res.Inspect() != `ERROR("cannot rebind const f") at 1:1` {
+			t.Errorf("expected f to stay bound by const. got: %s", res.Inspect())
+		}
+	}
+}
+
+func TestResolvedAndDynamicLookup(t *testing.T) {
+	// resolving names must not change what they mean
+	tests := []string{
+		"let x = 1; let f = fn() { let y = x; let x = 2; [x, y] }; f()",
+		"let x = 1; let f = fn(c) { if (c) { let x = 2 } x }; [f(true), f(false)]",
+		"let x = 1; let f = fn(c) { let g = fn() { x }; if (c) { let x = 2 } g() }; [f(true), f(false)]",
+		"let make = fn(n) { fn(m) { n + m } }; let addTwo = make(2); addTwo(3)",
+		"let f = fn(a, b = a + 1, ...r) { [a, b, r] }; [f(1), f(1, 5, 6)]",
+		"let f = fn(x) { match (x) { [a, ...r] => fn() { a + len(r) }, a => fn() { a } } }; let len = fn(xs) { 10 }; [f([1])(), f(7)()]",
+		"let f = fn() { try { throw 1 } catch (e) { let g = fn() { e[\"data\"] }; g() } }; f()",
+		"let f = fn(n) { if (n == 0) { 0 } else { let m = n - 1; f(m) } }; f(10)",
+		"match ([1, 2]) { [a, b] => a + b }",
+		"let a = 5; match (1) { a => a }; a",
+	}
+
+	for _, in := range tests {
+		dynamic := Eval(parser.New(lexer.New(in)).Parse(), object.NewEnvironment())
+		resolved := testEval(in)
+		if dynamic.Inspect() != resolved.Inspect() {
+			t.Errorf("different results for %q. dynamic: %s, resolved: %s", in, dynamic.Inspect(), resolved.Inspect())
+		}
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	env := object.NewEnvironment()
+	run := func(in string) string {
+		prog := parser.New(lexer.New(in)).Parse()
+		resolver.Resolve(prog)
+		return Eval(prog, env).Inspect()
+	}
+
+	run("let x = 1; let get = fn() { x }; let make = fn(n) { fn() { n + x } }; let add = make(10)")
+	snap := env.Snapshot()
+
+	run("let x = 2; let y = 3")
+	if got := run("[get(), add()]"); got != "[2, 12]" {
+		t.Fatalf("wrong result before restoring: %s", got)
+	}
+
+	if err := env.Restore(snap); err != nil {
+		t.Fatal(err)
+	}
+	if got := run("[get(), add()]"); got != "[1, 11]" {
+		t.Errorf("closures do not see the restored bindings: %s", got)
+	}
+	if got := run("y"); got != `ERROR("unknown identifier: y") at 1:1` {
+		t.Errorf("names bound after the snapshot are still there: %s", got)
+	}
+
+	if err := object.NewEnvironment().Restore(snap); err == nil {
+		t.Errorf("expected an error restoring the snapshot of another environment")
+	}
+}
+
+func benchmarkEval(b *testing.B, in string, resolve bool) {
+	prog := parser.New(lexer.New(in)).Parse()
+	if resolve {
+		resolver.Resolve(prog)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Eval(prog, object.NewEnvironment())
+	}
+}
+
+func BenchmarkLookup(b *testing.B) {
+	fib := "let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(15)"
+	nested := `let f = fn(a, b, c, d) {
+		let g = fn(e) { a + b + c + d + e };
+		let h = fn(n, acc) { if (n == 0) { acc } else { h(n - 1, acc + g(n)) } };
+		h(500, 0)
+	}; f(1, 2, 3, 4)`
+
+	b.Run("fib/map", func(b *testing.B) { benchmarkEval(b, fib, false) })
+	b.Run("fib/slots", func(b *testing.B) { benchmarkEval(b, fib, true) })
+	b.Run("closures/map", func(b *testing.B) { benchmarkEval(b, nested, false) })
+	b.Run("closures/slots", func(b *testing.B) { benchmarkEval(b, nested, true) })
+}
@@ -0,0 +1,60 @@
+package evaluator
+
+import (
+	"ast"
+	"object"
+)
+
+// throw turns a value thrown by the script into an Error.
+// Error values keep the position and stack of their first throw.
+func throw(value object.Object) *object.Error {
+	switch value := value.(type) {
+	case *object.ErrorValue:
+		return value.Err
+	case *object.String:
+		return &object.Error{Message: value.Value, Data: value}
+	default:
+		return &object.Error{Message: value.Inspect(), Data: value}
+	}
+}
+
+func evalTry(c *Context, node *ast.TryExpression, env *object.Environment) object.Object {
+	res := eval(c, node.Body, env)
+
+	if err, ok := res.(*object.Error); ok && node.Catch != nil {
+		scope := env.NewFrame(node.CatchLocals)
+		scope.Set(node.CatchParam.Name, c.alloc(&object.ErrorValue{Err: err}))
+		res = eval(c, node.Catch, scope)
+	}
+
+	if node.Finally != nil {
+		// the finally block only changes the outcome if it fails or returns itself
+		fin := eval(c, node.Finally, env)
+		if fin.Type() == object.TYPE_ERROR || fin.Type() == object.TYPE_RETURN {
+			return fin
+		}
+	}
+
+	return res
+}
+
+// errorField implements indexing of an error value.
+func errorField(c *Context, err *object.Error, name string) object.Object {
+	switch name {
+	case "message":
+		return c.alloc(&object.String{Value: err.Message})
+	case "position":
+		return c.alloc(&object.String{Value: err.Position.String()})
+	case "stack":
+		stack := []object.Object{}
+		for _, s := range err.Stack {
+			stack = append(stack, c.alloc(&object.String{Value: s}))
+		}
+		return c.alloc(&object.Array{Elements: stack})
+	case "data":
+		if err.Data != nil {
+			return err.Data
+		}
+	}
+	return object.NULL
+}
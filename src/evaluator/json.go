@@ -0,0 +1,272 @@
+package evaluator
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math"
+	"object"
+	"strconv"
+	"strings"
+)
+
+// json_encode(value, indent) turns value into JSON text, indented by indent spaces if it is given.
+// Hash keys that are integers or booleans become strings, as JSON only has string keys,
+// so a hash with keys such as 1 and "1", which would become the same one, cannot be encoded.
+func builtinJSONEncode(args ...object.Object) object.Object {
+	if len(args) < 1 || len(args) > 2 {
+		return newError("wrong number of arguments for json_encode: expected 1 or 2, got %d", len(args))
+	}
+
+	indent := 0
+	if len(args) == 2 {
+		n, ok := args[1].(*object.Integer)
+		if !ok || n.Value < 0 {
+			return newError("second argument of json_encode must be a non-negative integer, got %s", args[1].Inspect())
+		}
+		indent = int(n.Value)
+	}
+
+	e := &jsonEncoder{seen: map[object.Object]bool{}}
+	if err := e.encode(args[0]); err != nil {
+		return err
+	}
+
+	if indent > 0 {
+		out := bytes.Buffer{}
+		json.Indent(&out, e.buf.Bytes(), "", strings.Repeat(" ", indent))
+		return &object.String{Value: out.String()}
+	}
+	return &object.String{Value: e.buf.String()}
+}
+
+type jsonEncoder struct {
+	buf  bytes.Buffer
+	seen map[object.Object]bool // arrays, hashes and structs being encoded, to detect cycles
+}
+
+func (e *jsonEncoder) encode(value object.Object) *object.Error {
+	switch value := value.(type) {
+	case *object.Integer:
+		e.buf.WriteString(strconv.FormatInt(value.Value, 10))
+	case *object.Boolean:
+		e.buf.WriteString(strconv.FormatBool(value.Value))
+	case *object.Null:
+		e.buf.WriteString("null")
+	case *object.String:
+		e.writeString(value.Value)
+
+	case *object.Array:
+		if e.seen[value] {
+			return newError("cannot encode a cyclic value as JSON")
+		}
+		e.seen[value] = true
+		defer delete(e.seen, value)
+
+		e.buf.WriteByte('[')
+		for i, el := range value.Elements {
+			if i > 0 {
+				e.buf.WriteByte(',')
+			}
+			if err := e.encode(el); err != nil {
+				return err
+			}
+		}
+		e.buf.WriteByte(']')
+
+	case *object.Hash:
+		if e.seen[value] {
+			return newError("cannot encode a cyclic value as JSON")
+		}
+		e.seen[value] = true
+		defer delete(e.seen, value)
+
+		e.buf.WriteByte('{')
+		keys := map[string]object.Object{} // the keys of value by the JSON key they become
+		for i, hk := range value.Order {
+			pair := value.Pairs[hk]
+			if i > 0 {
+				e.buf.WriteByte(',')
+			}
+			name := pair.Key.Inspect()
+			if key, ok := pair.Key.(*object.String); ok {
+				name = key.Value
+			}
+			if other, ok := keys[name]; ok {
+				return newError("hash keys %s and %s both become the JSON key %s", other.Inspect(), pair.Key.Inspect(), strconv.Quote(name))
+			}
+			keys[name] = pair.Key
+			e.writeString(name)
+			e.buf.WriteByte(':')
+			if err := e.encode(pair.Value); err != nil {
+				return err
+			}
+		}
+		e.buf.WriteByte('}')
+
+	case *object.Struct:
+		if e.seen[value] {
+			return newError("cannot encode a cyclic value as JSON")
+		}
+		e.seen[value] = true
+		defer delete(e.seen, value)
+
+		e.buf.WriteByte('{')
+		for i, name := range value.StructType.Fields {
+			if i > 0 {
+				e.buf.WriteByte(',')
+			}
+			e.writeString(name)
+			e.buf.WriteByte(':')
+			if err := e.encode(value.Fields[i]); err != nil {
+				return err
+			}
+		}
+		e.buf.WriteByte('}')
+
+	default:
+		return newError("cannot encode %s as JSON", value.Type())
+	}
+	return nil
+}
+
+func (e *jsonEncoder) writeString(s string) {
+	enc := json.NewEncoder(&e.buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	e.buf.Truncate(e.buf.Len() - 1) // the newline added by Encode
+}
+
+// How json_decode treats numbers that are not integers, or too large for one.
+// Integral numbers such as 1.0 or 1e3 are always decoded as integers.
+const (
+	jsonNumbersError    = "error"    // fail, which is the default
+	jsonNumbersTruncate = "truncate" // drop the fractional part
+	jsonNumbersString   = "string"   // keep the number as written in a string
+)
+
+// json_decode(text, numbers) turns JSON text into monkey values. Objects become hashes
+// with their keys in the same order. numbers is one of "error", "truncate" or "string",
+// as monkey has no floating point numbers.
+func builtinJSONDecode(c *Context, args []object.Object) object.Object {
+	if len(args) < 1 || len(args) > 2 {
+		return newError("wrong number of arguments for json_decode: expected 1 or 2, got %d", len(args))
+	}
+
+	text, ok := args[0].(*object.String)
+	if !ok {
+		return newError("first argument of json_decode must be a string, got %s", args[0].Type())
+	}
+
+	numbers := jsonNumbersError
+	if len(args) == 2 {
+		mode, ok := args[1].(*object.String)
+		if !ok || (mode.Value != jsonNumbersError && mode.Value != jsonNumbersTruncate && mode.Value != jsonNumbersString) {
+			return newError(`second argument of json_decode must be "error", "truncate" or "string", got %s`, args[1].Inspect())
+		}
+		numbers = mode.Value
+	}
+
+	d := &jsonDecoder{c: c, dec: json.NewDecoder(strings.NewReader(text.Value)), numbers: numbers}
+	d.dec.UseNumber()
+
+	res, err := d.decode()
+	if err != nil {
+		return err
+	}
+	if _, e := d.dec.Token(); e != io.EOF {
+		return newError("invalid JSON: unexpected data after the value")
+	}
+	return res
+}
+
+// jsonDecoder decodes values for an evaluation with the Context c, whose limits count each of them.
+type jsonDecoder struct {
+	c       *Context
+	dec     *json.Decoder
+	numbers string
+}
+
+func (d *jsonDecoder) decode() (object.Object, *object.Error) {
+	tok, err := d.dec.Token()
+	if err == io.EOF {
+		return nil, newError("invalid JSON: unexpected end of input")
+	}
+	if err != nil {
+		return nil, newError("invalid JSON: %s", err)
+	}
+	d.c.step()
+
+	switch tok := tok.(type) {
+	case json.Delim:
+		switch tok {
+		case '[':
+			elements := []object.Object{}
+			for d.dec.More() {
+				el, err := d.decode()
+				if err != nil {
+					return nil, err
+				}
+				elements = append(elements, el)
+			}
+			if _, err := d.dec.Token(); err != nil {
+				return nil, newError("invalid JSON: unexpected end of input")
+			}
+			return d.c.alloc(&object.Array{Elements: elements}), nil
+
+		case '{':
+			hash := object.NewHash()
+			d.c.alloc(hash)
+			for d.dec.More() {
+				key, err := d.dec.Token()
+				if err != nil {
+					return nil, newError("invalid JSON: %s", err)
+				}
+				value, e := d.decode()
+				if e != nil {
+					return nil, e
+				}
+				k := &object.String{Value: key.(string)}
+				d.c.alloc(k)
+				hash.Set(k, value)
+			}
+			if _, err := d.dec.Token(); err != nil {
+				return nil, newError("invalid JSON: unexpected end of input")
+			}
+			return hash, nil
+		}
+
+	case string:
+		return d.c.alloc(&object.String{Value: tok}), nil
+	case bool:
+		return object.NativeBool(tok), nil
+	case nil:
+		return object.NULL, nil
+	case json.Number:
+		return d.number(tok)
+	}
+
+	return nil, newError("invalid JSON: unexpected %v", tok)
+}
+
+func (d *jsonDecoder) number(n json.Number) (object.Object, *object.Error) {
+	if i, err := strconv.ParseInt(string(n), 10, 64); err == nil {
+		return d.c.alloc(&object.Integer{Value: i}), nil
+	}
+
+	f, _ := strconv.ParseFloat(string(n), 64)
+	inRange := f >= math.MinInt64 && f < math.MaxInt64
+	if inRange && f == math.Trunc(f) {
+		return d.c.alloc(&object.Integer{Value: int64(f)}), nil
+	}
+
+	switch {
+	case d.numbers == jsonNumbersString:
+		return d.c.alloc(&object.String{Value: string(n)}), nil
+	case !inRange:
+		return nil, newError("JSON number %s is out of the range of integers", n)
+	case d.numbers == jsonNumbersTruncate:
+		return d.c.alloc(&object.Integer{Value: int64(f)}), nil
+	}
+	return nil, newError("JSON number %s is not an integer", n)
+}
@@ -0,0 +1,227 @@
+package evaluator
+
+import (
+	"ast"
+	"fmt"
+	"object"
+)
+
+func evalMatch(c *Context, node *ast.MatchExpression, env *object.Environment) object.Object {
+	subject := eval(c, node.Subject, env)
+	if subject.Type() == object.TYPE_ERROR {
+		return subject
+	}
+
+	for _, arm := range node.Arms {
+		// each arm gets its own scope so bindings of an arm that failed don't leak
+		scope := env.NewFrame(arm.Locals)
+
+		mismatch, err := matchPattern(c, arm.Pattern, subject, scope)
+		if err != nil {
+			return err
+		}
+		if mismatch != "" {
+			continue
+		}
+
+		if arm.Guard != nil {
+			guard := eval(c, arm.Guard, scope)
+			if guard.Type() == object.TYPE_ERROR {
+				return guard
+			}
+			pred, err := ToBool(guard)
+			if err != nil {
+				return err
+			}
+			if !pred {
+				continue
+			}
+		}
+
+		return eval(c, arm.Body, scope)
+	}
+
+	return newError("no match arm matches %s", subject.Inspect())
+}
+
+// matchPattern binds the parts of value to the names in pat, in env.
+// If the value does not have the shape of the pattern, mismatch describes why.
+func matchPattern(c *Context, pat ast.Pattern, value object.Object, env *object.Environment) (mismatch string, err object.Object) {
+	switch pat := pat.(type) {
+	case *ast.WildcardPattern:
+		return "", nil
+
+	case *ast.BindingPattern:
+		if err := bind(env, pat.Ident, value); err != nil {
+			return "", err
+		}
+		return "", nil
+
+	case *ast.LiteralPattern:
+		expected := eval(c, pat.Value, env)
+		if expected.Type() == object.TYPE_ERROR {
+			return "", expected
+		}
+		return MatchLiteral(expected, value), nil
+
+	case *ast.ArrayPattern:
+		hasDefault := func(i int) bool {
+			_, ok := pat.Elements[i].(*ast.DefaultPattern)
+			return ok
+		}
+		element := func(i int, v object.Object) (string, object.Object) {
+			if v == nil {
+				return matchDefault(c, pat.Elements[i].(*ast.DefaultPattern), env)
+			}
+			return matchPattern(c, pat.Elements[i], v, env)
+		}
+		rest, mismatch, err := MatchArray(value, len(pat.Elements), pat.Rest != nil, hasDefault, element)
+		if err != nil || mismatch != "" {
+			return mismatch, err
+		}
+
+		if pat.Rest != nil {
+			if err := bind(env, pat.Rest, c.alloc(&object.Array{Elements: rest})); err != nil {
+				return "", err
+			}
+		}
+		return "", nil
+
+	case *ast.HashPattern:
+		key := func(i int) object.Object {
+			return eval(c, pat.Pairs[i].Key, env)
+		}
+		hasDefault := func(i int) bool {
+			_, ok := pat.Pairs[i].Value.(*ast.DefaultPattern)
+			return ok
+		}
+		element := func(i int, v object.Object) (string, object.Object) {
+			if v == nil {
+				return matchDefault(c, pat.Pairs[i].Value.(*ast.DefaultPattern), env)
+			}
+			return matchPattern(c, pat.Pairs[i].Value, v, env)
+		}
+		return MatchHash(value, len(pat.Pairs), key, hasDefault, element)
+
+	case *ast.DefaultPattern:
+		// the value is there, so the default is not needed
+		return matchPattern(c, pat.Pattern, value, env)
+	}
+
+	return "", newError("unhandled pattern %T", pat)
+}
+
+// matchDefault matches the default value of pat, for an element which is missing.
+func matchDefault(c *Context, pat *ast.DefaultPattern, env *object.Environment) (mismatch string, err object.Object) {
+	value := eval(c, pat.Default, env)
+	if value.Type() == object.TYPE_ERROR {
+		return "", value
+	}
+	return matchPattern(c, pat.Pattern, value, env)
+}
+
+// MatchLiteral tells why value does not match a literal pattern of the value expected, if it does not.
+func MatchLiteral(expected object.Object, value object.Object) (mismatch string) {
+	if !literalEquals(expected, value) {
+		return fmt.Sprintf("expected %s, got %s", expected.Inspect(), value.Inspect())
+	}
+	return ""
+}
+
+// MatchArray matches value to an array pattern of n elements, followed by a rest if rest.
+// The elements for which hasDefault is true may be missing, but only at the end.
+// element matches element i of the pattern to v, or to its default if v is nil.
+// If the value matches, rest holds the elements left for the rest.
+func MatchArray(value object.Object, n int, rest bool, hasDefault func(i int) bool,
+	element func(i int, v object.Object) (mismatch string, err object.Object)) (restElements []object.Object, mismatch string, err object.Object) {
+	array, ok := value.(*object.Array)
+	if !ok {
+		return nil, fmt.Sprintf("expected an array, got %s", value.Type()), nil
+	}
+
+	// elements with a default may be missing, but only at the end
+	required := n
+	for required > 0 && hasDefault(required-1) {
+		required--
+	}
+
+	if !rest && required == n && len(array.Elements) != required {
+		return nil, fmt.Sprintf("expected an array of %d elements, got %d", required, len(array.Elements)), nil
+	}
+	if !rest && len(array.Elements) > n {
+		return nil, fmt.Sprintf("expected an array of at most %d elements, got %d", n, len(array.Elements)), nil
+	}
+	if len(array.Elements) < required {
+		return nil, fmt.Sprintf("expected an array of at least %d elements, got %d", required, len(array.Elements)), nil
+	}
+
+	for i := 0; i < n; i++ {
+		var v object.Object
+		if i < len(array.Elements) {
+			v = array.Elements[i]
+		}
+		if mismatch, err := element(i, v); err != nil || mismatch != "" {
+			return nil, prefixMismatch(fmt.Sprintf("element %d", i), mismatch), err
+		}
+	}
+
+	restElements = []object.Object{}
+	if len(array.Elements) > n {
+		restElements = append(restElements, array.Elements[n:]...)
+	}
+	return restElements, "", nil
+}
+
+// MatchHash matches value to a hash pattern of n keys, where key gives key i of the pattern.
+// The keys for which hasDefault is true may be missing.
+// element matches the value pattern of key i to v, or to its default if v is nil.
+func MatchHash(value object.Object, n int, key func(i int) object.Object, hasDefault func(i int) bool,
+	element func(i int, v object.Object) (mismatch string, err object.Object)) (mismatch string, err object.Object) {
+	hash, ok := value.(*object.Hash)
+	if !ok {
+		return fmt.Sprintf("expected a hash, got %s", value.Type()), nil
+	}
+
+	for i := 0; i < n; i++ {
+		k := key(i)
+		if k.Type() == object.TYPE_ERROR {
+			return "", k
+		}
+		hashable, ok := k.(object.Hashable)
+		if !ok {
+			return "", newError("unusable as hash key: %s", k.Type())
+		}
+
+		v, ok := hash.Get(hashable)
+		if !ok && !hasDefault(i) {
+			return fmt.Sprintf("missing key %s", k.Inspect()), nil
+		}
+		if mismatch, err := element(i, v); err != nil || mismatch != "" {
+			return prefixMismatch(fmt.Sprintf("key %s", k.Inspect()), mismatch), err
+		}
+	}
+	return "", nil
+}
+
+func prefixMismatch(where string, mismatch string) string {
+	if mismatch == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s: %s", where, mismatch)
+}
+
+// literalEquals compares values of the literal types, which are only equal to values of the same type.
+func literalEquals(a object.Object, b object.Object) bool {
+	if a == object.NULL || b == object.NULL {
+		return a == b
+	}
+	ha, ok := a.(object.Hashable)
+	if !ok {
+		return false
+	}
+	hb, ok := b.(object.Hashable)
+	if !ok {
+		return false
+	}
+	return ha.HashKey() == hb.HashKey()
+}
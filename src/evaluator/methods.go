@@ -0,0 +1,332 @@
+package evaluator
+
+import (
+	"object"
+	"strings"
+	"unicode/utf8"
+)
+
+// method is a function of the values of one type, called on one of them as receiver.name(args).
+type method func(c *Context, receiver object.Object, args []object.Object) object.Object
+
+// maxRepeatLength is the length in bytes of the longest string repeat makes. As the string is made
+// in one step, the limits of a Context would only see it once it takes all the memory it needs.
+const maxRepeatLength = 1 << 26
+
+// methods are the methods of each type, by name.
+var methods = map[object.Type]map[string]method{
+	object.TYPE_STRING: {
+		"len": func(c *Context, s object.Object, args []object.Object) object.Object {
+			if err := checkArgs("len", args, 0, 0); err != nil {
+				return err
+			}
+			return c.alloc(&object.Integer{Value: int64(utf8.RuneCountInString(s.(*object.String).Value))})
+		},
+		"upper": stringMethod("upper", strings.ToUpper),
+		"lower": stringMethod("lower", strings.ToLower),
+		"trim":  stringMethod("trim", strings.TrimSpace),
+		"split": func(c *Context, s object.Object, args []object.Object) object.Object {
+			sep, err := stringArg("split", args)
+			if err != nil {
+				return err
+			}
+			parts := []object.Object{}
+			for _, p := range strings.Split(s.(*object.String).Value, sep) {
+				parts = append(parts, c.alloc(&object.String{Value: p}))
+			}
+			return c.alloc(&object.Array{Elements: parts})
+		},
+		"contains":    stringPredicate("contains", strings.Contains),
+		"starts_with": stringPredicate("starts_with", strings.HasPrefix),
+		"ends_with":   stringPredicate("ends_with", strings.HasSuffix),
+		"repeat": func(c *Context, s object.Object, args []object.Object) object.Object {
+			if err := checkArgs("repeat", args, 1, 1); err != nil {
+				return err
+			}
+			n, ok := args[0].(*object.Integer)
+			if !ok || n.Value < 0 {
+				return newError("argument of repeat must be a non-negative integer, got %s", args[0].Inspect())
+			}
+			value := s.(*object.String).Value
+			if len(value) > 0 && n.Value > maxRepeatLength/int64(len(value)) {
+				return newError("result of repeat would be longer than %d bytes", maxRepeatLength)
+			}
+			return c.alloc(&object.String{Value: strings.Repeat(value, int(n.Value))})
+		},
+	},
+
+	object.TYPE_ARRAY: {
+		"len": func(c *Context, a object.Object, args []object.Object) object.Object {
+			if err := checkArgs("len", args, 0, 0); err != nil {
+				return err
+			}
+			return c.alloc(&object.Integer{Value: int64(len(a.(*object.Array).Elements))})
+		},
+		"first": func(c *Context, a object.Object, args []object.Object) object.Object {
+			if err := checkArgs("first", args, 0, 0); err != nil {
+				return err
+			}
+			if els := a.(*object.Array).Elements; len(els) > 0 {
+				return els[0]
+			}
+			return object.NULL
+		},
+		"last": func(c *Context, a object.Object, args []object.Object) object.Object {
+			if err := checkArgs("last", args, 0, 0); err != nil {
+				return err
+			}
+			if els := a.(*object.Array).Elements; len(els) > 0 {
+				return els[len(els)-1]
+			}
+			return object.NULL
+		},
+		"rest": func(c *Context, a object.Object, args []object.Object) object.Object {
+			if err := checkArgs("rest", args, 0, 0); err != nil {
+				return err
+			}
+			els := a.(*object.Array).Elements
+			if len(els) == 0 {
+				return c.alloc(&object.Array{Elements: []object.Object{}})
+			}
+			return c.alloc(&object.Array{Elements: append([]object.Object{}, els[1:]...)})
+		},
+		"push": func(c *Context, a object.Object, args []object.Object) object.Object {
+			if err := checkArgs("push", args, 1, 1); err != nil {
+				return err
+			}
+			els := a.(*object.Array).Elements
+			return c.alloc(&object.Array{Elements: append(append([]object.Object{}, els...), args[0])})
+		},
+		"concat": func(c *Context, a object.Object, args []object.Object) object.Object {
+			if err := checkArgs("concat", args, 1, 1); err != nil {
+				return err
+			}
+			other, ok := args[0].(*object.Array)
+			if !ok {
+				return newError("argument of concat must be an array, got %s", args[0].Type())
+			}
+			els := a.(*object.Array).Elements
+			return c.alloc(&object.Array{Elements: append(append([]object.Object{}, els...), other.Elements...)})
+		},
+		"join": func(c *Context, a object.Object, args []object.Object) object.Object {
+			sep, err := stringArg("join", args)
+			if err != nil {
+				return err
+			}
+			parts := []string{}
+			for _, el := range a.(*object.Array).Elements {
+				if s, ok := el.(*object.String); ok {
+					parts = append(parts, s.Value)
+				} else {
+					parts = append(parts, el.Inspect())
+				}
+			}
+			return c.alloc(&object.String{Value: strings.Join(parts, sep)})
+		},
+		"contains": func(c *Context, a object.Object, args []object.Object) object.Object {
+			if err := checkArgs("contains", args, 1, 1); err != nil {
+				return err
+			}
+			for _, el := range a.(*object.Array).Elements {
+				if equals(c, el, args[0]) {
+					return object.TRUE
+				}
+			}
+			return object.FALSE
+		},
+		"reverse": func(c *Context, a object.Object, args []object.Object) object.Object {
+			if err := checkArgs("reverse", args, 0, 0); err != nil {
+				return err
+			}
+			els := a.(*object.Array).Elements
+			res := make([]object.Object, len(els))
+			for i, el := range els {
+				res[len(els)-1-i] = el
+			}
+			return c.alloc(&object.Array{Elements: res})
+		},
+	},
+
+	object.TYPE_HASH: {
+		"len": func(c *Context, h object.Object, args []object.Object) object.Object {
+			if err := checkArgs("len", args, 0, 0); err != nil {
+				return err
+			}
+			return c.alloc(&object.Integer{Value: int64(len(h.(*object.Hash).Order))})
+		},
+		"keys": func(c *Context, h object.Object, args []object.Object) object.Object {
+			if err := checkArgs("keys", args, 0, 0); err != nil {
+				return err
+			}
+			hash := h.(*object.Hash)
+			keys := []object.Object{}
+			for _, hk := range hash.Order {
+				keys = append(keys, hash.Pairs[hk].Key)
+			}
+			return c.alloc(&object.Array{Elements: keys})
+		},
+		"values": func(c *Context, h object.Object, args []object.Object) object.Object {
+			if err := checkArgs("values", args, 0, 0); err != nil {
+				return err
+			}
+			hash := h.(*object.Hash)
+			values := []object.Object{}
+			for _, hk := range hash.Order {
+				values = append(values, hash.Pairs[hk].Value)
+			}
+			return c.alloc(&object.Array{Elements: values})
+		},
+		"has": func(c *Context, h object.Object, args []object.Object) object.Object {
+			if err := checkArgs("has", args, 1, 1); err != nil {
+				return err
+			}
+			key, err := hashKey(args[0])
+			if err != nil {
+				return err
+			}
+			_, ok := h.(*object.Hash).Get(key)
+			return object.NativeBool(ok)
+		},
+		"get": func(c *Context, h object.Object, args []object.Object) object.Object {
+			if err := checkArgs("get", args, 1, 2); err != nil {
+				return err
+			}
+			key, err := hashKey(args[0])
+			if err != nil {
+				return err
+			}
+			if value, ok := h.(*object.Hash).Get(key); ok {
+				return value
+			}
+			if len(args) == 2 {
+				return args[1]
+			}
+			return object.NULL
+		},
+		"set": func(c *Context, h object.Object, args []object.Object) object.Object {
+			if err := checkArgs("set", args, 2, 2); err != nil {
+				return err
+			}
+			key, err := hashKey(args[0])
+			if err != nil {
+				return err
+			}
+			res := copyHash(h.(*object.Hash), nil)
+			res.Set(key, args[1])
+			return c.alloc(res)
+		},
+		"delete": func(c *Context, h object.Object, args []object.Object) object.Object {
+			if err := checkArgs("delete", args, 1, 1); err != nil {
+				return err
+			}
+			key, err := hashKey(args[0])
+			if err != nil {
+				return err
+			}
+			return c.alloc(copyHash(h.(*object.Hash), key))
+		},
+	},
+}
+
+// evalMember gets the member name of left: one of its own, like the field of a struct,
+// or else a method of its type bound to it.
+func evalMember(c *Context, left object.Object, name string) object.Object {
+	if m, ok := left.(object.Members); ok {
+		if value, ok := m.Member(name); ok {
+			return value
+		}
+	}
+	if m, ok := methods[left.Type()][name]; ok {
+		return c.alloc(bindMethod(m, name, left))
+	}
+	if s, ok := left.(*object.Struct); ok {
+		return newError("struct %s has no field %s", s.StructType.Name, name)
+	}
+	return newError("%s has no member %s", left.Type(), name)
+}
+
+func bindMethod(m method, name string, receiver object.Object) *contextBuiltin {
+	return newContextBuiltin(name, func(c *Context, args []object.Object) object.Object {
+		return m(c, receiver, args)
+	})
+}
+
+// LookupMethod returns the method name of the type of receiver, bound to receiver,
+// for other ways of running programs.
+func LookupMethod(receiver object.Object, name string) (*object.Builtin, bool) {
+	m, ok := methods[receiver.Type()][name]
+	if !ok {
+		return nil, false
+	}
+	return &bindMethod(m, name, receiver).Builtin, true
+}
+
+func checkArgs(name string, args []object.Object, min int, max int) *object.Error {
+	if len(args) >= min && len(args) <= max {
+		return nil
+	}
+	switch {
+	case min == max:
+		return newError("wrong number of arguments for %s: expected %d, got %d", name, min, len(args))
+	case max == min+1:
+		return newError("wrong number of arguments for %s: expected %d or %d, got %d", name, min, max, len(args))
+	}
+	return newError("wrong number of arguments for %s: expected %d to %d, got %d", name, min, max, len(args))
+}
+
+// stringArg is the only argument of the method name, which must be a string.
+func stringArg(name string, args []object.Object) (string, *object.Error) {
+	if err := checkArgs(name, args, 1, 1); err != nil {
+		return "", err
+	}
+	s, ok := args[0].(*object.String)
+	if !ok {
+		return "", newError("argument of %s must be a string, got %s", name, args[0].Type())
+	}
+	return s.Value, nil
+}
+
+func stringMethod(name string, f func(string) string) method {
+	return func(c *Context, s object.Object, args []object.Object) object.Object {
+		if err := checkArgs(name, args, 0, 0); err != nil {
+			return err
+		}
+		return c.alloc(&object.String{Value: f(s.(*object.String).Value)})
+	}
+}
+
+func stringPredicate(name string, f func(string, string) bool) method {
+	return func(c *Context, s object.Object, args []object.Object) object.Object {
+		arg, err := stringArg(name, args)
+		if err != nil {
+			return err
+		}
+		return object.NativeBool(f(s.(*object.String).Value, arg))
+	}
+}
+
+// equals tells whether a == b. Values that cannot be compared are not equal.
+func equals(c *Context, a object.Object, b object.Object) bool {
+	return a.Type() == b.Type() && evalInfix(c, "==", a, b, nil) == object.TRUE
+}
+
+func hashKey(key object.Object) (object.Hashable, *object.Error) {
+	hashable, ok := key.(object.Hashable)
+	if !ok {
+		return nil, newError("unusable as hash key: %s", key.Type())
+	}
+	return hashable, nil
+}
+
+// copyHash copies h without the key without, if not nil.
+func copyHash(h *object.Hash, without object.Hashable) *object.Hash {
+	res := object.NewHash()
+	for _, hk := range h.Order {
+		if without != nil && hk == without.HashKey() {
+			continue
+		}
+		pair := h.Pairs[hk]
+		res.Set(pair.Key.(object.Hashable), pair.Value)
+	}
+	return res
+}
@@ -0,0 +1,130 @@
+package evaluator
+
+import (
+	"ast"
+	"object"
+)
+
+func evalStructStatement(c *Context, node *ast.StructStatement, env *object.Environment) object.Object {
+	st := &object.StructType{Name: node.Name.Name, Fields: node.Fields}
+	if err := bind(env, node.Name, st); err != nil {
+		return err
+	}
+	return c.alloc(st)
+}
+
+func evalStructLiteral(c *Context, node *ast.StructLiteral, env *object.Environment) object.Object {
+	typ := eval(c, node.Type, env)
+	if typ.Type() == object.TYPE_ERROR {
+		return typ
+	}
+	st, ok := typ.(*object.StructType)
+	if !ok {
+		return newError("%s is not a struct type, but %s", node.Type, typ.Type())
+	}
+
+	fields := make([]object.Object, len(st.Fields))
+	for _, f := range node.Fields {
+		i := st.Field(f.Name)
+		if i < 0 {
+			return newError("struct %s has no field %s", st.Name, f.Name)
+		}
+		if fields[i] != nil {
+			return newError("field %s of struct %s is given twice", f.Name, st.Name)
+		}
+		value := eval(c, f.Value, env)
+		if value.Type() == object.TYPE_ERROR {
+			return value
+		}
+		fields[i] = value
+	}
+	for i, value := range fields {
+		if value == nil {
+			return newError("missing field %s of struct %s", st.Fields[i], st.Name)
+		}
+	}
+
+	return c.alloc(&object.Struct{StructType: st, Fields: fields})
+}
+
+// evalAssign sets a field of a struct, which is the only thing that can be assigned to.
+func evalAssign(c *Context, node *ast.AssignStatement, env *object.Environment) object.Object {
+	left := eval(c, node.Target.Left, env)
+	if left.Type() == object.TYPE_ERROR {
+		return left
+	}
+	value := eval(c, node.Value, env)
+	if value.Type() == object.TYPE_ERROR {
+		return value
+	}
+
+	name := node.Target.Field
+	s, ok := left.(*object.Struct)
+	if !ok {
+		return newError("cannot set field %s of %s", name, left.Type())
+	}
+	i := s.StructType.Field(name)
+	if i < 0 {
+		return newError("struct %s has no field %s", s.StructType.Name, name)
+	}
+	if s.Frozen {
+		return newError("cannot set field %s of frozen struct %s", name, s.StructType.Name)
+	}
+	s.Fields[i] = value
+	return value
+}
+
+// structEquals compares structs field by field, with ==. Structs of different types are never equal.
+// Fields holding values which == cannot compare, like arrays, make it fail.
+func structEquals(c *Context, left *object.Struct, right *object.Struct) (bool, *object.Error) {
+	return structsEqual(c, left, right, map[[2]*object.Struct]bool{})
+}
+
+// structsEqual is structEquals inside the comparisons of the pairs of structs in comparing.
+// As fields can be set to the struct holding them, a pair met again inside itself is taken as equal:
+// if the structs differ, it is somewhere else.
+func structsEqual(c *Context, left *object.Struct, right *object.Struct, comparing map[[2]*object.Struct]bool) (bool, *object.Error) {
+	if left == right {
+		return true, nil
+	}
+	if left.StructType != right.StructType {
+		return false, nil
+	}
+	pair := [2]*object.Struct{left, right}
+	if comparing[pair] {
+		return true, nil
+	}
+	comparing[pair] = true
+	defer delete(comparing, pair)
+
+	for i := range left.Fields {
+		l, lok := left.Fields[i].(*object.Struct)
+		r, rok := right.Fields[i].(*object.Struct)
+		if lok && rok {
+			if equal, err := structsEqual(c, l, r, comparing); !equal || err != nil {
+				return false, err
+			}
+			continue
+		}
+		if !comparable(left.Fields[i]) || !comparable(right.Fields[i]) {
+			return false, newError("field %s of struct %s is not comparable", left.StructType.Fields[i], left.StructType.Name)
+		}
+		res := evalInfix(c, "==", left.Fields[i], right.Fields[i], nil)
+		if err, ok := res.(*object.Error); ok {
+			return false, err
+		}
+		if res != object.TRUE {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// comparable tells whether obj can be compared with ==.
+func comparable(obj object.Object) bool {
+	switch obj.(type) {
+	case *object.Integer, *object.Boolean, *object.String, *object.Null, *object.Struct:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,648 @@
+// Package gocode translates monkey programs into Go programs running on package gort.
+//
+// Every expression is computed into a temporary variable before the next one, so that
+// if, match and try, which become Go statements, keep the order of evaluation of the evaluator.
+// Names resolved to a slot live in a slice per scope, indexed like the slots of the evaluator;
+// the names of the top level scope live in one more slice.
+package gocode
+
+import (
+	"ast"
+	"bytes"
+	"fmt"
+	"go/format"
+	"object"
+	"resolver"
+	"strconv"
+	"strings"
+)
+
+// Generate returns the source of a Go program running prog and printing its value as `monkey run` does.
+// prog is resolved first. The program uses package gort, so it builds where this repository is in GOPATH.
+func Generate(prog *ast.Program) ([]byte, error) {
+	var src bytes.Buffer
+	src.WriteString("// Code generated by monkey build. DO NOT EDIT.\n\npackage main\n\nimport \"gort\"\n\n")
+	src.WriteString(program(prog, "program"))
+	src.WriteString("\nfunc main() {\n\tgort.Main(program)\n}\n")
+	return format.Source(src.Bytes())
+}
+
+// program is the Go function called name which returns the value of prog.
+func program(prog *ast.Program, name string) string {
+	resolver.Resolve(prog)
+
+	g := &generator{out: &bytes.Buffer{}, globals: globalNames(prog), consts: constNames(prog)}
+	res := g.block(prog.Statements)
+
+	var src bytes.Buffer
+	fmt.Fprintf(&src, "func %s() gort.Object {\n", name)
+	if len(g.globals) > 0 {
+		fmt.Fprintf(&src, "g := make([]gort.Object, %d)\n", len(g.globals))
+	}
+	src.Write(g.out.Bytes())
+	fmt.Fprintf(&src, "return %s\n}\n", res)
+	return src.String()
+}
+
+// globalNames gives an index to every name which is not resolved, and so lives in the top level scope.
+func globalNames(prog *ast.Program) map[string]int {
+	res := map[string]int{}
+	var visit func(node ast.Node) bool
+	visit = func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.NamedArgument:
+			// the name is the one of a parameter, not a variable
+			ast.Inspect(node.Value, visit)
+			return false
+		case *ast.Identifier:
+			if _, ok := res[node.Name]; !ok && !node.Resolved {
+				res[node.Name] = len(res)
+			}
+		}
+		return true
+	}
+	ast.Inspect(prog, visit)
+	return res
+}
+
+// constNames are the names bound by const somewhere in prog. Only their bindings need to be checked.
+func constNames(prog *ast.Program) map[string]bool {
+	res := map[string]bool{}
+	ast.Inspect(prog, func(node ast.Node) bool {
+		if let, ok := node.(*ast.LetStatement); ok && let.IsConst() {
+			res[let.Ident.Name] = true
+		}
+		return true
+	})
+	return res
+}
+
+// returnKind is how a return statement leaves the Go function being written.
+type returnKind int
+
+const (
+	returnValue   returnKind = iota // the function returns an Object
+	returnFromTry                   // the function is a block of a try, which returns an Object and true
+)
+
+type scope struct {
+	v      string   // the Go variable holding the slots
+	locals []string // the name of each slot
+}
+
+func (s *scope) slot(name string) int {
+	for i, n := range s.locals {
+		if n == name {
+			return i
+		}
+	}
+	return -1
+}
+
+type generator struct {
+	out     *bytes.Buffer // statements of the Go function being written
+	temps   int
+	scopes  []*scope // the scopes of the resolver, innermost last
+	globals map[string]int
+	consts  map[string]bool
+	returns returnKind
+	letPos  string // position of the let whose pattern is being written, empty if none
+	chain   string // label of the loop of the optional chain being written, see optionalChain
+	linking bool   // the expression being written is a link of the chain, see chainLeft
+}
+
+func (g *generator) emit(format string, args ...interface{}) {
+	fmt.Fprintf(g.out, format, args...)
+	g.out.WriteByte('\n')
+}
+
+// temp emits the computation of a temporary variable and returns its name.
+func (g *generator) temp(format string, args ...interface{}) string {
+	g.temps++
+	v := fmt.Sprintf("t%d", g.temps)
+	g.emit("%s := %s", v, fmt.Sprintf(format, args...))
+	return v
+}
+
+// declare declares a temporary variable to be set later.
+func (g *generator) declare() string {
+	g.temps++
+	v := fmt.Sprintf("t%d", g.temps)
+	g.emit("var %s gort.Object", v)
+	return v
+}
+
+func (g *generator) pushScope(locals []string) *scope {
+	g.temps++
+	s := &scope{v: fmt.Sprintf("s%d", g.temps), locals: locals}
+	g.scopes = append(g.scopes, s)
+	return s
+}
+
+func (g *generator) popScope() {
+	g.scopes = g.scopes[:len(g.scopes)-1]
+}
+
+// closure writes a Go function literal with the given signature, whose statements are
+// written by body. body returns the Go expressions returned at the end.
+func (g *generator) closure(signature string, returns returnKind, body func() string) string {
+	out, prevReturns := g.out, g.returns
+	g.out, g.returns = &bytes.Buffer{}, returns
+	res := body()
+	code := fmt.Sprintf("%s {\n%sreturn %s\n}", signature, g.out.String(), res)
+	g.out, g.returns = out, prevReturns
+	return code
+}
+
+func pos(node ast.Node) string {
+	p := node.Pos()
+	return fmt.Sprintf("gort.At(%d, %d)", p.Line, p.Column)
+}
+
+// block emits the statements and returns the value of the last one.
+func (g *generator) block(stmts []ast.Statement) string {
+	if fs := ast.FunctionClash(stmts); fs != nil {
+		g.emit("gort.Fail(%s, %s)", pos(fs), strconv.Quote(fmt.Sprintf("fn %s clashes with another declaration of %s in its block", fs.Name.Name, fs.Name.Name)))
+	}
+
+	// fn statements are bound before anything else runs, so they can call each other
+	for _, s := range stmts {
+		if s, ok := s.(*ast.FunctionStatement); ok {
+			g.emit("%s", g.bind(pos(s), s.Name, g.function(s.Function), false))
+		}
+	}
+
+	res := "gort.NULL"
+	for i, s := range stmts {
+		v := g.statement(s)
+		if i == len(stmts)-1 {
+			res = v
+		} else {
+			g.emit("_ = %s", v)
+		}
+	}
+	return res
+}
+
+// scopedBlock emits the statements of b, in a scope of its own if it has one, and returns the value of the last one.
+// It must be emitted in a Go block, so that closures made by b keep the scope of the time they are made.
+func (g *generator) scopedBlock(b *ast.BlockStatement) string {
+	if !b.Scoped {
+		return g.block(b.Statements)
+	}
+	s := g.pushScope(b.Locals)
+	defer g.popScope()
+	if len(b.Locals) > 0 {
+		g.emit("%s := make([]gort.Object, %d)", s.v, len(b.Locals))
+	}
+	return g.block(b.Statements)
+}
+
+func (g *generator) statement(s ast.Statement) string {
+	switch s := s.(type) {
+	case *ast.ExpressionStatement:
+		return g.expression(s.Expression)
+
+	case *ast.LetStatement:
+		value := g.expression(s.Value)
+		if s.Pattern != nil {
+			g.letPos = pos(s)
+			pat := g.pattern(s.Pattern)
+			g.letPos = ""
+			g.emit("gort.Destructure(%s, %s, %s, %s)", pos(s), pat, strconv.Quote(s.Pattern.String()), value)
+		} else {
+			g.emit("%s", g.bind(pos(s), s.Ident, value, s.IsConst()))
+		}
+		return value
+
+	case *ast.FunctionStatement:
+		// already bound by block
+		return g.expression(s.Name)
+
+	case *ast.ReturnStatement:
+		g.emitReturn(g.expression(s.Value))
+		return "gort.NULL"
+
+	case *ast.ThrowStatement:
+		g.emit("gort.Throw(%s, %s)", pos(s), g.expression(s.Value))
+		return "gort.NULL"
+
+	case *ast.StructStatement:
+		args := []string{strconv.Quote(s.Name.Name)}
+		for _, f := range s.Fields {
+			args = append(args, strconv.Quote(f))
+		}
+		value := g.temp("gort.NewStructType(%s)", strings.Join(args, ", "))
+		g.emit("%s", g.bind(pos(s), s.Name, value, false))
+		return value
+
+	case *ast.AssignStatement:
+		left := g.expression(s.Target.Left)
+		value := g.expression(s.Value)
+		return g.temp("gort.SetField(%s, %s, %q, %s)", pos(s), left, s.Target.Field, value)
+	}
+
+	g.emit("gort.Fail(%s, %s)", pos(s), strconv.Quote(fmt.Sprintf("unhandled case %T", s)))
+	return "gort.NULL"
+}
+
+func (g *generator) emitReturn(value string) {
+	if g.returns == returnFromTry {
+		g.emit("return %s, true", value)
+	} else {
+		g.emit("return %s", value)
+	}
+}
+
+// bind is the Go statement binding value to id, by a statement at pos.
+// Names bound by const somewhere are checked not to be bound again.
+func (g *generator) bind(pos string, id *ast.Identifier, value string, isConst bool) string {
+	v := g.variable(id)
+	if !g.consts[id.Name] {
+		return fmt.Sprintf("%s = %s", v, value)
+	}
+	return fmt.Sprintf("%s = gort.Bind(%s, %q, %s, %s, %t)", v, pos, id.Name, v, value, isConst)
+}
+
+// variable is the Go variable where id is bound.
+func (g *generator) variable(id *ast.Identifier) string {
+	if id.Resolved {
+		s := g.scopes[len(g.scopes)-1-id.Depth]
+		return fmt.Sprintf("%s[%d]", s.v, id.Slot)
+	}
+	return fmt.Sprintf("g[%d]", g.globals[id.Name])
+}
+
+// candidates are the Go variables id may refer to, innermost first: if its slot is not bound yet,
+// the name means whatever it means in the outer scopes, as in the evaluator.
+func (g *generator) candidates(id *ast.Identifier) []string {
+	res := []string{}
+	if id.Resolved {
+		res = append(res, g.variable(id))
+		for i := len(g.scopes) - 2 - id.Depth; i >= 0; i-- {
+			if slot := g.scopes[i].slot(id.Name); slot >= 0 {
+				res = append(res, fmt.Sprintf("%s[%d]", g.scopes[i].v, slot))
+			}
+		}
+	}
+	if i, ok := g.globals[id.Name]; ok {
+		res = append(res, fmt.Sprintf("g[%d]", i))
+	}
+	return res
+}
+
+func (g *generator) expression(e ast.Expression) string {
+	if g.linking {
+		g.linking = false
+	} else if ast.IsOptionalChain(e) {
+		return g.optionalChain(e)
+	}
+
+	switch e := e.(type) {
+	case *ast.IntegerLiteral:
+		return fmt.Sprintf("gort.Int(%d)", e.IntValue)
+	case *ast.BooleanLiteral:
+		return fmt.Sprintf("gort.Bool(%t)", e.BoolValue)
+	case *ast.NullLiteral:
+		return "gort.NULL"
+	case *ast.StringLiteral:
+		return fmt.Sprintf("gort.Str(%s)", strconv.Quote(e.Value))
+
+	case *ast.TemplateLiteral:
+		parts := []string{strconv.Quote(e.Parts[0])}
+		for i, ex := range e.Expressions {
+			parts = append(parts, fmt.Sprintf("gort.Display(%s)", g.expression(ex)), strconv.Quote(e.Parts[i+1]))
+		}
+		return g.temp("gort.Str(%s)", strings.Join(parts, " + "))
+
+	case *ast.Identifier:
+		args := append([]string{pos(e), strconv.Quote(e.Name)}, g.candidates(e)...)
+		return g.temp("gort.Lookup(%s)", strings.Join(args, ", "))
+
+	case *ast.PrefixExpression:
+		operand := g.expression(e.Expression)
+		return g.temp("gort.Prefix(%s, %q, %s)", pos(e), e.Operator, operand)
+
+	case *ast.InfixExpression:
+		if e.Operator == "??" {
+			left := g.expression(e.Left)
+			res := g.declare()
+			g.emit("%s = %s", res, left)
+			g.emit("if %s == gort.NULL {", res)
+			g.emit("%s = %s", res, g.expression(e.Right))
+			g.emit("}")
+			return res
+		}
+		left := g.expression(e.Left)
+		right := g.expression(e.Right)
+		return g.temp("gort.Infix(%s, %q, %s, %s)", pos(e), e.Operator, left, right)
+
+	case *ast.IfExpression:
+		condition := g.expression(e.Condition)
+		res := g.declare()
+		g.emit("if gort.Truthy(%s, %s) {", pos(e), condition)
+		g.emit("%s = %s", res, g.scopedBlock(e.Consequence))
+		g.emit("} else {")
+		if e.Alternative != nil {
+			g.emit("%s = %s", res, g.scopedBlock(e.Alternative))
+		} else {
+			g.emit("%s = gort.NULL", res)
+		}
+		g.emit("}")
+		return res
+
+	case *ast.IndexExpression:
+		left := g.chainLeft(e.Left, e.IsOptional())
+		index := g.expression(e.Index)
+		return g.temp("gort.Index(%s, %s, %s)", pos(e), left, index)
+
+	case *ast.ArrayLiteral:
+		elements, _ := g.arguments(e, e.Elements)
+		return g.temp("gort.Array(%s)", elements)
+
+	case *ast.HashLiteral:
+		res := g.temp("gort.NewHash()")
+		for _, pair := range e.Pairs {
+			key := g.temp("gort.Key(%s, %s)", pos(e), g.expression(pair.Key))
+			g.emit("%s.Set(%s, %s)", res, key, g.expression(pair.Value))
+		}
+		return res
+
+	case *ast.StructLiteral:
+		typ := g.temp("gort.StructType(%s, %s, %s)", pos(e), strconv.Quote(e.Type.String()), g.expression(e.Type))
+		fields := g.temp("make([]gort.Object, len(%s.Fields))", typ)
+		for _, f := range e.Fields {
+			i := g.temp("gort.LiteralField(%s, %s, %s, %q)", pos(e), typ, fields, f.Name)
+			g.emit("%s[%s] = %s", fields, i, g.expression(f.Value))
+		}
+		return g.temp("gort.NewStruct(%s, %s, %s)", pos(e), typ, fields)
+
+	case *ast.FieldExpression:
+		left := g.chainLeft(e.Left, e.IsOptional())
+		return g.temp("gort.Member(%s, %s, %q)", pos(e), left, e.Field)
+
+	case *ast.FunctionExpression:
+		return g.function(e)
+
+	case *ast.CallExpression:
+		callee := g.chainLeft(e.Function, false)
+		g.emit("gort.Callable(%s, %s)", pos(e), callee)
+		args, named := g.arguments(e, e.Arguments)
+		call := "gort.Call"
+		if e.Tail {
+			call = "gort.TailCall"
+		}
+		return g.temp("%s(%s, %s, %s, %s, %s)", call, pos(e), strconv.Quote(e.CalleeName()), callee, args, named)
+
+	case *ast.MatchExpression:
+		return g.match(e)
+
+	case *ast.TryExpression:
+		return g.try(e)
+
+	case *ast.SpreadExpression:
+		g.emit("gort.Fail(%s, %q)", pos(e), "... can only be used in calls and array literals")
+		return "gort.NULL"
+
+	case *ast.NamedArgument:
+		g.emit("gort.Fail(%s, %q)", pos(e), fmt.Sprintf("named argument %s can only be used in calls", e.Name))
+		return "gort.NULL"
+	}
+
+	g.emit("gort.Fail(%s, %s)", pos(e), strconv.Quote(fmt.Sprintf("unhandled case %T", e)))
+	return "gort.NULL"
+}
+
+// optionalChain writes e, the end of a chain with optional fields or indexes, in a loop
+// which they break out of when they find null, leaving null as the value of the chain.
+// See ast.IsOptionalChain.
+func (g *generator) optionalChain(e ast.Expression) string {
+	res := g.temp("gort.NULL")
+	g.temps++
+	prev := g.chain
+	g.chain = fmt.Sprintf("c%d", g.temps)
+	defer func() { g.chain = prev }()
+
+	g.emit("%s:", g.chain)
+	g.emit("for {")
+	g.linking = true
+	g.emit("%s = %s", res, g.expression(e))
+	g.emit("break")
+	g.emit("}")
+	return res
+}
+
+// chainLeft writes left, what a field, index or call applies to, as a link of the same chain.
+// If optional, the chain is left when left is null.
+func (g *generator) chainLeft(left ast.Expression, optional bool) string {
+	// a chain in parentheses is one of its own
+	g.linking = !ast.IsGrouped(left)
+	res := g.expression(left)
+	if optional {
+		g.emit("if %s == gort.NULL {", res)
+		g.emit("break %s", g.chain)
+		g.emit("}")
+	}
+	return res
+}
+
+// arguments emits the arguments of a call or the elements of an array literal,
+// and returns the Go expressions of the positional ones and of the named ones.
+// Errors spreading a value are the ones of node, the call or the array literal.
+func (g *generator) arguments(node ast.Node, exps []ast.Expression) (positional string, named string) {
+	parts := []string{}
+	plain := []string{}
+	nameds := []string{}
+	spread := false
+
+	flush := func() {
+		if len(plain) > 0 {
+			parts = append(parts, fmt.Sprintf("[]gort.Object{%s}", strings.Join(plain, ", ")))
+			plain = nil
+		}
+	}
+
+	for _, exp := range exps {
+		switch exp := exp.(type) {
+		case *ast.SpreadExpression:
+			value := g.expression(exp.Value)
+			flush()
+			parts = append(parts, g.temp("gort.Spread(%s, %s)", pos(node), value))
+			spread = true
+		case *ast.NamedArgument:
+			nameds = append(nameds, fmt.Sprintf("{Name: %q, Value: %s}", exp.Name.Name, g.expression(exp.Value)))
+		default:
+			plain = append(plain, g.expression(exp))
+		}
+	}
+
+	if spread {
+		flush()
+		positional = fmt.Sprintf("gort.Concat(%s)", strings.Join(parts, ", "))
+	} else {
+		positional = fmt.Sprintf("[]gort.Object{%s}", strings.Join(plain, ", "))
+	}
+	named = "nil"
+	if len(nameds) > 0 {
+		named = fmt.Sprintf("[]gort.Named{%s}", strings.Join(nameds, ", "))
+	}
+	return positional, named
+}
+
+func (g *generator) function(e *ast.FunctionExpression) string {
+	// print the function as the evaluator does
+	f := &object.Function{Defaults: e.Defaults, Body: e.Body}
+	for _, p := range e.Params {
+		f.Params = append(f.Params, p.Name)
+	}
+	if e.Rest != nil {
+		f.Rest = e.Rest.Name
+	}
+
+	s := g.pushScope(e.Locals)
+	defer g.popScope()
+
+	params := []string{}
+	slots := []string{}
+	defaults := []string{}
+	for i, p := range e.Params {
+		params = append(params, strconv.Quote(p.Name))
+		slots = append(slots, strconv.Itoa(s.slot(p.Name)))
+		if i < len(e.Defaults) && e.Defaults[i] != nil {
+			def := e.Defaults[i]
+			defaults = append(defaults, g.closure(fmt.Sprintf("func(%s []gort.Object) gort.Object", s.v), returnValue, func() string {
+				return g.expression(def)
+			}))
+		} else {
+			defaults = append(defaults, "nil")
+		}
+	}
+	if e.Rest != nil {
+		slots = append(slots, strconv.Itoa(s.slot(e.Rest.Name)))
+	}
+
+	body := g.closure(fmt.Sprintf("func(%s []gort.Object) gort.Object", s.v), returnValue, func() string {
+		return g.block(e.Body.Statements)
+	})
+
+	return g.temp("&gort.Function{\nParams: []string{%s},\nDefaults: []func([]gort.Object) gort.Object{%s},\nRest: %q,\nSlots: []int{%s},\nLocals: %d,\nBody: %s,\nSource: %s,\nSignature: %s,\n}",
+		strings.Join(params, ", "), strings.Join(defaults, ", "), f.Rest, strings.Join(slots, ", "), len(e.Locals),
+		body, strconv.Quote(f.Inspect()), strconv.Quote(f.Signature()))
+}
+
+// match tries the arms in a loop, which the first one matching breaks out of.
+func (g *generator) match(e *ast.MatchExpression) string {
+	subject := g.expression(e.Subject)
+	res := g.declare()
+
+	g.emit("for {")
+	for _, arm := range e.Arms {
+		// each arm gets its own scope so bindings of an arm that failed don't leak
+		s := g.pushScope(arm.Locals)
+		g.emit("{")
+		if len(arm.Locals) > 0 {
+			g.emit("%s := make([]gort.Object, %d)", s.v, len(arm.Locals))
+		}
+		g.emit("if gort.Match(%s, %s) {", g.pattern(arm.Pattern), subject)
+		if arm.Guard != nil {
+			g.emit("if gort.Truthy(%s, %s) {", pos(e), g.expression(arm.Guard))
+		}
+		g.emit("%s = %s", res, g.expression(arm.Body))
+		g.emit("break")
+		if arm.Guard != nil {
+			g.emit("}")
+		}
+		g.emit("}")
+		g.emit("}")
+		g.popScope()
+	}
+	g.emit("gort.NoMatch(%s, %s)", pos(e), subject)
+	g.emit("}")
+	return res
+}
+
+// try makes each block into a function returning its value and whether it returned,
+// so that gort.Try can catch the errors of the body.
+func (g *generator) try(e *ast.TryExpression) string {
+	blockFunc := func(block *ast.BlockStatement) string {
+		return g.closure("func() (gort.Object, bool)", returnFromTry, func() string {
+			return g.scopedBlock(block) + ", false"
+		})
+	}
+
+	body := blockFunc(e.Body)
+	catch := "nil"
+	if e.Catch != nil {
+		s := g.pushScope(e.CatchLocals)
+		catch = g.closure("func(e *gort.ErrorValue) (gort.Object, bool)", returnFromTry, func() string {
+			g.emit("%s := make([]gort.Object, %d)", s.v, len(e.CatchLocals))
+			g.emit("%s[%d] = e", s.v, s.slot(e.CatchParam.Name))
+			return g.block(e.Catch.Statements) + ", false"
+		})
+		g.popScope()
+	}
+	finally := "nil"
+	if e.Finally != nil {
+		finally = blockFunc(e.Finally)
+	}
+
+	g.temps++
+	res, returned := fmt.Sprintf("t%d", g.temps), fmt.Sprintf("r%d", g.temps)
+	g.emit("%s, %s := gort.Try(%s, %s, %s)", res, returned, body, catch, finally)
+	g.emit("if %s {", returned)
+	g.emitReturn(res)
+	g.emit("}")
+	return res
+}
+
+// patternBind is the Go statement binding v to a name of a pattern. Only the names bound by a let
+// may be bound by const before, match arms having scopes of their own.
+func (g *generator) patternBind(id *ast.Identifier) string {
+	if g.letPos == "" {
+		return fmt.Sprintf("%s = v", g.variable(id))
+	}
+	return g.bind(g.letPos, id, "v", false)
+}
+
+// pattern emits what the literals of pat need and returns a Go expression making it.
+func (g *generator) pattern(pat ast.Pattern) string {
+	switch pat := pat.(type) {
+	case *ast.WildcardPattern:
+		return "gort.Wildcard{}"
+
+	case *ast.BindingPattern:
+		return fmt.Sprintf("gort.Binding{Set: func(v gort.Object) { %s }}", g.patternBind(pat.Ident))
+
+	case *ast.LiteralPattern:
+		return fmt.Sprintf("gort.Literal{Value: %s}", g.expression(pat.Value))
+
+	case *ast.ArrayPattern:
+		elements := []string{}
+		for _, el := range pat.Elements {
+			elements = append(elements, g.pattern(el))
+		}
+		rest := "nil"
+		if pat.Rest != nil {
+			rest = fmt.Sprintf("func(v gort.Object) { %s }", g.patternBind(pat.Rest))
+		}
+		return fmt.Sprintf("&gort.ArrayPattern{Elements: []gort.Pattern{%s}, Rest: %s}", strings.Join(elements, ", "), rest)
+
+	case *ast.HashPattern:
+		keys := []string{}
+		values := []string{}
+		for _, pair := range pat.Pairs {
+			keys = append(keys, g.expression(pair.Key))
+			values = append(values, g.pattern(pair.Value))
+		}
+		return fmt.Sprintf("&gort.HashPattern{Keys: []gort.Object{%s}, Values: []gort.Pattern{%s}}", strings.Join(keys, ", "), strings.Join(values, ", "))
+
+	case *ast.DefaultPattern:
+		def := g.closure("func() gort.Object", returnValue, func() string {
+			return g.expression(pat.Default)
+		})
+		return fmt.Sprintf("&gort.DefaultPattern{Pattern: %s, Default: %s}", g.pattern(pat.Pattern), def)
+	}
+
+	g.emit("gort.Fail(%s, %s)", pos(pat), strconv.Quote(fmt.Sprintf("unhandled pattern %T", pat)))
+	return "gort.Wildcard{}"
+}
@@ -0,0 +1,127 @@
+package gocode
+
+import (
+	"bytes"
+	"difftest"
+	"evaluator"
+	"fmt"
+	"io/ioutil"
+	"lexer"
+	"object"
+	"os"
+	"os/exec"
+	"parser"
+	"path/filepath"
+	"resolver"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// goRun builds and runs the Go program src, with this repository in GOPATH so it finds package gort.
+func goRun(t *testing.T, src []byte) (stdout string, stderr string, err error) {
+	if testing.Short() {
+		t.Skip("building Go programs takes a while")
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("the go command is not available")
+	}
+
+	gopath, err := filepath.Abs(filepath.Join("..", ".."))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "monkey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "main.go")
+	if err := ioutil.WriteFile(file, src, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	bin := filepath.Join(dir, "main")
+	build := exec.Command("go", "build", "-o", bin, file)
+	build.Env = append(os.Environ(), "GOPATH="+gopath, "GO111MODULE=off")
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("cannot build the generated program: %s\n%s", err, out)
+	}
+
+	var out, errOut bytes.Buffer
+	cmd := exec.Command(bin)
+	cmd.Stdout, cmd.Stderr = &out, &errOut
+	err = cmd.Run()
+	return out.String(), errOut.String(), err
+}
+
+func TestSameResultsAsEvaluator(t *testing.T) {
+	inputs := difftest.Programs()
+
+	// all the programs go in one Go program, which prints the value of each on a line
+	var src bytes.Buffer
+	src.WriteString("package main\n\nimport (\n\t\"fmt\"\n\t\"gort\"\n\t\"strconv\"\n)\n\n")
+	expected := []string{}
+	for i, in := range inputs {
+		p := parser.New(lexer.New(in))
+		prog := p.Parse()
+		if len(p.Errors()) > 0 {
+			t.Fatalf("parse errors in %q: %v", in, p.Errors())
+		}
+		src.WriteString(program(prog, fmt.Sprintf("program%d", i)))
+
+		prog = parser.New(lexer.New(in)).Parse()
+		resolver.Resolve(prog)
+		expected = append(expected, evaluator.Eval(prog, object.NewEnvironment()).Inspect())
+	}
+	src.WriteString("\nfunc main() {\n")
+	for i := range inputs {
+		fmt.Fprintf(&src, "\tfmt.Println(strconv.Quote(gort.Run(program%d).Inspect()))\n", i)
+	}
+	src.WriteString("}\n")
+
+	stdout, stderr, err := goRun(t, src.Bytes())
+	if err != nil {
+		t.Fatalf("%s\n%s", err, stderr)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(stdout, "\n"), "\n")
+	if len(lines) != len(inputs) {
+		t.Fatalf("expected %d results, got %d", len(inputs), len(lines))
+	}
+	for i, line := range lines {
+		got, err := strconv.Unquote(line)
+		if err != nil {
+			t.Fatalf("wrong output line %q", line)
+		}
+		if got != expected[i] {
+			t.Errorf("wrong result for %q. expected: %s, got: %s", inputs[i], expected[i], got)
+		}
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	tests := []struct {
+		in     string
+		stdout string
+		stderr string
+	}{
+		{"let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(20)", "6765\n", ""},
+		{"let f = fn() {\n  1 / 0\n}; f()", "", `ERROR("division by zero") at 2:5` + "\n"},
+	}
+
+	for _, tt := range tests {
+		src, err := Generate(parser.New(lexer.New(tt.in)).Parse())
+		if err != nil {
+			t.Fatalf("cannot generate %q: %s", tt.in, err)
+		}
+		stdout, stderr, err := goRun(t, src)
+		if stdout != tt.stdout || stderr != tt.stderr {
+			t.Errorf("wrong output for %q. expected: %q %q, got: %q %q", tt.in, tt.stdout, tt.stderr, stdout, stderr)
+		}
+		if (err != nil) != (tt.stderr != "") {
+			t.Errorf("wrong exit status for %q: %v", tt.in, err)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package gort
+
+import (
+	"fmt"
+	"object"
+	"token"
+)
+
+// Function is a monkey function made into Go. Its bindings live in a frame with a slot
+// for each name of its scope, which the generated code indexes directly.
+type Function struct {
+	Params    []string
+	Defaults  []func(frame []Object) Object // computes the default value of each of Params, nil if it has none
+	Rest      string
+	Slots     []int // slot of each of Params in the frame, then the one of Rest if any
+	Locals    int   // number of slots in the frame
+	Body      func(frame []Object) Object
+	Source    string // how the function is printed, as object.Function does
+	Signature string
+}
+
+func (f *Function) Inspect() string {
+	return f.Source
+}
+func (f *Function) Type() object.Type {
+	return object.TYPE_FUNCTION
+}
+
+type Named struct {
+	Name  string
+	Value Object
+}
+
+// tailCall is a call in tail position that is yet to be made.
+// It is returned as the result of the function making it, for its caller to run.
+type tailCall struct {
+	function *Function
+	args     []Object
+	named    []Named
+	name     string
+	pos      token.Position
+}
+
+func (tc *tailCall) Inspect() string {
+	return fmt.Sprintf("tail call to %s", tc.name)
+}
+func (tc *tailCall) Type() object.Type {
+	return object.TYPE_TAIL_CALL
+}
+
+// Callable checks that callee can be called, before its arguments are computed.
+func Callable(pos token.Position, callee Object) {
+	if callee.Type() != object.TYPE_FUNCTION && callee.Type() != object.TYPE_BUILTIN {
+		raisef(pos, "non callable object is used: %s", callee.Inspect())
+	}
+}
+
+// Call calls callee, which Callable accepted. name is how it is called, for stack traces.
+func Call(pos token.Position, name string, callee Object, args []Object, named []Named) Object {
+	if builtin, ok := callee.(*object.Builtin); ok {
+		if len(named) > 0 {
+			raisef(pos, "builtin %s does not take named arguments", builtin.Name)
+		}
+		res := builtin.Fn(args...)
+		if err, ok := res.(*object.Error); ok {
+			raise(pos, err)
+		}
+		return res
+	}
+
+	// tail calls made by f are run in this loop, instead of nesting deeper and deeper.
+	// They replace the frame of the function making them, as if called from here.
+	f, callPos := callee.(*Function), pos
+	for {
+		slots := make([]Object, f.Locals)
+
+		frames = append(frames, frame{name: name, callPos: callPos})
+		if err := bind(f, args, named, slots); err != nil {
+			frames = frames[:len(frames)-1]
+			raise(pos, err)
+		}
+		value := f.Body(slots)
+		frames = frames[:len(frames)-1]
+
+		tc, ok := value.(*tailCall)
+		if !ok {
+			return value
+		}
+		f, args, named, name, pos = tc.function, tc.args, tc.named, tc.name, tc.pos
+	}
+}
+
+// TailCall is Call for a call in tail position, which is left to the caller of the current function.
+func TailCall(pos token.Position, name string, callee Object, args []Object, named []Named) Object {
+	if f, ok := callee.(*Function); ok && len(frames) > 0 {
+		return &tailCall{function: f, args: args, named: named, name: name, pos: pos}
+	}
+	return Call(pos, name, callee, args, named)
+}
+
+// bind sets the parameters of f in frame. Parameters without an argument get their
+// default value, which is computed in frame so it can refer to the parameters before it.
+func bind(f *Function, args []Object, named []Named, frame []Object) *object.Error {
+	if len(args) > len(f.Params) && f.Rest == "" {
+		return newError("too many arguments for %s: expected %d, got %d", f.Signature, len(f.Params), len(args))
+	}
+
+	given := make([]Object, len(f.Params))
+	copy(given, args)
+
+	for _, na := range named {
+		i := paramIndex(f, na.Name)
+		if i < 0 {
+			return newError("unknown parameter %s for %s", na.Name, f.Signature)
+		}
+		if given[i] != nil {
+			return newError("parameter %s of %s is given twice", na.Name, f.Signature)
+		}
+		given[i] = na.Value
+	}
+
+	for i, name := range f.Params {
+		if given[i] == nil {
+			if f.Defaults[i] == nil {
+				return newError("missing argument %s for %s", name, f.Signature)
+			}
+			given[i] = f.Defaults[i](frame)
+		}
+		frame[f.Slots[i]] = given[i]
+	}
+
+	if f.Rest != "" {
+		rest := []Object{}
+		if len(args) > len(f.Params) {
+			rest = append(rest, args[len(f.Params):]...)
+		}
+		frame[f.Slots[len(f.Params)]] = &object.Array{Elements: rest}
+	}
+
+	return nil
+}
+
+func paramIndex(f *Function, name string) int {
+	for i, p := range f.Params {
+		if p == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func newError(format string, args ...interface{}) *object.Error {
+	return &object.Error{Message: fmt.Sprintf(format, args...)}
+}
@@ -0,0 +1,210 @@
+// Package gort is the runtime of the Go programs made from monkey programs by package gocode.
+// Values are the ones of package object and operations behave as in package evaluator.
+// Errors are raised as panics, which unwind the program until a try catches them,
+// and carry the position and stack trace of where they happened like in the evaluator.
+//
+// The runtime keeps the calls in progress in global state, so a generated program runs
+// on a single goroutine.
+package gort
+
+import (
+	"evaluator"
+	"fmt"
+	"object"
+	"os"
+	"token"
+)
+
+type Object = object.Object
+type ErrorValue = object.ErrorValue
+
+var NULL Object = object.NULL
+
+func Int(value int64) Object {
+	return &object.Integer{Value: value}
+}
+
+func Str(value string) Object {
+	return &object.String{Value: value}
+}
+
+func Bool(value bool) Object {
+	return object.NativeBool(value)
+}
+
+// Display is how value is shown in a template string.
+func Display(value Object) string {
+	return object.Display(value)
+}
+
+// At is the position of a node in the monkey source.
+func At(line int, column int) token.Position {
+	return token.Position{Line: line, Column: column}
+}
+
+// frame is a function call in progress.
+type frame struct {
+	name    string
+	callPos token.Position
+}
+
+var frames []frame
+
+// stackTrace describes the calls in progress, given the position currently being run.
+func stackTrace(pos token.Position) []string {
+	res := []string{}
+	for i := len(frames) - 1; i >= 0; i-- {
+		res = append(res, fmt.Sprintf("%s (%s)", frames[i].name, pos))
+		pos = frames[i].callPos
+	}
+	return append(res, fmt.Sprintf("<program> (%s)", pos))
+}
+
+// raise aborts with err. It happened at pos, unless it already knows where it happened.
+func raise(pos token.Position, err *object.Error) {
+	if !err.Position.IsValid() {
+		err.Position = pos
+		err.Stack = stackTrace(pos)
+	}
+	panic(err)
+}
+
+func raisef(pos token.Position, format string, args ...interface{}) {
+	raise(pos, &object.Error{Message: fmt.Sprintf(format, args...)})
+}
+
+// Fail aborts with an error found by the generated code itself.
+func Fail(pos token.Position, message string) {
+	raisef(pos, "%s", message)
+}
+
+// Run runs program and returns its value, or the error that aborted it.
+func Run(program func() Object) (res Object) {
+	frames = nil
+	defer func() {
+		if r := recover(); r != nil {
+			err, ok := r.(*object.Error)
+			if !ok {
+				panic(r)
+			}
+			res = err
+		}
+	}()
+	return program()
+}
+
+// Main runs program and prints its value like `monkey run`, exiting with status 1 if it fails.
+func Main(program func() Object) {
+	res := Run(program)
+	if res.Type() == object.TYPE_ERROR {
+		fmt.Fprintln(os.Stderr, res.Inspect())
+		os.Exit(1)
+	}
+	fmt.Println(res.Inspect())
+}
+
+// Constant is what the variables bound by const hold, so that they are not bound again.
+// Lookup sees through it.
+type Constant struct {
+	Value Object
+}
+
+func (c *Constant) Inspect() string {
+	return c.Value.Inspect()
+}
+func (c *Constant) Type() object.Type {
+	return c.Value.Type()
+}
+
+// Bind is the value to put in a variable holding old, to bind it to value, by const if isConst.
+// Variables bound by const cannot be bound again.
+func Bind(pos token.Position, name string, old Object, value Object, isConst bool) Object {
+	if _, ok := old.(*Constant); ok {
+		raisef(pos, "cannot rebind const %s", name)
+	}
+	if isConst {
+		return &Constant{Value: value}
+	}
+	return value
+}
+
+// Lookup is the value of the identifier name. bindings are the variables it may refer to,
+// innermost first; the first one bound wins, then the builtins.
+func Lookup(pos token.Position, name string, bindings ...Object) Object {
+	for _, b := range bindings {
+		if c, ok := b.(*Constant); ok {
+			return c.Value
+		}
+		if b != nil {
+			return b
+		}
+	}
+	if b, ok := evaluator.LookupBuiltin(name); ok {
+		return b
+	}
+	// the builtins calling functions make their calls from here, as in the evaluator
+	call := func(f Object, args ...Object) Object {
+		return Call(pos, "<anonymous>", f, args, nil)
+	}
+	if b, ok := evaluator.LookupNative(name, call); ok {
+		return b
+	}
+	raisef(pos, "unknown identifier: %s", name)
+	return nil
+}
+
+// Throw raises value like a throw statement.
+// Error values keep the position and stack of their first throw.
+func Throw(pos token.Position, value Object) {
+	switch value := value.(type) {
+	case *object.ErrorValue:
+		raise(pos, value.Err)
+	case *object.String:
+		raise(pos, &object.Error{Message: value.Value, Data: value})
+	default:
+		raise(pos, &object.Error{Message: value.Inspect(), Data: value})
+	}
+}
+
+// Try runs a try expression. Each block returns its value, and whether it ran a return statement.
+// catch and finally are nil when missing.
+func Try(body func() (Object, bool), catch func(*ErrorValue) (Object, bool), finally func() (Object, bool)) (Object, bool) {
+	depth := len(frames)
+
+	res, returned, err := protect(body)
+	if err != nil && catch != nil {
+		frames = frames[:depth]
+		ev := &object.ErrorValue{Err: err}
+		res, returned, err = protect(func() (Object, bool) { return catch(ev) })
+	}
+	if err != nil {
+		frames = frames[:depth]
+	}
+
+	if finally != nil {
+		// the finally block only changes the outcome if it fails or returns itself
+		if fin, ret := finally(); ret {
+			return fin, true
+		}
+	}
+
+	if err != nil {
+		panic(err)
+	}
+	return res, returned
+}
+
+// protect runs block, returning the error it raises if any.
+func protect(block func() (Object, bool)) (res Object, returned bool, err *object.Error) {
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(*object.Error)
+			if !ok {
+				panic(r)
+			}
+			err = e
+		}
+	}()
+	res, returned = block()
+	return
+}
@@ -0,0 +1,112 @@
+package gort
+
+import (
+	"evaluator"
+	"object"
+	"token"
+)
+
+func Prefix(pos token.Position, operator string, operand Object) Object {
+	return check(pos, evaluator.Prefix(operator, operand))
+}
+
+// Truthy converts the condition of an if or the guard of a match arm.
+func Truthy(pos token.Position, obj Object) bool {
+	value, err := evaluator.ToBool(obj)
+	if err != nil {
+		raise(pos, err)
+	}
+	return value
+}
+
+func Infix(pos token.Position, operator string, left Object, right Object) Object {
+	return check(pos, evaluator.Infix(operator, left, right))
+}
+
+// check raises res if it is an error.
+func check(pos token.Position, res Object) Object {
+	if err, ok := res.(*object.Error); ok {
+		raise(pos, err)
+	}
+	return res
+}
+
+func Index(pos token.Position, left Object, index Object) Object {
+	switch left := left.(type) {
+	case *object.Array:
+		if i, ok := index.(*object.Integer); ok {
+			if i.Value < 0 || i.Value >= int64(len(left.Elements)) {
+				return object.NULL
+			}
+			return left.Elements[i.Value]
+		}
+	case *object.Hash:
+		if value, ok := left.Get(Key(pos, index)); ok {
+			return value
+		}
+		return object.NULL
+	case *object.ErrorValue:
+		if key, ok := index.(*object.String); ok {
+			return errorField(left.Err, key.Value)
+		}
+	}
+
+	raisef(pos, "cannot index %s with %s", left.Type(), index.Type())
+	return nil
+}
+
+// errorField implements indexing of an error value.
+func errorField(err *object.Error, name string) Object {
+	switch name {
+	case "message":
+		return &object.String{Value: err.Message}
+	case "position":
+		return &object.String{Value: err.Position.String()}
+	case "stack":
+		stack := []Object{}
+		for _, s := range err.Stack {
+			stack = append(stack, &object.String{Value: s})
+		}
+		return &object.Array{Elements: stack}
+	case "data":
+		if err.Data != nil {
+			return err.Data
+		}
+	}
+	return object.NULL
+}
+
+func NewHash() *object.Hash {
+	return object.NewHash()
+}
+
+// Key checks that key can be used in a hash.
+func Key(pos token.Position, key Object) object.Hashable {
+	hashable, ok := key.(object.Hashable)
+	if !ok {
+		raisef(pos, "unusable as hash key: %s", key.Type())
+	}
+	return hashable
+}
+
+func Array(elements []Object) Object {
+	return &object.Array{Elements: elements}
+}
+
+// Spread is the elements of a spread argument or array element.
+func Spread(pos token.Position, value Object) []Object {
+	array, ok := value.(*object.Array)
+	if !ok {
+		raisef(pos, "cannot spread %s, only arrays", value.Type())
+	}
+	return array.Elements
+}
+
+// Concat puts together the elements of an array literal, or the arguments of a call, with spread ones.
+func Concat(parts ...[]Object) []Object {
+	res := []Object{}
+	for _, p := range parts {
+		res = append(res, p...)
+	}
+	return res
+}
@@ -0,0 +1,113 @@
+package gort
+
+import (
+	"evaluator"
+	"object"
+	"token"
+)
+
+// Pattern is a pattern of a let statement or a match arm. Bindings are set as the pattern is matched.
+type Pattern interface {
+	// match binds the parts of value. If the value does not have the shape of the pattern, it tells why.
+	match(value Object) (mismatch string)
+}
+
+type Wildcard struct{}
+
+func (Wildcard) match(value Object) string {
+	return ""
+}
+
+type Binding struct {
+	Set func(value Object)
+}
+
+func (b Binding) match(value Object) string {
+	b.Set(value)
+	return ""
+}
+
+type Literal struct {
+	Value Object
+}
+
+func (l Literal) match(value Object) string {
+	return evaluator.MatchLiteral(l.Value, value)
+}
+
+type ArrayPattern struct {
+	Elements []Pattern
+	Rest     func(value Object) // binds the remaining elements, nil if there is no rest
+}
+
+func (p *ArrayPattern) match(value Object) string {
+	// errors are raised rather than returned
+	rest, mismatch, _ := evaluator.MatchArray(value, len(p.Elements), p.Rest != nil, func(i int) bool {
+		return hasDefault(p.Elements[i])
+	}, func(i int, v Object) (string, Object) {
+		return matchElement(p.Elements[i], v), nil
+	})
+	if mismatch == "" && p.Rest != nil {
+		p.Rest(&object.Array{Elements: rest})
+	}
+	return mismatch
+}
+
+type HashPattern struct {
+	Keys   []Object // literals, which are all hashable
+	Values []Pattern
+}
+
+func (p *HashPattern) match(value Object) string {
+	// errors are raised rather than returned, and the keys cannot fail
+	mismatch, _ := evaluator.MatchHash(value, len(p.Keys), func(i int) Object {
+		return p.Keys[i]
+	}, func(i int) bool {
+		return hasDefault(p.Values[i])
+	}, func(i int, v Object) (string, Object) {
+		return matchElement(p.Values[i], v), nil
+	})
+	return mismatch
+}
+
+type DefaultPattern struct {
+	Pattern Pattern
+	Default func() Object
+}
+
+func (p *DefaultPattern) match(value Object) string {
+	// the value is there, so the default is not needed
+	return p.Pattern.match(value)
+}
+
+func hasDefault(pat Pattern) bool {
+	_, ok := pat.(*DefaultPattern)
+	return ok
+}
+
+// matchElement matches pat, an element of an array or hash pattern, to value,
+// or to its default if value is nil because the element is missing.
+func matchElement(pat Pattern, value Object) string {
+	if value == nil {
+		def := pat.(*DefaultPattern)
+		return def.Pattern.match(def.Default())
+	}
+	return pat.match(value)
+}
+
+// Match tells whether value matches pat, the pattern of a match arm.
+func Match(pat Pattern, value Object) bool {
+	return pat.match(value) == ""
+}
+
+// Destructure binds the parts of value to pat, the pattern of a let statement printed as source.
+func Destructure(pos token.Position, pat Pattern, source string, value Object) {
+	if mismatch := pat.match(value); mismatch != "" {
+		raisef(pos, "cannot destructure %s with %s: %s", value.Inspect(), source, mismatch)
+	}
+}
+
+// NoMatch raises the error of a match expression without an arm for subject.
+func NoMatch(pos token.Position, subject Object) {
+	raisef(pos, "no match arm matches %s", subject.Inspect())
+}
@@ -0,0 +1,76 @@
+package gort
+
+import (
+	"evaluator"
+	"object"
+	"token"
+)
+
+func NewStructType(name string, fields ...string) Object {
+	return &object.StructType{Name: name, Fields: fields}
+}
+
+// StructType checks that typ, the type of a struct literal written as source, is a struct type.
+func StructType(pos token.Position, source string, typ Object) *object.StructType {
+	st, ok := typ.(*object.StructType)
+	if !ok {
+		raisef(pos, "%s is not a struct type, but %s", source, typ.Type())
+	}
+	return st
+}
+
+// LiteralField is the index of the field name of a struct literal of type st, whose fields so far are fields.
+func LiteralField(pos token.Position, st *object.StructType, fields []Object, name string) int {
+	i := st.Field(name)
+	if i < 0 {
+		raisef(pos, "struct %s has no field %s", st.Name, name)
+	}
+	if fields[i] != nil {
+		raisef(pos, "field %s of struct %s is given twice", name, st.Name)
+	}
+	return i
+}
+
+// NewStruct makes a struct of type st, once all its fields are given.
+func NewStruct(pos token.Position, st *object.StructType, fields []Object) Object {
+	for i, value := range fields {
+		if value == nil {
+			raisef(pos, "missing field %s of struct %s", st.Fields[i], st.Name)
+		}
+	}
+	return &object.Struct{StructType: st, Fields: fields}
+}
+
+// Member gets the member name of left: one of its own, like the field of a struct,
+// or else a method of its type bound to it.
+func Member(pos token.Position, left Object, name string) Object {
+	if m, ok := left.(object.Members); ok {
+		if value, ok := m.Member(name); ok {
+			return value
+		}
+	}
+	if m, ok := evaluator.LookupMethod(left, name); ok {
+		return m
+	}
+	if s, ok := left.(*object.Struct); ok {
+		raisef(pos, "struct %s has no field %s", s.StructType.Name, name)
+	}
+	raisef(pos, "%s has no member %s", left.Type(), name)
+	return nil
+}
+
+func SetField(pos token.Position, left Object, name string, value Object) Object {
+	s, ok := left.(*object.Struct)
+	if !ok {
+		raisef(pos, "cannot set field %s of %s", name, left.Type())
+	}
+	i := s.StructType.Field(name)
+	if i < 0 {
+		raisef(pos, "struct %s has no field %s", s.StructType.Name, name)
+	}
+	if s.Frozen {
+		raisef(pos, "cannot set field %s of frozen struct %s", name, s.StructType.Name)
+	}
+	s.Fields[i] = value
+	return value
+}
@@ -0,0 +1,653 @@
+// Package jscode translates monkey programs into JavaScript, which runs with a small runtime
+// put at the start of the program, and makes source maps back to the monkey source.
+//
+// Like package gocode, every expression is computed into a temporary variable before the next one,
+// and names resolved to a slot live in an array per scope. Try expressions become JavaScript try
+// statements, whose finally blocks already only change the outcome when they throw or return.
+package jscode
+
+import (
+	"ast"
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"object"
+	"path"
+	"resolver"
+	"strconv"
+	"strings"
+)
+
+//go:embed runtime.js
+var runtime string
+
+// Generate returns a JavaScript program running prog and printing its value as `monkey run` does,
+// and its source map. prog is resolved first. source is the name of the monkey file and target
+// the one of the JavaScript file, which expects its source map next to it in target + ".map".
+func Generate(prog *ast.Program, source string, target string) (code []byte, sourceMap []byte) {
+	var head bytes.Buffer
+	head.WriteString("// Code generated by monkey build. DO NOT EDIT.\n\n")
+	head.WriteString(runtime)
+	head.WriteString("\n")
+
+	var tail bytes.Buffer
+	tail.WriteString(program(prog, "program"))
+	tail.WriteString("\nrt.main(program);\n")
+	fmt.Fprintf(&tail, "//# sourceMappingURL=%s.map\n", path.Base(target))
+
+	body, mappings := layout(tail.String(), strings.Count(head.String(), "\n"))
+	code = append(head.Bytes(), body...)
+	sourceMap, _ = json.Marshal(map[string]interface{}{
+		"version":  3,
+		"file":     path.Base(target),
+		"sources":  []string{source},
+		"names":    []string{},
+		"mappings": encodeMappings(mappings),
+	})
+	return code, sourceMap
+}
+
+// program is the JavaScript function called name which returns the value of prog.
+// Its lines are marked with the positions they come from, see layout.
+func program(prog *ast.Program, name string) string {
+	resolver.Resolve(prog)
+
+	g := &generator{out: &bytes.Buffer{}, globals: globalNames(prog), consts: constNames(prog)}
+	res := g.block(prog.Statements)
+
+	var src bytes.Buffer
+	fmt.Fprintf(&src, "function %s() {\n", name)
+	if len(g.globals) > 0 {
+		fmt.Fprintf(&src, "const g = new Array(%d);\n", len(g.globals))
+	}
+	src.Write(g.out.Bytes())
+	fmt.Fprintf(&src, "return %s;\n}\n", res)
+	return src.String()
+}
+
+// constNames are the names bound by const somewhere in prog. Only their bindings need to be checked.
+func constNames(prog *ast.Program) map[string]bool {
+	res := map[string]bool{}
+	ast.Inspect(prog, func(node ast.Node) bool {
+		if let, ok := node.(*ast.LetStatement); ok && let.IsConst() {
+			res[let.Ident.Name] = true
+		}
+		return true
+	})
+	return res
+}
+
+// globalNames gives an index to every name which is not resolved, and so lives in the top level scope.
+func globalNames(prog *ast.Program) map[string]int {
+	res := map[string]int{}
+	var visit func(node ast.Node) bool
+	visit = func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.NamedArgument:
+			// the name is the one of a parameter, not a variable
+			ast.Inspect(node.Value, visit)
+			return false
+		case *ast.Identifier:
+			if _, ok := res[node.Name]; !ok && !node.Resolved {
+				res[node.Name] = len(res)
+			}
+		}
+		return true
+	}
+	ast.Inspect(prog, visit)
+	return res
+}
+
+type scope struct {
+	v      string   // the JavaScript variable holding the slots
+	locals []string // the name of each slot
+}
+
+func (s *scope) slot(name string) int {
+	for i, n := range s.locals {
+		if n == name {
+			return i
+		}
+	}
+	return -1
+}
+
+type generator struct {
+	out     *bytes.Buffer // statements of the JavaScript function being written
+	names   int           // to number the variables
+	scopes  []*scope      // the scopes of the resolver, innermost last
+	globals map[string]int
+	consts  map[string]bool
+	letPos  string // position of the let whose pattern is being written, empty if none
+	chain   string // label of the block of the optional chain being written, see optionalChain
+	linking bool   // the expression being written is a link of the chain, see chainLeft
+}
+
+// marker marks the line written after it as coming from node, for the source map.
+const marker = '\x01'
+
+// emit writes a line of code coming from node, which may be nil.
+func (g *generator) emit(node ast.Node, format string, args ...interface{}) {
+	if node != nil {
+		p := node.Pos()
+		fmt.Fprintf(g.out, "%c%d:%d%c", marker, p.Line, p.Column, marker)
+	}
+	fmt.Fprintf(g.out, format, args...)
+	g.out.WriteByte('\n')
+}
+
+func (g *generator) name(prefix string) string {
+	g.names++
+	return fmt.Sprintf("%s%d", prefix, g.names)
+}
+
+// temp emits the computation of a temporary variable and returns its name.
+func (g *generator) temp(node ast.Node, format string, args ...interface{}) string {
+	v := g.name("t")
+	g.emit(node, "const %s = %s;", v, fmt.Sprintf(format, args...))
+	return v
+}
+
+// declare declares a temporary variable to be set later.
+func (g *generator) declare() string {
+	v := g.name("t")
+	g.emit(nil, "let %s;", v)
+	return v
+}
+
+func (g *generator) pushScope(locals []string) *scope {
+	s := &scope{v: g.name("s"), locals: locals}
+	g.scopes = append(g.scopes, s)
+	return s
+}
+
+func (g *generator) popScope() {
+	g.scopes = g.scopes[:len(g.scopes)-1]
+}
+
+// closure writes an arrow function with the given parameters, whose statements are
+// written by body. body returns the JavaScript expression returned at the end.
+func (g *generator) closure(params string, body func() string) string {
+	out := g.out
+	g.out = &bytes.Buffer{}
+	res := body()
+	code := fmt.Sprintf("(%s) => {\n%sreturn %s;\n}", params, g.out.String(), res)
+	g.out = out
+	return code
+}
+
+func pos(node ast.Node) string {
+	return strconv.Quote(node.Pos().String())
+}
+
+// jsString is s as a JavaScript string literal.
+func jsString(s string) string {
+	var res bytes.Buffer
+	enc := json.NewEncoder(&res)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	return strings.TrimSuffix(res.String(), "\n")
+}
+
+// block emits the statements and returns the value of the last one.
+func (g *generator) block(stmts []ast.Statement) string {
+	if fs := ast.FunctionClash(stmts); fs != nil {
+		g.emit(fs, "rt.fail(%s, %s);", pos(fs), jsString(fmt.Sprintf("fn %s clashes with another declaration of %s in its block", fs.Name.Name, fs.Name.Name)))
+	}
+
+	// fn statements are bound before anything else runs, so they can call each other
+	for _, s := range stmts {
+		if s, ok := s.(*ast.FunctionStatement); ok {
+			g.emit(s, "%s;", g.bind(pos(s), s.Name, g.function(s.Function), false))
+		}
+	}
+
+	res := "null"
+	for i, s := range stmts {
+		v := g.statement(s)
+		if i == len(stmts)-1 {
+			res = v
+		}
+	}
+	return res
+}
+
+// scopedBlock emits the statements of b, in a scope of its own if it has one, and returns the value of the last one.
+// It must be emitted in a JavaScript block, so that closures made by b keep the scope of the time they are made.
+func (g *generator) scopedBlock(b *ast.BlockStatement) string {
+	if !b.Scoped {
+		return g.block(b.Statements)
+	}
+	s := g.pushScope(b.Locals)
+	defer g.popScope()
+	if len(b.Locals) > 0 {
+		g.emit(nil, "const %s = new Array(%d);", s.v, len(b.Locals))
+	}
+	return g.block(b.Statements)
+}
+
+func (g *generator) statement(s ast.Statement) string {
+	switch s := s.(type) {
+	case *ast.ExpressionStatement:
+		return g.expression(s.Expression)
+
+	case *ast.LetStatement:
+		value := g.expression(s.Value)
+		if s.Pattern != nil {
+			g.letPos = pos(s)
+			pat := g.pattern(s.Pattern)
+			g.letPos = ""
+			g.emit(s, "rt.destructure(%s, %s, %s, %s);", pos(s), pat, jsString(s.Pattern.String()), value)
+		} else {
+			g.emit(s, "%s;", g.bind(pos(s), s.Ident, value, s.IsConst()))
+		}
+		return value
+
+	case *ast.FunctionStatement:
+		// already bound by block
+		return g.expression(s.Name)
+
+	case *ast.ReturnStatement:
+		g.emit(s, "return %s;", g.expression(s.Value))
+		return "null"
+
+	case *ast.ThrowStatement:
+		g.emit(s, "rt.throwValue(%s, %s);", pos(s), g.expression(s.Value))
+		return "null"
+
+	case *ast.StructStatement:
+		fields := []string{}
+		for _, f := range s.Fields {
+			fields = append(fields, jsString(f))
+		}
+		value := g.temp(s, "new rt.StructType(%s, [%s])", jsString(s.Name.Name), strings.Join(fields, ", "))
+		g.emit(s, "%s;", g.bind(pos(s), s.Name, value, false))
+		return value
+
+	case *ast.AssignStatement:
+		left := g.expression(s.Target.Left)
+		value := g.expression(s.Value)
+		return g.temp(s, "rt.setField(%s, %s, %s, %s)", pos(s), left, jsString(s.Target.Field), value)
+	}
+
+	g.emit(s, "rt.fail(%s, %s);", pos(s), jsString(fmt.Sprintf("unhandled case %T", s)))
+	return "null"
+}
+
+// bind is the JavaScript expression binding value to id, by a statement at pos.
+// Names bound by const somewhere are checked not to be bound again.
+func (g *generator) bind(pos string, id *ast.Identifier, value string, isConst bool) string {
+	v := g.variable(id)
+	if !g.consts[id.Name] {
+		return fmt.Sprintf("%s = %s", v, value)
+	}
+	return fmt.Sprintf("%s = rt.bindName(%s, %s, %s, %s, %t)", v, pos, jsString(id.Name), v, value, isConst)
+}
+
+// patternBind is the JavaScript expression binding v to a name of a pattern. Only the names bound by a let
+// may be bound by const before, match arms having scopes of their own.
+func (g *generator) patternBind(id *ast.Identifier) string {
+	if g.letPos == "" {
+		return fmt.Sprintf("%s = v", g.variable(id))
+	}
+	return g.bind(g.letPos, id, "v", false)
+}
+
+// variable is the JavaScript variable where id is bound.
+func (g *generator) variable(id *ast.Identifier) string {
+	if id.Resolved {
+		s := g.scopes[len(g.scopes)-1-id.Depth]
+		return fmt.Sprintf("%s[%d]", s.v, id.Slot)
+	}
+	return fmt.Sprintf("g[%d]", g.globals[id.Name])
+}
+
+// candidates are the variables id may refer to, innermost first: if its slot is not bound yet,
+// the name means whatever it means in the outer scopes, as in the evaluator.
+func (g *generator) candidates(id *ast.Identifier) []string {
+	res := []string{}
+	if id.Resolved {
+		res = append(res, g.variable(id))
+		for i := len(g.scopes) - 2 - id.Depth; i >= 0; i-- {
+			if slot := g.scopes[i].slot(id.Name); slot >= 0 {
+				res = append(res, fmt.Sprintf("%s[%d]", g.scopes[i].v, slot))
+			}
+		}
+	}
+	if i, ok := g.globals[id.Name]; ok {
+		res = append(res, fmt.Sprintf("g[%d]", i))
+	}
+	return res
+}
+
+func (g *generator) expression(e ast.Expression) string {
+	if g.linking {
+		g.linking = false
+	} else if ast.IsOptionalChain(e) {
+		return g.optionalChain(e)
+	}
+
+	switch e := e.(type) {
+	case *ast.IntegerLiteral:
+		return fmt.Sprintf("%dn", e.IntValue)
+	case *ast.BooleanLiteral:
+		return strconv.FormatBool(e.BoolValue)
+	case *ast.NullLiteral:
+		return "null"
+	case *ast.StringLiteral:
+		return jsString(e.Value)
+
+	case *ast.TemplateLiteral:
+		parts := []string{jsString(e.Parts[0])}
+		for i, ex := range e.Expressions {
+			parts = append(parts, fmt.Sprintf("rt.display(%s)", g.expression(ex)), jsString(e.Parts[i+1]))
+		}
+		return g.temp(e, "%s", strings.Join(parts, " + "))
+
+	case *ast.Identifier:
+		args := append([]string{pos(e), jsString(e.Name)}, g.candidates(e)...)
+		return g.temp(e, "rt.lookup(%s)", strings.Join(args, ", "))
+
+	case *ast.PrefixExpression:
+		operand := g.expression(e.Expression)
+		return g.temp(e, "rt.prefix(%s, %s, %s)", pos(e), jsString(e.Operator), operand)
+
+	case *ast.InfixExpression:
+		if e.Operator == "??" {
+			left := g.expression(e.Left)
+			res := g.declare()
+			g.emit(e, "%s = %s;", res, left)
+			g.emit(e, "if (%s === null) {", res)
+			g.emit(nil, "%s = %s;", res, g.expression(e.Right))
+			g.emit(nil, "}")
+			return res
+		}
+		left := g.expression(e.Left)
+		right := g.expression(e.Right)
+		return g.temp(e, "rt.infix(%s, %s, %s, %s)", pos(e), jsString(e.Operator), left, right)
+
+	case *ast.IfExpression:
+		condition := g.expression(e.Condition)
+		res := g.declare()
+		g.emit(e, "if (rt.truthy(%s, %s)) {", pos(e), condition)
+		g.emit(nil, "%s = %s;", res, g.scopedBlock(e.Consequence))
+		g.emit(nil, "} else {")
+		if e.Alternative != nil {
+			g.emit(nil, "%s = %s;", res, g.scopedBlock(e.Alternative))
+		} else {
+			g.emit(nil, "%s = null;", res)
+		}
+		g.emit(nil, "}")
+		return res
+
+	case *ast.IndexExpression:
+		left := g.chainLeft(e, e.Left, e.IsOptional())
+		index := g.expression(e.Index)
+		return g.temp(e, "rt.index(%s, %s, %s)", pos(e), left, index)
+
+	case *ast.ArrayLiteral:
+		elements, _ := g.arguments(e, e.Elements)
+		return g.temp(e, "%s", elements)
+
+	case *ast.HashLiteral:
+		res := g.temp(e, "new rt.Hash()")
+		for _, pair := range e.Pairs {
+			key := g.temp(e, "rt.key(%s, %s)", pos(e), g.expression(pair.Key))
+			g.emit(pair.Value, "%s.set(%s, %s);", res, key, g.expression(pair.Value))
+		}
+		return res
+
+	case *ast.StructLiteral:
+		typ := g.temp(e, "rt.structType(%s, %s, %s)", pos(e), jsString(e.Type.String()), g.expression(e.Type))
+		fields := g.temp(e, "new Array(%s.fields.length)", typ)
+		for _, f := range e.Fields {
+			i := g.temp(e, "rt.literalField(%s, %s, %s, %s)", pos(e), typ, fields, jsString(f.Name))
+			g.emit(f.Value, "%s[%s] = %s;", fields, i, g.expression(f.Value))
+		}
+		return g.temp(e, "rt.newStruct(%s, %s, %s)", pos(e), typ, fields)
+
+	case *ast.FieldExpression:
+		left := g.chainLeft(e, e.Left, e.IsOptional())
+		return g.temp(e, "rt.member(%s, %s, %s)", pos(e), left, jsString(e.Field))
+
+	case *ast.FunctionExpression:
+		return g.function(e)
+
+	case *ast.CallExpression:
+		callee := g.chainLeft(e, e.Function, false)
+		g.emit(e, "rt.callable(%s, %s);", pos(e), callee)
+		args, named := g.arguments(e, e.Arguments)
+		call := "rt.call"
+		if e.Tail {
+			call = "rt.tailCall"
+		}
+		return g.temp(e, "%s(%s, %s, %s, %s, %s)", call, pos(e), jsString(e.CalleeName()), callee, args, named)
+
+	case *ast.MatchExpression:
+		return g.match(e)
+
+	case *ast.TryExpression:
+		return g.try(e)
+
+	case *ast.SpreadExpression:
+		g.emit(e, "rt.fail(%s, %s);", pos(e), jsString("... can only be used in calls and array literals"))
+		return "null"
+
+	case *ast.NamedArgument:
+		g.emit(e, "rt.fail(%s, %s);", pos(e), jsString(fmt.Sprintf("named argument %s can only be used in calls", e.Name)))
+		return "null"
+	}
+
+	g.emit(e, "rt.fail(%s, %s);", pos(e), jsString(fmt.Sprintf("unhandled case %T", e)))
+	return "null"
+}
+
+// arguments emits the arguments of a call or the elements of an array literal,
+// and returns the JavaScript arrays of the positional ones and of the named ones.
+// Errors spreading a value are the ones of node, the call or the array literal.
+func (g *generator) arguments(node ast.Node, exps []ast.Expression) (positional string, named string) {
+	parts := []string{}
+	plain := []string{}
+	nameds := []string{}
+	spread := false
+
+	flush := func() {
+		if len(plain) > 0 {
+			parts = append(parts, fmt.Sprintf("[%s]", strings.Join(plain, ", ")))
+			plain = nil
+		}
+	}
+
+	for _, exp := range exps {
+		switch exp := exp.(type) {
+		case *ast.SpreadExpression:
+			value := g.expression(exp.Value)
+			flush()
+			parts = append(parts, g.temp(exp, "rt.spread(%s, %s)", pos(node), value))
+			spread = true
+		case *ast.NamedArgument:
+			nameds = append(nameds, fmt.Sprintf("{ name: %s, value: %s }", jsString(exp.Name.Name), g.expression(exp.Value)))
+		default:
+			plain = append(plain, g.expression(exp))
+		}
+	}
+
+	if spread {
+		flush()
+		positional = fmt.Sprintf("rt.concat(%s)", strings.Join(parts, ", "))
+	} else {
+		positional = fmt.Sprintf("[%s]", strings.Join(plain, ", "))
+	}
+	return positional, fmt.Sprintf("[%s]", strings.Join(nameds, ", "))
+}
+
+// optionalChain writes e, the end of a chain with optional fields or indexes, in a labeled block
+// which they break out of when they find null, leaving null as the value of the chain.
+// See ast.IsOptionalChain.
+func (g *generator) optionalChain(e ast.Expression) string {
+	res := g.declare()
+	prev := g.chain
+	g.chain = g.name("c")
+	defer func() { g.chain = prev }()
+
+	g.emit(e, "%s = null;", res)
+	g.emit(nil, "%s: {", g.chain)
+	g.linking = true
+	g.emit(e, "%s = %s;", res, g.expression(e))
+	g.emit(nil, "}")
+	return res
+}
+
+// chainLeft writes left, what the field, index or call e applies to, as a link of the same chain.
+// If optional, the chain is left when left is null.
+func (g *generator) chainLeft(e ast.Expression, left ast.Expression, optional bool) string {
+	// a chain in parentheses is one of its own
+	g.linking = !ast.IsGrouped(left)
+	res := g.expression(left)
+	if optional {
+		g.emit(e, "if (%s === null) break %s;", res, g.chain)
+	}
+	return res
+}
+
+func (g *generator) function(e *ast.FunctionExpression) string {
+	// print the function as the evaluator does
+	f := &object.Function{Defaults: e.Defaults, Body: e.Body}
+	for _, p := range e.Params {
+		f.Params = append(f.Params, p.Name)
+	}
+	if e.Rest != nil {
+		f.Rest = e.Rest.Name
+	}
+
+	s := g.pushScope(e.Locals)
+	defer g.popScope()
+
+	params := []string{}
+	slots := []string{}
+	defaults := []string{}
+	for i, p := range e.Params {
+		params = append(params, jsString(p.Name))
+		slots = append(slots, strconv.Itoa(s.slot(p.Name)))
+		if i < len(e.Defaults) && e.Defaults[i] != nil {
+			def := e.Defaults[i]
+			defaults = append(defaults, g.closure(s.v, func() string {
+				return g.expression(def)
+			}))
+		} else {
+			defaults = append(defaults, "null")
+		}
+	}
+	if e.Rest != nil {
+		slots = append(slots, strconv.Itoa(s.slot(e.Rest.Name)))
+	}
+
+	body := g.closure(s.v, func() string {
+		return g.block(e.Body.Statements)
+	})
+
+	return g.temp(e, "new rt.Func({\nparams: [%s],\ndefaults: [%s],\nrest: %s,\nslots: [%s],\nlocals: %d,\nbody: %s,\nsource: %s,\nsignature: %s,\n})",
+		strings.Join(params, ", "), strings.Join(defaults, ", "), jsString(f.Rest), strings.Join(slots, ", "), len(e.Locals),
+		body, jsString(f.Inspect()), jsString(f.Signature()))
+}
+
+// match tries the arms in a labeled block, which the first one matching breaks out of.
+func (g *generator) match(e *ast.MatchExpression) string {
+	subject := g.expression(e.Subject)
+	res := g.declare()
+	label := g.name("m")
+
+	g.emit(e, "%s: {", label)
+	for _, arm := range e.Arms {
+		// each arm gets its own scope so bindings of an arm that failed don't leak
+		s := g.pushScope(arm.Locals)
+		g.emit(nil, "{")
+		if len(arm.Locals) > 0 {
+			g.emit(nil, "const %s = new Array(%d);", s.v, len(arm.Locals))
+		}
+		g.emit(arm.Pattern, "if (rt.match(%s, %s)) {", g.pattern(arm.Pattern), subject)
+		if arm.Guard != nil {
+			g.emit(arm.Guard, "if (rt.truthy(%s, %s)) {", pos(e), g.expression(arm.Guard))
+		}
+		g.emit(arm.Body, "%s = %s;", res, g.expression(arm.Body))
+		g.emit(nil, "break %s;", label)
+		if arm.Guard != nil {
+			g.emit(nil, "}")
+		}
+		g.emit(nil, "}")
+		g.emit(nil, "}")
+		g.popScope()
+	}
+	g.emit(e, "rt.noMatch(%s, %s);", pos(e), subject)
+	g.emit(nil, "}")
+	return res
+}
+
+func (g *generator) try(e *ast.TryExpression) string {
+	res := g.declare()
+	depth := g.name("d")
+
+	g.emit(e, "const %s = rt.depth();", depth)
+	g.emit(e, "try {")
+	g.emit(nil, "%s = %s;", res, g.scopedBlock(e.Body))
+	if e.Catch != nil {
+		caught := g.name("e")
+		s := g.pushScope(e.CatchLocals)
+		g.emit(e.CatchParam, "} catch (%s) {", caught)
+		g.emit(nil, "const %s = new Array(%d);", s.v, len(e.CatchLocals))
+		g.emit(nil, "%s[%d] = rt.caught(%s, %s);", s.v, s.slot(e.CatchParam.Name), caught, depth)
+		g.emit(nil, "%s = %s;", res, g.block(e.Catch.Statements))
+		g.popScope()
+	}
+	if e.Finally != nil {
+		g.emit(e.Finally, "} finally {")
+		g.emit(nil, "rt.unwind(%s);", depth)
+		g.scopedBlock(e.Finally)
+	}
+	g.emit(nil, "}")
+	return res
+}
+
+// pattern emits what the literals of pat need and returns a JavaScript expression making it.
+func (g *generator) pattern(pat ast.Pattern) string {
+	switch pat := pat.(type) {
+	case *ast.WildcardPattern:
+		return "rt.wildcard"
+
+	case *ast.BindingPattern:
+		return fmt.Sprintf("rt.binding((v) => { %s; })", g.patternBind(pat.Ident))
+
+	case *ast.LiteralPattern:
+		return fmt.Sprintf("rt.literal(%s)", g.expression(pat.Value))
+
+	case *ast.ArrayPattern:
+		elements := []string{}
+		for _, el := range pat.Elements {
+			elements = append(elements, g.pattern(el))
+		}
+		rest := "null"
+		if pat.Rest != nil {
+			rest = fmt.Sprintf("(v) => { %s; }", g.patternBind(pat.Rest))
+		}
+		return fmt.Sprintf("rt.arrayPattern([%s], %s)", strings.Join(elements, ", "), rest)
+
+	case *ast.HashPattern:
+		keys := []string{}
+		values := []string{}
+		for _, pair := range pat.Pairs {
+			keys = append(keys, g.expression(pair.Key))
+			values = append(values, g.pattern(pair.Value))
+		}
+		return fmt.Sprintf("rt.hashPattern([%s], [%s])", strings.Join(keys, ", "), strings.Join(values, ", "))
+
+	case *ast.DefaultPattern:
+		def := g.closure("", func() string {
+			return g.expression(pat.Default)
+		})
+		return fmt.Sprintf("rt.withDefault(%s, %s)", g.pattern(pat.Pattern), def)
+	}
+
+	g.emit(pat, "rt.fail(%s, %s);", pos(pat), jsString(fmt.Sprintf("unhandled pattern %T", pat)))
+	return "rt.wildcard"
+}
@@ -0,0 +1,216 @@
+package jscode
+
+import (
+	"bytes"
+	"difftest"
+	"encoding/json"
+	"evaluator"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"lexer"
+	"object"
+	"os"
+	"os/exec"
+	"parser"
+	"path/filepath"
+	"resolver"
+	"strings"
+	"testing"
+)
+
+// node tells to run the generated programs, which needs Node.js: `go test jscode -node`.
+var node = flag.Bool("node", false, "run the generated JavaScript with Node.js")
+
+// nodeRun runs the JavaScript program src with Node.js. Without -node, the test is skipped,
+// so that the default test run does not need Node.js.
+func nodeRun(t *testing.T, src []byte) (stdout string, stderr string, err error) {
+	if !*node {
+		t.Skip("running the generated JavaScript needs Node.js, see -node")
+	}
+	if _, err := exec.LookPath("node"); err != nil {
+		t.Fatalf("the node command is needed to run the generated JavaScript: %v", err)
+	}
+
+	dir, err := ioutil.TempDir("", "monkey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "main.js")
+	if err := ioutil.WriteFile(file, src, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out, errOut bytes.Buffer
+	cmd := exec.Command("node", file)
+	cmd.Stdout, cmd.Stderr = &out, &errOut
+	err = cmd.Run()
+	return out.String(), errOut.String(), err
+}
+
+func TestSameResultsAsEvaluator(t *testing.T) {
+	inputs := difftest.Programs()
+
+	// all the programs go in one JavaScript program, which prints the value of each on a line
+	var src bytes.Buffer
+	// the runtime must also run in browsers, which have none of what only Node.js has
+	src.WriteString("globalThis.Buffer = undefined;\nglobalThis.process = undefined;\nglobalThis.require = undefined;\n")
+	src.WriteString(runtime)
+	expected := []string{}
+	for i, in := range inputs {
+		p := parser.New(lexer.New(in))
+		prog := p.Parse()
+		if len(p.Errors()) > 0 {
+			t.Fatalf("parse errors in %q: %v", in, p.Errors())
+		}
+		src.WriteString(program(prog, fmt.Sprintf("program%d", i)))
+
+		prog = parser.New(lexer.New(in)).Parse()
+		resolver.Resolve(prog)
+		expected = append(expected, evaluator.Eval(prog, object.NewEnvironment()).Inspect())
+	}
+	for i := range inputs {
+		fmt.Fprintf(&src, "console.log(JSON.stringify(rt.inspect(rt.run(program%d))));\n", i)
+	}
+	code, _ := layout(src.String(), 0)
+
+	stdout, stderr, err := nodeRun(t, code)
+	if err != nil {
+		t.Fatalf("%s\n%s", err, stderr)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(stdout, "\n"), "\n")
+	if len(lines) != len(inputs) {
+		t.Fatalf("expected %d results, got %d", len(inputs), len(lines))
+	}
+	for i, line := range lines {
+		var got string
+		if err := json.Unmarshal([]byte(line), &got); err != nil {
+			t.Fatalf("wrong output line %q", line)
+		}
+		if got != expected[i] {
+			t.Errorf("wrong result for %q. expected: %s, got: %s", inputs[i], expected[i], got)
+		}
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	tests := []struct {
+		in     string
+		stdout string
+		stderr string
+	}{
+		{"let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(20)", "6765\n", ""},
+		{"let f = fn() {\n  1 / 0\n}; f()", "", `ERROR("division by zero") at 2:5` + "\n"},
+	}
+
+	for _, tt := range tests {
+		src, _ := Generate(parser.New(lexer.New(tt.in)).Parse(), "main.mk", "main.js")
+		stdout, stderr, err := nodeRun(t, src)
+		if stdout != tt.stdout || stderr != tt.stderr {
+			t.Errorf("wrong output for %q. expected: %q %q, got: %q %q", tt.in, tt.stdout, tt.stderr, stdout, stderr)
+		}
+		if (err != nil) != (tt.stderr != "") {
+			t.Errorf("wrong exit status for %q: %v", tt.in, err)
+		}
+	}
+}
+
+func TestSourceMap(t *testing.T) {
+	in := "let x = 1;\nlet f = fn(a) {\n  a + x\n};\nf(2)"
+	code, sourceMap := Generate(parser.New(lexer.New(in)).Parse(), "main.mk", "out/main.js")
+
+	var m struct {
+		Version  int
+		File     string
+		Sources  []string
+		Mappings string
+	}
+	if err := json.Unmarshal(sourceMap, &m); err != nil {
+		t.Fatalf("invalid source map %s: %s", sourceMap, err)
+	}
+	if m.Version != 3 || m.File != "main.js" || len(m.Sources) != 1 || m.Sources[0] != "main.mk" {
+		t.Errorf("wrong source map %s", sourceMap)
+	}
+	if !bytes.HasSuffix(code, []byte("//# sourceMappingURL=main.js.map\n")) {
+		t.Errorf("the code does not point to its source map")
+	}
+
+	// the addition is mapped to the operator, at line 3 column 5
+	lines := strings.Split(string(code), "\n")
+	found := false
+	for _, mp := range decodeMappings(t, m.Mappings) {
+		if strings.Contains(lines[mp.genLine], "rt.infix(\"3:5\"") {
+			found = true
+			if mp.srcLine != 2 || mp.srcCol != 4 || mp.genCol != strings.Index(lines[mp.genLine], "const") {
+				t.Errorf("wrong mapping of %q: %+v", lines[mp.genLine], mp)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("no mapping for the addition in %s", m.Mappings)
+	}
+}
+
+// decodeMappings decodes the mappings of a source map, as written by encodeMappings.
+func decodeMappings(t *testing.T, s string) []mapping {
+	res := []mapping{}
+	var m mapping
+	for line, segments := range strings.Split(s, ";") {
+		m.genCol = 0
+		if segments == "" {
+			continue
+		}
+		for _, segment := range strings.Split(segments, ",") {
+			values := []int{}
+			v, shift := 0, uint(0)
+			for _, c := range segment {
+				digit := strings.IndexRune(base64Digits, c)
+				v |= (digit & 31) << shift
+				shift += 5
+				if digit&32 == 0 {
+					if v&1 == 1 {
+						values = append(values, -(v >> 1))
+					} else {
+						values = append(values, v>>1)
+					}
+					v, shift = 0, 0
+				}
+			}
+			if len(values) != 4 {
+				t.Fatalf("wrong segment %q", segment)
+			}
+			m.genLine = line
+			m.genCol += values[0]
+			m.srcLine += values[2]
+			m.srcCol += values[3]
+			res = append(res, m)
+		}
+	}
+	return res
+}
+
+func TestWriteVLQ(t *testing.T) {
+	tests := []struct {
+		n        int
+		expected string
+	}{
+		{0, "A"},
+		{1, "C"},
+		{-1, "D"},
+		{15, "e"},
+		{16, "gB"},
+		{-17, "jB"},
+		{1000, "w+B"},
+	}
+
+	for _, tt := range tests {
+		var b strings.Builder
+		writeVLQ(&b, tt.n)
+		if b.String() != tt.expected {
+			t.Errorf("wrong VLQ for %d. expected: %q, got: %q", tt.n, tt.expected, b.String())
+		}
+	}
+}
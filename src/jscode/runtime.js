@@ -0,0 +1,1335 @@
+// Runtime of the JavaScript programs made from monkey programs by package jscode.
+// Values and operations behave as in package evaluator:
+//   integer   BigInt, kept in 64 bits
+//   boolean   boolean
+//   null      null
+//   string    string
+//   array     Array
+//   hash      rt.Hash
+//   function  rt.Func, builtins are rt.Builtin
+//   struct    rt.Struct, of an rt.StructType
+// Errors are thrown as rt.MonkeyError, with the position and stack trace of where they happened.
+// Variables not bound yet are undefined.
+const rt = (() => {
+  "use strict";
+
+  class MonkeyError {
+    constructor(message, data) {
+      this.message = message;
+      this.data = data; // value attached by the program, undefined if none
+      this.position = ""; // line:column, empty until known
+      this.stack = [];
+    }
+  }
+
+  class Hash {
+    constructor() {
+      this.pairs = new Map(); // hash key to {key, value}, in insertion order
+    }
+    get(key) {
+      const pair = this.pairs.get(hashKey(key));
+      return pair === undefined ? undefined : pair.value;
+    }
+    set(key, value) {
+      this.pairs.set(hashKey(key), { key, value });
+    }
+  }
+
+  class Func {
+    constructor(f) {
+      this.params = f.params;
+      this.defaults = f.defaults; // computes the default value of each of params, null if it has none
+      this.rest = f.rest;
+      this.slots = f.slots; // slot of each of params in the frame, then the one of rest if any
+      this.locals = f.locals; // number of slots in the frame
+      this.body = f.body;
+      this.source = f.source; // how the function is printed
+      this.signature = f.signature;
+    }
+  }
+
+  class Builtin {
+    constructor(name, fn) {
+      this.name = name;
+      this.fn = fn; // returns a MonkeyError instead of throwing it
+    }
+  }
+
+  class StructType {
+    constructor(name, fields) {
+      this.name = name;
+      this.fields = fields;
+    }
+  }
+
+  class Struct {
+    constructor(type, fields) {
+      this.type = type;
+      this.fields = fields; // value of each of type.fields
+      this.frozen = false;
+    }
+  }
+
+  class ErrorValue {
+    constructor(err) {
+      this.err = err;
+    }
+  }
+
+  // a call in tail position that is yet to be made, returned to the caller of the function making it
+  class TailCall {
+    constructor(f, args, named, name, pos) {
+      Object.assign(this, { f, args, named, name, pos });
+    }
+  }
+
+  const typeName = (v) => {
+    switch (typeof v) {
+      case "bigint": return "integer";
+      case "boolean": return "boolean";
+      case "string": return "string";
+    }
+    if (v === null) return "null";
+    if (Array.isArray(v)) return "array";
+    if (v instanceof Hash) return "hash";
+    if (v instanceof Func) return "function";
+    if (v instanceof Builtin) return "builtin";
+    if (v instanceof ErrorValue) return "error value";
+    if (v instanceof StructType) return "struct type";
+    if (v instanceof Struct) return "struct";
+    return "unknown";
+  };
+
+  // goType is the type of v in the evaluator, as some of its messages show it
+  const goType = (v) => ({
+    integer: "*object.Integer", boolean: "*object.Boolean", null: "*object.Null", string: "*object.String",
+    array: "*object.Array", hash: "*object.Hash", function: "*object.Function", builtin: "*object.Builtin",
+    "error value": "*object.ErrorValue", "struct type": "*object.StructType", struct: "*object.Struct",
+  })[typeName(v)];
+
+  // quote quotes s as Go's strconv.Quote does
+  const quote = (s) => {
+    let res = "\"";
+    for (const ch of s) {
+      const c = ch.codePointAt(0);
+      switch (ch) {
+        case "\"": res += "\\\""; continue;
+        case "\\": res += "\\\\"; continue;
+        case "\x07": res += "\\a"; continue;
+        case "\b": res += "\\b"; continue;
+        case "\f": res += "\\f"; continue;
+        case "\n": res += "\\n"; continue;
+        case "\r": res += "\\r"; continue;
+        case "\t": res += "\\t"; continue;
+        case "\v": res += "\\v"; continue;
+      }
+      if (c < 0x20 || c === 0x7f) {
+        res += "\\x" + c.toString(16).padStart(2, "0");
+      } else if ((c >= 0x80 && c < 0xa0) || c === 0xad || (c >= 0xd800 && c < 0xe000)) {
+        res += "\\u" + c.toString(16).padStart(4, "0");
+      } else {
+        res += ch;
+      }
+    }
+    return res + "\"";
+  };
+
+  // seen are the structs v is inside, which are shown as <cycle> if met again, as in the evaluator
+  const inspect = (v, seen = new Set()) => {
+    switch (typeName(v)) {
+      case "integer": return v.toString();
+      case "boolean": return String(v);
+      case "null": return "null";
+      case "string": return quote(v);
+      case "array": return "[" + v.map((el) => inspect(el, seen)).join(", ") + "]";
+      case "hash": return "{" + Array.from(v.pairs.values(), (p) => inspect(p.key) + ": " + inspect(p.value, seen)).join(", ") + "}";
+      case "function": return v.source;
+      case "builtin": return "builtin " + v.name;
+      case "error value":
+        if (v.err.data !== undefined) {
+          return "error(" + quote(v.err.message) + ", " + inspect(v.err.data, seen) + ")";
+        }
+        return "error(" + quote(v.err.message) + ")";
+      case "struct type": return "struct " + v.name + " {" + v.fields.join(", ") + "}";
+      case "struct": {
+        if (seen.has(v)) {
+          return "<cycle>";
+        }
+        seen.add(v);
+        const res = v.type.name + "{" + v.type.fields.map((f, i) => f + ": " + inspect(v.fields[i], seen)).join(", ") + "}";
+        seen.delete(v);
+        return res;
+      }
+    }
+    if (v instanceof MonkeyError) {
+      return "ERROR(" + quote(v.message) + ")" + (v.position ? " at " + v.position : "");
+    }
+    return String(v);
+  };
+
+  // display is how v is shown in a template string
+  const display = (v) => typeof v === "string" ? v : inspect(v);
+
+  const hashKey = (v) => {
+    switch (typeof v) {
+      case "bigint": return "i" + v;
+      case "boolean": return "b" + v;
+      case "string": return "s" + v;
+    }
+    return undefined;
+  };
+
+  // the calls in progress
+  let frames = [];
+
+  const stackTrace = (pos) => {
+    const res = [];
+    for (let i = frames.length - 1; i >= 0; i--) {
+      res.push(frames[i].name + " (" + pos + ")");
+      pos = frames[i].callPos;
+    }
+    res.push("<program> (" + pos + ")");
+    return res;
+  };
+
+  // raise throws err. It happened at pos, unless it already knows where it happened.
+  const raise = (pos, err) => {
+    if (typeof err === "string") {
+      err = new MonkeyError(err);
+    }
+    if (!err.position) {
+      err.position = pos;
+      err.stack = stackTrace(pos);
+    }
+    throw err;
+  };
+
+  const run = (program) => {
+    frames = [];
+    try {
+      return program();
+    } catch (e) {
+      if (e instanceof MonkeyError) {
+        return e;
+      }
+      throw e;
+    }
+  };
+
+  // main runs program and prints its value like `monkey run`
+  const main = (program) => {
+    const res = run(program);
+    if (res instanceof MonkeyError) {
+      console.error(inspect(res));
+      if (typeof process !== "undefined") {
+        process.exitCode = 1;
+      }
+    } else {
+      console.log(inspect(res));
+    }
+  };
+
+  // Constant is what the variables bound by const hold, so that they are not bound again.
+  // lookup sees through it.
+  class Constant {
+    constructor(value) {
+      this.value = value;
+    }
+  }
+
+  // bindName is the value to put in a variable holding old, to bind it to value, by const if isConst
+  const bindName = (pos, name, old, value, isConst) => {
+    if (old instanceof Constant) {
+      raise(pos, "cannot rebind const " + name);
+    }
+    return isConst ? new Constant(value) : value;
+  };
+
+  const lookup = (pos, name, ...bindings) => {
+    for (const b of bindings) {
+      if (b instanceof Constant) {
+        return b.value;
+      }
+      if (b !== undefined) {
+        return b;
+      }
+    }
+    if (Object.prototype.hasOwnProperty.call(builtins, name)) {
+      return builtins[name];
+    }
+    if (Object.prototype.hasOwnProperty.call(natives, name)) {
+      // the calls it makes are from here, as in the evaluator
+      const apply = (f, ...args) => call(pos, "<anonymous>", f, args, []);
+      return new Builtin(name, (...args) => natives[name](apply, args));
+    }
+    raise(pos, "unknown identifier: " + name);
+  };
+
+  const toInteger = (pos, v) => {
+    switch (typeName(v)) {
+      case "boolean": return v ? 1n : 0n;
+      case "null": return 0n;
+      case "integer": return v;
+    }
+    raise(pos, "unhandled type for integer conversion " + goType(v));
+  };
+
+  const truthy = (pos, v) => {
+    switch (typeName(v)) {
+      case "boolean": return v;
+      case "null": return false;
+      case "integer": return v !== 0n;
+    }
+    raise(pos, "unhandled type for bool conversion " + goType(v));
+  };
+
+  const int64 = (n) => BigInt.asIntN(64, n);
+
+  const prefix = (pos, operator, v) => {
+    switch (operator) {
+      case "!": return !truthy(pos, v);
+      case "-": return int64(-toInteger(pos, v));
+    }
+    raise(pos, "unhandled operator " + operator);
+  };
+
+  const infix = (pos, operator, left, right) => {
+    if (typeof left === "string" && typeof right === "string") {
+      switch (operator) {
+        case "+": return left + right;
+        case "==": return left === right;
+        case "!=": return left !== right;
+      }
+      raise(pos, "unhandled operator " + operator + " for strings");
+    }
+
+    if ((left === null || right === null) && (operator === "==" || operator === "!=")) {
+      // null is only equal to itself
+      return (left === right) === (operator === "==");
+    }
+
+    if (left instanceof Struct && right instanceof Struct && (operator === "==" || operator === "!=")) {
+      return structEquals(pos, left, right) === (operator === "==");
+    }
+
+    switch (operator) {
+      case "+": case "-": case "*": case "/": case "<": case ">":
+        // booleans are not allowed
+        if (typeof left === "boolean") {
+          raise(pos, "first operand of " + operator + " cannot be boolean");
+        }
+        if (typeof right === "boolean") {
+          raise(pos, "second operand of " + operator + " cannot be boolean");
+        }
+        break;
+      case "==": case "!=":
+        // must be both boolean or both integers
+        if (!(typeof left === "bigint" && typeof right === "bigint") && !(typeof left === "boolean" && typeof right === "boolean")) {
+          raise(pos, "cannot do " + operator + " of different types");
+        }
+        break;
+      default:
+        raise(pos, "unhandled operator " + operator);
+    }
+
+    const l = toInteger(pos, left);
+    const r = toInteger(pos, right);
+    switch (operator) {
+      case "+": return int64(l + r);
+      case "-": return int64(l - r);
+      case "*": return int64(l * r);
+      case "/":
+        if (r === 0n) {
+          raise(pos, "division by zero");
+        }
+        return int64(l / r);
+      case "<": return l < r;
+      case ">": return l > r;
+      case "==": return l === r;
+      case "!=": return l !== r;
+    }
+  };
+
+  // structEquals compares structs field by field, with ==. Structs of different types are never equal.
+  // Fields holding values which == cannot compare, like arrays, make it fail.
+  // Pairs met again inside their own comparison are taken as equal, as in the evaluator.
+  const structEquals = (pos, left, right, comparing = new Map()) => {
+    if (left === right) {
+      return true;
+    }
+    if (left.type !== right.type) {
+      return false;
+    }
+    if (comparing.has(left) && comparing.get(left).has(right)) {
+      return true;
+    }
+    if (!comparing.has(left)) {
+      comparing.set(left, new Set());
+    }
+    comparing.get(left).add(right);
+    try {
+      return left.fields.every((v, i) => {
+        const w = right.fields[i];
+        if (v instanceof Struct && w instanceof Struct) {
+          return structEquals(pos, v, w, comparing);
+        }
+        if (!comparable(v) || !comparable(w)) {
+          raise(pos, "field " + left.type.fields[i] + " of struct " + left.type.name + " is not comparable");
+        }
+        return infix(pos, "==", v, w) === true;
+      });
+    } finally {
+      comparing.get(left).delete(right);
+    }
+  };
+
+  // comparable tells whether v can be compared with ==
+  const comparable = (v) =>
+    typeof v === "bigint" || typeof v === "boolean" || typeof v === "string" || v === null || v instanceof Struct;
+
+  // structType checks that v, the type of a struct literal written as source, is a struct type
+  const structType = (pos, source, v) => {
+    if (!(v instanceof StructType)) {
+      raise(pos, source + " is not a struct type, but " + typeName(v));
+    }
+    return v;
+  };
+
+  // literalField is the index of the field name of a struct literal of type t, whose fields so far are fields
+  const literalField = (pos, t, fields, name) => {
+    const i = t.fields.indexOf(name);
+    if (i < 0) {
+      raise(pos, "struct " + t.name + " has no field " + name);
+    }
+    if (fields[i] !== undefined) {
+      raise(pos, "field " + name + " of struct " + t.name + " is given twice");
+    }
+    return i;
+  };
+
+  const newStruct = (pos, t, fields) => {
+    for (let i = 0; i < t.fields.length; i++) {
+      if (fields[i] === undefined) {
+        raise(pos, "missing field " + t.fields[i] + " of struct " + t.name);
+      }
+    }
+    return new Struct(t, fields);
+  };
+
+  // member gets the member name of left: a field of a struct, or else a method of its type bound to it
+  const member = (pos, left, name) => {
+    if (left instanceof Struct) {
+      const i = left.type.fields.indexOf(name);
+      if (i >= 0) {
+        return left.fields[i];
+      }
+    }
+    const table = methods[typeName(left)];
+    if (table !== undefined && Object.prototype.hasOwnProperty.call(table, name)) {
+      return new Builtin(name, (...args) => table[name](left, args));
+    }
+    if (left instanceof Struct) {
+      raise(pos, "struct " + left.type.name + " has no field " + name);
+    }
+    raise(pos, typeName(left) + " has no member " + name);
+  };
+
+  const setField = (pos, left, name, value) => {
+    if (!(left instanceof Struct)) {
+      raise(pos, "cannot set field " + name + " of " + typeName(left));
+    }
+    const i = left.type.fields.indexOf(name);
+    if (i < 0) {
+      raise(pos, "struct " + left.type.name + " has no field " + name);
+    }
+    if (left.frozen) {
+      raise(pos, "cannot set field " + name + " of frozen struct " + left.type.name);
+    }
+    left.fields[i] = value;
+    return value;
+  };
+
+  // key checks that v can be used as a hash key
+  const key = (pos, v) => {
+    if (hashKey(v) === undefined) {
+      raise(pos, "unusable as hash key: " + typeName(v));
+    }
+    return v;
+  };
+
+  const errorField = (err, name) => {
+    switch (name) {
+      case "message": return err.message;
+      case "position": return err.position || "?";
+      case "stack": return err.stack.slice();
+      case "data": return err.data === undefined ? null : err.data;
+    }
+    return null;
+  };
+
+  const index = (pos, left, i) => {
+    if (Array.isArray(left) && typeof i === "bigint") {
+      return i < 0n || i >= BigInt(left.length) ? null : left[Number(i)];
+    }
+    if (left instanceof Hash) {
+      const v = left.get(key(pos, i));
+      return v === undefined ? null : v;
+    }
+    if (left instanceof ErrorValue && typeof i === "string") {
+      return errorField(left.err, i);
+    }
+    raise(pos, "cannot index " + typeName(left) + " with " + typeName(i));
+  };
+
+  const spread = (pos, v) => {
+    if (!Array.isArray(v)) {
+      raise(pos, "cannot spread " + typeName(v) + ", only arrays");
+    }
+    return v;
+  };
+
+  const concat = (...parts) => [].concat(...parts);
+
+  // throwValue throws value like a throw statement. Error values keep the position and stack of their first throw.
+  const throwValue = (pos, value) => {
+    if (value instanceof ErrorValue) {
+      raise(pos, value.err);
+    }
+    raise(pos, new MonkeyError(typeof value === "string" ? value : inspect(value), value));
+  };
+
+  // depth, caught and unwind let a try put back the calls in progress as they were when it started
+  const depth = () => frames.length;
+
+  const caught = (e, depth) => {
+    if (!(e instanceof MonkeyError)) {
+      throw e;
+    }
+    frames.length = depth;
+    return new ErrorValue(e);
+  };
+
+  const unwind = (depth) => {
+    frames.length = depth;
+  };
+
+  const callable = (pos, callee) => {
+    if (!(callee instanceof Func) && !(callee instanceof Builtin)) {
+      raise(pos, "non callable object is used: " + inspect(callee));
+    }
+  };
+
+  const call = (pos, name, callee, args, named) => {
+    if (callee instanceof Builtin) {
+      if (named.length > 0) {
+        raise(pos, "builtin " + callee.name + " does not take named arguments");
+      }
+      const res = callee.fn(...args);
+      if (res instanceof MonkeyError) {
+        raise(pos, res);
+      }
+      return res;
+    }
+
+    // tail calls made by f are run in this loop, instead of nesting deeper and deeper.
+    // They replace the frame of the function making them, as if called from here.
+    const callPos = pos;
+    let f = callee;
+    for (;;) {
+      const slots = new Array(f.locals);
+
+      frames.push({ name, callPos });
+      const err = bind(f, args, named, slots);
+      if (err !== null) {
+        frames.pop();
+        raise(pos, err);
+      }
+      const value = f.body(slots);
+      frames.pop();
+
+      if (!(value instanceof TailCall)) {
+        return value;
+      }
+      ({ f, args, named, name, pos } = value);
+    }
+  };
+
+  const tailCall = (pos, name, callee, args, named) => {
+    if (callee instanceof Func && frames.length > 0) {
+      return new TailCall(callee, args, named, name, pos);
+    }
+    return call(pos, name, callee, args, named);
+  };
+
+  // bind sets the parameters of f in slots, or returns why it cannot
+  const bind = (f, args, named, slots) => {
+    if (args.length > f.params.length && f.rest === "") {
+      return new MonkeyError("too many arguments for " + f.signature + ": expected " + f.params.length + ", got " + args.length);
+    }
+
+    const given = f.params.map((_, i) => args[i]);
+    for (const na of named) {
+      const i = f.params.indexOf(na.name);
+      if (i < 0) {
+        return new MonkeyError("unknown parameter " + na.name + " for " + f.signature);
+      }
+      if (given[i] !== undefined) {
+        return new MonkeyError("parameter " + na.name + " of " + f.signature + " is given twice");
+      }
+      given[i] = na.value;
+    }
+
+    for (let i = 0; i < f.params.length; i++) {
+      if (given[i] === undefined) {
+        if (f.defaults[i] === null) {
+          return new MonkeyError("missing argument " + f.params[i] + " for " + f.signature);
+        }
+        given[i] = f.defaults[i](slots);
+      }
+      slots[f.slots[i]] = given[i];
+    }
+
+    if (f.rest !== "") {
+      slots[f.slots[f.params.length]] = args.slice(f.params.length);
+    }
+    return null;
+  };
+
+  // patterns are functions binding the parts of a value, which return why it does not match, if it does not
+  const wildcard = () => "";
+
+  const binding = (set) => (v) => {
+    set(v);
+    return "";
+  };
+
+  const literalEquals = (a, b) => a === null || b === null ? a === b : hashKey(a) !== undefined && hashKey(a) === hashKey(b);
+
+  const literal = (expected) => (v) => literalEquals(expected, v) ? "" : "expected " + inspect(expected) + ", got " + inspect(v);
+
+  const withDefault = (pattern, value) => {
+    const res = (v) => pattern(v);
+    res.matchDefault = () => pattern(value());
+    return res;
+  };
+
+  const arrayPattern = (elements, rest) => (v) => {
+    if (!Array.isArray(v)) {
+      return "expected an array, got " + typeName(v);
+    }
+
+    // elements with a default may be missing, but only at the end
+    let required = elements.length;
+    while (required > 0 && elements[required - 1].matchDefault !== undefined) {
+      required--;
+    }
+
+    if (rest === null && required === elements.length && v.length !== required) {
+      return "expected an array of " + required + " elements, got " + v.length;
+    }
+    if (rest === null && v.length > elements.length) {
+      return "expected an array of at most " + elements.length + " elements, got " + v.length;
+    }
+    if (v.length < required) {
+      return "expected an array of at least " + required + " elements, got " + v.length;
+    }
+
+    for (let i = 0; i < elements.length; i++) {
+      const mismatch = i < v.length ? elements[i](v[i]) : elements[i].matchDefault();
+      if (mismatch !== "") {
+        return "element " + i + ": " + mismatch;
+      }
+    }
+
+    if (rest !== null) {
+      rest(v.slice(elements.length));
+    }
+    return "";
+  };
+
+  const hashPattern = (keys, values) => (v) => {
+    if (!(v instanceof Hash)) {
+      return "expected a hash, got " + typeName(v);
+    }
+
+    for (let i = 0; i < keys.length; i++) {
+      const found = v.get(keys[i]);
+      let mismatch;
+      if (found !== undefined) {
+        mismatch = values[i](found);
+      } else if (values[i].matchDefault !== undefined) {
+        mismatch = values[i].matchDefault();
+      } else {
+        return "missing key " + inspect(keys[i]);
+      }
+      if (mismatch !== "") {
+        return "key " + inspect(keys[i]) + ": " + mismatch;
+      }
+    }
+    return "";
+  };
+
+  const match = (pattern, v) => pattern(v) === "";
+
+  const destructure = (pos, pattern, source, v) => {
+    const mismatch = pattern(v);
+    if (mismatch !== "") {
+      raise(pos, "cannot destructure " + inspect(v) + " with " + source + ": " + mismatch);
+    }
+  };
+
+  const noMatch = (pos, subject) => raise(pos, "no match arm matches " + inspect(subject));
+
+  const fail = (pos, message) => raise(pos, message);
+
+  // json_encode and json_decode work as in the evaluator, with the messages of Go's encoding/json
+
+  const jsonString = (s) => {
+    let res = "\"";
+    for (const ch of s) {
+      const c = ch.codePointAt(0);
+      if (ch === "\"" || ch === "\\") {
+        res += "\\" + ch;
+      } else if (ch === "\n") {
+        res += "\\n";
+      } else if (ch === "\r") {
+        res += "\\r";
+      } else if (ch === "\t") {
+        res += "\\t";
+      } else if (ch === "\b") {
+        res += "\\b";
+      } else if (ch === "\f") {
+        res += "\\f";
+      } else if (c < 0x20 || c === 0x2028 || c === 0x2029) {
+        res += "\\u" + c.toString(16).padStart(4, "0");
+      } else {
+        res += ch;
+      }
+    }
+    return res + "\"";
+  };
+
+  const jsonEncode = (...args) => {
+    if (args.length < 1 || args.length > 2) {
+      return new MonkeyError("wrong number of arguments for json_encode: expected 1 or 2, got " + args.length);
+    }
+    let indent = 0;
+    if (args.length === 2) {
+      if (typeof args[1] !== "bigint" || args[1] < 0n) {
+        return new MonkeyError("second argument of json_encode must be a non-negative integer, got " + inspect(args[1]));
+      }
+      indent = Number(args[1]);
+    }
+
+    const seen = new Set(); // arrays, hashes and structs being encoded, to detect cycles
+    const encode = (v, level) => {
+      const newline = indent > 0 ? "\n" + " ".repeat(indent * (level + 1)) : "";
+      const end = indent > 0 ? "\n" + " ".repeat(indent * level) : "";
+      switch (typeName(v)) {
+        case "integer": case "boolean": return String(v);
+        case "null": return "null";
+        case "string": return jsonString(v);
+        case "array": case "hash": case "struct": {
+          if (seen.has(v)) {
+            throw new MonkeyError("cannot encode a cyclic value as JSON");
+          }
+          seen.add(v);
+          let res;
+          if (Array.isArray(v)) {
+            res = v.length === 0 ? "[]" : "[" + v.map((el) => newline + encode(el, level + 1)).join(",") + end + "]";
+          } else if (v instanceof Struct) {
+            const fields = v.type.fields.map((f, i) =>
+              newline + jsonString(f) + (indent > 0 ? ": " : ":") + encode(v.fields[i], level + 1));
+            res = fields.length === 0 ? "{}" : "{" + fields.join(",") + end + "}";
+          } else {
+            const keys = new Map(); // the keys of v by the JSON key they become
+            const pairs = Array.from(v.pairs.values(), (p) => {
+              const name = typeof p.key === "string" ? p.key : inspect(p.key);
+              if (keys.has(name)) {
+                throw new MonkeyError("hash keys " + inspect(keys.get(name)) + " and " + inspect(p.key) + " both become the JSON key " + inspect(name));
+              }
+              keys.set(name, p.key);
+              return newline + jsonString(name) + (indent > 0 ? ": " : ":") + encode(p.value, level + 1);
+            });
+            res = pairs.length === 0 ? "{}" : "{" + pairs.join(",") + end + "}";
+          }
+          seen.delete(v);
+          return res;
+        }
+      }
+      throw new MonkeyError("cannot encode " + typeName(v) + " as JSON");
+    };
+
+    try {
+      return encode(args[0], 0);
+    } catch (e) {
+      if (e instanceof MonkeyError) {
+        return e;
+      }
+      throw e;
+    }
+  };
+
+  const quoteChar = (c) => {
+    if (c === "'") {
+      return "'\\''";
+    }
+    if (c === "\"") {
+      return "'\"'";
+    }
+    const q = quote(c);
+    return "'" + q.slice(1, -1) + "'";
+  };
+
+  const MIN_INT64 = -(2n ** 63n);
+  const MAX_INT64 = 2n ** 63n - 1n;
+
+  const jsonDecode = (...args) => {
+    if (args.length < 1 || args.length > 2) {
+      return new MonkeyError("wrong number of arguments for json_decode: expected 1 or 2, got " + args.length);
+    }
+    if (typeof args[0] !== "string") {
+      return new MonkeyError("first argument of json_decode must be a string, got " + typeName(args[0]));
+    }
+    let numbers = "error";
+    if (args.length === 2) {
+      if (args[1] !== "error" && args[1] !== "truncate" && args[1] !== "string") {
+        return new MonkeyError("second argument of json_decode must be \"error\", \"truncate\" or \"string\", got " + inspect(args[1]));
+      }
+      numbers = args[1];
+    }
+
+    const text = args[0];
+    let i = 0;
+    const invalid = (message) => new MonkeyError("invalid JSON: " + message);
+    const skip = () => {
+      while (i < text.length && " \t\r\n".includes(text[i])) {
+        i++;
+      }
+    };
+    const unexpected = (context) => {
+      throw invalid(i < text.length ? "invalid character " + quoteChar(text[i]) + " " + context : "unexpected end of JSON input");
+    };
+
+    const number = () => {
+      const m = /^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?/.exec(text.slice(i));
+      if (m === null || m[0] === "-") {
+        if (i + 1 >= text.length) {
+          throw invalid("unexpected EOF");
+        }
+        i++;
+        unexpected("in numeric literal");
+      }
+      i += m[0].length;
+      const n = m[0];
+
+      if (/^-?[0-9]+$/.test(n) && BigInt(n) >= MIN_INT64 && BigInt(n) <= MAX_INT64) {
+        return BigInt(n);
+      }
+      const f = Number(n);
+      const inRange = f >= -(2 ** 63) && f < 2 ** 63;
+      if (inRange && Number.isInteger(f)) {
+        return BigInt(f);
+      }
+      if (numbers === "string") {
+        return n;
+      }
+      if (!inRange) {
+        throw new MonkeyError("JSON number " + n + " is out of the range of integers");
+      }
+      if (numbers === "truncate") {
+        return BigInt(Math.trunc(f));
+      }
+      throw new MonkeyError("JSON number " + n + " is not an integer");
+    };
+
+    const string = () => {
+      let res = "";
+      i++; // the opening quote
+      for (;;) {
+        if (i >= text.length) {
+          throw invalid("unexpected end of JSON input");
+        }
+        const c = text[i];
+        if (c === "\"") {
+          i++;
+          return res;
+        }
+        if (c < " ") {
+          unexpected("in string literal");
+        }
+        if (c !== "\\") {
+          res += c;
+          i++;
+          continue;
+        }
+        i++;
+        const esc = { "\"": "\"", "\\": "\\", "/": "/", b: "\b", f: "\f", n: "\n", r: "\r", t: "\t" }[text[i]];
+        if (esc !== undefined) {
+          res += esc;
+          i++;
+        } else if (text[i] === "u" && /^[0-9a-fA-F]{4}$/.test(text.slice(i + 1, i + 5))) {
+          res += String.fromCharCode(parseInt(text.slice(i + 1, i + 5), 16));
+          i += 5;
+        } else {
+          unexpected("in string escape code");
+        }
+      }
+    };
+
+    const word = (w, value) => {
+      for (let j = 0; j < w.length; j++, i++) {
+        if (i >= text.length) {
+          throw invalid("unexpected EOF");
+        }
+        if (text[i] !== w[j]) {
+          unexpected("in literal " + w + " (expecting " + quoteChar(w[j]) + ")");
+        }
+      }
+      return value;
+    };
+
+    const value = () => {
+      skip();
+      switch (text[i]) {
+        case "[": {
+          i++;
+          const res = [];
+          skip();
+          if (text[i] === "]") {
+            i++;
+            return res;
+          }
+          for (;;) {
+            res.push(value());
+            skip();
+            if (text[i] === "]") {
+              i++;
+              return res;
+            }
+            if (text[i] !== ",") {
+              unexpected("after array element");
+            }
+            const comma = i++;
+            skip();
+            if (text[i] === "]") {
+              i = comma;
+              unexpected("looking for beginning of value");
+            }
+          }
+        }
+        case "{": {
+          i++;
+          const res = new Hash();
+          skip();
+          if (text[i] === "}") {
+            i++;
+            return res;
+          }
+          for (;;) {
+            skip();
+            if (text[i] !== "\"") {
+              unexpected("looking for beginning of value");
+            }
+            const k = string();
+            skip();
+            if (text[i] !== ":") {
+              unexpected("after object key");
+            }
+            i++;
+            res.set(k, value());
+            skip();
+            if (text[i] === "}") {
+              i++;
+              return res;
+            }
+            if (text[i] !== ",") {
+              unexpected("after object key:value pair");
+            }
+            const comma = i++;
+            skip();
+            if (text[i] === "}") {
+              i = comma;
+              unexpected("looking for beginning of value");
+            }
+          }
+        }
+        case "\"": return string();
+        case "t": return word("true", true);
+        case "f": return word("false", false);
+        case "n": return word("null", null);
+      }
+      if (i < text.length && (text[i] === "-" || (text[i] >= "0" && text[i] <= "9"))) {
+        return number();
+      }
+      unexpected("looking for beginning of value");
+    };
+
+    try {
+      skip();
+      if (i >= text.length) {
+        return invalid("unexpected end of input");
+      }
+      const res = value();
+      skip();
+      if (i < text.length) {
+        return invalid("unexpected data after the value");
+      }
+      return res;
+    } catch (e) {
+      if (e instanceof MonkeyError) {
+        return e;
+      }
+      throw e;
+    }
+  };
+
+  // freeze(value) makes the structs in value unable to change, looking into arrays, hashes and fields
+  const freeze = (...args) => {
+    if (args.length !== 1) {
+      return new MonkeyError("wrong number of arguments for freeze: expected 1, got " + args.length);
+    }
+    const visit = (v) => {
+      if (Array.isArray(v)) {
+        v.forEach(visit);
+      } else if (v instanceof Hash) {
+        for (const p of v.pairs.values()) {
+          visit(p.value);
+        }
+      } else if (v instanceof Struct && !v.frozen) {
+        v.frozen = true;
+        v.fields.forEach(visit);
+      } else if (v instanceof ErrorValue && v.err.data !== undefined) {
+        visit(v.err.data);
+      }
+    };
+    visit(args[0]);
+    return args[0];
+  };
+
+  // error(message, data) makes an error value that can be thrown
+  const error = (...args) => {
+    if (args.length < 1 || args.length > 2) {
+      return new MonkeyError("wrong number of arguments for error: expected 1 or 2, got " + args.length);
+    }
+    if (typeof args[0] !== "string") {
+      return new MonkeyError("first argument of error must be a string, got " + typeName(args[0]));
+    }
+    return new ErrorValue(new MonkeyError(args[0], args.length === 2 ? args[1] : undefined));
+  };
+
+  // methods are the methods of each type, by name, as in the evaluator.
+  // Like builtins, they return a MonkeyError instead of throwing it.
+  const checkArgs = (name, args, min, max) => {
+    if (args.length >= min && args.length <= max) {
+      return undefined;
+    }
+    const expected = min === max ? String(min) : max === min + 1 ? min + " or " + max : min + " to " + max;
+    return new MonkeyError("wrong number of arguments for " + name + ": expected " + expected + ", got " + args.length);
+  };
+
+  const stringArg = (name, args) => {
+    const err = checkArgs(name, args, 1, 1);
+    if (err === undefined && typeof args[0] !== "string") {
+      return new MonkeyError("argument of " + name + " must be a string, got " + typeName(args[0]));
+    }
+    return err;
+  };
+
+  const noArgs = (name, f) => (receiver, args) => checkArgs(name, args, 0, 0) || f(receiver);
+
+  const stringPredicate = (name, f) => (s, args) => stringArg(name, args) || f(s, args[0]);
+
+  // equals tells whether a == b. Values that cannot be compared are not equal.
+  const equals = (a, b) => {
+    if (typeName(a) !== typeName(b)) {
+      return false;
+    }
+    try {
+      return infix("", "==", a, b) === true;
+    } catch (e) {
+      if (e instanceof MonkeyError) {
+        return false;
+      }
+      throw e;
+    }
+  };
+
+  const hashKeyArg = (v) => hashKey(v) === undefined ? new MonkeyError("unusable as hash key: " + typeName(v)) : undefined;
+
+  // copyHash copies h without the key without, if not undefined
+  const copyHash = (h, without) => {
+    const res = new Hash();
+    for (const p of h.pairs.values()) {
+      if (without === undefined || hashKey(p.key) !== hashKey(without)) {
+        res.set(p.key, p.value);
+      }
+    }
+    return res;
+  };
+
+  // the length in bytes of the longest string repeat makes, as in the evaluator
+  const maxRepeatLength = 1 << 26;
+
+  // byteLength is the length of s in UTF-8, as the evaluator measures strings
+  const utf8 = new TextEncoder();
+  const byteLength = (s) => utf8.encode(s).length;
+
+  const methods = {
+    string: {
+      len: noArgs("len", (s) => BigInt(Array.from(s).length)),
+      upper: noArgs("upper", (s) => s.toUpperCase()),
+      lower: noArgs("lower", (s) => s.toLowerCase()),
+      trim: noArgs("trim", (s) => s.trim()),
+      split: (s, args) => stringArg("split", args) || (args[0] === "" ? Array.from(s) : s.split(args[0])),
+      contains: stringPredicate("contains", (s, sub) => s.includes(sub)),
+      starts_with: stringPredicate("starts_with", (s, prefix) => s.startsWith(prefix)),
+      ends_with: stringPredicate("ends_with", (s, suffix) => s.endsWith(suffix)),
+      repeat: (s, args) => {
+        const err = checkArgs("repeat", args, 1, 1);
+        if (err !== undefined) {
+          return err;
+        }
+        if (typeof args[0] !== "bigint" || args[0] < 0n) {
+          return new MonkeyError("argument of repeat must be a non-negative integer, got " + inspect(args[0]));
+        }
+        if (s.length > 0 && args[0] > BigInt(Math.floor(maxRepeatLength / byteLength(s)))) {
+          return new MonkeyError("result of repeat would be longer than " + maxRepeatLength + " bytes");
+        }
+        return s.repeat(Number(args[0]));
+      },
+    },
+    array: {
+      len: noArgs("len", (a) => BigInt(a.length)),
+      first: noArgs("first", (a) => a.length > 0 ? a[0] : null),
+      last: noArgs("last", (a) => a.length > 0 ? a[a.length - 1] : null),
+      rest: noArgs("rest", (a) => a.slice(1)),
+      push: (a, args) => checkArgs("push", args, 1, 1) || a.concat([args[0]]),
+      concat: (a, args) => {
+        const err = checkArgs("concat", args, 1, 1);
+        if (err !== undefined) {
+          return err;
+        }
+        if (!Array.isArray(args[0])) {
+          return new MonkeyError("argument of concat must be an array, got " + typeName(args[0]));
+        }
+        return a.concat(args[0]);
+      },
+      join: (a, args) => stringArg("join", args) || a.map((el) => typeof el === "string" ? el : inspect(el)).join(args[0]),
+      contains: (a, args) => checkArgs("contains", args, 1, 1) || a.some((el) => equals(el, args[0])),
+      reverse: noArgs("reverse", (a) => a.slice().reverse()),
+    },
+    hash: {
+      len: noArgs("len", (h) => BigInt(h.pairs.size)),
+      keys: noArgs("keys", (h) => Array.from(h.pairs.values(), (p) => p.key)),
+      values: noArgs("values", (h) => Array.from(h.pairs.values(), (p) => p.value)),
+      has: (h, args) => checkArgs("has", args, 1, 1) || hashKeyArg(args[0]) || h.get(args[0]) !== undefined,
+      get: (h, args) => {
+        const err = checkArgs("get", args, 1, 2) || hashKeyArg(args[0]);
+        if (err !== undefined) {
+          return err;
+        }
+        const v = h.get(args[0]);
+        return v !== undefined ? v : args.length === 2 ? args[1] : null;
+      },
+      set: (h, args) => {
+        const err = checkArgs("set", args, 2, 2) || hashKeyArg(args[0]);
+        if (err !== undefined) {
+          return err;
+        }
+        const res = copyHash(h);
+        res.set(args[0], args[1]);
+        return res;
+      },
+      delete: (h, args) => checkArgs("delete", args, 1, 1) || hashKeyArg(args[0]) || copyHash(h, args[0]),
+    },
+  };
+
+  // natives are the builtins working on arrays with functions, which they call with apply, as in the evaluator.
+  // Functions which fail throw their error, the natives return theirs like builtins.
+  const arrayAndFunction = (name, args, min, max) => {
+    const err = checkArgs(name, args, min, max);
+    if (err !== undefined) {
+      return err;
+    }
+    if (!Array.isArray(args[0])) {
+      return new MonkeyError("first argument of " + name + " must be an array, got " + typeName(args[0]));
+    }
+    if (args.length > 1 && !(args[1] instanceof Func) && !(args[1] instanceof Builtin)) {
+      return new MonkeyError("second argument of " + name + " must be a function, got " + typeName(args[1]));
+    }
+    return undefined;
+  };
+
+  // predicate calls f with args, which must give a truth value. It returns a MonkeyError if it does not.
+  const predicate = (apply, f, ...args) => {
+    const v = apply(f, ...args);
+    switch (typeName(v)) {
+      case "boolean": return v;
+      case "null": return false;
+      case "integer": return v !== 0n;
+    }
+    return new MonkeyError("unhandled type for bool conversion " + goType(v));
+  };
+
+  // mergeSort sorts els stably, using tmp as space, calling less in the same order as the evaluator
+  const mergeSort = (els, tmp, lo, hi, less) => {
+    if (hi - lo < 2) {
+      return undefined;
+    }
+    const mid = lo + Math.floor((hi - lo) / 2);
+    const err = mergeSort(els, tmp, lo, mid, less) || mergeSort(els, tmp, mid, hi, less);
+    if (err !== undefined) {
+      return err;
+    }
+    for (let i = lo; i < hi; i++) {
+      tmp[i] = els[i];
+    }
+    let i = lo;
+    let j = mid;
+    let k = lo;
+    for (; i < mid && j < hi; k++) {
+      const before = less(tmp[j], tmp[i]);
+      if (before instanceof MonkeyError) {
+        return before;
+      }
+      els[k] = before ? tmp[j++] : tmp[i++];
+    }
+    for (; i < mid; k++) {
+      els[k] = tmp[i++];
+    }
+    return undefined;
+  };
+
+  // codePointLess orders strings by code point, which is the order of their UTF-8 bytes the evaluator sorts by,
+  // unlike < comparing UTF-16 code units
+  const codePointLess = (a, b) => {
+    let i = 0;
+    while (i < a.length && i < b.length) {
+      const c = a.codePointAt(i), d = b.codePointAt(i);
+      if (c !== d) {
+        return c < d;
+      }
+      i += c > 0xffff ? 2 : 1;
+    }
+    return i >= a.length && i < b.length;
+  };
+
+  const naturalLess = (a, b) => {
+    if (typeof a === "bigint" && typeof b === "bigint") {
+      return a < b;
+    }
+    if (typeof a === "string" && typeof b === "string") {
+      return codePointLess(a, b);
+    }
+    return new MonkeyError("cannot sort " + typeName(a) + " and " + typeName(b) + " without a function to compare them");
+  };
+
+  // search is any if want is true, or all if it is false: it looks for an element for which f gives want
+  const search = (name, want) => (apply, args) => {
+    const err = arrayAndFunction(name, args, 2, 2);
+    if (err !== undefined) {
+      return err;
+    }
+    for (const el of args[0]) {
+      const got = predicate(apply, args[1], el);
+      if (got instanceof MonkeyError) {
+        return got;
+      }
+      if (got === want) {
+        return want;
+      }
+    }
+    return !want;
+  };
+
+  const natives = {
+    map: (apply, args) => arrayAndFunction("map", args, 2, 2) || args[0].map((el) => apply(args[1], el)),
+    filter: (apply, args) => {
+      const err = arrayAndFunction("filter", args, 2, 2);
+      if (err !== undefined) {
+        return err;
+      }
+      const res = [];
+      for (const el of args[0]) {
+        const keep = predicate(apply, args[1], el);
+        if (keep instanceof MonkeyError) {
+          return keep;
+        }
+        if (keep) {
+          res.push(el);
+        }
+      }
+      return res;
+    },
+    reduce: (apply, args) => arrayAndFunction("reduce", args, 3, 3) || args[0].reduce((acc, el) => apply(args[1], acc, el), args[2]),
+    each: (apply, args) => {
+      const err = arrayAndFunction("each", args, 2, 2);
+      if (err !== undefined) {
+        return err;
+      }
+      for (const el of args[0]) {
+        apply(args[1], el);
+      }
+      return null;
+    },
+    sort: (apply, args) => {
+      const err = arrayAndFunction("sort", args, 1, 2);
+      if (err !== undefined) {
+        return err;
+      }
+      const less = args.length === 2 ? (a, b) => predicate(apply, args[1], a, b) : naturalLess;
+      const res = args[0].slice();
+      return mergeSort(res, new Array(res.length), 0, res.length, less) || res;
+    },
+    zip: (apply, args) => {
+      const err = checkArgs("zip", args, 2, 2);
+      if (err !== undefined) {
+        return err;
+      }
+      if (!Array.isArray(args[0])) {
+        return new MonkeyError("first argument of zip must be an array, got " + typeName(args[0]));
+      }
+      if (!Array.isArray(args[1])) {
+        return new MonkeyError("second argument of zip must be an array, got " + typeName(args[1]));
+      }
+      const n = Math.min(args[0].length, args[1].length);
+      return args[0].slice(0, n).map((el, i) => [el, args[1][i]]);
+    },
+    range: (apply, args) => {
+      const err = checkArgs("range", args, 1, 3);
+      if (err !== undefined) {
+        return err;
+      }
+      for (const arg of args) {
+        if (typeof arg !== "bigint") {
+          return new MonkeyError("arguments of range must be integers, got " + typeName(arg));
+        }
+      }
+      const [start, end, step] = args.length === 1 ? [0n, args[0], 1n] : [args[0], args[1], args.length === 3 ? args[2] : 1n];
+      if (step === 0n) {
+        return new MonkeyError("step of range cannot be 0");
+      }
+      const res = [];
+      for (let n = start; step > 0n ? n < end : n > end; n += step) {
+        res.push(n);
+      }
+      return res;
+    },
+    any: search("any", true),
+    all: search("all", false),
+  };
+
+  const builtins = {
+    error: new Builtin("error", error),
+    json_encode: new Builtin("json_encode", jsonEncode),
+    json_decode: new Builtin("json_decode", jsonDecode),
+    freeze: new Builtin("freeze", freeze),
+  };
+
+  return {
+    MonkeyError, Hash, Func, StructType, inspect, display, run, main, bindName, lookup, truthy, prefix, infix, key, index, spread, concat,
+    throwValue, depth, caught, unwind, callable, call, tailCall, wildcard, binding, literal, withDefault,
+    arrayPattern, hashPattern, match, destructure, noMatch, fail, structType, literalField, newStruct, member, setField,
+  };
+})();
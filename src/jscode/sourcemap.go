@@ -0,0 +1,162 @@
+package jscode
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// mapping ties a position of the generated code to one of the monkey source.
+// Lines and columns start from 0, columns counting UTF-16 code units as in JavaScript.
+type mapping struct {
+	genLine, genCol int
+	srcLine, srcCol int
+}
+
+// layout indents code, which is written without indentation, and takes out the markers
+// of its lines, returning where they were as mappings. code starts at line firstLine of the output.
+func layout(code string, firstLine int) ([]byte, []mapping) {
+	var out bytes.Buffer
+	mappings := []mapping{}
+
+	// the brackets opened by each line indenting the next ones, a line indenting by one level however many it opens
+	levels := []int{}
+	for i, text := range strings.SplitAfter(code, "\n") {
+		var stripped strings.Builder
+		marks := []mapping{}
+		for {
+			start := strings.IndexRune(text, marker)
+			if start < 0 {
+				stripped.WriteString(text)
+				break
+			}
+			stripped.WriteString(text[:start])
+			end := strings.IndexRune(text[start+1:], marker) + start + 1
+			if l, c, ok := parsePosition(text[start+1 : end]); ok {
+				col := len(utf16.Encode([]rune(strings.TrimLeft(stripped.String(), " \t"))))
+				marks = append(marks, mapping{genLine: firstLine + i, genCol: col, srcLine: l - 1, srcCol: c - 1})
+			}
+			text = text[end+1:]
+		}
+		line := strings.TrimLeft(stripped.String(), " \t")
+
+		closing := 0
+		for closing < len(line) && strings.IndexByte("}])", line[closing]) >= 0 {
+			closing++
+		}
+		levels = closeBrackets(levels, closing)
+		indent := len(levels)
+		if strings.TrimSpace(line) != "" {
+			out.WriteString(strings.Repeat("  ", indent))
+		}
+		out.WriteString(line)
+
+		for _, m := range marks {
+			m.genCol += 2 * indent
+			mappings = append(mappings, m)
+		}
+		if n := nesting(line[closing:]); n > 0 {
+			levels = append(levels, n)
+		} else {
+			levels = closeBrackets(levels, -n)
+		}
+	}
+	return out.Bytes(), mappings
+}
+
+// closeBrackets closes n brackets of levels, removing the levels whose brackets are all closed.
+func closeBrackets(levels []int, n int) []int {
+	for n > 0 && len(levels) > 0 {
+		closed := n
+		if last := levels[len(levels)-1]; last < closed {
+			closed = last
+		}
+		levels[len(levels)-1] -= closed
+		n -= closed
+		if levels[len(levels)-1] == 0 {
+			levels = levels[:len(levels)-1]
+		}
+	}
+	return levels
+}
+
+func parsePosition(s string) (line int, column int, ok bool) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+	line, err1 := strconv.Atoi(parts[0])
+	column, err2 := strconv.Atoi(parts[1])
+	return line, column, err1 == nil && err2 == nil
+}
+
+// nesting is how many more brackets text opens than it closes, outside of strings.
+func nesting(text string) int {
+	res := 0
+	inString := false
+	for i := 0; i < len(text); i++ {
+		switch c := text[i]; {
+		case inString && c == '\\':
+			i++
+		case c == '"':
+			inString = !inString
+		case inString:
+		case c == '{' || c == '[' || c == '(':
+			res++
+		case c == '}' || c == ']' || c == ')':
+			res--
+		}
+	}
+	return res
+}
+
+// encodeMappings encodes mappings in the "mappings" field of a source map, version 3.
+// They must be sorted by generated position.
+func encodeMappings(mappings []mapping) string {
+	var res strings.Builder
+	line, prevCol, prevSrcLine, prevSrcCol := 0, 0, 0, 0
+	first := true
+
+	for _, m := range mappings {
+		for line < m.genLine {
+			res.WriteByte(';')
+			line++
+			prevCol = 0
+			first = true
+		}
+		if !first {
+			res.WriteByte(',')
+		}
+		first = false
+
+		writeVLQ(&res, m.genCol-prevCol)
+		writeVLQ(&res, 0) // the only source
+		writeVLQ(&res, m.srcLine-prevSrcLine)
+		writeVLQ(&res, m.srcCol-prevSrcCol)
+		prevCol, prevSrcLine, prevSrcCol = m.genCol, m.srcLine, m.srcCol
+	}
+	return res.String()
+}
+
+const base64Digits = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+
+// writeVLQ writes n in base 64, 5 bits at a time with the least significant first,
+// the lowest bit of the first digit being the sign.
+func writeVLQ(b *strings.Builder, n int) {
+	v := n << 1
+	if n < 0 {
+		v = (-n << 1) | 1
+	}
+	for {
+		digit := v & 31
+		v >>= 5
+		if v > 0 {
+			digit |= 32
+		}
+		b.WriteByte(base64Digits[digit])
+		if v == 0 {
+			return
+		}
+	}
+}
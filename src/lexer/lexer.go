@@ -1,20 +1,35 @@
 package lexer
 
-import "token"
+import (
+	"bytes"
+	"token"
+)
 
 type Lexer struct {
 	input    string
 	position int // points to the ch
 	readPos  int
 	ch       byte // current char
+	line     int  // line of ch
+	column   int  // column of ch
+
+	// the braces opened in each of the interpolations of template strings being read, innermost last
+	templates []int
 }
 
 func New(input string) *Lexer {
-	res := &Lexer{input: input}
+	res := &Lexer{input: input, line: 1}
 	res.readChar()
 	return res
 }
 
+// Copy returns a lexer reading the same tokens as lx from where it is, independently of it.
+func (lx *Lexer) Copy() *Lexer {
+	res := *lx
+	res.templates = append([]int(nil), lx.templates...)
+	return &res
+}
+
 func (lx *Lexer) NextToken() token.Token {
 	res := token.Token{}
 
@@ -30,6 +45,7 @@ func (lx *Lexer) NextToken() token.Token {
 	for lx.ch == ' ' || lx.ch == '\t' || lx.ch == '\n' || lx.ch == '\r' {
 		lx.readChar()
 	}
+	pos := token.Position{Line: lx.line, Column: lx.column}
 
 	peekChar := func() byte {
 		if lx.readPos >= len(lx.input) {
@@ -44,7 +60,11 @@ func (lx *Lexer) NextToken() token.Token {
 		fallthrough
 	case '!':
 		firstChar := lx.ch
-		if peekChar() == '=' {
+		if firstChar == '=' && peekChar() == '>' {
+			lx.readChar()
+			res.Type = token.ARROW
+			res.Literal = "=>"
+		} else if peekChar() == '=' {
 			lx.readChar() // we really want to suck one character
 			if firstChar == '=' {
 				res.Type = token.EQ
@@ -67,15 +87,91 @@ func (lx *Lexer) NextToken() token.Token {
 	case ')':
 		res = newToken(token.RPAREN, lx.ch)
 	case '{':
+		if n := len(lx.templates); n > 0 {
+			lx.templates[n-1]++
+		}
 		res = newToken(token.LBRACE, lx.ch)
 	case '}':
+		n := len(lx.templates)
+		if n > 0 && lx.templates[n-1] == 0 {
+			// the end of an interpolation, the template string goes on
+			str, more, ok := lx.readString()
+			switch {
+			case !ok:
+				res.Type = token.ILLEGAL
+				res.Literal = "unterminated string"
+			case more:
+				res.Type = token.TEMPLATE_MIDDLE
+				res.Literal = str
+			default:
+				res.Type = token.TEMPLATE_END
+				res.Literal = str
+			}
+			if !more {
+				lx.templates = lx.templates[:n-1]
+			}
+			break
+		}
+		if n > 0 {
+			lx.templates[n-1]--
+		}
 		res = newToken(token.RBRACE, lx.ch)
+	case '[':
+		res = newToken(token.LBRACKET, lx.ch)
+	case ']':
+		res = newToken(token.RBRACKET, lx.ch)
+	case '"':
+		if str, more, ok := lx.readString(); ok {
+			res.Type = token.STRING
+			if more {
+				res.Type = token.TEMPLATE_START
+				lx.templates = append(lx.templates, 0)
+			}
+			res.Literal = str
+		} else {
+			res.Type = token.ILLEGAL
+			res.Literal = "unterminated string"
+		}
 	case ',':
 		res = newToken(token.COMMA, lx.ch)
+	case ':':
+		res = newToken(token.COLON, lx.ch)
+	case '.':
+		if peekChar() == '.' && lx.readPos+1 < len(lx.input) && lx.input[lx.readPos+1] == '.' {
+			lx.readChar()
+			lx.readChar()
+			res.Type = token.ELLIPSIS
+			res.Literal = "..."
+		} else {
+			res = newToken(token.DOT, lx.ch)
+		}
+	case '?':
+		switch peekChar() {
+		case '?':
+			lx.readChar()
+			res.Type = token.COALESCE
+			res.Literal = "??"
+		case '.':
+			lx.readChar()
+			res.Type = token.OPTIONAL_DOT
+			res.Literal = "?."
+		case '[':
+			lx.readChar()
+			res.Type = token.OPTIONAL_LBRACKET
+			res.Literal = "?["
+		default:
+			res = newToken(token.ILLEGAL, lx.ch)
+		}
 	case '+':
 		res = newToken(token.PLUS, lx.ch)
 	case '-':
-		res = newToken(token.MINUS, lx.ch)
+		if peekChar() == '>' {
+			lx.readChar()
+			res.Type = token.RARROW
+			res.Literal = "->"
+		} else {
+			res = newToken(token.MINUS, lx.ch)
+		}
 	case '/':
 		res = newToken(token.SLASH, lx.ch)
 	case '*':
@@ -105,6 +201,7 @@ func (lx *Lexer) NextToken() token.Token {
 			}
 			res.Literal = readIdentifier()
 			res.Type = token.LookupIdent(res.Literal)
+			res.Pos = pos
 			return res
 
 		} else if isDigit(lx.ch) {
@@ -117,6 +214,7 @@ func (lx *Lexer) NextToken() token.Token {
 			}
 			res.Type = token.INT
 			res.Literal = readNumber()
+			res.Pos = pos
 			return res
 
 		} else {
@@ -125,10 +223,20 @@ func (lx *Lexer) NextToken() token.Token {
 	}
 
 	lx.readChar()
+	res.Pos = pos
 	return res
 }
 
 func (lx *Lexer) readChar() {
+	if lx.readPos > len(lx.input) {
+		// the end was already reached, and stays at the same position
+		return
+	}
+	if lx.ch == '\n' {
+		lx.line++
+		lx.column = 0
+	}
+
 	if lx.readPos >= len(lx.input) {
 		lx.ch = 0
 	} else {
@@ -136,4 +244,42 @@ func (lx *Lexer) readChar() {
 	}
 	lx.position = lx.readPos
 	lx.readPos++
+	lx.column++
+}
+
+// readString reads a string literal starting at the opening quote and leaves ch at the closing quote.
+// In template strings, it stops at the `${` starting an interpolation instead, leaving ch at its brace,
+// and tells that more of the string follows. It is then called again at the brace ending the interpolation.
+// The result has its escape sequences already resolved, so `\$` keeps a dollar from starting an interpolation.
+func (lx *Lexer) readString() (result string, more bool, ok bool) {
+	buf := bytes.Buffer{}
+	for {
+		lx.readChar()
+		switch lx.ch {
+		case 0:
+			return "", false, false
+		case '"':
+			return buf.String(), false, true
+		case '$':
+			if lx.readPos < len(lx.input) && lx.input[lx.readPos] == '{' {
+				lx.readChar()
+				return buf.String(), true, true
+			}
+			buf.WriteByte(lx.ch)
+		case '\\':
+			lx.readChar()
+			switch lx.ch {
+			case 'n':
+				buf.WriteByte('\n')
+			case 't':
+				buf.WriteByte('\t')
+			case 0:
+				return "", false, false
+			default:
+				buf.WriteByte(lx.ch)
+			}
+		default:
+			buf.WriteByte(lx.ch)
+		}
+	}
 }
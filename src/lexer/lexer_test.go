@@ -155,3 +155,144 @@ func TestNextToken2(t *testing.T) {
 		}
 	}
 }
+
+func TestStringsAndBrackets(t *testing.T) {
+	input := `"foo bar" "a\"b\\c\n" [1, "x"] throw try catch finally match => : ... -> - > struct p.x null a ?? b?.c?[0] ?`
+
+	tests := []struct {
+		expectedType    token.Type
+		expectedLiteral string
+	}{
+		{token.STRING, "foo bar"},
+		{token.STRING, "a\"b\\c\n"},
+		{token.LBRACKET, "["},
+		{token.INT, "1"},
+		{token.COMMA, ","},
+		{token.STRING, "x"},
+		{token.RBRACKET, "]"},
+		{token.THROW, "throw"},
+		{token.TRY, "try"},
+		{token.CATCH, "catch"},
+		{token.FINALLY, "finally"},
+		{token.MATCH, "match"},
+		{token.ARROW, "=>"},
+		{token.COLON, ":"},
+		{token.ELLIPSIS, "..."},
+		{token.RARROW, "->"},
+		{token.MINUS, "-"},
+		{token.GT, ">"},
+		{token.STRUCT, "struct"},
+		{token.IDENT, "p"},
+		{token.DOT, "."},
+		{token.IDENT, "x"},
+		{token.NULL, "null"},
+		{token.IDENT, "a"},
+		{token.COALESCE, "??"},
+		{token.IDENT, "b"},
+		{token.OPTIONAL_DOT, "?."},
+		{token.IDENT, "c"},
+		{token.OPTIONAL_LBRACKET, "?["},
+		{token.INT, "0"},
+		{token.RBRACKET, "]"},
+		{token.ILLEGAL, "?"},
+		{token.EOF, ""},
+	}
+
+	lx := New(input)
+
+	for i, tt := range tests {
+		tok := lx.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("test %d: token type is wrong. Expected %q, got %q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("test %d: literal is wrong. Expected %q, got %q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+
+	tok := New(`"unterminated`).NextToken()
+	if tok.Type != token.ILLEGAL {
+		t.Fatalf("unterminated string must be illegal. got %q", tok.Type)
+	}
+}
+
+func TestTemplateStrings(t *testing.T) {
+	input := `"a ${x} b ${ {"k": "}"}["k"] } c${"${y}"}" "$ \${z}" }`
+
+	tests := []struct {
+		expectedType    token.Type
+		expectedLiteral string
+	}{
+		{token.TEMPLATE_START, "a "},
+		{token.IDENT, "x"},
+		{token.TEMPLATE_MIDDLE, " b "},
+		{token.LBRACE, "{"},
+		{token.STRING, "k"},
+		{token.COLON, ":"},
+		{token.STRING, "}"},
+		{token.RBRACE, "}"},
+		{token.LBRACKET, "["},
+		{token.STRING, "k"},
+		{token.RBRACKET, "]"},
+		{token.TEMPLATE_MIDDLE, " c"},
+		{token.TEMPLATE_START, ""},
+		{token.IDENT, "y"},
+		{token.TEMPLATE_END, ""},
+		{token.TEMPLATE_END, ""},
+		{token.STRING, "$ ${z}"},
+		{token.RBRACE, "}"},
+		{token.EOF, ""},
+	}
+
+	lx := New(input)
+
+	for i, tt := range tests {
+		tok := lx.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("test %d: token type is wrong. Expected %q, got %q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("test %d: literal is wrong. Expected %q, got %q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+
+	lx = New(`"a ${x} b`)
+	for _, typ := range []token.Type{token.TEMPLATE_START, token.IDENT, token.ILLEGAL} {
+		if tok := lx.NextToken(); tok.Type != typ {
+			t.Fatalf("unterminated template string: expected %q, got %q", typ, tok.Type)
+		}
+	}
+}
+
+func TestPositions(t *testing.T) {
+	input := "let x = 5;\n  x + 10"
+
+	tests := []struct {
+		line   int
+		column int
+	}{
+		{1, 1},
+		{1, 5},
+		{1, 7},
+		{1, 9},
+		{1, 10},
+		{2, 3},
+		{2, 5},
+		{2, 7},
+		{2, 9},
+	}
+
+	lx := New(input)
+
+	for i, tt := range tests {
+		tok := lx.NextToken()
+
+		if tok.Pos.Line != tt.line || tok.Pos.Column != tt.column {
+			t.Fatalf("test %d: position of %q is wrong. Expected %d:%d, got %s", i, tok.Literal, tt.line, tt.column, tok.Pos)
+		}
+	}
+}
@@ -8,6 +8,24 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "check":
+			os.Exit(check(os.Args[2:]))
+		case "tokens":
+			os.Exit(dumpTokens(os.Args[2:]))
+		case "ast":
+			os.Exit(dumpAST(os.Args[2:]))
+		case "run":
+			os.Exit(run(os.Args[2:]))
+		case "build":
+			os.Exit(build(os.Args[2:]))
+		default:
+			fmt.Fprintf(os.Stderr, "unknown command %q\n", os.Args[1])
+			os.Exit(2)
+		}
+	}
+
 	u, err := user.Current()
 	if err != nil {
 		panic(err)
@@ -1,8 +1,20 @@
 package object
 
+import (
+	"fmt"
+	"sort"
+)
+
+// Environment holds the bindings of a scope. Names known in advance by the resolver
+// are kept in slots, which are indexed directly; other names go to a map,
+// as in the global scope where the REPL keeps adding new ones.
 type Environment struct {
 	vars  map[string]Object
+	names []string // name of each slot
+	slots []Object // nil until bound
 	outer *Environment
+
+	consts map[string]bool // names bound by const, nil if none
 }
 
 func NewEnvironment() *Environment {
@@ -15,8 +27,20 @@ func (env *Environment) NewLinkedEnvironment() *Environment {
 	return res
 }
 
+// NewFrame makes an inner scope with a slot for each of names.
+func (env *Environment) NewFrame(names []string) *Environment {
+	return &Environment{names: names, slots: make([]Object, len(names)), outer: env}
+}
+
 func (env *Environment) Get(name string) (result Object, ok bool) {
 	result, ok = env.vars[name]
+	if !ok {
+		for i, n := range env.names {
+			if n == name && env.slots[i] != nil {
+				return env.slots[i], true
+			}
+		}
+	}
 	if !ok && env.outer != nil {
 		result, ok = env.outer.Get(name)
 	}
@@ -24,5 +48,124 @@ func (env *Environment) Get(name string) (result Object, ok bool) {
 }
 
 func (env *Environment) Set(name string, value Object) {
+	for i, n := range env.names {
+		if n == name {
+			env.slots[i] = value
+			return
+		}
+	}
+	if env.vars == nil {
+		env.vars = make(map[string]Object)
+	}
 	env.vars[name] = value
 }
+
+// SetConst marks name, which must be bound in env, as bound for good.
+func (env *Environment) SetConst(name string) {
+	if env.consts == nil {
+		env.consts = make(map[string]bool)
+	}
+	env.consts[name] = true
+}
+
+// IsConst tells whether name is bound by const in env itself, not looking into the outer environments.
+func (env *Environment) IsConst(name string) bool {
+	return env.consts[name]
+}
+
+// GetSlot gets the binding in slot of the scope depth levels up.
+// If the slot is not bound yet, name still refers to whatever it means in the outer scopes.
+func (env *Environment) GetSlot(depth int, slot int, name string) (result Object, ok bool) {
+	for ; depth > 0; depth-- {
+		env = env.outer
+	}
+	if result = env.slots[slot]; result != nil {
+		return result, true
+	}
+	if env.outer != nil {
+		return env.outer.Get(name)
+	}
+	return nil, false
+}
+
+func (env *Environment) SetSlot(slot int, value Object) {
+	env.slots[slot] = value
+}
+
+// Names returns the names bound in env and its outer environments, in alphabetical order.
+func (env *Environment) Names() []string {
+	seen := map[string]bool{}
+	for ; env != nil; env = env.outer {
+		for name := range env.vars {
+			seen[name] = true
+		}
+		for i, name := range env.names {
+			if env.slots[i] != nil {
+				seen[name] = true
+			}
+		}
+	}
+
+	res := []string{}
+	for name := range seen {
+		res = append(res, name)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// Snapshot is a copy of the bindings of an Environment and of its outer ones, see Environment.Snapshot.
+type Snapshot struct {
+	env    *Environment
+	vars   map[string]Object
+	slots  []Object
+	consts map[string]bool
+	outer  *Snapshot
+}
+
+// Snapshot copies the current bindings of env and of its outer environments,
+// so that they can be put back later with Restore. Values are shared, not copied,
+// as nothing but the fields of structs that are not frozen can change once made.
+func (env *Environment) Snapshot() *Snapshot {
+	res := &Snapshot{env: env, slots: append([]Object(nil), env.slots...)}
+	if env.vars != nil {
+		res.vars = make(map[string]Object, len(env.vars))
+		for name, value := range env.vars {
+			res.vars[name] = value
+		}
+	}
+	if env.consts != nil {
+		res.consts = make(map[string]bool, len(env.consts))
+		for name := range env.consts {
+			res.consts[name] = true
+		}
+	}
+	if env.outer != nil {
+		res.outer = env.outer.Snapshot()
+	}
+	return res
+}
+
+// Restore puts back the bindings from s, which must be a snapshot of env.
+// Names bound since the snapshot are removed. Functions defined in env keep referring to it,
+// so they see the restored bindings as well.
+func (env *Environment) Restore(s *Snapshot) error {
+	if s.env != env {
+		return fmt.Errorf("cannot restore a snapshot of another environment")
+	}
+	for ; s != nil; s = s.outer {
+		s.env.vars = nil
+		if s.vars != nil {
+			s.env.vars = make(map[string]Object, len(s.vars))
+			for name, value := range s.vars {
+				s.env.vars[name] = value
+			}
+		}
+		copy(s.env.slots, s.slots)
+		s.env.consts = nil
+		for name := range s.consts {
+			s.env.SetConst(name)
+		}
+	}
+	return nil
+}
@@ -3,20 +3,64 @@ package object
 import (
 	"ast"
 	"fmt"
+	"strconv"
 	"strings"
+	"token"
 )
 
 type Type int
 
 const (
-	TYPE_INTEGER  = iota + 1
+	TYPE_INTEGER = iota + 1
 	TYPE_BOOLEAN
 	TYPE_NULL
 	TYPE_RETURN
 	TYPE_ERROR
 	TYPE_FUNCTION
+	TYPE_STRING
+	TYPE_ARRAY
+	TYPE_BUILTIN
+	TYPE_ERROR_VALUE
+	TYPE_HASH
+	TYPE_TAIL_CALL
+	TYPE_STRUCT_TYPE
+	TYPE_STRUCT
 )
 
+func (t Type) String() string {
+	switch t {
+	case TYPE_INTEGER:
+		return "integer"
+	case TYPE_BOOLEAN:
+		return "boolean"
+	case TYPE_NULL:
+		return "null"
+	case TYPE_RETURN:
+		return "return"
+	case TYPE_ERROR:
+		return "error"
+	case TYPE_FUNCTION:
+		return "function"
+	case TYPE_STRING:
+		return "string"
+	case TYPE_ARRAY:
+		return "array"
+	case TYPE_BUILTIN:
+		return "builtin"
+	case TYPE_ERROR_VALUE:
+		return "error value"
+	case TYPE_HASH:
+		return "hash"
+	case TYPE_TAIL_CALL:
+		return "tail call"
+	case TYPE_STRUCT_TYPE:
+		return "struct type"
+	case TYPE_STRUCT:
+		return "struct"
+	}
+	return fmt.Sprintf("Type(%d)", int(t))
+}
+
 type Object interface {
 	Type() Type
 	Inspect() string
@@ -47,6 +91,22 @@ func (b *Boolean) Type() Type {
 type Null struct {
 }
 
+// Booleans and null carry no state besides their type and value,
+// so a single shared instance of each is used everywhere.
+var (
+	TRUE  = &Boolean{Value: true}
+	FALSE = &Boolean{Value: false}
+	NULL  = &Null{}
+)
+
+// NativeBool returns the shared Boolean for b.
+func NativeBool(b bool) *Boolean {
+	if b {
+		return TRUE
+	}
+	return FALSE
+}
+
 func (n *Null) Inspect() string {
 	return "null"
 }
@@ -65,11 +125,19 @@ func (r *Return) Type() Type {
 	return TYPE_RETURN
 }
 
+// Error is a runtime error, either raised by the interpreter or thrown by the script.
+// It aborts the evaluation until it is caught by a try expression.
 type Error struct {
-	Message string
+	Message  string
+	Data     Object // value attached by the script, nil if none
+	Position token.Position
+	Stack    []string // innermost call first
 }
 
 func (e *Error) Inspect() string {
+	if e.Position.IsValid() {
+		return fmt.Sprintf("ERROR(%q) at %s", e.Message, e.Position)
+	}
 	return fmt.Sprintf("ERROR(%q)", e.Message)
 }
 func (e *Error) Type() Type {
@@ -77,14 +145,237 @@ func (e *Error) Type() Type {
 }
 
 type Function struct {
-	Params []string
-	Body   *ast.BlockStatement
-	Env    *Environment
+	Params   []string
+	Defaults []ast.Expression // default value of each of Params, nil if it has none
+	Rest     string           // parameter collecting the remaining arguments, empty if there is none
+	Body     *ast.BlockStatement
+	Env      *Environment
+	Locals   []string // slots of the scope of a call, if resolved
+}
+
+func (f *Function) paramsString() string {
+	params := []string{}
+	for i, name := range f.Params {
+		if i < len(f.Defaults) && f.Defaults[i] != nil {
+			params = append(params, fmt.Sprintf("%s = %s", name, f.Defaults[i]))
+		} else {
+			params = append(params, name)
+		}
+	}
+	if f.Rest != "" {
+		params = append(params, "..."+f.Rest)
+	}
+	return strings.Join(params, ", ")
+}
+
+// Signature describes how the function is called, for error messages.
+func (f *Function) Signature() string {
+	return fmt.Sprintf("fn(%s)", f.paramsString())
 }
 
 func (f *Function) Inspect() string {
-	return fmt.Sprintf("fn (%s) %s", strings.Join(f.Params, ", "), f.Body)
+	return fmt.Sprintf("fn (%s) %s", f.paramsString(), f.Body)
 }
 func (f *Function) Type() Type {
 	return TYPE_FUNCTION
 }
+
+type String struct {
+	Value string
+}
+
+func (s *String) Inspect() string {
+	return strconv.Quote(s.Value)
+}
+func (s *String) Type() Type {
+	return TYPE_STRING
+}
+
+// Display is how obj is shown in a template string: strings as they are, other values as Inspect shows them.
+func Display(obj Object) string {
+	if s, ok := obj.(*String); ok {
+		return s.Value
+	}
+	return obj.Inspect()
+}
+
+type Array struct {
+	Elements []Object
+}
+
+func (a *Array) Inspect() string {
+	return inspect(a, map[*Struct]bool{})
+}
+func (a *Array) Type() Type {
+	return TYPE_ARRAY
+}
+
+type Builtin struct {
+	Name string
+	Fn   func(args ...Object) Object
+}
+
+func (b *Builtin) Inspect() string {
+	return fmt.Sprintf("builtin %s", b.Name)
+}
+func (b *Builtin) Type() Type {
+	return TYPE_BUILTIN
+}
+
+// ErrorValue is an error as seen by the script, that is a caught Error or one made by error().
+// Unlike Error, it does not abort the evaluation and can be passed around like any other value.
+type ErrorValue struct {
+	Err *Error
+}
+
+func (ev *ErrorValue) Inspect() string {
+	return inspect(ev, map[*Struct]bool{})
+}
+func (ev *ErrorValue) Type() Type {
+	return TYPE_ERROR_VALUE
+}
+
+// Hashable is implemented by the objects that can be used as hash keys.
+type Hashable interface {
+	Object
+	HashKey() HashKey
+}
+
+type HashKey struct {
+	Type  Type
+	Value string
+}
+
+func (i *Integer) HashKey() HashKey {
+	return HashKey{Type: TYPE_INTEGER, Value: i.Inspect()}
+}
+func (b *Boolean) HashKey() HashKey {
+	return HashKey{Type: TYPE_BOOLEAN, Value: b.Inspect()}
+}
+func (s *String) HashKey() HashKey {
+	return HashKey{Type: TYPE_STRING, Value: s.Value}
+}
+
+type HashPair struct {
+	Key   Object
+	Value Object
+}
+
+type Hash struct {
+	Pairs map[HashKey]HashPair
+	Order []HashKey // keys in insertion order
+}
+
+func NewHash() *Hash {
+	return &Hash{Pairs: make(map[HashKey]HashPair)}
+}
+
+func (h *Hash) Get(key Hashable) (value Object, ok bool) {
+	pair, ok := h.Pairs[key.HashKey()]
+	return pair.Value, ok
+}
+
+func (h *Hash) Set(key Hashable, value Object) {
+	hk := key.HashKey()
+	if _, ok := h.Pairs[hk]; !ok {
+		h.Order = append(h.Order, hk)
+	}
+	h.Pairs[hk] = HashPair{Key: key, Value: value}
+}
+
+func (h *Hash) Inspect() string {
+	return inspect(h, map[*Struct]bool{})
+}
+func (h *Hash) Type() Type {
+	return TYPE_HASH
+}
+
+// Members is implemented by the values having named members of their own, like the fields of a struct.
+// They are got with value.name, before the methods of the type of the value.
+type Members interface {
+	Object
+	Member(name string) (Object, bool)
+}
+
+// StructType is the type declared by a struct statement. Its structs have the fields in Fields.
+type StructType struct {
+	Name   string
+	Fields []string
+}
+
+// Field returns the index of the field called name, or -1 if there is none.
+func (st *StructType) Field(name string) int {
+	for i, f := range st.Fields {
+		if f == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func (st *StructType) Inspect() string {
+	return fmt.Sprintf("struct %s {%s}", st.Name, strings.Join(st.Fields, ", "))
+}
+func (st *StructType) Type() Type {
+	return TYPE_STRUCT_TYPE
+}
+
+// Struct is a value of a StructType. Unlike other values, its fields can be changed in place,
+// until it is frozen.
+type Struct struct {
+	StructType *StructType
+	Fields     []Object // value of each of StructType.Fields
+	Frozen     bool
+}
+
+func (s *Struct) Member(name string) (Object, bool) {
+	if i := s.StructType.Field(name); i >= 0 {
+		return s.Fields[i], true
+	}
+	return nil, false
+}
+
+func (s *Struct) Inspect() string {
+	return inspect(s, map[*Struct]bool{})
+}
+func (s *Struct) Type() Type {
+	return TYPE_STRUCT
+}
+
+// inspect is the Inspect of obj, which is inside the structs in seen. As fields can be set to
+// the struct holding them, a struct met again inside itself is shown as <cycle>.
+func inspect(obj Object, seen map[*Struct]bool) string {
+	switch obj := obj.(type) {
+	case *Array:
+		elements := []string{}
+		for _, el := range obj.Elements {
+			elements = append(elements, inspect(el, seen))
+		}
+		return fmt.Sprintf("[%s]", strings.Join(elements, ", "))
+	case *Hash:
+		pairs := []string{}
+		for _, hk := range obj.Order {
+			pair := obj.Pairs[hk]
+			pairs = append(pairs, fmt.Sprintf("%s: %s", pair.Key.Inspect(), inspect(pair.Value, seen)))
+		}
+		return fmt.Sprintf("{%s}", strings.Join(pairs, ", "))
+	case *Struct:
+		if seen[obj] {
+			return "<cycle>"
+		}
+		seen[obj] = true
+		defer delete(seen, obj)
+
+		fields := []string{}
+		for i, name := range obj.StructType.Fields {
+			fields = append(fields, fmt.Sprintf("%s: %s", name, inspect(obj.Fields[i], seen)))
+		}
+		return fmt.Sprintf("%s{%s}", obj.StructType.Name, strings.Join(fields, ", "))
+	case *ErrorValue:
+		if obj.Err.Data != nil {
+			return fmt.Sprintf("error(%q, %s)", obj.Err.Message, inspect(obj.Err.Data, seen))
+		}
+		return fmt.Sprintf("error(%q)", obj.Err.Message)
+	}
+	return obj.Inspect()
+}
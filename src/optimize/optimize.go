@@ -0,0 +1,211 @@
+// Package optimize rewrites programs into equivalent ones that are cheaper to evaluate.
+package optimize
+
+import (
+	"ast"
+	"evaluator"
+	"object"
+	"strconv"
+	"token"
+)
+
+// Program optimizes prog in place. It folds the operators and template strings whose operands are all literals,
+// and drops the branches of if expressions whose condition is a literal.
+// It is meant to be run after parsing and before resolving.
+func Program(prog *ast.Program) {
+	for i, s := range prog.Statements {
+		prog.Statements[i] = statement(s)
+	}
+}
+
+func block(b *ast.BlockStatement) {
+	if b == nil {
+		return
+	}
+	for i, s := range b.Statements {
+		b.Statements[i] = statement(s)
+	}
+}
+
+func statement(s ast.Statement) ast.Statement {
+	switch s := s.(type) {
+	case *ast.ExpressionStatement:
+		s.Expression = expression(s.Expression)
+	case *ast.LetStatement:
+		if s.Pattern != nil {
+			pattern(s.Pattern)
+		}
+		s.Value = expression(s.Value)
+	case *ast.ReturnStatement:
+		s.Value = expression(s.Value)
+	case *ast.ThrowStatement:
+		s.Value = expression(s.Value)
+	case *ast.FunctionStatement:
+		expression(s.Function)
+	case *ast.BlockStatement:
+		block(s)
+	case *ast.AssignStatement:
+		s.Target.Left = expression(s.Target.Left)
+		s.Value = expression(s.Value)
+	}
+	return s
+}
+
+func pattern(p ast.Pattern) {
+	switch p := p.(type) {
+	case *ast.ArrayPattern:
+		for _, el := range p.Elements {
+			pattern(el)
+		}
+	case *ast.HashPattern:
+		for _, pair := range p.Pairs {
+			pattern(pair.Value)
+		}
+	case *ast.DefaultPattern:
+		pattern(p.Pattern)
+		p.Default = expression(p.Default)
+	}
+}
+
+func expression(e ast.Expression) ast.Expression {
+	switch e := e.(type) {
+	case *ast.PrefixExpression:
+		e.Expression = expression(e.Expression)
+		if isLiteral(e.Expression) {
+			return fold(e)
+		}
+	case *ast.InfixExpression:
+		e.Left = expression(e.Left)
+		e.Right = expression(e.Right)
+		if isLiteral(e.Left) && isLiteral(e.Right) {
+			return fold(e)
+		}
+	case *ast.TemplateLiteral:
+		literals := true
+		for i, ex := range e.Expressions {
+			e.Expressions[i] = expression(ex)
+			literals = literals && isLiteral(e.Expressions[i])
+		}
+		if literals {
+			return fold(e)
+		}
+	case *ast.IfExpression:
+		return ifExpression(e)
+	case *ast.FunctionExpression:
+		for i, d := range e.Defaults {
+			if d != nil {
+				e.Defaults[i] = expression(d)
+			}
+		}
+		block(e.Body)
+	case *ast.CallExpression:
+		e.Function = expression(e.Function)
+		for i, arg := range e.Arguments {
+			e.Arguments[i] = expression(arg)
+		}
+	case *ast.ArrayLiteral:
+		for i, el := range e.Elements {
+			e.Elements[i] = expression(el)
+		}
+	case *ast.HashLiteral:
+		for _, pair := range e.Pairs {
+			pair.Key = expression(pair.Key)
+			pair.Value = expression(pair.Value)
+		}
+	case *ast.IndexExpression:
+		e.Left = expression(e.Left)
+		e.Index = expression(e.Index)
+	case *ast.TryExpression:
+		block(e.Body)
+		block(e.Catch)
+		block(e.Finally)
+	case *ast.MatchExpression:
+		e.Subject = expression(e.Subject)
+		for _, arm := range e.Arms {
+			pattern(arm.Pattern)
+			if arm.Guard != nil {
+				arm.Guard = expression(arm.Guard)
+			}
+			arm.Body = expression(arm.Body)
+		}
+	case *ast.StructLiteral:
+		e.Type = expression(e.Type)
+		for _, f := range e.Fields {
+			f.Value = expression(f.Value)
+		}
+	case *ast.FieldExpression:
+		e.Left = expression(e.Left)
+	case *ast.SpreadExpression:
+		e.Value = expression(e.Value)
+	case *ast.NamedArgument:
+		e.Value = expression(e.Value)
+	}
+	return e
+}
+
+func isLiteral(e ast.Expression) bool {
+	switch e.(type) {
+	case *ast.IntegerLiteral, *ast.BooleanLiteral, *ast.StringLiteral:
+		return true
+	}
+	return false
+}
+
+// fold evaluates e, whose operands are literals, and returns the literal of the result.
+// Operations that fail are kept as they are, so that they still fail at run time
+// with the usual error and position.
+func fold(e ast.Expression) ast.Expression {
+	pos := e.Pos()
+	switch res := evaluator.Eval(e, object.NewEnvironment()).(type) {
+	case *object.Integer:
+		lit := strconv.FormatInt(res.Value, 10)
+		return &ast.IntegerLiteral{Token: &token.Token{Type: token.INT, Literal: lit, Pos: pos}, IntValue: res.Value}
+	case *object.Boolean:
+		tok := &token.Token{Type: token.FALSE, Literal: "false", Pos: pos}
+		if res.Value {
+			tok = &token.Token{Type: token.TRUE, Literal: "true", Pos: pos}
+		}
+		return &ast.BooleanLiteral{Token: tok, BoolValue: res.Value}
+	case *object.String:
+		return &ast.StringLiteral{Token: &token.Token{Type: token.STRING, Literal: res.Value, Pos: pos}, Value: res.Value}
+	}
+	return e
+}
+
+// ifExpression drops the branch that cannot be taken when the condition is a literal.
+// The branch that is left replaces the whole expression if it is a single expression.
+func ifExpression(e *ast.IfExpression) ast.Expression {
+	e.Condition = expression(e.Condition)
+	block(e.Consequence)
+	block(e.Alternative)
+
+	var pred bool
+	switch cond := e.Condition.(type) {
+	case *ast.BooleanLiteral:
+		pred = cond.BoolValue
+	case *ast.IntegerLiteral:
+		pred = cond.IntValue != 0
+	default:
+		return e
+	}
+
+	taken := e.Consequence
+	if !pred {
+		taken = e.Alternative
+	}
+	if taken == nil {
+		// nothing is left to evaluate, but the value of the expression is still null
+		e.Consequence = &ast.BlockStatement{Token: e.Consequence.Token}
+		e.Alternative = nil
+		return e
+	}
+	if len(taken.Statements) == 1 {
+		if s, ok := taken.Statements[0].(*ast.ExpressionStatement); ok {
+			return s.Expression
+		}
+	}
+	e.Condition = &ast.BooleanLiteral{Token: &token.Token{Type: token.TRUE, Literal: "true", Pos: e.Condition.Pos()}, BoolValue: true}
+	e.Consequence = taken
+	e.Alternative = nil
+	return e
+}
@@ -0,0 +1,92 @@
+package optimize
+
+import (
+	"ast"
+	"evaluator"
+	"lexer"
+	"object"
+	"parser"
+	"resolver"
+	"testing"
+)
+
+func parse(t *testing.T, in string) *ast.Program {
+	p := parser.New(lexer.New(in))
+	prog := p.Parse()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parse errors for %q: %v", in, p.Errors())
+	}
+	return prog
+}
+
+func TestProgram(t *testing.T) {
+	tests := []struct {
+		in  string
+		out string
+	}{
+		{"60 * 60 * 24", "86400"},
+		{"1 + 2 * x", "(1 + (2 * x))"},
+		{"x * (2 + 3)", "(x * 5)"},
+		{"-(3 - 5)", "2"},
+		{"!true == false", "true"},
+		{"1 < 2", "true"},
+		{`"a" + "b" == "ab"`, "true"},
+
+		// errors are left to happen at run time
+		{"1 / 0", "(1 / 0)"},
+		{"10 / (5 - 5)", "(10 / 0)"},
+		{`1 + "a"`, `(1 + "a")`},
+		{`-"a"`, `(-"a")`},
+		{"1 + true", "(1 + true)"},
+		{`"n = ${1 + 2}, ${"s"}${true}"`, `"n = 3, strue"`},
+		{`"n = ${1 + x}"`, `"n = ${(1 + x)}"`},
+
+		{"if (true) { a } else { b }", "a"},
+		{"if (1 > 2) { a } else { b }", "b"},
+		{"if (0) { a }", "if 0 {}"},
+		{"if (true) { let a = 1; a } else { b }", "if true {let a = 1;a;}"},
+		{"if (x) { 1 + 1 } else { 2 * 2 }", "if x {2;} else {4;}"},
+		{`if ("a") { a }`, `if "a" {a;}`},
+
+		{"fn(a = 2 * 3) { if (false) { a } else { [1 + 1, a] } }", "fn (a = 6) {[2, a];}"},
+		{"match (x) { [a = 1 + 1] => a * (1 + 1) }", "match (x) {[a = 2] => (a * 2)}"},
+	}
+
+	for _, tt := range tests {
+		prog := parse(t, tt.in)
+		Program(prog)
+		if out := prog.String(); out != tt.out {
+			t.Errorf("optimizing %q: expected %q, got %q", tt.in, tt.out, out)
+		}
+	}
+}
+
+// Optimized programs must evaluate to the same thing as the original ones.
+func TestSameResult(t *testing.T) {
+	tests := []string{
+		"60 * 60 * 24",
+		"1 / 0",
+		"let f = fn(x) { 100 / (2 - 2) + x }; f(1)",
+		`let f = fn() { 1 + "a" }; try { f() } catch (e) { e["position"] }`,
+		"if (0) { 1 }",
+		"if (false) { 1 } else { let a = 2; a * 3 }",
+		"let fact = fn(n, acc = 1) { if (n < 1) { acc } else { fact(n - 1, acc * n) } }; fact(10)",
+		"let f = fn(n) { if (true) { if (n == 0) { 0 } else { f(n - 1) } } }; f(50000)",
+		"let x = 5; let f = fn() { if (false) { let x = 1 } x }; f()",
+		`match (2 + 1) { 3 => "three", _ => "other" }`,
+		`let x = 2; "${x * 2} ${"a" + "b"}"`,
+	}
+
+	for _, in := range tests {
+		plain := parse(t, in)
+		resolver.Resolve(plain)
+		optimized := parse(t, in)
+		Program(optimized)
+		resolver.Resolve(optimized)
+
+		expected := evaluator.Eval(plain, object.NewEnvironment()).Inspect()
+		if got := evaluator.Eval(optimized, object.NewEnvironment()).Inspect(); got != expected {
+			t.Errorf("evaluating %q: expected %s, got %s", in, expected, got)
+		}
+	}
+}
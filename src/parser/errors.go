@@ -0,0 +1,146 @@
+package parser
+
+import (
+	"fmt"
+	"token"
+	"unicode/utf8"
+)
+
+// DefaultMaxErrors is the number of errors reported by a new Parser before it gives up.
+const DefaultMaxErrors = 10
+
+// Code tells what kind of error a syntax error is, for tools that want more than the message.
+type Code string
+
+const (
+	UnexpectedToken  Code = "unexpected-token"  // a token that cannot appear where it is
+	Unclosed         Code = "unclosed"          // a bracket or parenthesis without its closing one
+	InvalidInteger   Code = "invalid-integer"   // an integer literal out of range
+	InvalidParameter Code = "invalid-parameter" // a function parameter list that cannot be used
+	InvalidArgument  Code = "invalid-argument"  // the arguments of a call in the wrong order
+	InvalidPattern   Code = "invalid-pattern"   // a pattern of a let or a match arm
+	InvalidType      Code = "invalid-type"      // a type annotation
+	InvalidMatch     Code = "invalid-match"     // a match without arms, or with unreachable ones
+	InvalidTry       Code = "invalid-try"       // a try without catch or finally
+	InvalidStruct    Code = "invalid-struct"    // a struct declaring a field twice
+	TooManyErrors    Code = "too-many-errors"   // the last error, when the parser gives up
+)
+
+// Span is the part of the source an error is about, End being just after its last character.
+type Span struct {
+	Start token.Position
+	End   token.Position
+}
+
+// Error is a syntax error.
+type Error struct {
+	Code    Code
+	Span    Span
+	Message string
+	Hints   []string // what may fix the error, if it can be guessed
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Span.Start, e.Message)
+}
+
+// tokenSpan is the span of tok in the source, which is empty for the end of the input.
+func tokenSpan(tok *token.Token) Span {
+	end := tok.Pos
+	if tok.Type != token.EOF {
+		n := utf8.RuneCountInString(tok.Literal)
+		if tok.Type == token.STRING {
+			n += 2 // the quotes
+		}
+		end.Column += n
+	}
+	return Span{Start: tok.Pos, End: end}
+}
+
+// describe tells what tok is in an error message.
+func describe(tok *token.Token) string {
+	switch tok.Type {
+	case token.EOF:
+		return "end of input"
+	case token.ILLEGAL:
+		return fmt.Sprintf("illegal character %q", tok.Literal)
+	case token.STRING:
+		return fmt.Sprintf("string %q", tok.Literal)
+	case token.TEMPLATE_START:
+		return fmt.Sprintf("template string starting with %q", tok.Literal)
+	case token.TEMPLATE_MIDDLE, token.TEMPLATE_END:
+		return "`}` ending the interpolation"
+	}
+	return fmt.Sprintf("`%s`", tok.Literal)
+}
+
+// describeType tells what a token of type typ is in an error message.
+func describeType(typ token.Type) string {
+	switch typ {
+	case token.IDENT:
+		return "a name"
+	case token.INT:
+		return "an integer"
+	case token.STRING:
+		return "a string"
+	case token.EOF:
+		return "end of input"
+	}
+	return fmt.Sprintf("`%s`", typ)
+}
+
+// errorAt records an error about tok, and returns it so that hints can be added.
+// Once MaxErrors errors are recorded, a last one says so and the others are dropped.
+func (p *Parser) errorAt(tok *token.Token, code Code, format string, args ...interface{}) *Error {
+	res := &Error{Code: code, Span: tokenSpan(tok), Message: fmt.Sprintf(format, args...)}
+	if p.stopped {
+		return res
+	}
+
+	if p.MaxErrors > 0 && len(p.errors) == p.MaxErrors {
+		p.errors = append(p.errors, &Error{
+			Code:    TooManyErrors,
+			Span:    res.Span,
+			Message: fmt.Sprintf("too many errors, only the first %d are reported", p.MaxErrors),
+		})
+		p.stopped = true
+		return res
+	}
+
+	p.errors = append(p.errors, res)
+	return res
+}
+
+// synchronize skips the rest of a statement with errors, so that they do not cause more errors
+// in the statements after it. It stops at a semicolon, before the end of the enclosing block,
+// or before a keyword or a line starting a statement, leaving the current token as the last one skipped.
+// A statement which stopped at the brace ending its block leaves it as the current token, for the block to end there.
+// Only those found in the block, whose depth in braces is base, count: a missing parenthesis
+// is then recovered from at the end of the statement, and a missing brace at the end of the block.
+func (p *Parser) synchronize(base int) {
+	for p.curToken.Type != token.EOF && !(p.braces <= base && p.curToken.Type == token.SEMICOLON) {
+		if p.braces < base && p.curToken.Type == token.RBRACE {
+			break
+		}
+		if p.braces <= base {
+			switch p.peekToken.Type {
+			case token.RBRACE, token.LET, token.CONST, token.RETURN, token.THROW, token.STRUCT:
+				p.synced = len(p.errors)
+				return
+			}
+			if p.peekToken.Pos.Line > p.curToken.Pos.Line {
+				p.synced = len(p.errors)
+				return
+			}
+		}
+		p.nextToken()
+	}
+	p.synced = len(p.errors)
+}
+
+// recoverFromErrors synchronizes if the statement just parsed has errors that were not recovered from yet.
+func (p *Parser) recoverFromErrors(base int) {
+	if len(p.errors) > p.synced {
+		p.synchronize(base)
+	}
+}
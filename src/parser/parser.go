@@ -9,17 +9,21 @@ import (
 )
 
 const (
-	_        = iota
+	_ = iota
 	LOWEST
+	COALESCE
 	EQUALS
 	INEQUALS
 	SUM
 	PRODUCT
 	PREFIX
 	CALL
+	INDEX
+	MEMBER
 )
 
 var precedences = map[token.Type]int{
+	token.COALESCE: COALESCE,
 	token.EQ:       EQUALS,
 	token.NOT_EQ:   EQUALS,
 	token.LT:       INEQUALS,
@@ -29,11 +33,27 @@ var precedences = map[token.Type]int{
 	token.ASTERISK: PRODUCT,
 	token.SLASH:    PRODUCT,
 	token.LPAREN:   CALL,
+	token.LBRACKET: INDEX,
+	token.DOT:      MEMBER,
+	token.LBRACE:   CALL, // only after a name, see parseExpression
+
+	token.OPTIONAL_DOT:      MEMBER,
+	token.OPTIONAL_LBRACKET: INDEX,
 }
 
 type Parser struct {
-	lx     *lexer.Lexer
-	errors []string
+	lx      *lexer.Lexer
+	errors  []*Error
+	synced  int  // number of errors already recovered from, see synchronize
+	braces  int  // depth of the current token in braces
+	stopped bool // whether MaxErrors was reached
+
+	// MaxErrors is the number of errors reported before giving up, no limit if 0 or less
+	MaxErrors int
+
+	// FunctionScope makes the blocks of if and try expressions bind in the scope enclosing them,
+	// as they did before blocks had scopes of their own
+	FunctionScope bool
 
 	curToken  *token.Token
 	peekToken *token.Token
@@ -43,7 +63,7 @@ type Parser struct {
 }
 
 func New(lx *lexer.Lexer) *Parser {
-	res := &Parser{lx: lx}
+	res := &Parser{lx: lx, MaxErrors: DefaultMaxErrors}
 
 	res.prefixParseFns = make(map[token.Type]func() ast.Expression)
 	res.prefixParseFns[token.IDENT] = res.parseIdentifier
@@ -52,9 +72,17 @@ func New(lx *lexer.Lexer) *Parser {
 	res.prefixParseFns[token.MINUS] = res.parsePrefixOperator
 	res.prefixParseFns[token.TRUE] = res.parseBooleanLiteral
 	res.prefixParseFns[token.FALSE] = res.parseBooleanLiteral
+	res.prefixParseFns[token.NULL] = res.parseNullLiteral
 	res.prefixParseFns[token.LPAREN] = res.parseGroupedExpression
 	res.prefixParseFns[token.IF] = res.parseIfExpression
 	res.prefixParseFns[token.FUNCTION] = res.parseFunctionExpression
+	res.prefixParseFns[token.STRING] = res.parseStringLiteral
+	res.prefixParseFns[token.TEMPLATE_START] = res.parseTemplateLiteral
+	res.prefixParseFns[token.LBRACKET] = res.parseArrayLiteral
+	res.prefixParseFns[token.TRY] = res.parseTryExpression
+	res.prefixParseFns[token.LBRACE] = res.parseHashLiteral
+	res.prefixParseFns[token.MATCH] = res.parseMatchExpression
+	res.prefixParseFns[token.ELLIPSIS] = res.parseSpreadExpression
 
 	res.infixParseFns = make(map[token.Type]func(ast.Expression) ast.Expression)
 	res.infixParseFns[token.EQ] = res.parseInfixExpression
@@ -65,7 +93,13 @@ func New(lx *lexer.Lexer) *Parser {
 	res.infixParseFns[token.MINUS] = res.parseInfixExpression
 	res.infixParseFns[token.ASTERISK] = res.parseInfixExpression
 	res.infixParseFns[token.SLASH] = res.parseInfixExpression
+	res.infixParseFns[token.COALESCE] = res.parseInfixExpression
 	res.infixParseFns[token.LPAREN] = res.parseCallExpression
+	res.infixParseFns[token.LBRACKET] = res.parseIndexExpression
+	res.infixParseFns[token.DOT] = res.parseFieldExpression
+	res.infixParseFns[token.OPTIONAL_DOT] = res.parseFieldExpression
+	res.infixParseFns[token.OPTIONAL_LBRACKET] = res.parseIndexExpression
+	res.infixParseFns[token.LBRACE] = res.parseStructLiteral
 
 	// read two tokens so curToken and peekToken are set
 	res.nextToken()
@@ -74,54 +108,87 @@ func New(lx *lexer.Lexer) *Parser {
 	return res
 }
 
-func (p *Parser) Errors() []string {
+func (p *Parser) Errors() []*Error {
 	return p.errors
 }
 
-func (p *Parser) peekError(typ token.Type) {
-	p.errors = append(p.errors, fmt.Sprintf("next token is expected to be %q, got: %q", typ, p.peekToken.Type))
-}
-
 func (p *Parser) nextToken() {
 	p.curToken = p.peekToken
 	tmp := p.lx.NextToken()
 	p.peekToken = &tmp
+
+	if p.curToken != nil {
+		switch p.curToken.Type {
+		case token.LBRACE:
+			p.braces++
+		case token.RBRACE:
+			p.braces--
+		}
+	}
 }
 
 func (p *Parser) Parse() *ast.Program {
 	res := &ast.Program{}
 
-	for p.curToken.Type != token.EOF {
+	for p.curToken.Type != token.EOF && !p.stopped {
 		s := p.parseStatement()
 		if s != nil {
 			res.Statements = append(res.Statements, s)
 		}
+		p.recoverFromErrors(0)
 		p.nextToken()
 	}
 
 	return res
 }
+
 func (p *Parser) parseStatement() ast.Statement {
 	switch p.curToken.Type {
-	case token.LET:
+	case token.LET, token.CONST:
 		return p.parseLetStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.THROW:
+		return p.parseThrowStatement()
+	case token.STRUCT:
+		return p.parseStructStatement()
+	case token.FUNCTION:
+		if p.peekTokenIs(token.IDENT) {
+			return p.parseFunctionStatement()
+		}
+		return p.parseExpressionStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
-	return nil
 }
 
+// parseLetStatement parses a let, or a const which is the same but only binds a name.
 func (p *Parser) parseLetStatement() *ast.LetStatement {
 	res := &ast.LetStatement{Token: p.curToken}
-	if !p.expectPeek(token.IDENT) {
-		return nil
-	}
 
-	res.Ident = &ast.Identifier{Token: p.curToken, Name: p.curToken.Literal}
+	var bound string
+	if p.peekTokenIs(token.LBRACKET) || p.peekTokenIs(token.LBRACE) {
+		if res.IsConst() {
+			e := p.errorAt(p.peekToken, InvalidPattern, "const can only bind a name, not a pattern")
+			e.Hints = append(e.Hints, "destructure with let, then bind each name with const")
+			return nil
+		}
+		p.nextToken()
+		res.Pattern = p.parsePattern()
+		if res.Pattern == nil {
+			return nil
+		}
+		bound = res.Pattern.String()
+	} else {
+		if !p.expectPeek(token.IDENT, fmt.Sprintf("after `%s`", res.Token.Literal)) {
+			return nil
+		}
+		res.Ident = &ast.Identifier{Token: p.curToken, Name: p.curToken.Literal}
+		res.Type = p.parseAnnotation()
+		bound = res.Ident.Name
+	}
 
-	if !p.expectPeek(token.ASSIGN) {
+	if !p.expectPeek(token.ASSIGN, fmt.Sprintf("after `%s %s`", res.Token.Literal, bound)) {
 		return nil
 	}
 
@@ -139,7 +206,37 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	res := &ast.ReturnStatement{Token: p.curToken}
 	p.nextToken()
-	
+
+	res.Value = p.parseExpression(LOWEST)
+
+	// several values are returned as an array
+	if p.peekTokenIs(token.COMMA) {
+		values := &ast.ArrayLiteral{
+			Token:    &token.Token{Type: token.LBRACKET, Literal: "["},
+			Elements: []ast.Expression{res.Value},
+		}
+		if res.Value != nil {
+			values.Token.Pos = res.Value.Pos()
+		}
+		for p.peekTokenIs(token.COMMA) {
+			p.nextToken()
+			p.nextToken()
+			values.Elements = append(values.Elements, p.parseExpression(LOWEST))
+		}
+		res.Value = values
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return res
+}
+
+func (p *Parser) parseThrowStatement() *ast.ThrowStatement {
+	res := &ast.ThrowStatement{Token: p.curToken}
+	p.nextToken()
+
 	res.Value = p.parseExpression(LOWEST)
 
 	if p.peekTokenIs(token.SEMICOLON) {
@@ -151,28 +248,117 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	res := &ast.BlockStatement{Token: p.curToken}
+	base := p.braces
 
 	p.nextToken()
 
 	statements := []ast.Statement{}
-	for p.curToken.Type != token.RBRACE && p.curToken.Type != token.EOF {
+	for p.curToken.Type != token.RBRACE && p.curToken.Type != token.EOF && !p.stopped {
 		s := p.parseStatement()
 		if s != nil {
 			statements = append(statements, s)
 		}
+		p.recoverFromErrors(base)
+		if p.curToken.Type == token.RBRACE && p.braces < base {
+			// a statement with errors stopped at the end of the block
+			break
+		}
 		p.nextToken()
 	}
+	if p.curToken.Type == token.EOF {
+		p.unclosed(p.curToken, token.RBRACE, "block", res.Token)
+	}
 
 	res.Statements = statements
 
 	return res
 }
 
-func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
+// parseScopedBlock parses a block which has a scope of its own, unless FunctionScope is set.
+// The blocks of functions and catch clauses are parsed with parseBlockStatement,
+// as they share the scope of their parameters.
+func (p *Parser) parseScopedBlock() *ast.BlockStatement {
+	res := p.parseBlockStatement()
+	res.Scoped = !p.FunctionScope
+	return res
+}
+
+func (p *Parser) parseStructStatement() *ast.StructStatement {
+	res := &ast.StructStatement{Token: p.curToken, Fields: []string{}}
+
+	if !p.expectPeek(token.IDENT, "after `struct`") {
+		return nil
+	}
+	res.Name = &ast.Identifier{Token: p.curToken, Name: p.curToken.Literal}
+
+	if !p.expectPeek(token.LBRACE, fmt.Sprintf("after `struct %s`", res.Name)) {
+		return nil
+	}
+	open := p.curToken
+
+	seen := map[string]bool{}
+	for !p.peekTokenIs(token.RBRACE) {
+		if !p.expectPeek(token.IDENT, fmt.Sprintf("in the fields of struct %s", res.Name)) {
+			return nil
+		}
+		name := p.curToken.Literal
+		if seen[name] {
+			p.errorAt(p.curToken, InvalidStruct, "field %s of struct %s is declared twice", name, res.Name)
+		}
+		seen[name] = true
+		res.Fields = append(res.Fields, name)
+
+		if !p.expectSeparator(token.RBRACE, "struct", open) {
+			return nil
+		}
+	}
+	p.nextToken()
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return res
+}
+
+func (p *Parser) parseExpressionStatement() ast.Statement {
 	res := &ast.ExpressionStatement{Token: p.curToken}
 
 	res.Expression = p.parseExpression(LOWEST)
 
+	if p.peekTokenIs(token.ASSIGN) {
+		return p.parseAssignStatement(res.Expression)
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return res
+}
+
+// parseAssignStatement parses the rest of `target = value`, the peek token being the =.
+func (p *Parser) parseAssignStatement(target ast.Expression) ast.Statement {
+	p.nextToken()
+	res := &ast.AssignStatement{Token: p.curToken}
+
+	field, ok := target.(*ast.FieldExpression)
+	if !ok {
+		e := p.errorAt(p.curToken, UnexpectedToken, "cannot assign to %s, only to a field", target)
+		if _, ok := target.(*ast.Identifier); ok {
+			e.Hints = append(e.Hints, fmt.Sprintf("use `let %s = ...` to bind the name again", target))
+		}
+		return nil
+	}
+	if ast.IsOptionalChain(field) {
+		p.errorAt(p.curToken, UnexpectedToken, "cannot assign to %s, which has ?. or ?[", target)
+		return nil
+	}
+	res.Target = field
+
+	p.nextToken()
+	res.Value = p.parseExpression(LOWEST)
+
 	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
@@ -187,12 +373,80 @@ func (p *Parser) parseIdentifier() ast.Expression {
 func (p *Parser) parseIntegerLiteral() ast.Expression {
 	number, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
 	if err != nil {
-		p.errors = append(p.errors, fmt.Sprintf("cannot parse %q as integer", p.curToken.Literal))
+		p.errorAt(p.curToken, InvalidInteger, "cannot parse %s as an integer, it is too large", p.curToken.Literal)
 		return nil
 	}
 	return &ast.IntegerLiteral{Token: p.curToken, IntValue: number}
 }
 
+func (p *Parser) parseStringLiteral() ast.Expression {
+	return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+}
+
+// parseTemplateLiteral parses a string with interpolations, from the part before the first one.
+func (p *Parser) parseTemplateLiteral() ast.Expression {
+	res := &ast.TemplateLiteral{Token: p.curToken, Parts: []string{p.curToken.Literal}}
+	for {
+		p.nextToken()
+		e := p.parseExpression(LOWEST)
+		if e == nil {
+			return nil
+		}
+		res.Expressions = append(res.Expressions, e)
+		if !p.peekTokenIs(token.TEMPLATE_MIDDLE) && !p.peekTokenIs(token.TEMPLATE_END) {
+			p.unclosed(p.peekToken, token.RBRACE, "interpolation in the string", res.Token)
+			return nil
+		}
+		p.nextToken()
+		res.Parts = append(res.Parts, p.curToken.Literal)
+		if p.curToken.Type == token.TEMPLATE_END {
+			return res
+		}
+	}
+}
+
+func (p *Parser) parseArrayLiteral() ast.Expression {
+	return &ast.ArrayLiteral{Token: p.curToken, Elements: p.parseExpressionList(token.RBRACKET, "array")}
+}
+
+func (p *Parser) parseHashLiteral() ast.Expression {
+	res := &ast.HashLiteral{Token: p.curToken}
+
+	for !p.peekTokenIs(token.RBRACE) {
+		p.nextToken()
+		key := p.parseExpression(LOWEST)
+		if key == nil {
+			return nil
+		}
+
+		if !p.expectPeek(token.COLON, fmt.Sprintf("after hash key %s", key)) {
+			return nil
+		}
+
+		p.nextToken()
+		value := p.parseExpression(LOWEST)
+
+		res.Pairs = append(res.Pairs, &ast.HashLiteralPair{Key: key, Value: value})
+
+		if !p.expectSeparator(token.RBRACE, "hash", res.Token) {
+			return nil
+		}
+	}
+
+	p.nextToken()
+
+	return res
+}
+
+func (p *Parser) parseSpreadExpression() ast.Expression {
+	res := &ast.SpreadExpression{Token: p.curToken}
+
+	p.nextToken()
+	res.Value = p.parseExpression(LOWEST)
+
+	return res
+}
+
 func (p *Parser) parseBooleanLiteral() ast.Expression {
 	b := true
 	if p.curToken.Literal == "false" {
@@ -202,6 +456,10 @@ func (p *Parser) parseBooleanLiteral() ast.Expression {
 	return &ast.BooleanLiteral{Token: p.curToken, BoolValue: b}
 }
 
+func (p *Parser) parseNullLiteral() ast.Expression {
+	return &ast.NullLiteral{Token: p.curToken}
+}
+
 func (p *Parser) parsePrefixOperator() ast.Expression {
 	cur := p.curToken
 
@@ -229,82 +487,225 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 }
 
 func (p *Parser) parseCallExpression(left ast.Expression) ast.Expression {
-	tok := p.curToken
+	what := "call"
+	if ident, ok := left.(*ast.Identifier); ok {
+		what = fmt.Sprintf("call to `%s`", ident.Name)
+	}
+
+	return &ast.CallExpression{
+		Token:     p.curToken,
+		Function:  left,
+		Arguments: p.parseCallArguments(what),
+	}
+}
 
+// parseCallArguments is like parseExpressionList, but also accepts named arguments after the positional ones.
+func (p *Parser) parseCallArguments(what string) []ast.Expression {
+	open := p.curToken
 	p.nextToken()
 
-	arguments := []ast.Expression{}
-	for {
-		if p.curToken.Type == token.RPAREN {
-			break
+	res := []ast.Expression{}
+	named := false
+	for p.curToken.Type != token.RPAREN && p.curToken.Type != token.EOF {
+		var arg ast.Expression
+		if p.curToken.Type == token.IDENT && p.peekTokenIs(token.COLON) {
+			na := &ast.NamedArgument{Token: p.curToken, Name: &ast.Identifier{Token: p.curToken, Name: p.curToken.Literal}}
+			p.nextToken()
+			p.nextToken()
+			na.Value = p.parseExpression(LOWEST)
+			arg = na
+			named = true
+		} else {
+			if named {
+				e := p.errorAt(p.curToken, InvalidArgument, "positional argument after named argument in %s", what)
+				e.Hints = append(e.Hints, "put the positional arguments before the named ones")
+			}
+			arg = p.parseExpression(LOWEST)
 		}
 
-		arg := p.parseExpression(LOWEST)
 		if arg != nil {
-			arguments = append(arguments, arg)
+			res = append(res, arg)
 		}
 
-		if p.peekTokenIs(token.COMMA) {
-			p.nextToken()
-		} else if p.peekTokenIs(token.RPAREN) {
-			// nop
-		} else {
-			p.errors = append(p.errors, fmt.Sprintf("unexpected token at argument list: %q", p.peekToken.Literal))
+		if !p.expectSeparator(token.RPAREN, what, open) {
+			return res
+		}
+		p.nextToken()
+	}
+	if p.curToken.Type == token.EOF {
+		p.unclosed(p.curToken, token.RPAREN, what, open)
+	}
+
+	return res
+}
+
+func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
+	tok := p.curToken
+
+	p.nextToken()
+
+	index := p.parseExpression(LOWEST)
+	if index == nil {
+		return nil
+	}
+
+	if !p.expectClose(token.RBRACKET, "index", tok) {
+		return nil
+	}
+
+	return &ast.IndexExpression{
+		Token: tok,
+		Left:  left,
+		Index: index,
+	}
+}
+
+func (p *Parser) parseFieldExpression(left ast.Expression) ast.Expression {
+	tok := p.curToken
+
+	if !p.expectPeek(token.IDENT, fmt.Sprintf("after `%s`", tok.Literal)) {
+		return nil
+	}
+
+	return &ast.FieldExpression{Token: tok, Left: left, Field: p.curToken.Literal}
+}
+
+// structLiteralFollows tells whether the brace after left starts the fields of a struct literal,
+// which only follow the name of a struct type, and are either empty or start with `name:`.
+// Otherwise the brace is left for what comes after the expression, such as a block.
+func (p *Parser) structLiteralFollows(left ast.Expression) bool {
+	if _, ok := left.(*ast.Identifier); !ok {
+		return false
+	}
+	lx := p.lx.Copy()
+	switch first := lx.NextToken(); first.Type {
+	case token.RBRACE:
+		return true
+	case token.IDENT:
+		return lx.NextToken().Type == token.COLON
+	}
+	return false
+}
+
+// parseStructLiteral parses `{field: value, ...}` after the name of a struct type.
+func (p *Parser) parseStructLiteral(left ast.Expression) ast.Expression {
+	res := &ast.StructLiteral{Token: p.curToken, Type: left, Fields: []*ast.StructLiteralField{}}
+	what := fmt.Sprintf("%s literal", left)
+
+	for !p.peekTokenIs(token.RBRACE) {
+		if !p.expectPeek(token.IDENT, fmt.Sprintf("as field name in %s", what)) {
+			return nil
+		}
+		field := &ast.StructLiteralField{Token: p.curToken, Name: p.curToken.Literal}
+
+		if !p.expectPeek(token.COLON, fmt.Sprintf("after field %s", field.Name)) {
+			return nil
 		}
 
 		p.nextToken()
+		field.Value = p.parseExpression(LOWEST)
+
+		res.Fields = append(res.Fields, field)
+
+		if !p.expectSeparator(token.RBRACE, what, res.Token) {
+			return nil
+		}
 	}
 
-	return &ast.CallExpression{
-		Token:     tok,
-		Function:  left,
-		Arguments: arguments,
+	p.nextToken()
+
+	return res
+}
+
+// parseExpressionList parses comma separated expressions starting after the current token
+// up to the end token, leaving the end token as the current token. what is the kind of list, for errors.
+func (p *Parser) parseExpressionList(end token.Type, what string) []ast.Expression {
+	open := p.curToken
+	p.nextToken()
+
+	res := []ast.Expression{}
+	for {
+		if p.curToken.Type == end || p.curToken.Type == token.EOF {
+			break
+		}
+
+		exp := p.parseExpression(LOWEST)
+		if exp != nil {
+			res = append(res, exp)
+		}
+
+		if !p.expectSeparator(end, what, open) {
+			return res
+		}
+		p.nextToken()
+	}
+	if p.curToken.Type == token.EOF {
+		p.unclosed(p.curToken, end, what, open)
 	}
+
+	return res
 }
 
 func (p *Parser) parseGroupedExpression() ast.Expression {
+	open := p.curToken
 	p.nextToken()
 
 	exp := p.parseExpression(LOWEST)
+	if exp == nil {
+		return nil
+	}
 
-	if !p.expectPeek(token.RPAREN) {
+	if !p.expectClose(token.RPAREN, "parenthesis", open) {
 		return nil
 	}
 
+	// the parentheses end the chain in them, see ast.ChainLeft
+	switch exp := exp.(type) {
+	case *ast.FieldExpression:
+		exp.Grouped = true
+	case *ast.IndexExpression:
+		exp.Grouped = true
+	case *ast.CallExpression:
+		exp.Grouped = true
+	}
 	return exp
 }
 
 func (p *Parser) parseIfExpression() ast.Expression {
 	tok := p.curToken
 
-	if !p.expectPeek(token.LPAREN) {
+	if !p.expectPeek(token.LPAREN, "after `if`") {
 		return nil
 	}
+	open := p.curToken
 
 	p.nextToken()
 
 	condition := p.parseExpression(LOWEST)
+	if condition == nil {
+		return nil
+	}
 
-	if !p.expectPeek(token.RPAREN) {
+	if !p.expectClose(token.RPAREN, "condition of if", open) {
 		return nil
 	}
 
-	if !p.expectPeek(token.LBRACE) {
+	if !p.expectPeek(token.LBRACE, "after the condition of if") {
 		return nil
 	}
 
-	consequence := p.parseBlockStatement()
+	consequence := p.parseScopedBlock()
 
 	// check if there is an else
 	var alternative *ast.BlockStatement
 	if p.peekTokenIs(token.ELSE) {
 		p.nextToken()
 
-		if !p.expectPeek(token.LBRACE) {
+		if !p.expectPeek(token.LBRACE, "after `else`") {
 			return nil
 		}
 
-		alternative = p.parseBlockStatement()
+		alternative = p.parseScopedBlock()
 	}
 
 	return &ast.IfExpression{
@@ -315,67 +716,175 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	}
 }
 
-func (p *Parser) parseFunctionExpression() ast.Expression {
-	tok := p.curToken
+func (p *Parser) parseTryExpression() ast.Expression {
+	res := &ast.TryExpression{Token: p.curToken}
 
-	if !p.expectPeek(token.LPAREN) {
+	if !p.expectPeek(token.LBRACE, "after `try`") {
 		return nil
 	}
+	res.Body = p.parseScopedBlock()
 
-	p.nextToken()
+	if p.peekTokenIs(token.CATCH) {
+		p.nextToken()
 
-	params := []*ast.Identifier{}
-	for {
-		if p.curToken.Type == token.RPAREN {
-			break
+		if !p.expectPeek(token.LPAREN, "after `catch`") {
+			return nil
+		}
+		open := p.curToken
+		if !p.expectPeek(token.IDENT, "after `catch (`") {
+			return nil
+		}
+		res.CatchParam = &ast.Identifier{Token: p.curToken, Name: p.curToken.Literal}
+		if !p.expectClose(token.RPAREN, "catch", open) {
+			return nil
 		}
 
-		if p.curToken.Type != token.IDENT {
-			p.errors = append(p.errors, fmt.Sprintf("unexpected token at function parameter list: %q", p.curToken.Literal))
+		if !p.expectPeek(token.LBRACE, fmt.Sprintf("after `catch (%s)`", res.CatchParam.Name)) {
+			return nil
 		}
+		res.Catch = p.parseBlockStatement()
+	}
 
-		id := &ast.Identifier{Token: p.curToken, Name: p.curToken.Literal}
-		if id != nil {
-			params = append(params, id)
+	if p.peekTokenIs(token.FINALLY) {
+		p.nextToken()
+
+		if !p.expectPeek(token.LBRACE, "after `finally`") {
+			return nil
 		}
+		res.Finally = p.parseScopedBlock()
+	}
 
-		if p.peekTokenIs(token.COMMA) {
-			p.nextToken()
-		} else if p.peekTokenIs(token.RPAREN) {
-			// nop
+	if res.Catch == nil && res.Finally == nil {
+		e := p.errorAt(res.Token, InvalidTry, "try must be followed by catch or finally")
+		e.Hints = append(e.Hints, "add `catch (e) { ... }` or `finally { ... }` after the block of the try")
+		return nil
+	}
+
+	return res
+}
+
+func (p *Parser) parseFunctionExpression() ast.Expression {
+	if res := p.parseFunction(p.curToken, "after `fn`"); res != nil {
+		return res
+	}
+	return nil
+}
+
+// parseFunctionStatement parses `fn name(params) { ... }`, the current token being the fn.
+func (p *Parser) parseFunctionStatement() ast.Statement {
+	res := &ast.FunctionStatement{Token: p.curToken}
+
+	p.nextToken()
+	res.Name = &ast.Identifier{Token: p.curToken, Name: p.curToken.Literal}
+
+	res.Function = p.parseFunction(res.Token, fmt.Sprintf("after `fn %s`", res.Name.Name))
+	if res.Function == nil {
+		return nil
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return res
+}
+
+// parseFunction parses the parameters and body of a function, which follow the current token.
+// tok is the fn starting the function, and where tells where the parameters are expected in errors.
+func (p *Parser) parseFunction(tok *token.Token, where string) *ast.FunctionExpression {
+	if !p.expectPeek(token.LPAREN, where) {
+		return nil
+	}
+	open := p.curToken
+
+	p.nextToken()
+
+	params := []*ast.Identifier{}
+	defaults := []ast.Expression{}
+	types := []ast.TypeExpr{}
+	var rest *ast.Identifier
+	var restType ast.TypeExpr
+	for p.curToken.Type != token.RPAREN && p.curToken.Type != token.EOF {
+		if rest != nil {
+			p.errorAt(p.curToken, InvalidParameter, "rest parameter ...%s must be the last one", rest.Name)
+		}
+
+		if p.curToken.Type == token.ELLIPSIS {
+			if !p.expectPeek(token.IDENT, "after `...` in parameter list") {
+				return nil
+			}
+			rest = &ast.Identifier{Token: p.curToken, Name: p.curToken.Literal}
+			restType = p.parseAnnotation()
 		} else {
-			p.errors = append(p.errors, fmt.Sprintf("unexpected token at function parameter list: %q", p.peekToken.Literal))
+			if p.curToken.Type != token.IDENT {
+				p.errorAt(p.curToken, InvalidParameter, "expected a parameter name, got %s", describe(p.curToken))
+			}
+
+			params = append(params, &ast.Identifier{Token: p.curToken, Name: p.curToken.Literal})
+			types = append(types, p.parseAnnotation())
+
+			var def ast.Expression
+			if p.peekTokenIs(token.ASSIGN) {
+				p.nextToken()
+				p.nextToken()
+				def = p.parseExpression(LOWEST)
+			}
+			defaults = append(defaults, def)
 		}
 
+		if !p.expectSeparator(token.RPAREN, "parameter list", open) {
+			return nil
+		}
 		p.nextToken()
 	}
-
-	if !p.expectPeek(token.LBRACE) {
+	if p.curToken.Type == token.EOF {
+		p.unclosed(p.curToken, token.RPAREN, "parameter list", open)
 		return nil
 	}
 
-	body := p.parseBlockStatement()
+	var returnType ast.TypeExpr
+	if p.peekTokenIs(token.RARROW) {
+		p.nextToken()
+		p.nextToken()
+		returnType = p.parseType()
+	}
 
-	return &ast.FunctionExpression{
-		Token:  tok,
-		Params: params,
-		Body:   body,
+	if !p.expectPeek(token.LBRACE, "before the body of the function") {
+		return nil
 	}
+
+	res := &ast.FunctionExpression{
+		Token:      tok,
+		Params:     params,
+		Defaults:   defaults,
+		Rest:       rest,
+		Body:       p.parseBlockStatement(),
+		ParamTypes: types,
+		RestType:   restType,
+		ReturnType: returnType,
+	}
+	ast.MarkTailCalls(res)
+
+	return res
 }
 
 func (p *Parser) parseExpression(precedence int) ast.Expression {
 	prefixParseFn := p.prefixParseFns[p.curToken.Type]
 	if prefixParseFn == nil {
-		p.errors = append(p.errors, fmt.Sprintf("no prefix parser function for %s", p.curToken.Type))
+		p.errorAt(p.curToken, UnexpectedToken, "expected an expression, got %s", describe(p.curToken))
 		return nil
 	}
 
 	leftExp := prefixParseFn()
 
 	for !p.peekTokenIs(token.SEMICOLON) && precedence < p.peekPrecedence() {
+		if p.peekTokenIs(token.LBRACE) && !p.structLiteralFollows(leftExp) {
+			break
+		}
+
 		infixParseFns := p.infixParseFns[p.peekToken.Type]
 		if infixParseFns == nil {
-			p.errors = append(p.errors, fmt.Sprintf("no infix parser function for %s", p.curToken.Type))
+			p.errorAt(p.peekToken, UnexpectedToken, "unexpected %s after an expression", describe(p.peekToken))
 			return leftExp
 		}
 
@@ -387,16 +896,51 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 }
 
 // expectPeek checks if the peek token is of specified type,
-// then advances to the next one if it is. If not it will record it as an error.
-func (p *Parser) expectPeek(typ token.Type) bool {
+// then advances to the next one if it is. If not it will record it as an error,
+// saying where the token was expected, as in "after `let`".
+func (p *Parser) expectPeek(typ token.Type, where string) bool {
 	if p.peekTokenIs(typ) {
 		p.nextToken()
 		return true
 	}
-	p.peekError(typ)
+	p.errorAt(p.peekToken, UnexpectedToken, "expected %s %s, got %s", describeType(typ), where, describe(p.peekToken))
 	return false
 }
 
+// expectClose is like expectPeek for the token closing what was opened by the open token,
+// such as the parenthesis of a call.
+func (p *Parser) expectClose(typ token.Type, what string, open *token.Token) bool {
+	if p.peekTokenIs(typ) {
+		p.nextToken()
+		return true
+	}
+	p.unclosed(p.peekToken, typ, what, open)
+	return false
+}
+
+// expectSeparator checks that an element of a list opened by open is followed by a comma,
+// which becomes the current token, or by the end token. If not it will record it as an error.
+func (p *Parser) expectSeparator(end token.Type, what string, open *token.Token) bool {
+	switch p.peekToken.Type {
+	case token.COMMA:
+		p.nextToken()
+		return true
+	case end:
+		return true
+	}
+
+	e := p.unclosed(p.peekToken, end, what, open)
+	if p.peekToken.Type != token.EOF && p.peekToken.Type != token.SEMICOLON {
+		e.Hints = append(e.Hints, "the elements of a list are separated by `,`")
+	}
+	return false
+}
+
+// unclosed records that tok was found where the end token of what was opened by open was expected.
+func (p *Parser) unclosed(tok *token.Token, end token.Type, what string, open *token.Token) *Error {
+	return p.errorAt(tok, Unclosed, "expected %s to close %s opened at %s, got %s", describeType(end), what, open.Pos, describe(tok))
+}
+
 func (p *Parser) peekTokenIs(typ token.Type) bool {
 	return p.peekToken.Type == typ
 }
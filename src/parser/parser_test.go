@@ -3,7 +3,9 @@ package parser
 import (
 	"ast"
 	"lexer"
+	"strings"
 	"testing"
+	"token"
 )
 
 func TestLetStatements(t *testing.T) {
@@ -135,6 +137,125 @@ return 1123456789000123456789;
 	}
 }
 
+func TestErrorRecovery(t *testing.T) {
+	tests := []struct {
+		in     string
+		errors []string
+	}{
+		{"let add = fn(a, b) { a + b };\nlet y = add(1, 2;\nlet z = y;", []string{
+			"2:17: expected `)` to close call to `add` opened at 2:12, got `;`",
+		}},
+		{"let y 10;\nlet z = [1, 2 3]\nz", []string{
+			"1:7: expected `=` after `let y`, got `10`",
+			"2:15: expected `]` to close array opened at 2:9, got `3`",
+		}},
+		{"let h = {\"a\" 1};\nif (h { 1 }\nlet f = fn(x) {\n  let y = (x + 1;\n  y\n}", []string{
+			"1:14: expected `:` after hash key \"a\", got `1`",
+			"2:7: expected `)` to close condition of if opened at 2:4, got `{`",
+			"4:17: expected `)` to close parenthesis opened at 4:11, got `;`",
+		}},
+		{"fn(x) {\n  x +\n", []string{
+			"3:1: expected an expression, got end of input",
+			"3:1: expected `}` to close block opened at 1:7, got end of input",
+		}},
+		{"f(a: 1, 2)\ntry { 1 }\n}", []string{
+			"1:9: positional argument after named argument in call to `f`",
+			"2:1: try must be followed by catch or finally",
+			"3:1: expected an expression, got `}`",
+		}},
+		{"struct P { x, y, x }\nP{x: 1 y: 2}\nf().x = 1\nx = 2", []string{
+			"1:18: field x of struct P is declared twice",
+			"2:8: expected `}` to close P literal opened at 2:2, got `y`",
+			"4:3: cannot assign to x, only to a field",
+		}},
+		{"const [a] = x\nconst = 1", []string{
+			"1:7: const can only bind a name, not a pattern",
+			"2:7: expected a name after `const`, got `=`",
+		}},
+		{"a?.b.c = 1\nx?.1", []string{
+			"1:8: cannot assign to ((a?.b).c), which has ?. or ?[",
+			"2:4: expected a name after `?.`, got `1`",
+		}},
+		{"let x = \"${}\"\nlet y = \"a ${1 2} b\"", []string{
+			"1:12: expected an expression, got `}` ending the interpolation",
+			"2:16: expected `}` to close interpolation in the string opened at 2:9, got `2`",
+		}},
+		{"let f = fn(x) { x + }\nlet g = 2\nlet h = 3", []string{
+			"1:21: expected an expression, got `}`",
+		}},
+		{"let f = fn(x) { if (x) { x * } else { 1 } }; f(1) +", []string{
+			"1:30: expected an expression, got `}`",
+			"1:52: expected an expression, got end of input",
+		}},
+		{"fn f x\nfn g(a) { a", []string{
+			"1:6: expected `(` after `fn f`, got `x`",
+			"2:12: expected `}` to close block opened at 2:9, got end of input",
+		}},
+		{"match (x) { _ => 1, 2 => 3 }\nlet [a, ...r, b] = x", []string{
+			"1:21: unreachable match arm 2, the arm _ before it matches everything",
+			"2:13: expected `]` to close array pattern opened at 2:5, got `,`",
+		}},
+		{"match (x) { 1 => 1, n if n > 2 => 2, n => 3, 4 => 4, _ => 5 }", []string{
+			"1:46: unreachable match arm 4, the arm n before it matches everything",
+			"1:54: unreachable match arm _, the arm n before it matches everything",
+		}},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.in))
+		p.Parse()
+
+		errors := []string{}
+		for _, err := range p.Errors() {
+			errors = append(errors, err.Error())
+		}
+		if strings.Join(errors, "\n") != strings.Join(tt.errors, "\n") {
+			t.Errorf("wrong errors for %q. expected:\n%s\ngot:\n%s", tt.in, strings.Join(tt.errors, "\n"), strings.Join(errors, "\n"))
+		}
+	}
+}
+
+func TestErrorValues(t *testing.T) {
+	p := New(lexer.New("let x = [1, 2 \"three\"]"))
+	p.Parse()
+
+	errors := p.Errors()
+	if len(errors) != 1 {
+		t.Fatalf("wrong number of errors: %v", errors)
+	}
+	err := errors[0]
+	if err.Code != Unclosed {
+		t.Errorf("wrong code: %s", err.Code)
+	}
+	if err.Span.Start != (token.Position{Line: 1, Column: 15}) || err.Span.End != (token.Position{Line: 1, Column: 22}) {
+		t.Errorf("wrong span: %v", err.Span)
+	}
+	if len(err.Hints) != 1 || err.Hints[0] != "the elements of a list are separated by `,`" {
+		t.Errorf("wrong hints: %q", err.Hints)
+	}
+}
+
+func TestMaxErrors(t *testing.T) {
+	input := strings.Repeat("let = 1;\n", 20)
+
+	p := New(lexer.New(input))
+	p.Parse()
+	errors := p.Errors()
+	if len(errors) != DefaultMaxErrors+1 {
+		t.Fatalf("wrong number of errors: %d", len(errors))
+	}
+	if last := errors[len(errors)-1]; last.Code != TooManyErrors || last.Error() != "11:5: too many errors, only the first 10 are reported" {
+		t.Errorf("wrong last error: %s", last)
+	}
+
+	p = New(lexer.New(input))
+	p.MaxErrors = 0
+	p.Parse()
+	if len(p.Errors()) != 20 {
+		t.Errorf("wrong number of errors without a limit: %d", len(p.Errors()))
+	}
+}
+
 func TestIdentifierExpression(t *testing.T) {
 	input := "foo;"
 	lx := lexer.New(input)
@@ -284,7 +405,7 @@ func testIdentifier(t *testing.T, exp ast.Expression, name string) bool {
 	}
 
 	if id.Name != name {
-		t.Errorf("identifier name is not correct. expected: %d, got: %d", name, id.Name)
+		t.Errorf("identifier name is not correct. expected: %q, got: %q", name, id.Name)
 		return false
 	}
 
@@ -430,6 +551,14 @@ func TestFunctionExpressions(t *testing.T) {
 			"fn(x,y){z;a}",
 			"fn (x, y) {z;a;}",
 		},
+		{
+			"fn(a, b = 10, c = a * 2, ...rest) {}",
+			"fn (a, b = 10, c = (a * 2), ...rest) {}",
+		},
+		{
+			"fn(...all){all}",
+			"fn (...all) {all;}",
+		},
 	}
 
 	for _, tt := range tests {
@@ -447,6 +576,27 @@ func TestFunctionExpressions(t *testing.T) {
 	}
 }
 
+func TestFunctionStatements(t *testing.T) {
+	tests := []struct {
+		in  string
+		out string
+	}{
+		{"fn add(a, b) { a + b }", "fn add(a, b) {(a + b);}"},
+		{"fn f(x: int) -> int { x }; f(1)", "fn f(x: int) -> int {x;}f(1)"},
+		{"fn() { 1 }(); fn g() { fn h() {} }", "fn () {1;}()fn g() {fn h() {};}"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.in))
+		prog := p.Parse()
+		cannotHaveErrors(t, p)
+
+		if tt.out != prog.String() {
+			t.Errorf("wrong parsing of %q. expected: %q, got: %q", tt.in, tt.out, prog.String())
+		}
+	}
+}
+
 func TestCallExpressions(t *testing.T) {
 	tests := []struct {
 		in  string
@@ -464,6 +614,52 @@ func TestCallExpressions(t *testing.T) {
 			"fn(x){z}(y)(xxx,1,23)",
 			"fn (x) {z;}(y)(xxx, 1, 23)",
 		},
+		{
+			"f(1, ...args, b: 2 + 3, c: x)",
+			"f(1, ...args, b: (2 + 3), c: x)",
+		},
+		{
+			"[0, ...xs, ...f(y)]",
+			"[0, ...xs, ...f(y)]",
+		},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.in))
+		prog := p.Parse()
+		cannotHaveErrors(t, p)
+
+		if len(prog.Statements) != 1 {
+			t.Fatalf("wrong number of statements. got: %d", len(prog.Statements))
+		}
+
+		if tt.out != prog.String() {
+			t.Fatalf("wrong parsing. expected: %q, got: %q", tt.out, prog.String())
+		}
+	}
+}
+
+func TestArraysAndIndexExpressions(t *testing.T) {
+	tests := []struct {
+		in  string
+		out string
+	}{
+		{
+			`[1, "two", 3 * 4]`,
+			`[1, "two", (3 * 4)]`,
+		},
+		{
+			"[]",
+			"[]",
+		},
+		{
+			"a[1 + 1] * 2",
+			"((a[(1 + 1)]) * 2)",
+		},
+		{
+			"f(x)[0][1]",
+			"((f(x)[0])[1])",
+		},
 	}
 
 	for _, tt := range tests {
@@ -480,3 +676,450 @@ func TestCallExpressions(t *testing.T) {
 		}
 	}
 }
+
+func TestTryAndThrow(t *testing.T) {
+	tests := []struct {
+		in  string
+		out string
+	}{
+		{
+			"try { throw 1 } catch (e) { e }",
+			"try {throw 1;} catch (e) {e;}",
+		},
+		{
+			"let x = try { f() } finally { g() }",
+			"let x = try {f();} finally {g();}",
+		},
+		{
+			`try { throw error("x", 2); } catch (err) { 0 } finally { 1 }`,
+			`try {throw error("x", 2);} catch (err) {0;} finally {1;}`,
+		},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.in))
+		prog := p.Parse()
+		cannotHaveErrors(t, p)
+
+		if len(prog.Statements) != 1 {
+			t.Fatalf("wrong number of statements. got: %d", len(prog.Statements))
+		}
+
+		if tt.out != prog.String() {
+			t.Fatalf("wrong parsing. expected: %q, got: %q", tt.out, prog.String())
+		}
+	}
+
+	p := New(lexer.New("try { 1 }"))
+	p.Parse()
+	if len(p.Errors()) == 0 {
+		t.Fatalf("try without catch or finally must be an error")
+	}
+}
+
+func TestHashLiterals(t *testing.T) {
+	tests := []struct {
+		in  string
+		out string
+	}{
+		{
+			`{"one": 1, "two": 1 + 1}`,
+			`{"one": 1, "two": (1 + 1)}`,
+		},
+		{
+			"{}",
+			"{}",
+		},
+		{
+			`{1: true, key: [x]}["a"]`,
+			`({1: true, key: [x]}["a"])`,
+		},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.in))
+		prog := p.Parse()
+		cannotHaveErrors(t, p)
+
+		if len(prog.Statements) != 1 {
+			t.Fatalf("wrong number of statements. got: %d", len(prog.Statements))
+		}
+
+		if tt.out != prog.String() {
+			t.Fatalf("wrong parsing. expected: %q, got: %q", tt.out, prog.String())
+		}
+	}
+}
+
+func TestConstStatements(t *testing.T) {
+	tests := []struct {
+		in  string
+		out string
+	}{
+		{"const x = 5;", "const x = 5"},
+		{"const f: fn(int) -> int = fn(x) { x }", "const f: fn(int) -> int = fn (x) {x;}"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.in))
+		prog := p.Parse()
+		cannotHaveErrors(t, p)
+
+		if tt.out != prog.String() {
+			t.Errorf("wrong parsing of %q. expected: %q, got: %q", tt.in, tt.out, prog.String())
+		}
+		if !prog.Statements[0].(*ast.LetStatement).IsConst() {
+			t.Errorf("%q must be a const", tt.in)
+		}
+	}
+}
+
+func TestScopedBlocks(t *testing.T) {
+	in := "fn() { if (a) { 1 } else { 2 }; try { 3 } catch (e) { 4 } finally { 5 } }"
+
+	for _, functionScope := range []bool{false, true} {
+		p := New(lexer.New(in))
+		p.FunctionScope = functionScope
+		prog := p.Parse()
+		cannotHaveErrors(t, p)
+
+		fn := prog.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionExpression)
+		ife := fn.Body.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.IfExpression)
+		try := fn.Body.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.TryExpression)
+
+		if fn.Body.Scoped || try.Catch.Scoped {
+			t.Errorf("the blocks of functions and catch clauses must share the scope of their parameters")
+		}
+		for _, b := range []*ast.BlockStatement{ife.Consequence, ife.Alternative, try.Body, try.Finally} {
+			if b.Scoped == functionScope {
+				t.Errorf("block %s with FunctionScope %t: expected Scoped %t", b, functionScope, !functionScope)
+			}
+		}
+	}
+}
+
+func TestTemplateLiterals(t *testing.T) {
+	tests := []struct {
+		in  string
+		out string
+	}{
+		{`"Hello ${name}, you have ${n + 1} items"`, `"Hello ${name}, you have ${(n + 1)} items"`},
+		{`"${a}${b}"`, `"${a}${b}"`},
+		{`"${ {"k": "}"}["k"] }"`, `"${({"k": "}"}["k"])}"`},
+		{`"a ${"b ${c} \"d\""} e"`, `"a ${"b ${c} \"d\""} e"`},
+		{`"\${x} ${fn(x) { x }(1)}"`, `"\${x} ${fn (x) {x;}(1)}"`},
+		{`f("${x}", y)`, `f("${x}", y)`},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.in))
+		prog := p.Parse()
+		cannotHaveErrors(t, p)
+
+		if tt.out != prog.String() {
+			t.Errorf("wrong parsing of %q. expected: %q, got: %q", tt.in, tt.out, prog.String())
+		}
+	}
+}
+
+func TestStructs(t *testing.T) {
+	tests := []struct {
+		in  string
+		out string
+	}{
+		{"struct Point { x, y }", "struct Point {x, y}"},
+		{"struct Empty {}", "struct Empty {}"},
+		{"Point{x: 1, y: 2 * 3}", "Point{x: 1, y: (2 * 3)}"},
+		{"Empty{}", "Empty{}"},
+		{"p.x + a.b.c", "((p.x) + ((a.b).c))"},
+		{"f(x).y[0]", "((f(x).y)[0])"},
+		{"p.x = p.x + 1", "(p.x) = ((p.x) + 1)"},
+		{"if (x) { 1 }", "if x {1;}"},
+		{"s.trim().split(\",\")[0].len()", "((((s.trim)().split)(\",\")[0]).len)()"},
+		{"-a.b * c.d(e)", "((-(a.b)) * (c.d)(e))"},
+		{"match (x) { a => b }", "match (x) {a => b}"},
+		{"let f = fn() { p.next.x = Point{x: 1, y: 0}; }", "let f = fn () {((p.next).x) = Point{x: 1, y: 0};}"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.in))
+		prog := p.Parse()
+		cannotHaveErrors(t, p)
+
+		if tt.out != prog.String() {
+			t.Errorf("wrong parsing of %q. expected: %q, got: %q", tt.in, tt.out, prog.String())
+		}
+	}
+}
+
+func TestNullAndOptionalChains(t *testing.T) {
+	tests := []struct {
+		in  string
+		out string
+	}{
+		{"null", "null"},
+		{"x == null", "(x == null)"},
+		{"a ?? b ?? 1 + 2", "((a ?? b) ?? (1 + 2))"},
+		{"a == b ?? c", "((a == b) ?? c)"},
+		{"a?.b.c", "((a?.b).c)"},
+		{"a?[0]?.b(1)", "((a?[0])?.b)(1)"},
+		{"-a?.b ?? c[d?.e]", "((-(a?.b)) ?? (c[(d?.e)]))"},
+		{"match (x) { null => 0 }", "match (x) {null => 0}"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.in))
+		prog := p.Parse()
+		cannotHaveErrors(t, p)
+
+		if tt.out != prog.String() {
+			t.Errorf("wrong parsing of %q. expected: %q, got: %q", tt.in, tt.out, prog.String())
+		}
+	}
+
+	// parentheses end the chain in them
+	chains := []struct {
+		in       string
+		optional bool
+	}{
+		{"a?.b.c", true},
+		{"(a?.b)", true},
+		{"(a?.b).c", false},
+		{"((a?[0]))[1](2)", false},
+		{"(a?.b).c?.d", true},
+		{"(a.b)?.c(1)", true},
+	}
+	for _, tt := range chains {
+		p := New(lexer.New(tt.in))
+		prog := p.Parse()
+		cannotHaveErrors(t, p)
+
+		e := prog.Statements[0].(*ast.ExpressionStatement).Expression
+		if got := ast.IsOptionalChain(e); got != tt.optional {
+			t.Errorf("wrong chain for %q. expected optional %t, got %t", tt.in, tt.optional, got)
+		}
+	}
+}
+
+func TestMatchExpressions(t *testing.T) {
+	tests := []struct {
+		in  string
+		out string
+	}{
+		{
+			`match (x) { 1 => "one", -1 => "minus one", _ => "other" }`,
+			`match (x) {1 => "one", (-1) => "minus one", _ => "other"}`,
+		},
+		{
+			"match (f(x)) { [a, [b], ...rest] => a + b, [] => 0, }",
+			"match (f(x)) {[a, [b], ...rest] => (a + b), [] => 0}",
+		},
+		{
+			`match (p) { {"name": n, age} if age > 17 => n, {} => false, n => n }`,
+			`match (p) {{"name": n, "age": age} if (age > 17) => n, {} => false, n => n}`,
+		},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.in))
+		prog := p.Parse()
+		cannotHaveErrors(t, p)
+
+		if len(prog.Statements) != 1 {
+			t.Fatalf("wrong number of statements. got: %d", len(prog.Statements))
+		}
+
+		if tt.out != prog.String() {
+			t.Fatalf("wrong parsing. expected: %q, got: %q", tt.out, prog.String())
+		}
+	}
+
+	errorInputs := []string{
+		"match (x) { }",
+		"match (x) { _ => 1, 2 => 3 }",
+		"match (x) { [...a, b] => 1 }",
+		"match (x) { a + 1 => 1 }",
+	}
+
+	for _, in := range errorInputs {
+		p := New(lexer.New(in))
+		p.Parse()
+		if len(p.Errors()) == 0 {
+			t.Errorf("expected errors for %q", in)
+		}
+	}
+}
+
+func TestDestructuringLetStatements(t *testing.T) {
+	tests := []struct {
+		in  string
+		out string
+	}{
+		{
+			"let [a, b, ...rest] = f(x);",
+			"let [a, b, ...rest] = f(x)",
+		},
+		{
+			"let [a, [b, _], c = 1 + 2] = x",
+			"let [a, [b, _], c = (1 + 2)] = x",
+		},
+		{
+			`let {name, age = 18, "address": {city}} = person;`,
+			`let {"name": name, "age": age = 18, "address": {"city": city}} = person`,
+		},
+		{
+			"return a, b + 1, c;",
+			"return [a, (b + 1), c]",
+		},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.in))
+		prog := p.Parse()
+		cannotHaveErrors(t, p)
+
+		if len(prog.Statements) != 1 {
+			t.Fatalf("wrong number of statements. got: %d", len(prog.Statements))
+		}
+
+		if tt.out != prog.String() {
+			t.Fatalf("wrong parsing. expected: %q, got: %q", tt.out, prog.String())
+		}
+	}
+}
+
+func TestParameterErrors(t *testing.T) {
+	inputs := []string{
+		"fn(...rest, a) {}",
+		"fn(a, 1) {}",
+		"f(a: 1, 2)",
+		"fn(a",
+	}
+
+	for _, in := range inputs {
+		p := New(lexer.New(in))
+		p.Parse()
+		if len(p.Errors()) == 0 {
+			t.Errorf("expected errors for %q", in)
+		}
+	}
+}
+
+func TestTypeAnnotations(t *testing.T) {
+	tests := []struct {
+		in  string
+		out string
+	}{
+		{"let x: int = 1;", "let x: int = 1"},
+		{"let xs: [string] = [];", "let xs: [string] = []"},
+		{"let h: {string: [int]} = h", "let h: {string: [int]} = h"},
+		{"fn(a: int, b: bool = true, ...r: [int]) -> int { a }", "fn (a: int, b: bool = true, ...r: [int]) -> int {a;}"},
+		{"fn(f: fn(int, string) -> bool) -> fn() -> int { f }", "fn (f: fn(int, string) -> bool) -> fn() -> int {f;}"},
+		{"fn(a) -> int { a - 1 }", "fn (a) -> int {(a - 1);}"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.in))
+		prog := p.Parse()
+		cannotHaveErrors(t, p)
+
+		if tt.out != prog.String() {
+			t.Fatalf("wrong parsing. expected: %q, got: %q", tt.out, prog.String())
+		}
+	}
+
+	inputs := []string{
+		"let x: = 1",
+		"let x: [int = 1",
+		"fn(a: fn(int)) {}",
+		"fn(a) -> {}",
+	}
+
+	for _, in := range inputs {
+		p := New(lexer.New(in))
+		p.Parse()
+		if len(p.Errors()) == 0 {
+			t.Errorf("expected errors for %q", in)
+		}
+	}
+}
+
+func TestTailCallMarking(t *testing.T) {
+	tests := []struct {
+		in   string
+		tail []bool // of the calls in the order they appear
+	}{
+		{"fn() { f(x) }", []bool{true}},
+		{"fn() { f(x); g(x) }", []bool{false, true}},
+		{"fn() { f(g(x)) }", []bool{true, false}},
+		{"fn() { 1 + f(x) }", []bool{false}},
+		{"fn() { if (a) { return f(x) } g(x); h(x) }", []bool{true, false, true}},
+		{"fn() { if (a) { f(x) } else { g(x) } }", []bool{true, true}},
+		{"fn() { if (a) { f(x) } 1 }", []bool{false}},
+		{"fn() { let y = f(x); y }", []bool{false}},
+		{"fn() { match (x) { 1 => f(x), _ => g(x) } }", []bool{true, true}},
+		{"fn() { try { f(x) } catch (e) { g(x) } }", []bool{false, false}},
+		{"fn() { fn() { f(x) } }", []bool{true}},
+		{"f(x)", []bool{false}},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.in))
+		prog := p.Parse()
+		cannotHaveErrors(t, p)
+
+		calls := []*ast.CallExpression{}
+		collectCalls(prog, &calls)
+
+		if len(calls) != len(tt.tail) {
+			t.Fatalf("wrong number of calls in %q. got: %d", tt.in, len(calls))
+		}
+		for i, call := range calls {
+			if call.Tail != tt.tail[i] {
+				t.Errorf("tail of call %s in %q is wrong. expected: %t", call, tt.in, tt.tail[i])
+			}
+		}
+	}
+}
+
+// collectCalls collects the calls in node, outer calls first.
+func collectCalls(node ast.Node, calls *[]*ast.CallExpression) {
+	switch node := node.(type) {
+	case *ast.Program:
+		for _, s := range node.Statements {
+			collectCalls(s, calls)
+		}
+	case *ast.BlockStatement:
+		for _, s := range node.Statements {
+			collectCalls(s, calls)
+		}
+	case *ast.ExpressionStatement:
+		collectCalls(node.Expression, calls)
+	case *ast.ReturnStatement:
+		collectCalls(node.Value, calls)
+	case *ast.LetStatement:
+		collectCalls(node.Value, calls)
+	case *ast.InfixExpression:
+		collectCalls(node.Left, calls)
+		collectCalls(node.Right, calls)
+	case *ast.IfExpression:
+		collectCalls(node.Consequence, calls)
+		if node.Alternative != nil {
+			collectCalls(node.Alternative, calls)
+		}
+	case *ast.MatchExpression:
+		for _, arm := range node.Arms {
+			collectCalls(arm.Body, calls)
+		}
+	case *ast.TryExpression:
+		collectCalls(node.Body, calls)
+		collectCalls(node.Catch, calls)
+	case *ast.FunctionExpression:
+		collectCalls(node.Body, calls)
+	case *ast.CallExpression:
+		*calls = append(*calls, node)
+		for _, arg := range node.Arguments {
+			collectCalls(arg, calls)
+		}
+	}
+}
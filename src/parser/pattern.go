@@ -0,0 +1,206 @@
+package parser
+
+import (
+	"ast"
+	"fmt"
+	"token"
+)
+
+func (p *Parser) parseMatchExpression() ast.Expression {
+	res := &ast.MatchExpression{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN, "after `match`") {
+		return nil
+	}
+	open := p.curToken
+
+	p.nextToken()
+	res.Subject = p.parseExpression(LOWEST)
+
+	if !p.expectClose(token.RPAREN, "subject of match", open) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE, "after the subject of match") {
+		return nil
+	}
+	open = p.curToken
+
+	var catchAll *ast.MatchArm // the first arm which matches everything, after which no arm can be reached
+	for !p.peekTokenIs(token.RBRACE) {
+		p.nextToken()
+
+		armToken := p.curToken
+		arm := &ast.MatchArm{Pattern: p.parsePattern()}
+		if arm.Pattern == nil {
+			return nil
+		}
+
+		if p.peekTokenIs(token.IF) {
+			p.nextToken()
+			p.nextToken()
+			arm.Guard = p.parseExpression(LOWEST)
+		}
+
+		if !p.expectPeek(token.ARROW, fmt.Sprintf("after the pattern %s of a match arm", arm.Pattern)) {
+			return nil
+		}
+
+		p.nextToken()
+		arm.Body = p.parseExpression(LOWEST)
+
+		if catchAll != nil {
+			e := p.errorAt(armToken, InvalidMatch, "unreachable match arm %s, the arm %s before it matches everything", arm.Pattern, catchAll.Pattern)
+			e.Hints = append(e.Hints, fmt.Sprintf("move the arm %s to the end", catchAll.Pattern))
+		} else if arm.Guard == nil && isIrrefutable(arm.Pattern) {
+			catchAll = arm
+		}
+		res.Arms = append(res.Arms, arm)
+
+		if !p.expectSeparator(token.RBRACE, "match", open) {
+			return nil
+		}
+	}
+
+	p.nextToken()
+
+	if len(res.Arms) == 0 {
+		e := p.errorAt(res.Token, InvalidMatch, "match must have at least one arm")
+		e.Hints = append(e.Hints, "add an arm such as `_ => value`")
+		return nil
+	}
+
+	return res
+}
+
+// isIrrefutable reports whether pat matches every value.
+func isIrrefutable(pat ast.Pattern) bool {
+	switch pat.(type) {
+	case *ast.WildcardPattern, *ast.BindingPattern:
+		return true
+	}
+	return false
+}
+
+// parsePattern parses the pattern starting at the current token, leaving its last token as the current one.
+func (p *Parser) parsePattern() ast.Pattern {
+	switch p.curToken.Type {
+	case token.IDENT:
+		if p.curToken.Literal == "_" {
+			return &ast.WildcardPattern{Token: p.curToken}
+		}
+		return &ast.BindingPattern{Token: p.curToken, Ident: &ast.Identifier{Token: p.curToken, Name: p.curToken.Literal}}
+	case token.INT, token.STRING, token.TRUE, token.FALSE, token.NULL:
+		return &ast.LiteralPattern{Token: p.curToken, Value: p.parseExpression(PREFIX)}
+	case token.MINUS:
+		if !p.peekTokenIs(token.INT) {
+			p.errorAt(p.peekToken, InvalidPattern, "expected an integer after `-` in pattern, got %s", describe(p.peekToken))
+			return nil
+		}
+		return &ast.LiteralPattern{Token: p.curToken, Value: p.parseExpression(PREFIX)}
+	case token.LBRACKET:
+		return p.parseArrayPattern()
+	case token.LBRACE:
+		return p.parseHashPattern()
+	}
+
+	p.errorAt(p.curToken, InvalidPattern, "expected a pattern, got %s", describe(p.curToken))
+	return nil
+}
+
+func (p *Parser) parseArrayPattern() ast.Pattern {
+	res := &ast.ArrayPattern{Token: p.curToken}
+
+	for !p.peekTokenIs(token.RBRACKET) {
+		p.nextToken()
+
+		if p.curToken.Type == token.ELLIPSIS {
+			if !p.expectPeek(token.IDENT, "after `...` in array pattern") {
+				return nil
+			}
+			res.Rest = &ast.Identifier{Token: p.curToken, Name: p.curToken.Literal}
+
+			// the rest must be the last element
+			if !p.peekTokenIs(token.RBRACKET) {
+				e := p.unclosed(p.peekToken, token.RBRACKET, "array pattern", res.Token)
+				e.Hints = append(e.Hints, fmt.Sprintf("...%s must be the last element", res.Rest.Name))
+				return nil
+			}
+			p.nextToken()
+			return res
+		}
+
+		el := p.parsePattern()
+		if el == nil {
+			return nil
+		}
+		res.Elements = append(res.Elements, p.parseDefault(el))
+
+		if !p.expectSeparator(token.RBRACKET, "array pattern", res.Token) {
+			return nil
+		}
+	}
+
+	p.nextToken()
+	return res
+}
+
+func (p *Parser) parseHashPattern() ast.Pattern {
+	res := &ast.HashPattern{Token: p.curToken}
+
+	for !p.peekTokenIs(token.RBRACE) {
+		p.nextToken()
+
+		pair := &ast.HashPatternPair{}
+		switch p.curToken.Type {
+		case token.STRING, token.INT:
+			pair.Key = p.parseExpression(PREFIX)
+		case token.IDENT:
+			// a bare name is a string key
+			pair.Key = &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+		default:
+			p.errorAt(p.curToken, InvalidPattern, "expected a name, a string or an integer as hash pattern key, got %s", describe(p.curToken))
+			return nil
+		}
+
+		if p.peekTokenIs(token.COLON) {
+			p.nextToken()
+			p.nextToken()
+			pair.Value = p.parsePattern()
+			if pair.Value == nil {
+				return nil
+			}
+		} else if p.curToken.Type == token.IDENT {
+			// {name} is short for {name: name}
+			pair.Value = &ast.BindingPattern{Token: p.curToken, Ident: &ast.Identifier{Token: p.curToken, Name: p.curToken.Literal}}
+		} else {
+			p.errorAt(p.peekToken, InvalidPattern, "expected `:` and a pattern after hash pattern key %s, got %s", pair.Key, describe(p.peekToken))
+			return nil
+		}
+
+		pair.Value = p.parseDefault(pair.Value)
+		res.Pairs = append(res.Pairs, pair)
+
+		if !p.expectSeparator(token.RBRACE, "hash pattern", res.Token) {
+			return nil
+		}
+	}
+
+	p.nextToken()
+	return res
+}
+
+// parseDefault parses an optional `= default` after the element pattern pat.
+func (p *Parser) parseDefault(pat ast.Pattern) ast.Pattern {
+	if !p.peekTokenIs(token.ASSIGN) {
+		return pat
+	}
+
+	p.nextToken()
+	res := &ast.DefaultPattern{Token: p.curToken, Pattern: pat}
+
+	p.nextToken()
+	res.Default = p.parseExpression(LOWEST)
+
+	return res
+}
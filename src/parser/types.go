@@ -0,0 +1,84 @@
+package parser
+
+import (
+	"ast"
+	"token"
+)
+
+// parseAnnotation parses an optional `: type` after the current token.
+func (p *Parser) parseAnnotation() ast.TypeExpr {
+	if !p.peekTokenIs(token.COLON) {
+		return nil
+	}
+	p.nextToken()
+	p.nextToken()
+	return p.parseType()
+}
+
+// parseType parses the type starting at the current token, leaving its last token as the current one.
+func (p *Parser) parseType() ast.TypeExpr {
+	switch p.curToken.Type {
+	case token.IDENT:
+		return &ast.NamedType{Token: p.curToken, Name: p.curToken.Literal}
+
+	case token.LBRACKET:
+		res := &ast.ArrayType{Token: p.curToken}
+		p.nextToken()
+		if res.Element = p.parseType(); res.Element == nil {
+			return nil
+		}
+		if !p.expectClose(token.RBRACKET, "array type", res.Token) {
+			return nil
+		}
+		return res
+
+	case token.LBRACE:
+		res := &ast.HashType{Token: p.curToken}
+		p.nextToken()
+		if res.Key = p.parseType(); res.Key == nil {
+			return nil
+		}
+		if !p.expectPeek(token.COLON, "after the key type of hash type") {
+			return nil
+		}
+		p.nextToken()
+		if res.Value = p.parseType(); res.Value == nil {
+			return nil
+		}
+		if !p.expectClose(token.RBRACE, "hash type", res.Token) {
+			return nil
+		}
+		return res
+
+	case token.FUNCTION:
+		res := &ast.FunctionType{Token: p.curToken}
+		if !p.expectPeek(token.LPAREN, "after `fn` in type") {
+			return nil
+		}
+		open := p.curToken
+		for !p.peekTokenIs(token.RPAREN) {
+			p.nextToken()
+			param := p.parseType()
+			if param == nil {
+				return nil
+			}
+			res.Params = append(res.Params, param)
+
+			if !p.expectSeparator(token.RPAREN, "function type", open) {
+				return nil
+			}
+		}
+		p.nextToken()
+		if !p.expectPeek(token.RARROW, "after the parameters of function type") {
+			return nil
+		}
+		p.nextToken()
+		if res.Result = p.parseType(); res.Result == nil {
+			return nil
+		}
+		return res
+	}
+
+	p.errorAt(p.curToken, InvalidType, "expected a type, got %s", describe(p.curToken))
+	return nil
+}
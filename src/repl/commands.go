@@ -0,0 +1,235 @@
+package repl
+
+import (
+	"ast"
+	"evaluator"
+	"fmt"
+	"io/ioutil"
+	"lexer"
+	"object"
+	"optimize"
+	"parser"
+	"resolver"
+	"strings"
+	"time"
+	"token"
+	"typecheck"
+)
+
+// commands are the lines starting with a colon, with their arguments and what they do, for :help.
+var commands = []struct{ name, args, help string }{
+	{":tokens", "EXPR", "show the tokens of EXPR"},
+	{":ast", "EXPR", "show the syntax tree of EXPR"},
+	{":type", "EXPR", "show the type inferred for EXPR"},
+	{":time", "EXPR", "evaluate EXPR and show how long it took"},
+	{":env", "", "list the names bound in the session and their values"},
+	{":reset", "", "forget everything defined in the session"},
+	{":save", "FILE", "write the inputs of the session to FILE"},
+	{":load", "FILE", "run the statements of FILE in the session"},
+	{":help", "", "show this list"},
+}
+
+// command runs a line starting with a colon, such as `:save file`.
+func (s *session) command(line string) {
+	name, arg := line, ""
+	if i := strings.IndexAny(line, " \t"); i >= 0 {
+		name, arg = line[:i], strings.TrimSpace(line[i+1:])
+	}
+
+	switch name {
+	case ":tokens":
+		s.tokens(arg)
+	case ":ast":
+		s.ast(arg)
+	case ":type":
+		s.typeOf(arg)
+	case ":time":
+		s.time(arg)
+	case ":env":
+		s.listEnv()
+	case ":reset":
+		s.env, s.inputs = object.NewEnvironment(), nil
+		fmt.Fprintln(s.out, "the session was reset")
+	case ":save":
+		s.save(arg)
+	case ":load":
+		s.load(arg)
+	case ":help":
+		s.help()
+	default:
+		fmt.Fprintf(s.out, "unknown command %s, type :help to list the commands\n", name)
+	}
+}
+
+func (s *session) help() {
+	for _, c := range commands {
+		fmt.Fprintf(s.out, "%-16s %s\n", strings.TrimSpace(c.name+" "+c.args), c.help)
+	}
+}
+
+// parse parses src for a command, printing the parse errors if there are any.
+func (s *session) parse(command, src string) (*ast.Program, bool) {
+	if src == "" {
+		fmt.Fprintf(s.out, "usage: %s EXPR\n", command)
+		return nil, false
+	}
+
+	p := parser.New(lexer.New(src))
+	prog := p.Parse()
+	if errors := p.Errors(); len(errors) > 0 {
+		s.printErrors("", errors)
+		return nil, false
+	}
+	return prog, true
+}
+
+// tokens prints the tokens of src with their positions, one per line.
+func (s *session) tokens(src string) {
+	if src == "" {
+		fmt.Fprintln(s.out, "usage: :tokens EXPR")
+		return
+	}
+
+	lx := lexer.New(src)
+	for tok := lx.NextToken(); tok.Type != token.EOF; tok = lx.NextToken() {
+		fmt.Fprintf(s.out, "%-6s %-8s %s\n", tok.Pos, tok.Type, tok.Literal)
+	}
+}
+
+// ast prints the program in src, and then its nodes indented under their parents.
+func (s *session) ast(src string) {
+	prog, ok := s.parse(":ast", src)
+	if !ok {
+		return
+	}
+
+	fmt.Fprintln(s.out, prog.String())
+	var tree func(n ast.Node, depth int)
+	tree = func(n ast.Node, depth int) {
+		fmt.Fprintf(s.out, "%s%s %s\n", strings.Repeat("  ", depth), strings.TrimPrefix(fmt.Sprintf("%T", n), "*ast."), n)
+		ast.Inspect(n, func(child ast.Node) bool {
+			if child == n {
+				return true
+			}
+			tree(child, depth+1)
+			return false
+		})
+	}
+	for _, stmt := range prog.Statements {
+		tree(stmt, 0)
+	}
+}
+
+// typeOf prints the type of src, checked after the inputs of the session so that it sees their names.
+// Only the errors found in src are shown, not those of the inputs before it.
+func (s *session) typeOf(src string) {
+	prog, ok := s.parse(":type", src)
+	if !ok {
+		return
+	}
+
+	before := &ast.Program{}
+	for _, input := range s.inputs {
+		// the inputs have been parsed once already
+		before.Statements = append(before.Statements, parser.New(lexer.New(input)).Parse().Statements...)
+	}
+	t, errors := typecheck.CheckAfter(before, prog)
+	if len(errors) > 0 {
+		for _, err := range errors {
+			fmt.Fprintln(s.out, err)
+		}
+		return
+	}
+	fmt.Fprintln(s.out, t)
+}
+
+// time evaluates src as any other input, and prints how long it took.
+func (s *session) time(src string) {
+	if src == "" {
+		fmt.Fprintln(s.out, "usage: :time EXPR")
+		return
+	}
+
+	start := time.Now()
+	res, ok := s.run(src)
+	elapsed := time.Since(start)
+	if ok {
+		fmt.Fprintln(s.out, res.Inspect())
+		fmt.Fprintf(s.out, "took %s\n", elapsed)
+	}
+}
+
+// listEnv prints the names bound in the session with their values.
+func (s *session) listEnv() {
+	names := s.env.Names()
+	if len(names) == 0 {
+		fmt.Fprintln(s.out, "nothing is defined")
+		return
+	}
+	for _, name := range names {
+		value, _ := s.env.Get(name)
+		fmt.Fprintf(s.out, "%s = %s\n", name, value.Inspect())
+	}
+}
+
+// save writes the inputs of the session to file, so that loading it defines the same names.
+// Closures are made again by running the code that made them, along with what they captured.
+func (s *session) save(file string) {
+	if file == "" {
+		fmt.Fprintln(s.out, "usage: :save FILE")
+		return
+	}
+
+	buf := strings.Builder{}
+	for _, input := range s.inputs {
+		input = strings.TrimSpace(input)
+		buf.WriteString(input)
+		// so that the next input does not continue this one, as in `f` followed by `(1)`
+		if !strings.HasSuffix(input, ";") {
+			buf.WriteString(";")
+		}
+		buf.WriteString("\n")
+	}
+
+	if err := ioutil.WriteFile(file, []byte(buf.String()), 0644); err != nil {
+		fmt.Fprintln(s.out, err)
+		return
+	}
+	fmt.Fprintf(s.out, "saved %d input(s) to %s\n", len(s.inputs), file)
+}
+
+// load runs file as one program, its fn statements being bound first as with `monkey run`,
+// but an error only stops the statement it happens in, as if they had been typed in the REPL.
+func (s *session) load(file string) {
+	if file == "" {
+		fmt.Fprintln(s.out, "usage: :load FILE")
+		return
+	}
+
+	src, err := ioutil.ReadFile(file)
+	if err != nil {
+		fmt.Fprintln(s.out, err)
+		return
+	}
+
+	p := parser.New(lexer.New(string(src)))
+	prog := p.Parse()
+	if errors := p.Errors(); len(errors) > 0 {
+		s.printErrors(file, errors)
+		return
+	}
+
+	s.inputs = append(s.inputs, string(src))
+	optimize.Program(prog)
+	resolver.Resolve(prog)
+	printErrors := func(stmt ast.Statement, res object.Object) {
+		if res.Type() == object.TYPE_ERROR {
+			fmt.Fprintln(s.out, res.Inspect())
+		}
+	}
+	if err := evaluator.EvalEach(prog, s.env, printErrors); err != nil {
+		fmt.Fprintln(s.out, err.Inspect())
+		return
+	}
+	fmt.Fprintf(s.out, "loaded %s\n", file)
+}
@@ -0,0 +1,479 @@
+package repl
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// maximum number of lines kept in the history
+const historySize = 1000
+
+// lineReader reads the lines typed in the REPL.
+type lineReader interface {
+	// ReadLine shows prompt and returns the next line, or io.EOF when there is no more input.
+	ReadLine(prompt string) (string, error)
+}
+
+// scanReader reads plain lines, for when the input is not a terminal.
+type scanReader struct {
+	sc  *bufio.Scanner
+	out io.Writer
+}
+
+func (r *scanReader) ReadLine(prompt string) (string, error) {
+	fmt.Fprint(r.out, prompt)
+	if !r.sc.Scan() {
+		if err := r.sc.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+	return r.sc.Text(), nil
+}
+
+// editor is a line editor for terminals, with the usual emacs style keys,
+// a history navigated with the arrows and searched with Ctrl-R, and completion with Tab.
+type editor struct {
+	in  *bufio.Reader
+	out io.Writer
+
+	// makeRaw puts the terminal in raw mode while a line is edited
+	makeRaw func() (restore func(), err error)
+	// complete lists the words that may be completed
+	complete func() []string
+
+	history     []string
+	historyFile string // where lines are appended, none if empty
+
+	// the line being edited
+	prompt string
+	line   []rune
+	pos    int // of the cursor in line
+}
+
+// historyPath is where the history is kept between sessions.
+func historyPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".monkey_history")
+}
+
+// loadHistory reads the lines saved in historyFile by previous sessions.
+func (e *editor) loadHistory() {
+	if e.historyFile == "" {
+		return
+	}
+	f, err := os.Open(e.historyFile)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if sc.Text() != "" {
+			e.history = append(e.history, sc.Text())
+		}
+	}
+	if len(e.history) > historySize {
+		e.history = e.history[len(e.history)-historySize:]
+	}
+}
+
+func (e *editor) addHistory(line string) {
+	if strings.TrimSpace(line) == "" || (len(e.history) > 0 && e.history[len(e.history)-1] == line) {
+		return
+	}
+	e.history = append(e.history, line)
+	if len(e.history) > historySize {
+		e.history = e.history[1:]
+	}
+
+	if e.historyFile != "" {
+		if f, err := os.OpenFile(e.historyFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600); err == nil {
+			fmt.Fprintln(f, line)
+			f.Close()
+		}
+	}
+}
+
+// keys, as read in raw mode
+const (
+	keyCtrlA     = 1
+	keyCtrlB     = 2
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyCtrlF     = 6
+	keyCtrlG     = 7
+	keyBackspace = 8
+	keyTab       = 9
+	keyLineFeed  = 10
+	keyCtrlK     = 11
+	keyCtrlL     = 12
+	keyEnter     = 13
+	keyCtrlN     = 14
+	keyCtrlP     = 16
+	keyCtrlR     = 18
+	keyCtrlU     = 21
+	keyCtrlW     = 23
+	keyEscape    = 27
+	keyDelete    = 127
+)
+
+// escape sequences are turned into these, beyond the range of unicode
+const (
+	keyUp = unicode.MaxRune + 1 + iota
+	keyDown
+	keyRight
+	keyLeft
+	keyHome
+	keyEnd
+	keyDeleteForward
+	keyUnknown
+)
+
+func (e *editor) ReadLine(prompt string) (string, error) {
+	// a prompt starting on a new line is only written once, and then redrawn from its last line
+	if i := strings.LastIndex(prompt, "\n"); i >= 0 {
+		fmt.Fprint(e.out, prompt[:i+1])
+		prompt = prompt[i+1:]
+	}
+	e.prompt, e.line, e.pos = prompt, nil, 0
+
+	restore, err := e.makeRaw()
+	if err != nil {
+		return "", err
+	}
+	defer restore()
+
+	e.refresh()
+	histPos := len(e.history) // the history entry being shown, len(e.history) being the new line
+	saved := ""               // the new line, kept while going through the history
+
+	for {
+		key, err := e.readKey()
+		if err != nil {
+			return "", err
+		}
+
+		switch key {
+		case keyEnter, keyLineFeed:
+			fmt.Fprint(e.out, "\r\n")
+			line := string(e.line)
+			e.addHistory(line)
+			return line, nil
+
+		case keyCtrlC:
+			fmt.Fprint(e.out, "^C\r\n")
+			e.line, e.pos = nil, 0
+			histPos = len(e.history)
+			e.refresh()
+
+		case keyCtrlD:
+			if len(e.line) == 0 {
+				fmt.Fprint(e.out, "\r\n")
+				return "", io.EOF
+			}
+			e.deleteForward()
+
+		case keyBackspace, keyDelete:
+			if e.pos > 0 {
+				e.line = append(e.line[:e.pos-1], e.line[e.pos:]...)
+				e.pos--
+				e.refresh()
+			}
+		case keyDeleteForward:
+			e.deleteForward()
+
+		case keyCtrlA, keyHome:
+			e.pos = 0
+			e.refresh()
+		case keyCtrlE, keyEnd:
+			e.pos = len(e.line)
+			e.refresh()
+		case keyCtrlB, keyLeft:
+			if e.pos > 0 {
+				e.pos--
+				e.refresh()
+			}
+		case keyCtrlF, keyRight:
+			if e.pos < len(e.line) {
+				e.pos++
+				e.refresh()
+			}
+
+		case keyCtrlK:
+			e.line = e.line[:e.pos]
+			e.refresh()
+		case keyCtrlU:
+			e.line = append([]rune{}, e.line[e.pos:]...)
+			e.pos = 0
+			e.refresh()
+		case keyCtrlW:
+			start := e.pos
+			for start > 0 && e.line[start-1] == ' ' {
+				start--
+			}
+			for start > 0 && e.line[start-1] != ' ' {
+				start--
+			}
+			e.line = append(e.line[:start], e.line[e.pos:]...)
+			e.pos = start
+			e.refresh()
+		case keyCtrlL:
+			fmt.Fprint(e.out, "\x1b[H\x1b[2J")
+			e.refresh()
+
+		case keyCtrlP, keyUp, keyCtrlN, keyDown:
+			next := histPos - 1
+			if key == keyCtrlN || key == keyDown {
+				next = histPos + 1
+			}
+			if next < 0 || next > len(e.history) {
+				break
+			}
+			if histPos == len(e.history) {
+				saved = string(e.line)
+			}
+			histPos = next
+			if histPos == len(e.history) {
+				e.setLine(saved)
+			} else {
+				e.setLine(e.history[histPos])
+			}
+
+		case keyCtrlR:
+			line, accepted, err := e.search()
+			if err != nil {
+				return "", err
+			}
+			e.setLine(line)
+			if accepted {
+				fmt.Fprint(e.out, "\r\n")
+				e.addHistory(line)
+				return line, nil
+			}
+
+		case keyTab:
+			e.completeWord()
+
+		default:
+			if key >= ' ' && key <= unicode.MaxRune {
+				e.line = append(e.line[:e.pos], append([]rune{key}, e.line[e.pos:]...)...)
+				e.pos++
+				e.refresh()
+			}
+		}
+	}
+}
+
+// readKey reads a key press, turning the escape sequences of special keys into single keys.
+func (e *editor) readKey() (rune, error) {
+	r, _, err := e.in.ReadRune()
+	if err != nil || r != keyEscape {
+		return r, err
+	}
+
+	// terminals send the escape sequence of a key all at once,
+	// so an escape with nothing after it yet is the Escape key itself
+	if e.in.Buffered() == 0 {
+		return keyEscape, nil
+	}
+	next, _, err := e.in.ReadRune()
+	if err != nil {
+		return 0, err
+	}
+	if next != '[' && next != 'O' {
+		// Escape then another key, which is read next
+		e.in.UnreadRune()
+		return keyEscape, nil
+	}
+
+	// CSI sequences are parameters, then a final letter or ~
+	params := ""
+	for {
+		c, _, err := e.in.ReadRune()
+		if err != nil {
+			return 0, err
+		}
+		if c >= '0' && c <= '9' || c == ';' {
+			params += string(c)
+			continue
+		}
+
+		switch c {
+		case 'A':
+			return keyUp, nil
+		case 'B':
+			return keyDown, nil
+		case 'C':
+			return keyRight, nil
+		case 'D':
+			return keyLeft, nil
+		case 'H':
+			return keyHome, nil
+		case 'F':
+			return keyEnd, nil
+		case '~':
+			switch params {
+			case "1", "7":
+				return keyHome, nil
+			case "4", "8":
+				return keyEnd, nil
+			case "3":
+				return keyDeleteForward, nil
+			}
+		}
+		return keyUnknown, nil
+	}
+}
+
+func (e *editor) deleteForward() {
+	if e.pos < len(e.line) {
+		e.line = append(e.line[:e.pos], e.line[e.pos+1:]...)
+		e.refresh()
+	}
+}
+
+func (e *editor) setLine(line string) {
+	e.line = []rune(line)
+	e.pos = len(e.line)
+	e.refresh()
+}
+
+// refresh redraws the prompt and the line, and puts the cursor back where it is in the line.
+func (e *editor) refresh() {
+	e.draw(e.prompt, e.line, e.pos)
+}
+
+func (e *editor) draw(prompt string, line []rune, pos int) {
+	fmt.Fprintf(e.out, "\r%s%s\x1b[K", prompt, string(line))
+	if back := len(line) - pos; back > 0 {
+		fmt.Fprintf(e.out, "\x1b[%dD", back)
+	}
+}
+
+// search lets the user search the history backwards, as Ctrl-R does in shells.
+// Enter accepts the line found, while Escape, Ctrl-G or Ctrl-C go back to the line as it was.
+// Other keys leave the search with the line found, to go on editing it.
+func (e *editor) search() (line string, accepted bool, err error) {
+	query := []rune{}
+	found := len(e.history) // index of the match shown
+	original := string(e.line)
+
+	find := func(from int) {
+		for i := from; i >= 0; i-- {
+			if strings.Contains(e.history[i], string(query)) {
+				found = i
+				return
+			}
+		}
+	}
+	current := func() string {
+		if found < len(e.history) {
+			return e.history[found]
+		}
+		return original
+	}
+
+	for {
+		shown := []rune(current())
+		at := strings.Index(string(shown), string(query))
+		if at < 0 {
+			at = 0
+		}
+		e.draw(fmt.Sprintf("(reverse-i-search)`%s': ", string(query)), shown, len([]rune(string(shown)[:at])))
+
+		key, err := e.readKey()
+		if err != nil {
+			return "", false, err
+		}
+		switch key {
+		case keyCtrlR:
+			if found > 0 {
+				find(found - 1)
+			}
+		case keyBackspace, keyDelete:
+			if len(query) > 0 {
+				query = query[:len(query)-1]
+				found = len(e.history)
+				find(len(e.history) - 1)
+			}
+		case keyEnter, keyLineFeed:
+			return current(), true, nil
+		case keyEscape, keyCtrlG, keyCtrlC, keyUnknown:
+			return original, false, nil
+		default:
+			if key >= ' ' && key <= unicode.MaxRune {
+				query = append(query, key)
+				// the line found may still match
+				if found == len(e.history) {
+					find(found - 1)
+				} else {
+					find(found)
+				}
+			} else {
+				return current(), false, nil
+			}
+		}
+	}
+}
+
+// completeWord completes the word before the cursor with the longest prefix common to
+// all the candidates. If that adds nothing, the candidates are listed under the line.
+func (e *editor) completeWord() {
+	start := e.pos
+	for start > 0 && isWordRune(e.line[start-1]) {
+		start--
+	}
+	prefix := e.line[start:e.pos]
+
+	matches := []string{}
+	seen := map[string]bool{}
+	for _, w := range e.complete() {
+		if strings.HasPrefix(w, string(prefix)) && !seen[w] {
+			matches = append(matches, w)
+			seen[w] = true
+		}
+	}
+	if len(matches) == 0 {
+		return
+	}
+	sort.Strings(matches)
+
+	// in runes, so that a character is never cut in the middle
+	common := []rune(matches[0])
+	for _, m := range matches[1:] {
+		n := 0
+		for _, r := range m {
+			if n == len(common) || common[n] != r {
+				break
+			}
+			n++
+		}
+		common = common[:n]
+	}
+
+	if len(common) > len(prefix) {
+		added := common[len(prefix):]
+		e.line = append(e.line[:e.pos], append(added, e.line[e.pos:]...)...)
+		e.pos += len(added)
+		e.refresh()
+	} else if len(matches) > 1 {
+		fmt.Fprintf(e.out, "\r\n%s\r\n", strings.Join(matches, "  "))
+		e.refresh()
+	}
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
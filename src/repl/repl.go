@@ -1,42 +1,108 @@
 package repl
 
 import (
+	"ast"
 	"bufio"
+	"evaluator"
 	"fmt"
 	"io"
 	"lexer"
-	"parser"
-	"evaluator"
 	"object"
+	"optimize"
+	"os"
+	"parser"
+	"resolver"
+	"strings"
+	"token"
 )
 
 const PROMPT = "\n🐵> "
 
+// session is the state of a REPL: its environment, and the inputs that made it,
+// which is what :save writes out.
+type session struct {
+	out    io.Writer
+	env    *object.Environment
+	inputs []string
+}
+
 func Start(in io.Reader, out io.Writer) {
-	sc := bufio.NewScanner(in)
-	env := object.NewEnvironment()
+	s := &session{out: out, env: object.NewEnvironment()}
+	r := s.lineReader(in)
 
 	for {
-		fmt.Print(PROMPT)
-		if !sc.Scan() {
+		line, err := r.ReadLine(PROMPT)
+		if err != nil {
 			return
 		}
-		line := sc.Text()
-		lx := lexer.New(line)
-		p := parser.New(lx)
-		prog := p.Parse()
-
-		errors := p.Errors()
-		if len(errors) > 0 {
-			fmt.Printf("Found %d error(s):\n", len(errors))
-			for _, msg := range errors {
-				fmt.Printf("- %s\n", msg)
-			}
-
-		} else {
-			out := evaluator.Eval(prog, env)
-			fmt.Print(out.Inspect())
-			fmt.Println()
+
+		if strings.HasPrefix(line, ":") {
+			s.command(line)
+			continue
+		}
+
+		if res, ok := s.run(line); ok {
+			fmt.Fprint(out, res.Inspect())
+			fmt.Fprintln(out)
+		}
+	}
+}
+
+// lineReader returns a line editor if in is a terminal, or reads plain lines from it otherwise.
+func (s *session) lineReader(in io.Reader) lineReader {
+	f, ok := in.(*os.File)
+	if !ok || !isTerminal(f.Fd()) {
+		return &scanReader{sc: bufio.NewScanner(in), out: s.out}
+	}
+
+	e := &editor{
+		in:          bufio.NewReader(f),
+		out:         s.out,
+		makeRaw:     func() (func(), error) { return makeRaw(f.Fd()) },
+		complete:    s.completions,
+		historyFile: historyPath(),
+	}
+	e.loadHistory()
+	return e
+}
+
+// completions are the words completed by the line editor: keywords and the names bound in the session.
+func (s *session) completions() []string {
+	return append(token.Keywords(), s.env.Names()...)
+}
+
+// run evaluates src in the session, printing the parse errors if there are any.
+func (s *session) run(src string) (object.Object, bool) {
+	lx := lexer.New(src)
+	p := parser.New(lx)
+	prog := p.Parse()
+
+	if errors := p.Errors(); len(errors) > 0 {
+		s.printErrors("", errors)
+		return nil, false
+	}
+
+	s.inputs = append(s.inputs, src)
+	return s.eval(prog), true
+}
+
+// printErrors prints the syntax errors found in file, or in the input if it is empty, with their hints.
+func (s *session) printErrors(file string, errors []*parser.Error) {
+	if file != "" {
+		fmt.Fprintf(s.out, "Found %d error(s) in %s:\n", len(errors), file)
+	} else {
+		fmt.Fprintf(s.out, "Found %d error(s):\n", len(errors))
+	}
+	for _, err := range errors {
+		fmt.Fprintf(s.out, "- %s\n", err)
+		for _, hint := range err.Hints {
+			fmt.Fprintf(s.out, "  hint: %s\n", hint)
 		}
 	}
 }
+
+func (s *session) eval(prog *ast.Program) object.Object {
+	optimize.Program(prog)
+	resolver.Resolve(prog)
+	return evaluator.Eval(prog, s.env)
+}
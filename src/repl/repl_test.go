@@ -0,0 +1,213 @@
+package repl
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func runREPL(input string) string {
+	out := bytes.Buffer{}
+	Start(strings.NewReader(input), &out)
+	return out.String()
+}
+
+func TestSaveAndLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "monkey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "session.mk")
+
+	out := runREPL(strings.Join([]string{
+		"let make = fn(n) { fn(m) { n + m } }",
+		"let addTen = make(10)",
+		"let bad = 1 + true",
+		"let broken = (",
+		"let x = addTen(5)",
+		"if (x > 10) { x }",
+		"(1)",
+		":save " + file,
+	}, "\n"))
+	if !strings.Contains(out, "saved 6 input(s) to "+file) {
+		t.Fatalf("wrong output for :save: %s", out)
+	}
+
+	out = runREPL(":load " + file + "\naddTen(x)\nbad")
+	for _, expected := range []string{
+		`ERROR("second operand of + cannot be boolean") at 3:13`,
+		"loaded " + file,
+		"25",
+		`ERROR("unknown identifier: bad") at 1:1`,
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("expected %q in the output of :load, got: %s", expected, out)
+		}
+	}
+
+	// fn statements are bound before the rest of the file runs, as with monkey run
+	hoisted := filepath.Join(dir, "hoisted.mk")
+	src := "let even = isEven(4)\nfn isEven(n) { if (n == 0) { true } else { isOdd(n - 1) } }\nfn isOdd(n) { if (n == 0) { false } else { isEven(n - 1) } }"
+	if err := ioutil.WriteFile(hoisted, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out = runREPL(":load " + hoisted + "\n[even, isOdd(3)]")
+	if !strings.Contains(out, "loaded "+hoisted) || !strings.Contains(out, "[true, true]") {
+		t.Errorf("wrong output for :load with fn statements: %s", out)
+	}
+
+	clash := filepath.Join(dir, "clash.mk")
+	if err := ioutil.WriteFile(clash, []byte("const f = 1\nfn f() { 2 }"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out = runREPL(":load " + clash)
+	if !strings.Contains(out, `ERROR("fn f clashes with another declaration of f in its block") at 2:1`) || strings.Contains(out, "loaded") {
+		t.Errorf("wrong output for :load with clashing names: %s", out)
+	}
+
+	out = runREPL(":load " + filepath.Join(dir, "missing.mk") + "\n:nope")
+	if !strings.Contains(out, "no such file") || !strings.Contains(out, "unknown command :nope") {
+		t.Errorf("wrong errors: %s", out)
+	}
+}
+
+func TestCommands(t *testing.T) {
+	tests := []struct {
+		in       string
+		expected []string
+	}{
+		{":tokens let x = 1", []string{"1:1    LET      let", "1:5    IDENT    x", "1:9    INT      1"}},
+		{":ast -a + 1", []string{"ExpressionStatement ((-a) + 1)", "  InfixExpression ((-a) + 1)", "    PrefixExpression (-a)", "      Identifier a"}},
+		{"let f = fn(a) { a * 2 }\n:type f\n:type f(true)", []string{"fn(int) -> int", "1:3: argument 1 of f: expected int, got bool"}},
+		{"let bad = 1 + true\n:type [bad]", []string{"[int]"}},
+		{"y\n:type let y = 1", []string{"unknown identifier: y", "int"}},
+		{"let f = fn(x) { x + 1 }\nlet g = fn() { f(true) }\n:type f(\"a\")", []string{"1:3: argument 1 of f: expected int, got string"}},
+		{":time 1 + 2", []string{"3\ntook "}},
+		{"let a = 1\nlet b = [a]\n:env", []string{"a = 1\nb = [1]\n"}},
+		{"let a = 1\n:reset\n:env\na", []string{"the session was reset", "nothing is defined", "unknown identifier: a"}},
+		{":help", []string{":load FILE", ":help "}},
+		{":ast (", []string{"Found 1 error(s):\n- 1:2: expected an expression, got end of input"}},
+		{":type", []string{"usage: :type EXPR"}},
+		{":what", []string{"unknown command :what, type :help to list the commands"}},
+	}
+
+	for _, tt := range tests {
+		out := runREPL(tt.in)
+		for _, expected := range tt.expected {
+			if !strings.Contains(out, expected) {
+				t.Errorf("expected %q in the output of %q, got: %s", expected, tt.in, out)
+			}
+		}
+	}
+}
+
+func newTestEditor(input string, history ...string) (*editor, *bytes.Buffer) {
+	out := &bytes.Buffer{}
+	e := &editor{
+		in:       bufio.NewReader(strings.NewReader(input)),
+		out:      out,
+		makeRaw:  func() (func(), error) { return func() {}, nil },
+		complete: func() []string { return []string{"let", "fn", "format", "forward", "x", "aé", "aè", "étage"} },
+		history:  history,
+	}
+	return e, out
+}
+
+func TestEditor(t *testing.T) {
+	tests := []struct {
+		in      string
+		history []string
+		lines   []string
+	}{
+		{"abc\x1b[DX\r", nil, []string{"abXc"}},
+		{"abc\x01X\x05Y\r", nil, []string{"XabcY"}},
+		{"abcd\x02\x02\x0b\r", nil, []string{"ab"}},
+		{"ab cd\x17\r", nil, []string{"ab "}},
+		{"abc\x7f\x7f\r", nil, []string{"a"}},
+		{"abc\x1b[H\x1b[3~\r", nil, []string{"bc"}},
+		{"new\x1b[A\x1b[A\r\x1b[A\x1b[A\x1b[A\x1b[B\r", []string{"one", "two"}, []string{"one", "two"}},
+		{"x\x1b[A\x1b[B!\r", []string{"old"}, []string{"x!"}},
+		{"\x12ne\r", []string{"one", "none", "two"}, []string{"none"}},
+		{"\x12ne\x12\r", []string{"one", "none", "two"}, []string{"one"}},
+		{"\x12tw\x05!\r", []string{"one", "two"}, []string{"two!"}},
+		{"keep\x12zz\x07\r", []string{"one"}, []string{"keep"}},
+		{"keep\x12zz\x1b!\r", []string{"one"}, []string{"keep!"}},
+		{"ab\x1bc\r", nil, []string{"abc"}},
+		{"le\t 1\r", nil, []string{"let 1"}},
+		{"fo\tw\t\r", nil, []string{"forward"}},
+		{"a\t\r", nil, []string{"a"}},
+		{"ét\t!\r", nil, []string{"étage!"}},
+		{"a\x03b\r", nil, []string{"b"}},
+		{"a\r\x04", nil, []string{"a"}},
+	}
+
+	for _, tt := range tests {
+		e, _ := newTestEditor(tt.in, tt.history...)
+		lines := []string{}
+		for {
+			line, err := e.ReadLine("> ")
+			if err != nil {
+				break
+			}
+			lines = append(lines, line)
+		}
+		if strings.Join(lines, "|") != strings.Join(tt.lines, "|") {
+			t.Errorf("wrong lines for %q. expected: %q, got: %q", tt.in, tt.lines, lines)
+		}
+	}
+}
+
+// TestEditorLoneEscape types Escape on its own, as a terminal sends it, which cancels the search
+// without waiting for the next key.
+func TestEditorLoneEscape(t *testing.T) {
+	r, w := io.Pipe()
+	go func() {
+		for _, keys := range []string{"keep\x12zz", "\x1b", "\r"} {
+			w.Write([]byte(keys))
+		}
+		w.Close()
+	}()
+
+	e, _ := newTestEditor("")
+	e.in = bufio.NewReader(r)
+	line, err := e.ReadLine("> ")
+	if err != nil || line != "keep" {
+		t.Errorf("wrong line after cancelling the search with Escape: %q, error: %v", line, err)
+	}
+}
+
+func TestEditorCompletionList(t *testing.T) {
+	e, out := newTestEditor("f\t\r")
+	e.ReadLine("> ")
+	if !strings.Contains(out.String(), "fn  format  forward") {
+		t.Errorf("candidates are not listed: %q", out.String())
+	}
+}
+
+func TestHistoryFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "monkey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "history")
+
+	e, _ := newTestEditor("one\r\rone\rtwo\r")
+	e.historyFile = file
+	for i := 0; i < 4; i++ {
+		e.ReadLine("> ")
+	}
+
+	e, _ = newTestEditor("\x1b[A\x1b[A\r")
+	e.historyFile = file
+	e.loadHistory()
+	if line, _ := e.ReadLine("> "); line != "one" {
+		t.Errorf("wrong line from the saved history: %q, history: %q", line, e.history)
+	}
+}
@@ -0,0 +1,181 @@
+// Package resolver works out statically where the names in a program are bound,
+// so the evaluator can find local bindings by index instead of by name.
+package resolver
+
+import (
+	"ast"
+)
+
+// Resolve gives a slot to every name bound in a function, match arm, catch clause or scoped block in node,
+// and marks the identifiers referring to them with the slot and how many scopes up it is.
+// Names of the top level scope are left to be looked up by name, since the REPL keeps adding to it.
+func Resolve(node ast.Node) {
+	r := &resolver{}
+	r.resolve(node)
+}
+
+type scope struct {
+	names []string
+	slots map[string]int
+}
+
+func newScope() *scope {
+	return &scope{names: []string{}, slots: make(map[string]int)}
+}
+
+func (s *scope) declare(name string) {
+	if _, ok := s.slots[name]; !ok {
+		s.slots[name] = len(s.names)
+		s.names = append(s.names, name)
+	}
+}
+
+type resolver struct {
+	scopes []*scope // innermost last, the top level scope is not included
+}
+
+func (r *resolver) resolve(node ast.Node) {
+	ast.Inspect(node, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.Identifier:
+			r.lookup(node)
+
+		case *ast.NamedArgument:
+			// the name is the one of a parameter, not a variable
+			r.resolve(node.Value)
+			return false
+
+		case *ast.FunctionExpression:
+			s := newScope()
+			for _, p := range node.Params {
+				s.declare(p.Name)
+			}
+			if node.Rest != nil {
+				s.declare(node.Rest.Name)
+			}
+			for _, d := range node.Defaults {
+				declareIn(s, d)
+			}
+			declareIn(s, node.Body)
+
+			r.scopes = append(r.scopes, s)
+			for _, p := range node.Params {
+				r.resolve(p)
+			}
+			for _, d := range node.Defaults {
+				r.resolve(d)
+			}
+			r.resolve(node.Rest)
+			r.resolve(node.Body)
+			r.scopes = r.scopes[:len(r.scopes)-1]
+
+			node.Locals = s.names
+			return false
+
+		case *ast.MatchExpression:
+			r.resolve(node.Subject)
+			for _, arm := range node.Arms {
+				s := newScope()
+				declareIn(s, arm.Pattern)
+				declareIn(s, arm.Guard)
+				declareIn(s, arm.Body)
+
+				r.scopes = append(r.scopes, s)
+				r.resolve(arm.Pattern)
+				r.resolve(arm.Guard)
+				r.resolve(arm.Body)
+				r.scopes = r.scopes[:len(r.scopes)-1]
+
+				arm.Locals = s.names
+			}
+			return false
+
+		case *ast.BlockStatement:
+			if !node.Scoped {
+				return true
+			}
+			s := newScope()
+			for _, st := range node.Statements {
+				declareIn(s, st)
+			}
+
+			r.scopes = append(r.scopes, s)
+			for _, st := range node.Statements {
+				r.resolve(st)
+			}
+			r.scopes = r.scopes[:len(r.scopes)-1]
+
+			node.Locals = s.names
+			return false
+
+		case *ast.TryExpression:
+			r.resolve(node.Body)
+			if node.Catch != nil {
+				s := newScope()
+				s.declare(node.CatchParam.Name)
+				declareIn(s, node.Catch)
+
+				r.scopes = append(r.scopes, s)
+				r.resolve(node.CatchParam)
+				r.resolve(node.Catch)
+				r.scopes = r.scopes[:len(r.scopes)-1]
+
+				node.CatchLocals = s.names
+			}
+			r.resolve(node.Finally)
+			return false
+		}
+		return true
+	})
+}
+
+func (r *resolver) lookup(id *ast.Identifier) {
+	for i := len(r.scopes) - 1; i >= 0; i-- {
+		if slot, ok := r.scopes[i].slots[id.Name]; ok {
+			id.Resolved = true
+			id.Depth = len(r.scopes) - 1 - i
+			id.Slot = slot
+			return
+		}
+	}
+	id.Resolved = false
+}
+
+// declareIn declares in s the names bound by node in the scope it is in,
+// not looking into the nodes which have scopes of their own.
+func declareIn(s *scope, node ast.Node) {
+	ast.Inspect(node, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.LetStatement:
+			if node.Ident != nil {
+				s.declare(node.Ident.Name)
+			}
+		case *ast.StructStatement:
+			s.declare(node.Name.Name)
+		case *ast.FunctionStatement:
+			s.declare(node.Name.Name)
+		case *ast.BindingPattern:
+			s.declare(node.Ident.Name)
+		case *ast.ArrayPattern:
+			for _, el := range node.Elements {
+				declareIn(s, el)
+			}
+			if node.Rest != nil {
+				s.declare(node.Rest.Name)
+			}
+			return false
+		case *ast.FunctionExpression:
+			return false
+		case *ast.BlockStatement:
+			return !node.Scoped
+		case *ast.MatchExpression:
+			declareIn(s, node.Subject)
+			return false
+		case *ast.TryExpression:
+			declareIn(s, node.Body)
+			declareIn(s, node.Finally)
+			return false
+		}
+		return true
+	})
+}
@@ -0,0 +1,150 @@
+package resolver
+
+import (
+	"ast"
+	"fmt"
+	"lexer"
+	"parser"
+	"strings"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		in            string
+		out           string // name@depth:slot of each identifier, or name@global
+		functionScope bool   // see parser.Parser.FunctionScope
+	}{
+		{
+			"let x = 1; x",
+			"x@global x@global",
+			false,
+		},
+		{
+			"fn(a, b) { a + b + c }",
+			"a@0:0 b@0:1 a@0:0 b@0:1 c@global",
+			false,
+		},
+		{
+			"fn(a, ...r) { let b = 1; if (a) { let c = b } c }",
+			"a@0:0 r@0:1 b@0:2 a@0:0 c@0:0 b@1:2 c@global",
+			false,
+		},
+		{
+			"fn(a, ...r) { let b = 1; if (a) { let c = b } c }",
+			"a@0:0 r@0:1 b@0:2 a@0:0 c@0:3 b@0:2 c@0:3",
+			true,
+		},
+		{
+			"if (a) { let b = a; if (b) { let b = 2; fn() { b } } else { b } }",
+			"a@global b@0:0 a@global b@0:0 b@0:0 b@1:0 b@1:0",
+			false,
+		},
+		{
+			"fn(a) { fn(b) { a + b } }",
+			"a@0:0 b@0:0 a@1:0 b@0:0",
+			false,
+		},
+		{
+			"fn(a, b = a) { b }",
+			"a@0:0 b@0:1 a@0:0 b@0:1",
+			false,
+		},
+		{
+			"fn(x) { match (x) { [a, ...r] if a => a + x, _ => x } }",
+			"x@0:0 x@0:0 a@0:0 r@0:1 a@0:0 a@0:0 x@1:0 x@1:0",
+			false,
+		},
+		{
+			"fn(x) { try { let y = x } catch (e) { let z = e; y } }",
+			"x@0:0 y@0:0 x@1:0 e@0:0 z@0:1 e@0:0 y@global",
+			false,
+		},
+		{
+			"fn(x) { try { let y = x } catch (e) { let z = e; y } }",
+			"x@0:0 y@0:1 x@0:0 e@0:0 z@0:1 e@0:0 y@1:1",
+			true,
+		},
+		{
+			"fn() { let [a, {b}] = f(a: 1); g(c: a) }",
+			"a@0:0 b@0:1 f@global g@global a@0:0",
+			false,
+		},
+		{
+			"fn() { g(); fn g() { h() } let h = 1; fn h() {} }",
+			"g@0:0 g@0:0 h@1:1 h@0:1 h@0:1",
+			false,
+		},
+		{
+			"fn(x) { struct P { x }; let p = P{x: x}; p.x = p.x + 1 }",
+			"x@0:0 P@0:1 p@0:2 P@0:1 x@0:0 p@0:2 p@0:2",
+			false,
+		},
+	}
+
+	for _, tt := range tests {
+		p := parser.New(lexer.New(tt.in))
+		p.FunctionScope = tt.functionScope
+		prog := p.Parse()
+		if len(p.Errors()) > 0 {
+			t.Fatalf("parser errors for %q: %v", tt.in, p.Errors())
+		}
+
+		Resolve(prog)
+
+		ids := []string{}
+		ast.Inspect(prog, func(node ast.Node) bool {
+			if id, ok := node.(*ast.Identifier); ok {
+				if id.Resolved {
+					ids = append(ids, fmt.Sprintf("%s@%d:%d", id.Name, id.Depth, id.Slot))
+				} else {
+					ids = append(ids, id.Name+"@global")
+				}
+			}
+			if na, ok := node.(*ast.NamedArgument); ok {
+				ast.Inspect(na.Value, func(node ast.Node) bool {
+					if id, ok := node.(*ast.Identifier); ok {
+						ids = append(ids, fmt.Sprintf("%s@%d:%d", id.Name, id.Depth, id.Slot))
+					}
+					return true
+				})
+				return false
+			}
+			return true
+		})
+
+		if strings.Join(ids, " ") != tt.out {
+			t.Errorf("wrong resolution for %q.\nexpected: %s\ngot:      %s", tt.in, tt.out, strings.Join(ids, " "))
+		}
+	}
+}
+
+func TestLocals(t *testing.T) {
+	prog := parser.New(lexer.New("fn(a, b = 1, ...c) { let [d, e] = c; match (d) { x => x } }")).Parse()
+	Resolve(prog)
+
+	fn := prog.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionExpression)
+	if strings.Join(fn.Locals, " ") != "a b c d e" {
+		t.Errorf("wrong locals of function. got: %v", fn.Locals)
+	}
+
+	match := fn.Body.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.MatchExpression)
+	if strings.Join(match.Arms[0].Locals, " ") != "x" {
+		t.Errorf("wrong locals of match arm. got: %v", match.Arms[0].Locals)
+	}
+
+	prog = parser.New(lexer.New("fn(a) { if (a) { let b = 1; let [c, b] = a } else { 0 } }")).Parse()
+	Resolve(prog)
+
+	fn = prog.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionExpression)
+	if strings.Join(fn.Locals, " ") != "a" {
+		t.Errorf("wrong locals of function with blocks. got: %v", fn.Locals)
+	}
+	ife := fn.Body.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.IfExpression)
+	if strings.Join(ife.Consequence.Locals, " ") != "b c" {
+		t.Errorf("wrong locals of block. got: %v", ife.Consequence.Locals)
+	}
+	if ife.Alternative.Locals == nil || len(ife.Alternative.Locals) != 0 {
+		t.Errorf("wrong locals of empty block. got: %#v", ife.Alternative.Locals)
+	}
+}
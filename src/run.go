@@ -0,0 +1,57 @@
+package main
+
+import (
+	"ast"
+	"evaluator"
+	"fmt"
+	"lexer"
+	"object"
+	"optimize"
+	"os"
+	"parser"
+	"resolver"
+	"strings"
+)
+
+// run evaluates a file and prints its value. Files ending in .json hold
+// a program in the form printed by `monkey ast` instead of source code.
+func run(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: monkey run FILE")
+		return 2
+	}
+	src, ok := readSource("run", args)
+	if !ok {
+		return 2
+	}
+
+	var prog *ast.Program
+	if strings.HasSuffix(args[0], ".json") {
+		node, err := ast.FromJSON([]byte(src))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", args[0], err)
+			return 1
+		}
+		if prog, ok = node.(*ast.Program); !ok {
+			fmt.Fprintf(os.Stderr, "%s: expected a Program, got a %T\n", args[0], node)
+			return 1
+		}
+	} else {
+		p := parser.New(lexer.New(src))
+		prog = p.Parse()
+		if errors := p.Errors(); len(errors) > 0 {
+			printSyntaxErrors(os.Stderr, args[0], errors)
+			return 1
+		}
+	}
+
+	optimize.Program(prog)
+	resolver.Resolve(prog)
+	res := evaluator.Eval(prog, object.NewEnvironment())
+	if res.Type() == object.TYPE_ERROR {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", args[0], res.Inspect())
+		return 1
+	}
+	fmt.Println(res.Inspect())
+	return 0
+}
@@ -1,18 +1,49 @@
 package token
 
+import (
+	"fmt"
+	"sort"
+)
+
 type Type string
 
 type Token struct {
-	Type    Type
-	Literal string
+	Type    Type     `json:"type"`
+	Literal string   `json:"literal"`
+	Pos     Position `json:"pos"`
+}
+
+// Position is the location of a token in the source, both line and column start from 1.
+type Position struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// IsValid reports whether the position is known.
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+func (p Position) String() string {
+	if !p.IsValid() {
+		return "?"
+	}
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
 }
 
 const (
 	ILLEGAL = "ILLEGAL"
 	EOF     = "EOF"
 
-	IDENT = "IDENT"
-	INT   = "INT"
+	IDENT  = "IDENT"
+	INT    = "INT"
+	STRING = "STRING"
+
+	// a template string with interpolations is lexed as its start, up to the first `${`,
+	// the tokens of each interpolation separated by the middle parts, and its end after the last `}`
+	TEMPLATE_START  = "TEMPLATE_START"
+	TEMPLATE_MIDDLE = "TEMPLATE_MIDDLE"
+	TEMPLATE_END    = "TEMPLATE_END"
 
 	ASSIGN   = "="
 	PLUS     = "+"
@@ -26,13 +57,26 @@ const (
 	EQ     = "=="
 	NOT_EQ = "!="
 
+	COALESCE = "??"
+
+	// the optional forms of . and [, which give null instead of accessing null
+	OPTIONAL_DOT      = "?."
+	OPTIONAL_LBRACKET = "?["
+
 	COMMA     = ","
 	SEMICOLON = ";"
+	COLON     = ":"
+	ARROW     = "=>"
+	RARROW    = "->"
+	ELLIPSIS  = "..."
+	DOT       = "."
 
-	LPAREN = "("
-	RPAREN = ")"
-	LBRACE = "{"
-	RBRACE = "}"
+	LPAREN   = "("
+	RPAREN   = ")"
+	LBRACE   = "{"
+	RBRACE   = "}"
+	LBRACKET = "["
+	RBRACKET = "]"
 
 	FUNCTION = "FUNCTION"
 	LET      = "LET"
@@ -41,16 +85,32 @@ const (
 	RETURN   = "RETURN"
 	TRUE     = "TRUE"
 	FALSE    = "FALSE"
+	THROW    = "THROW"
+	TRY      = "TRY"
+	CATCH    = "CATCH"
+	FINALLY  = "FINALLY"
+	MATCH    = "MATCH"
+	STRUCT   = "STRUCT"
+	CONST    = "CONST"
+	NULL     = "NULL"
 )
 
 var keywords = map[string]Type{
-	"fn":     FUNCTION,
-	"let":    LET,
-	"if":     IF,
-	"else":   ELSE,
-	"return": RETURN,
-	"true":   TRUE,
-	"false":  FALSE,
+	"fn":      FUNCTION,
+	"let":     LET,
+	"if":      IF,
+	"else":    ELSE,
+	"return":  RETURN,
+	"true":    TRUE,
+	"false":   FALSE,
+	"throw":   THROW,
+	"try":     TRY,
+	"catch":   CATCH,
+	"finally": FINALLY,
+	"match":   MATCH,
+	"struct":  STRUCT,
+	"const":   CONST,
+	"null":    NULL,
 }
 
 func LookupIdent(ident string) Type {
@@ -60,3 +120,13 @@ func LookupIdent(ident string) Type {
 	// not a known keyword
 	return IDENT
 }
+
+// Keywords returns the keywords of the language in alphabetical order.
+func Keywords() []string {
+	res := []string{}
+	for k := range keywords {
+		res = append(res, k)
+	}
+	sort.Strings(res)
+	return res
+}
@@ -0,0 +1,990 @@
+// Package typecheck infers the types of a program and reports the operations that cannot work,
+// such as `1 + true`, before it is run. Annotations are checked where they are given,
+// and types are inferred everywhere else, Hindley-Milner style: functions bound by let
+// are polymorphic, so `let id = fn(x) { x }` can be used with both integers and strings.
+package typecheck
+
+import (
+	"ast"
+	"fmt"
+	"token"
+)
+
+// TypeError is a mismatch found by the checker.
+type TypeError struct {
+	Pos     token.Position
+	Message string
+}
+
+func (e *TypeError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Pos, e.Message)
+}
+
+// Check infers the type of prog, which is the one of its last statement,
+// and returns it with all the mismatches found, in source order.
+func Check(prog *ast.Program) (Type, []*TypeError) {
+	c := &checker{}
+	return c.program(prog, newScope(nil)), c.errors
+}
+
+// CheckAfter is Check for prog run after before, in the same scope, like the inputs of the REPL.
+// Only the errors found in prog are returned.
+func CheckAfter(before *ast.Program, prog *ast.Program) (Type, []*TypeError) {
+	c := &checker{}
+	env := newScope(nil)
+	c.program(before, env)
+	known := len(c.errors)
+	return c.program(prog, env), c.errors[known:]
+}
+
+// program checks the statements of prog in env, and returns the type of the last one.
+func (c *checker) program(prog *ast.Program, env *scope) Type {
+	c.predeclare(env, prog)
+	c.hoist(prog.Statements, env)
+
+	var res Type = Any
+	for _, s := range prog.Statements {
+		res = c.statement(s, env)
+	}
+	return res
+}
+
+// types of the builtin functions
+var builtins = map[string]*scheme{
+	"error":       {t: &Function{Params: []Type{String, Any}, Names: []string{"message", "data"}, Required: 1, Result: Error}},
+	"json_encode": {t: &Function{Params: []Type{Any, Int}, Names: []string{"value", "indent"}, Required: 1, Result: String}},
+	"json_decode": {t: &Function{Params: []Type{String, String}, Names: []string{"text", "numbers"}, Required: 1, Result: Any}},
+	"freeze": func() *scheme {
+		a := &Var{}
+		return &scheme{vars: []*Var{a}, t: &Function{Params: []Type{a}, Names: []string{"value"}, Required: 1, Result: a}}
+	}(),
+	"map": func() *scheme {
+		a, b := &Var{}, &Var{}
+		return &scheme{vars: []*Var{a, b}, t: &Function{Params: []Type{&Array{Element: a}, callback(b, a)}, Names: []string{"array", "f"}, Required: 2, Result: &Array{Element: b}}}
+	}(),
+	"filter": func() *scheme {
+		a := &Var{}
+		return &scheme{vars: []*Var{a}, t: &Function{Params: []Type{&Array{Element: a}, callback(Bool, a)}, Names: []string{"array", "f"}, Required: 2, Result: &Array{Element: a}}}
+	}(),
+	"reduce": func() *scheme {
+		a, b := &Var{}, &Var{}
+		return &scheme{vars: []*Var{a, b}, t: &Function{Params: []Type{&Array{Element: a}, callback(b, b, a), b}, Names: []string{"array", "f", "initial"}, Required: 3, Result: b}}
+	}(),
+	"each": func() *scheme {
+		a, b := &Var{}, &Var{}
+		return &scheme{vars: []*Var{a, b}, t: &Function{Params: []Type{&Array{Element: a}, callback(b, a)}, Names: []string{"array", "f"}, Required: 2, Result: Any}}
+	}(),
+	"sort": func() *scheme {
+		a := &Var{}
+		return &scheme{vars: []*Var{a}, t: &Function{Params: []Type{&Array{Element: a}, callback(Bool, a, a)}, Names: []string{"array", "less"}, Required: 1, Result: &Array{Element: a}}}
+	}(),
+	"zip": func() *scheme {
+		a, b := &Var{}, &Var{}
+		// the pairs mix the types of both
+		return &scheme{vars: []*Var{a, b}, t: &Function{Params: []Type{&Array{Element: a}, &Array{Element: b}}, Names: []string{"a", "b"}, Required: 2, Result: &Array{Element: &Array{Element: Any}}}}
+	}(),
+	"range": {t: &Function{Params: []Type{Int, Int, Int}, Names: []string{"start", "end", "step"}, Required: 1, Result: &Array{Element: Int}}},
+	"any":   predicateOver(),
+	"all":   predicateOver(),
+}
+
+// callback is the type of a function given to a builtin, taking params and returning result.
+func callback(result Type, params ...Type) *Function {
+	return &Function{Params: params, Names: make([]string, len(params)), Required: len(params), Result: result}
+}
+
+// predicateOver is the type of the builtins telling whether f is true for the elements of an array.
+func predicateOver() *scheme {
+	a := &Var{}
+	return &scheme{vars: []*Var{a}, t: &Function{Params: []Type{&Array{Element: a}, callback(Bool, a)}, Names: []string{"array", "f"}, Required: 2, Result: Bool}}
+}
+
+type scope struct {
+	names map[string]*scheme
+	outer *scope
+}
+
+func newScope(outer *scope) *scope {
+	return &scope{names: make(map[string]*scheme), outer: outer}
+}
+
+func (s *scope) lookup(name string) (*scheme, bool) {
+	for ; s != nil; s = s.outer {
+		if sc, ok := s.names[name]; ok {
+			return sc, true
+		}
+	}
+	return nil, false
+}
+
+type checker struct {
+	errors  []*TypeError
+	nextVar int
+	trail   []*Var // variables bound so far, so that a failed unification can be undone
+	results []Type // result type of the functions being checked, innermost last
+}
+
+func (c *checker) errorf(pos token.Position, format string, args ...interface{}) {
+	c.errors = append(c.errors, &TypeError{Pos: pos, Message: fmt.Sprintf(format, args...)})
+}
+
+func (c *checker) fresh() *Var {
+	c.nextVar++
+	return &Var{id: c.nextVar}
+}
+
+// expect reports a mismatch at pos unless got can be unified with want.
+func (c *checker) expect(pos token.Position, what string, want Type, got Type) bool {
+	if c.unify(want, got) {
+		return true
+	}
+	names := map[*Var]string{}
+	c.errorf(pos, "%s: expected %s, got %s", what, format(want, names), format(got, names))
+	return false
+}
+
+// try unifies a with b, leaving both as they were if that fails.
+func (c *checker) try(a, b Type) bool {
+	mark := len(c.trail)
+	if c.unify(a, b) {
+		return true
+	}
+	for _, v := range c.trail[mark:] {
+		v.ref = nil
+	}
+	c.trail = c.trail[:mark]
+	return false
+}
+
+func (c *checker) unify(a, b Type) bool {
+	a, b = prune(a), prune(b)
+	if a == b {
+		return true
+	}
+	if v, ok := a.(*Var); ok {
+		return c.bind(v, b)
+	}
+	if v, ok := b.(*Var); ok {
+		return c.bind(v, a)
+	}
+	if a == Any || b == Any {
+		return true
+	}
+
+	switch a := a.(type) {
+	case *Array:
+		if b, ok := b.(*Array); ok {
+			return c.unify(a.Element, b.Element)
+		}
+	case *Hash:
+		if b, ok := b.(*Hash); ok {
+			return c.unify(a.Key, b.Key) && c.unify(a.Value, b.Value)
+		}
+	case *Function:
+		b, ok := b.(*Function)
+		if !ok || len(a.Params) != len(b.Params) || a.Required != b.Required || (a.Rest == nil) != (b.Rest == nil) {
+			return false
+		}
+		for i := range a.Params {
+			if !c.unify(a.Params[i], b.Params[i]) {
+				return false
+			}
+		}
+		if a.Rest != nil && !c.unify(a.Rest, b.Rest) {
+			return false
+		}
+		return c.unify(a.Result, b.Result)
+	}
+	return false
+}
+
+func (c *checker) bind(v *Var, t Type) bool {
+	if occurs(v, t) {
+		return false
+	}
+	v.ref = t
+	c.trail = append(c.trail, v)
+	return true
+}
+
+func (c *checker) instantiate(sc *scheme) Type {
+	if len(sc.vars) == 0 {
+		return sc.t
+	}
+	s := map[*Var]Type{}
+	for _, v := range sc.vars {
+		s[v] = c.fresh()
+	}
+	return substitute(sc.t, s)
+}
+
+// generalize makes t polymorphic in the variables that are not used by env.
+func (c *checker) generalize(t Type, env *scope) *scheme {
+	vars := map[*Var]bool{}
+	freeVars(t, vars)
+	if len(vars) == 0 {
+		return &scheme{t: t}
+	}
+
+	used := map[*Var]bool{}
+	for s := env; s != nil; s = s.outer {
+		for _, sc := range s.names {
+			// the quantified variables of a scheme are not bound anywhere
+			inner := map[*Var]bool{}
+			freeVars(sc.t, inner)
+			for _, v := range sc.vars {
+				delete(inner, v)
+			}
+			for v := range inner {
+				used[v] = true
+			}
+		}
+	}
+
+	res := &scheme{t: t}
+	for v := range vars {
+		if !used[v] {
+			res.vars = append(res.vars, v)
+		}
+	}
+	return res
+}
+
+// predeclare gives a placeholder in env to the names bound by let, struct and fn in node,
+// as the evaluator binds them in the same scope.
+func (c *checker) predeclare(env *scope, node ast.Node) {
+	declare := func(id *ast.Identifier) {
+		if _, ok := env.names[id.Name]; !ok {
+			env.names[id.Name] = &scheme{t: c.fresh(), placeholder: true}
+		}
+	}
+	var visit func(node ast.Node) bool
+	visit = func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.FunctionExpression:
+			return false
+		case *ast.MatchExpression:
+			ast.Inspect(node.Subject, visit)
+			return false
+		case *ast.TryExpression:
+			ast.Inspect(node.Body, visit)
+			ast.Inspect(node.Finally, visit)
+			return false
+		case *ast.BlockStatement:
+			return !node.Scoped
+		case *ast.LetStatement:
+			if node.Ident != nil {
+				declare(node.Ident)
+			}
+		case *ast.StructStatement:
+			declare(node.Name)
+		case *ast.FunctionStatement:
+			declare(node.Name)
+		}
+		return true
+	}
+	ast.Inspect(node, visit)
+}
+
+// annotation turns a type annotation into a Type.
+func (c *checker) annotation(t ast.TypeExpr) Type {
+	switch t := t.(type) {
+	case *ast.NamedType:
+		switch t.Name {
+		case "int":
+			return Int
+		case "bool":
+			return Bool
+		case "string":
+			return String
+		case "error":
+			return Error
+		case "any":
+			return Any
+		}
+		c.errorf(t.Pos(), "unknown type %s", t.Name)
+		return Any
+	case *ast.ArrayType:
+		return &Array{Element: c.annotation(t.Element)}
+	case *ast.HashType:
+		return &Hash{Key: c.annotation(t.Key), Value: c.annotation(t.Value)}
+	case *ast.FunctionType:
+		res := &Function{Required: len(t.Params), Result: c.annotation(t.Result)}
+		for _, p := range t.Params {
+			res.Params = append(res.Params, c.annotation(p))
+		}
+		return res
+	}
+	return c.fresh()
+}
+
+func (c *checker) statement(s ast.Statement, env *scope) Type {
+	switch s := s.(type) {
+	case *ast.ExpressionStatement:
+		return c.expression(s.Expression, env)
+
+	case *ast.LetStatement:
+		if s.Pattern != nil {
+			t := c.expression(s.Value, env)
+			c.pattern(s.Pattern, t, env)
+			return t
+		}
+
+		c.rebind(s.Ident, env)
+
+		// a placeholder lets a function refer to itself, as it looks the name up when it is called
+		sc, ok := env.names[s.Ident.Name]
+		if _, isFunction := s.Value.(*ast.FunctionExpression); isFunction && (!ok || !sc.placeholder) {
+			sc = &scheme{t: c.fresh(), placeholder: true}
+			env.names[s.Ident.Name] = sc
+		}
+		t := c.expression(s.Value, env)
+		if s.Type != nil {
+			want := c.annotation(s.Type)
+			c.expect(s.Value.Pos(), "value of "+s.Ident.Name, want, t)
+			t = want
+		}
+		if sc != nil && sc.placeholder {
+			c.expect(s.Value.Pos(), "value of "+s.Ident.Name, sc.t, t)
+		}
+
+		delete(env.names, s.Ident.Name)
+		env.names[s.Ident.Name] = c.generalize(t, env)
+		env.names[s.Ident.Name].constant = s.IsConst()
+		return t
+
+	case *ast.FunctionStatement:
+		// hoist has bound it already
+		return c.expression(s.Name, env)
+
+	case *ast.ReturnStatement:
+		t := c.expression(s.Value, env)
+		if len(c.results) > 0 {
+			c.expect(s.Value.Pos(), "return value", c.results[len(c.results)-1], t)
+		}
+		// the statement itself never has a value
+		return c.fresh()
+
+	case *ast.ThrowStatement:
+		c.expression(s.Value, env)
+		return c.fresh()
+
+	case *ast.BlockStatement:
+		return c.block(s, env)
+
+	case *ast.StructStatement:
+		c.rebind(s.Name, env)
+		st := &Struct{Name: s.Name.Name, Fields: s.Fields}
+		for range s.Fields {
+			st.Types = append(st.Types, c.fresh())
+		}
+		t := &StructType{Struct: st}
+		if sc, ok := env.names[s.Name.Name]; ok && sc.placeholder {
+			c.unify(sc.t, t)
+		}
+		env.names[s.Name.Name] = &scheme{t: t}
+		return t
+
+	case *ast.AssignStatement:
+		value := c.expression(s.Value, env)
+		left := c.expression(s.Target.Left, env)
+		if st, ok := prune(left).(*Struct); ok {
+			if i := c.field(s.Target, st); i >= 0 && !c.try(st.Types[i], value) {
+				st.Types[i] = Any
+			}
+		} else if !isUnknown(left) {
+			c.errorf(s.Target.Pos(), "cannot set field %s of %s", s.Target.Field, left)
+		}
+		return value
+	}
+	return Any
+}
+
+// rebind reports that id cannot be bound in env, if it is already bound there by const.
+func (c *checker) rebind(id *ast.Identifier, env *scope) {
+	if sc, ok := env.names[id.Name]; ok && sc.constant {
+		c.errorf(id.Pos(), "cannot rebind const %s", id.Name)
+	}
+}
+
+func (c *checker) block(b *ast.BlockStatement, env *scope) Type {
+	if len(b.Statements) == 0 {
+		return Any // null
+	}
+	if b.Scoped {
+		env = newScope(env)
+		for _, s := range b.Statements {
+			c.predeclare(env, s)
+		}
+	}
+	c.hoist(b.Statements, env)
+
+	var res Type
+	for _, s := range b.Statements {
+		res = c.statement(s, env)
+	}
+	return res
+}
+
+// hoist binds in env the functions of the fn statements in stmts before any statement is checked,
+// like the evaluator does. They are checked together, so they can call each other,
+// and are generalized only after all of them are. A fn statement cannot share its name
+// with another declaration of stmts, which it would replace or be replaced by.
+func (c *checker) hoist(stmts []ast.Statement, env *scope) {
+	if fs := ast.FunctionClash(stmts); fs != nil {
+		c.errorf(fs.Pos(), "fn %s clashes with another declaration of %s in its block", fs.Name.Name, fs.Name.Name)
+	}
+
+	var fns []*ast.FunctionStatement
+	var types []Type
+	for _, s := range stmts {
+		fs, ok := s.(*ast.FunctionStatement)
+		if !ok {
+			continue
+		}
+		c.rebind(fs.Name, env)
+		if sc, ok := env.names[fs.Name.Name]; !ok || !sc.placeholder {
+			env.names[fs.Name.Name] = &scheme{t: c.fresh(), placeholder: true}
+		}
+		fns = append(fns, fs)
+	}
+	for _, fs := range fns {
+		t := c.function(fs.Function, env)
+		c.expect(fs.Function.Pos(), "value of "+fs.Name.Name, env.names[fs.Name.Name].t, t)
+		types = append(types, t)
+	}
+
+	for _, fs := range fns {
+		delete(env.names, fs.Name.Name)
+	}
+	for i, fs := range fns {
+		env.names[fs.Name.Name] = c.generalize(types[i], env)
+	}
+}
+
+// condition checks that t can be used as a truth value, like the evaluator's ToBool.
+func (c *checker) condition(pos token.Position, what string, t Type) {
+	switch prune(t) {
+	case Int, Bool, Any:
+		return
+	}
+	if _, ok := prune(t).(*Var); ok {
+		c.unify(t, Bool)
+		return
+	}
+	c.errorf(pos, "%s: expected bool or int, got %s", what, t)
+}
+
+func (c *checker) expression(e ast.Expression, env *scope) Type {
+	switch e := e.(type) {
+	case *ast.IntegerLiteral:
+		return Int
+	case *ast.BooleanLiteral:
+		return Bool
+	case *ast.NullLiteral:
+		return Any
+	case *ast.StringLiteral:
+		return String
+
+	case *ast.Identifier:
+		if sc, ok := env.lookup(e.Name); ok {
+			return c.instantiate(sc)
+		}
+		if sc, ok := builtins[e.Name]; ok {
+			return c.instantiate(sc)
+		}
+		c.errorf(e.Pos(), "unknown identifier: %s", e.Name)
+		return Any
+
+	case *ast.PrefixExpression:
+		t := c.expression(e.Expression, env)
+		switch e.Operator {
+		case "!":
+			c.condition(e.Expression.Pos(), "operand of !", t)
+			return Bool
+		case "-":
+			c.expect(e.Expression.Pos(), "operand of -", Int, t)
+			return Int
+		}
+		return Any
+
+	case *ast.InfixExpression:
+		return c.infix(e, env)
+
+	case *ast.IfExpression:
+		c.condition(e.Condition.Pos(), "condition", c.expression(e.Condition, env))
+		t := c.block(e.Consequence, env)
+		if e.Alternative == nil {
+			return Any // null when the condition does not hold
+		}
+		// like the values of a hash, the branches may give values of different types
+		if !c.try(t, c.block(e.Alternative, env)) {
+			return Any
+		}
+		return t
+
+	case *ast.FunctionExpression:
+		return c.function(e, env)
+
+	case *ast.CallExpression:
+		return c.call(e, env)
+
+	case *ast.ArrayLiteral:
+		// arrays are also used as tuples, whose elements have different types
+		elem := Type(c.fresh())
+		for _, el := range e.Elements {
+			var t Type
+			if spread, ok := el.(*ast.SpreadExpression); ok {
+				t = c.fresh()
+				if !c.expect(spread.Value.Pos(), "spread value", &Array{Element: t}, c.expression(spread.Value, env)) {
+					continue
+				}
+			} else {
+				t = c.expression(el, env)
+			}
+			if !c.try(elem, t) {
+				elem = Any
+			}
+		}
+		return &Array{Element: elem}
+
+	case *ast.HashLiteral:
+		key, value := c.fresh(), Type(c.fresh())
+		for _, pair := range e.Pairs {
+			k := c.expression(pair.Key, env)
+			c.expect(pair.Key.Pos(), "hash key", key, k)
+			// hashes are often used as records, whose values have different types
+			if v := c.expression(pair.Value, env); !c.try(value, v) {
+				value = Any
+			}
+		}
+		c.hashable(e.Pos(), key)
+		return &Hash{Key: key, Value: value}
+
+	case *ast.IndexExpression:
+		return c.index(e, env)
+
+	case *ast.TryExpression:
+		t := c.block(e.Body, env)
+		if e.Catch != nil {
+			scope := newScope(env)
+			scope.names[e.CatchParam.Name] = &scheme{t: Error}
+			c.predeclare(scope, e.Catch)
+			// like the branches of an if, the body and the catch block may give values of different types
+			if !c.try(t, c.block(e.Catch, scope)) {
+				t = Any
+			}
+		}
+		if e.Finally != nil {
+			c.block(e.Finally, env)
+		}
+		return t
+
+	case *ast.MatchExpression:
+		subject := c.expression(e.Subject, env)
+		// the arms may give values of different types, like the branches of an if
+		res := Type(c.fresh())
+		for _, arm := range e.Arms {
+			scope := newScope(env)
+			c.pattern(arm.Pattern, subject, scope)
+			if arm.Guard != nil {
+				c.condition(arm.Guard.Pos(), "guard", c.expression(arm.Guard, scope))
+			}
+			if !c.try(res, c.expression(arm.Body, scope)) {
+				res = Any
+			}
+		}
+		return res
+
+	case *ast.StructLiteral:
+		return c.structLiteral(e, env)
+
+	case *ast.TemplateLiteral:
+		// any value can be interpolated
+		for _, ex := range e.Expressions {
+			c.expression(ex, env)
+		}
+		return String
+
+	case *ast.FieldExpression:
+		left := c.expression(e.Left, env)
+		if st, ok := prune(left).(*Struct); ok {
+			if i := c.field(e, st); i >= 0 {
+				return st.Types[i]
+			}
+			return Any
+		}
+		if t, ok := methodType(left, e.Field); ok {
+			return t
+		}
+		if !isUnknown(left) {
+			c.errorf(e.Pos(), "%s has no member %s", left, e.Field)
+		}
+		return Any
+
+	case *ast.SpreadExpression:
+		c.expression(e.Value, env)
+		return Any
+	case *ast.NamedArgument:
+		c.expression(e.Value, env)
+		return Any
+	}
+	return Any
+}
+
+func (c *checker) infix(e *ast.InfixExpression, env *scope) Type {
+	left := c.expression(e.Left, env)
+	right := c.expression(e.Right, env)
+	first, second := "first operand of "+e.Operator, "second operand of "+e.Operator
+
+	switch e.Operator {
+	case "+":
+		// either adds integers or concatenates strings
+		if prune(left) == String || prune(right) == String {
+			c.expect(e.Left.Pos(), first, String, left)
+			c.expect(e.Right.Pos(), second, String, right)
+			return String
+		}
+		fallthrough
+	case "-", "*", "/":
+		c.expect(e.Left.Pos(), first, Int, left)
+		c.expect(e.Right.Pos(), second, Int, right)
+		return Int
+	case "<", ">":
+		c.expect(e.Left.Pos(), first, Int, left)
+		c.expect(e.Right.Pos(), second, Int, right)
+		return Bool
+	case "??":
+		// left is mostly something that may be null, which has no type of its own
+		if prune(left) == Any {
+			return right
+		}
+		if c.try(left, right) {
+			return left
+		}
+		return Any
+	case "==", "!=":
+		if isNull(e.Left) || isNull(e.Right) {
+			// anything can be compared with null
+			return Bool
+		}
+		if c.expect(e.Right.Pos(), second, left, right) && !comparable(left) {
+			c.errorf(e.Pos(), "cannot compare %s with %s", left, e.Operator)
+		}
+		return Bool
+	}
+	return Any
+}
+
+func isNull(e ast.Expression) bool {
+	_, ok := e.(*ast.NullLiteral)
+	return ok
+}
+
+// comparable reports whether values of type t can be compared with == and !=.
+func comparable(t Type) bool {
+	switch t := prune(t).(type) {
+	case *Var:
+		return true
+	case *Basic:
+		return t != Error
+	case *Struct:
+		return true
+	}
+	return false
+}
+
+// hashable reports the types that cannot be used as hash keys.
+func (c *checker) hashable(pos token.Position, t Type) {
+	if !comparable(t) {
+		c.errorf(pos, "unusable as hash key: %s", t)
+	}
+}
+
+func (c *checker) index(e *ast.IndexExpression, env *scope) Type {
+	left := c.expression(e.Left, env)
+	index := c.expression(e.Index, env)
+
+	switch l := prune(left).(type) {
+	case *Array:
+		c.expect(e.Index.Pos(), "array index", Int, index)
+		return l.Element
+	case *Hash:
+		c.expect(e.Index.Pos(), "hash key", l.Key, index)
+		return l.Value
+	case *Var:
+		// guess from the index whether it is an array or a hash
+		elem := c.fresh()
+		if prune(index) == Int {
+			c.unify(l, &Array{Element: elem})
+		} else {
+			c.hashable(e.Index.Pos(), index)
+			c.unify(l, &Hash{Key: index, Value: elem})
+		}
+		return elem
+	}
+
+	if prune(left) == Error {
+		c.expect(e.Index.Pos(), "error field", String, index)
+		if name, ok := e.Index.(*ast.StringLiteral); ok {
+			switch name.Value {
+			case "message", "position":
+				return String
+			case "stack":
+				return &Array{Element: String}
+			}
+		}
+		return Any
+	}
+	if prune(left) == Any {
+		return Any
+	}
+
+	c.errorf(e.Pos(), "cannot index %s with %s", left, index)
+	return Any
+}
+
+func (c *checker) structLiteral(e *ast.StructLiteral, env *scope) Type {
+	typ := c.expression(e.Type, env)
+	st, ok := prune(typ).(*StructType)
+	if !ok {
+		for _, f := range e.Fields {
+			c.expression(f.Value, env)
+		}
+		if _, isVar := prune(typ).(*Var); !isVar && prune(typ) != Any {
+			c.errorf(e.Type.Pos(), "%s is not a struct type, but %s", e.Type, typ)
+		}
+		return Any
+	}
+
+	given := make([]bool, len(st.Struct.Fields))
+	for _, f := range e.Fields {
+		t := c.expression(f.Value, env)
+		i := indexOf(st.Struct.Fields, f.Name)
+		if i < 0 {
+			c.errorf(f.Token.Pos, "struct %s has no field %s", st.Struct.Name, f.Name)
+			continue
+		}
+		if given[i] {
+			c.errorf(f.Token.Pos, "field %s of struct %s is given twice", f.Name, st.Struct.Name)
+		}
+		given[i] = true
+		if !c.try(st.Struct.Types[i], t) {
+			st.Struct.Types[i] = Any
+		}
+	}
+	for i, ok := range given {
+		if !ok {
+			c.errorf(e.Pos(), "missing field %s of struct %s", st.Struct.Fields[i], st.Struct.Name)
+		}
+	}
+	return st.Struct
+}
+
+// field is the index of the field of st got by e, or -1 if st has no such field.
+func (c *checker) field(e *ast.FieldExpression, st *Struct) int {
+	i := indexOf(st.Fields, e.Field)
+	if i < 0 {
+		c.errorf(e.Pos(), "struct %s has no field %s", st.Name, e.Field)
+	}
+	return i
+}
+
+// isUnknown tells whether nothing can be checked about values of type t.
+func isUnknown(t Type) bool {
+	switch prune(t).(type) {
+	case *Var:
+		return true
+	}
+	return prune(t) == Any
+}
+
+func (c *checker) function(e *ast.FunctionExpression, env *scope) Type {
+	scope := newScope(env)
+	res := &Function{Required: len(e.Params)}
+
+	for i, p := range e.Params {
+		var t Type = c.fresh()
+		if i < len(e.ParamTypes) && e.ParamTypes[i] != nil {
+			t = c.annotation(e.ParamTypes[i])
+		}
+		scope.names[p.Name] = &scheme{t: t}
+		res.Params = append(res.Params, t)
+		res.Names = append(res.Names, p.Name)
+	}
+	for i, d := range e.Defaults {
+		if d != nil {
+			if i < res.Required {
+				res.Required = i
+			}
+			c.expect(d.Pos(), "default value of "+e.Params[i].Name, res.Params[i], c.expression(d, scope))
+		}
+	}
+	if e.Rest != nil {
+		res.Rest = &Array{Element: c.fresh()}
+		if e.RestType != nil {
+			c.expect(e.RestType.Pos(), "rest parameter "+e.Rest.Name, res.Rest, c.annotation(e.RestType))
+		}
+		scope.names[e.Rest.Name] = &scheme{t: res.Rest}
+	}
+
+	if e.ReturnType != nil {
+		res.Result = c.annotation(e.ReturnType)
+	} else {
+		res.Result = c.fresh()
+	}
+
+	c.predeclare(scope, e.Body)
+	c.results = append(c.results, res.Result)
+	body := c.block(e.Body, scope)
+	c.results = c.results[:len(c.results)-1]
+
+	pos := e.Body.Pos()
+	if n := len(e.Body.Statements); n > 0 {
+		pos = e.Body.Statements[n-1].Pos()
+	}
+	c.expect(pos, "result of function", res.Result, body)
+
+	return res
+}
+
+func (c *checker) call(e *ast.CallExpression, env *scope) Type {
+	callee := c.expression(e.Function, env)
+	name := e.CalleeName()
+
+	var args []ast.Expression
+	named := map[string]ast.Expression{}
+	var namedOrder []*ast.NamedArgument
+	spread := false
+	for _, arg := range e.Arguments {
+		switch arg := arg.(type) {
+		case *ast.NamedArgument:
+			named[arg.Name.Name] = arg.Value
+			namedOrder = append(namedOrder, arg)
+		case *ast.SpreadExpression:
+			spread = true
+			args = append(args, arg)
+		default:
+			args = append(args, arg)
+		}
+	}
+
+	switch f := prune(callee).(type) {
+	case *Var:
+		if spread || len(named) > 0 {
+			// the shape of the function cannot be told from the call
+			for _, arg := range e.Arguments {
+				c.expression(arg, env)
+			}
+			return c.fresh()
+		}
+		fn := &Function{Required: len(args), Result: c.fresh()}
+		for _, arg := range args {
+			fn.Params = append(fn.Params, c.expression(arg, env))
+		}
+		if !c.unify(f, fn) {
+			c.errorf(e.Pos(), "cannot infer a type for %s, a value would have to contain itself", e)
+		}
+		return fn.Result
+
+	case *Function:
+		for i, arg := range args {
+			if s, ok := arg.(*ast.SpreadExpression); ok {
+				c.expect(s.Value.Pos(), "spread value", &Array{Element: c.fresh()}, c.expression(s.Value, env))
+				continue
+			}
+			t := c.expression(arg, env)
+			what := fmt.Sprintf("argument %d of %s", i+1, name)
+			if i < len(f.Params) {
+				c.expect(arg.Pos(), what, f.Params[i], t)
+			} else if f.Rest != nil {
+				c.expect(arg.Pos(), what, f.Rest.(*Array).Element, t)
+			} else if !spread {
+				c.errorf(arg.Pos(), "too many arguments for %s: expected %d, got %d", name, len(f.Params), len(args))
+			}
+		}
+
+		given := make([]bool, len(f.Params))
+		for i := range args {
+			if i < len(given) {
+				given[i] = true
+			}
+		}
+		for _, arg := range namedOrder {
+			t := c.expression(arg.Value, env)
+			i := indexOf(f.Names, arg.Name.Name)
+			if i < 0 {
+				if f.Names != nil {
+					c.errorf(arg.Pos(), "unknown parameter %s for %s", arg.Name.Name, name)
+				}
+				continue
+			}
+			if given[i] {
+				c.errorf(arg.Pos(), "parameter %s of %s is given twice", arg.Name.Name, name)
+			}
+			given[i] = true
+			c.expect(arg.Value.Pos(), "argument "+arg.Name.Name+" of "+name, f.Params[i], t)
+		}
+		if !spread {
+			for i := 0; i < f.Required; i++ {
+				if !given[i] {
+					if f.Names != nil {
+						c.errorf(e.Pos(), "missing argument %s for %s", f.Names[i], name)
+					} else {
+						c.errorf(e.Pos(), "missing argument %d for %s", i+1, name)
+					}
+				}
+			}
+		}
+		return f.Result
+
+	default:
+		for _, arg := range e.Arguments {
+			c.expression(arg, env)
+		}
+		if f != Any {
+			c.errorf(e.Pos(), "cannot call %s", callee)
+		}
+		return Any
+	}
+}
+
+func indexOf(names []string, name string) int {
+	for i, n := range names {
+		if n == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// pattern checks that pat can match values of type t, and binds its names in env.
+func (c *checker) pattern(pat ast.Pattern, t Type, env *scope) {
+	switch pat := pat.(type) {
+	case *ast.BindingPattern:
+		c.rebind(pat.Ident, env)
+		env.names[pat.Ident.Name] = &scheme{t: t}
+	case *ast.LiteralPattern:
+		c.expect(pat.Pos(), "pattern "+pat.String(), t, c.expression(pat.Value, env))
+	case *ast.ArrayPattern:
+		elem := c.fresh()
+		c.expect(pat.Pos(), "pattern "+pat.String(), t, &Array{Element: elem})
+		for _, el := range pat.Elements {
+			c.pattern(el, elem, env)
+		}
+		if pat.Rest != nil {
+			c.rebind(pat.Rest, env)
+			env.names[pat.Rest.Name] = &scheme{t: &Array{Element: elem}}
+		}
+	case *ast.HashPattern:
+		key, value := c.fresh(), c.fresh()
+		c.expect(pat.Pos(), "pattern "+pat.String(), t, &Hash{Key: key, Value: value})
+		for _, pair := range pat.Pairs {
+			c.expect(pair.Key.Pos(), "key of pattern", key, c.expression(pair.Key, env))
+			c.pattern(pair.Value, value, env)
+		}
+	case *ast.DefaultPattern:
+		c.expect(pat.Default.Pos(), "default value", t, c.expression(pat.Default, env))
+		c.pattern(pat.Pattern, t, env)
+	}
+}
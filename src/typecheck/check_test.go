@@ -0,0 +1,198 @@
+package typecheck
+
+import (
+	"ast"
+	"lexer"
+	"parser"
+	"strings"
+	"testing"
+)
+
+func check(t *testing.T, in string) (Type, []*TypeError) {
+	p := parser.New(lexer.New(in))
+	prog := p.Parse()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parse errors for %q: %v", in, p.Errors())
+	}
+	return Check(prog)
+}
+
+func TestInference(t *testing.T) {
+	tests := []struct {
+		in  string
+		out string
+	}{
+		{"1 + 2 * 3", "int"},
+		{`"a" + "b"`, "string"},
+		{"1 < 2 == true", "bool"},
+		{"!5", "bool"},
+		{"[1, 2, 3]", "[int]"},
+		{"[]", "['a]"},
+		{`{"a": 1, "b": 2}`, "{string: int}"},
+		{`{"name": "x", "age": 3}`, "{string: any}"},
+		{"fn(x) { x }", "fn('a) -> 'a"},
+		{"fn(a, b) { a + b * 2 }", "fn(int, int) -> int"},
+		{`fn(a, b) { a + "!" }`, "fn(string, 'a) -> string"},
+		{"fn(f, x) { f(f(x)) }", "fn(fn('a) -> 'a, 'a) -> 'a"},
+		{"fn(a, b = 1, ...r) { r }", "fn('a, int?, ...['b]) -> ['b]"},
+		{"fn(a: int, b: bool) -> int { if (b) { a } else { 0 } }", "fn(int, bool) -> int"},
+		{"let id = fn(x) { x }; [id(1), id(2)]", "[int]"},
+		{`let id = fn(x) { x }; let a = id(1); id("s")`, "string"},
+		{"let fact = fn(n) { if (n < 2) { 1 } else { n * fact(n - 1) } }; fact", "fn(int) -> int"},
+		{"let f = fn() { g(1) }; let g = fn(x) { [x] }; f()", "[int]"},
+		{"let x = 1; let x = x < 2; x", "bool"},
+		{"fn(x) { if (x) { return 1 } 2 }", "fn(bool) -> int"},
+		{"fn(a) { a[0] }", "fn(['a]) -> 'a"},
+		{`fn(h) { h["k"] + 1 }`, "fn({string: int}) -> int"},
+		{`try { throw "x" } catch (e) { e["message"] }`, "string"},
+		{`match (1) { 1 => 1, x => "s" }`, "any"},
+		{`match (1) { 1 => 1, _ => "other" }`, "any"},
+		{"let f = fn(x) { match (x) { 1 => x, _ => 0 } }; f", "fn(int) -> int"},
+		{`try { 1 } catch (e) { "failed" }`, "any"},
+		{"try { 1 } catch (e) { 2 }", "int"},
+		{`error("boom", 1)`, "error"},
+		{`match ([1, 2]) { [a, ...r] => r, _ => [] }`, "[int]"},
+		{`let [a, b = 2] = [1]; a + b`, "int"},
+		{`let {name, age} = {"name": "x", "age": 3}; name`, "any"},
+		{"let f = fn(a, b = 2) { a - b }; f(b: 1, a: 2)", "int"},
+		{"let add = fn(...xs) { xs }; add(...[1, 2], 3)", "[int]"},
+		{"let x: any = 1; x + 1", "int"},
+		{"struct Point { x, y }; Point", "struct Point"},
+		{"struct Point { x, y }; Point{x: 1, y: 2}", "Point"},
+		{"struct Point { x, y }; let p = Point{x: 1, y: 2}; p.x + 1", "int"},
+		{`struct Box { v }; let a = Box{v: 1}; let b = Box{v: "s"}; b.v`, "any"},
+		{"struct P { v }; let f = fn(p) { p.v }; f(P{v: 1})", "any"},
+		{"struct P { v }; P{v: 1} == P{v: 2}", "bool"},
+		{`"a,b".split(",")`, "[string]"},
+		{`let n = 1; "n = ${n + 1}, ${[true]}"`, "string"},
+		{"const x = 1; let f = fn(x) { let x = true; x }; f(x)", "bool"},
+		{"struct P { v }; freeze(P{v: [1]}).v", "[int]"},
+		{`"a".upper().len() + 1`, "int"},
+		{"[1, 2].push(3).first()", "int"},
+		{`{"a": true}.keys()`, "[string]"},
+		{`{"a": true}.get("b", false)`, "bool"},
+		{"let f = fn(x) { x.len() }; f", "fn('a) -> any"},
+		{`let x = 1; let s = if (true) { let x = "a"; x } else { "b" }; x`, "int"},
+		{"null", "any"},
+		{"[1] == null", "bool"},
+		{"let f = fn(x) { x ?? 0 }; f", "fn(int) -> int"},
+		{`fn(h) { h["k"] ?? 1 }`, "fn({string: int}) -> int"},
+		{`let h = {"a": "s"}; h?["a"]?.len()`, "int"},
+		{`let f = fn(b) { try { let y = [b]; y } finally { let y = "s" } }; f(true)`, "[bool]"},
+		{"fn isEven(n) { if (n == 0) { true } else { isOdd(n - 1) } }; fn isOdd(n) { if (n == 0) { false } else { isEven(n - 1) } }; isOdd", "fn(int) -> bool"},
+		{"let a = id(1); fn id(x) { x }; [id(true)]", "[bool]"},
+		{`map([1, 2], fn(x) { "s" })`, "[string]"},
+		{"filter(range(10), fn(x) { x > 5 })", "[int]"},
+		{`reduce(["a"], fn(acc, s) { acc + s.len() }, 0)`, "int"},
+		{"sort([3, 1], fn(a, b) { a < b })", "[int]"},
+		{`zip([1], ["a"])`, "[[any]]"},
+		{"let f = fn(xs) { [any(xs, fn(x) { x }), all(xs, fn(x) { x })] }; f", "fn([bool]) -> [bool]"},
+		{"each([1], fn(x) { x })", "any"},
+		{"fn f(n) { if (true) { fn g(m) { [m] }; g(n) } else { [0] } }; f", "fn(int) -> [int]"},
+		{`if (true) { 1 } else { "a" }`, "any"},
+		{"[1, true]", "[any]"},
+		{`[1, "x"]`, "[any]"},
+		{`[1, ...["a"]]`, "[any]"},
+		{"[...[1], 2]", "[int]"},
+		{"let f = fn(x) { [x, 1] }; f", "fn(int) -> [int]"},
+		{"let f = fn(x) { if (true) { x } else { 1 } }; f", "fn(int) -> int"},
+	}
+
+	for _, tt := range tests {
+		typ, errs := check(t, tt.in)
+		if len(errs) > 0 {
+			t.Errorf("checking %q: unexpected errors %v", tt.in, errs)
+			continue
+		}
+		if typ.String() != tt.out {
+			t.Errorf("checking %q: expected type %s, got %s", tt.in, tt.out, typ)
+		}
+	}
+}
+
+func TestTypeErrors(t *testing.T) {
+	tests := []struct {
+		in   string
+		errs string // the errors joined by "; "
+	}{
+		{"1 + true", "1:5: second operand of +: expected int, got bool"},
+		{`1 + "a"`, "1:1: first operand of +: expected string, got int"},
+		{"-true", "1:2: operand of -: expected int, got bool"},
+		{`if ("a") { 1 }`, "1:5: condition: expected bool or int, got string"},
+		{"[1, ...2]", "1:8: spread value: expected ['a], got int"},
+		{"1 == true", "1:6: second operand of ==: expected int, got bool"},
+		{"[1] == [2]", "1:5: cannot compare [int] with =="},
+		{"let x: int = true", "1:14: value of x: expected int, got bool"},
+		{"let f = fn(a: int) -> string { a }", "1:32: result of function: expected string, got int"},
+		{"fn(x) -> int { return true }", "1:23: return value: expected int, got bool"},
+		{"let f = fn(a, b) { a + b }; f(1, true)", "1:34: argument 2 of f: expected int, got bool"},
+		{"let f = fn(a) { a }; f(1, 2)", "1:27: too many arguments for f: expected 1, got 2"},
+		{"let f = fn(a, b) { a }; f(1)", "1:25: missing argument b for f"},
+		{"let f = fn(a) { a }; f(b: 1)", "1:24: unknown parameter b for f; 1:22: missing argument a for f"},
+		{"let f = fn(a) { a }; f(1, a: 2)", "1:27: parameter a of f is given twice"},
+		{"let x = 1; x(2)", "1:12: cannot call int"},
+		{"y + 1", "1:1: unknown identifier: y"},
+		{"if (true) { let y = 1 } else { 0 }; y + 1", "1:37: unknown identifier: y"},
+		{`1 ?? "a"`, ""},
+		{"[1] == [2]", "1:5: cannot compare [int] with =="},
+		{"let id = fn(x) { x }; fn(f) { f(1) + f(true) }", "1:40: argument 1 of f: expected int, got bool"},
+		{"fn(x) { x(x) }", "1:9: cannot infer a type for x(x), a value would have to contain itself"},
+		{"let x: number = 1", "1:8: unknown type number"},
+		{`let [a] = "s"`, "1:5: pattern [a]: expected string, got ['a]"},
+		{`match (1) { "a" => 1, _ => 2 }`, `1:13: pattern "a": expected int, got string`},
+		{`{[1]: 2}`, "1:1: unusable as hash key: [int]"},
+		{`fn(e) { e[true] }`, ""},
+		{`try { 1 } catch (e) { e[0] }`, "1:25: error field: expected string, got int"},
+		{`"a"[0]`, "1:4: cannot index string with int"},
+		{"struct P { v }; P{v: 1, w: 2}", "1:25: struct P has no field w"},
+		{"struct P { v, w }; P{v: 1, v: 2}", "1:28: field v of struct P is given twice; 1:21: missing field w of struct P"},
+		{"struct P { v }; let p = P{v: 1}; p.w", "1:35: struct P has no field w"},
+		{"struct P { v }; let p = P{v: 1}; p.v + true", "1:40: second operand of +: expected int, got bool"},
+		{"let x = 1; x.y", "1:13: int has no member y"},
+		{"let x = 1; x.y = 2", "1:13: cannot set field y of int"},
+		{`"a".size()`, "1:4: string has no member size"},
+		{`"${1 + true}"`, "1:8: second operand of +: expected int, got bool"},
+		{"const x = 1; let x = 2", "1:18: cannot rebind const x"},
+		{"const x = 1; let [x] = [2]", "1:19: cannot rebind const x"},
+		{"const x = 1; struct x {}", "1:21: cannot rebind const x"},
+		{"filter([1], fn(x) { [x] })", "1:13: argument 2 of filter: expected fn(int) -> bool, got fn(int) -> [int]"},
+		{`sort(["a"], fn(a, b) { a < b })`, "1:13: argument 2 of sort: expected fn(string, string) -> bool, got fn(int, int) -> bool"},
+		{"range(true)", "1:7: argument 1 of range: expected int, got bool"},
+		{"fn f(a) { a + 1 }; fn g() { f(true) }", "1:31: argument 1 of f: expected int, got bool"},
+		{"const f = fn() { 1 }; fn f() { 2 }; f()", "1:23: fn f clashes with another declaration of f in its block"},
+		{"fn f() { 1 }; let f = 3", "1:1: fn f clashes with another declaration of f in its block"},
+		{"let g = fn() { struct f { x }; fn f() { 2 } }", "1:32: fn f clashes with another declaration of f in its block"},
+		{"const f = fn() { const y = 1; if (true) { let y = 2 }; let y = 3 }", "1:60: cannot rebind const y"},
+		{`"a".split(1)`, "1:11: argument 1 of split: expected string, got int"},
+		{"[1].push(true)", "1:10: argument 1 of push: expected int, got bool"},
+		{"let x = 1; x{y: 1}", "1:12: x is not a struct type, but int"},
+	}
+
+	for _, tt := range tests {
+		_, errs := check(t, tt.in)
+		msgs := []string{}
+		for _, err := range errs {
+			msgs = append(msgs, err.Error())
+		}
+		if got := strings.Join(msgs, "; "); got != tt.errs {
+			t.Errorf("checking %q: expected errors %q, got %q", tt.in, tt.errs, got)
+		}
+	}
+}
+
+func TestCheckAfter(t *testing.T) {
+	parse := func(in string) *ast.Program {
+		return parser.New(lexer.New(in)).Parse()
+	}
+
+	// y is unknown before, and the error of f(true) is not the one of the new input
+	typ, errs := CheckAfter(parse("y; let f = fn(x) { x + 1 }; f(true)"), parse("let y = f(2); [y]"))
+	if len(errs) > 0 || typ.String() != "[int]" {
+		t.Errorf("expected [int] without errors. got: %s, %v", typ, errs)
+	}
+
+	_, errs = CheckAfter(parse("let f = fn(x) { x + 1 }"), parse(`f("a")`))
+	if len(errs) != 1 || errs[0].Error() != "1:3: argument 1 of f: expected int, got string" {
+		t.Errorf("expected the error of f(\"a\"). got: %v", errs)
+	}
+}
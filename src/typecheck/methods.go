@@ -0,0 +1,62 @@
+package typecheck
+
+// methodType is the type of the method name of the values of type t, and whether it has such a method.
+// Like in the evaluator, only strings, arrays and hashes have methods.
+func methodType(t Type, name string) (Type, bool) {
+	fn := func(result Type, params ...Type) Type {
+		return &Function{Params: params, Required: len(params), Result: result}
+	}
+	switch t := prune(t).(type) {
+	case *Basic:
+		if t != String {
+			return nil, false
+		}
+		switch name {
+		case "len":
+			return fn(Int), true
+		case "upper", "lower", "trim":
+			return fn(String), true
+		case "split":
+			return fn(&Array{Element: String}, String), true
+		case "contains", "starts_with", "ends_with":
+			return fn(Bool, String), true
+		case "repeat":
+			return fn(String, Int), true
+		}
+	case *Array:
+		switch name {
+		case "len":
+			return fn(Int), true
+		case "first", "last":
+			return fn(t.Element), true
+		case "rest", "reverse":
+			return fn(t), true
+		case "push":
+			return fn(t, t.Element), true
+		case "concat":
+			return fn(t, t), true
+		case "join":
+			return fn(String, String), true
+		case "contains":
+			return fn(Bool, t.Element), true
+		}
+	case *Hash:
+		switch name {
+		case "len":
+			return fn(Int), true
+		case "keys":
+			return fn(&Array{Element: t.Key}), true
+		case "values":
+			return fn(&Array{Element: t.Value}), true
+		case "has":
+			return fn(Bool, t.Key), true
+		case "get":
+			return &Function{Params: []Type{t.Key, t.Value}, Required: 1, Result: t.Value}, true
+		case "set":
+			return fn(t, t.Key, t.Value), true
+		case "delete":
+			return fn(t, t.Key), true
+		}
+	}
+	return nil, false
+}
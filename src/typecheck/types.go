@@ -0,0 +1,201 @@
+package typecheck
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Type is the static type of an expression.
+type Type interface {
+	String() string
+}
+
+// Basic is one of the types without parts.
+type Basic struct {
+	Name string
+}
+
+var (
+	Int    = &Basic{Name: "int"}
+	Bool   = &Basic{Name: "bool"}
+	String = &Basic{Name: "string"}
+	Error  = &Basic{Name: "error"}
+
+	// Any is the type of values that cannot be known statically.
+	// It is compatible with every type, so nothing is checked about them.
+	Any = &Basic{Name: "any"}
+)
+
+type Array struct {
+	Element Type
+}
+
+type Hash struct {
+	Key   Type
+	Value Type
+}
+
+type Function struct {
+	Params   []Type
+	Names    []string // name of each of Params, nil if they are not known
+	Required int      // the parameters after the first Required ones have a default value
+	Rest     Type     // type of the rest parameter, which is an array, nil if there is none
+	Result   Type
+}
+
+// Struct is the type of the structs of a struct statement. Two structs only have the same type
+// if they come from the same statement. Field types are inferred from the values given to them,
+// becoming any when they are given values of different types.
+type Struct struct {
+	Name   string
+	Fields []string
+	Types  []Type // type of each of Fields
+}
+
+// StructType is the type of the name bound by a struct statement, which makes structs of type Struct.
+type StructType struct {
+	Struct *Struct
+}
+
+// Var is a type that is not known yet. It becomes another type once it is unified with it.
+type Var struct {
+	id  int
+	ref Type
+}
+
+func (t *Basic) String() string      { return t.Name }
+func (t *Array) String() string      { return format(t, map[*Var]string{}) }
+func (t *Hash) String() string       { return format(t, map[*Var]string{}) }
+func (t *Function) String() string   { return format(t, map[*Var]string{}) }
+func (t *Var) String() string        { return format(t, map[*Var]string{}) }
+func (t *Struct) String() string     { return t.Name }
+func (t *StructType) String() string { return "struct " + t.Struct.Name }
+
+// prune follows the variables that are already bound.
+func prune(t Type) Type {
+	for {
+		v, ok := t.(*Var)
+		if !ok || v.ref == nil {
+			return t
+		}
+		t = v.ref
+	}
+}
+
+// format writes t with its unbound variables named 'a, 'b, ... in order of appearance.
+func format(t Type, names map[*Var]string) string {
+	switch t := prune(t).(type) {
+	case *Basic:
+		return t.Name
+	case *Array:
+		return fmt.Sprintf("[%s]", format(t.Element, names))
+	case *Hash:
+		return fmt.Sprintf("{%s: %s}", format(t.Key, names), format(t.Value, names))
+	case *Function:
+		params := []string{}
+		for i, p := range t.Params {
+			s := format(p, names)
+			if i >= t.Required {
+				s += "?"
+			}
+			params = append(params, s)
+		}
+		if t.Rest != nil {
+			params = append(params, "..."+format(t.Rest, names))
+		}
+		return fmt.Sprintf("fn(%s) -> %s", strings.Join(params, ", "), format(t.Result, names))
+	case *Struct, *StructType:
+		return t.String()
+	case *Var:
+		name, ok := names[t]
+		if !ok {
+			name = "'" + string(rune('a'+len(names)%26))
+			if n := len(names) / 26; n > 0 {
+				name += fmt.Sprint(n)
+			}
+			names[t] = name
+		}
+		return name
+	}
+	return "?"
+}
+
+// occurs reports whether v appears in t.
+func occurs(v *Var, t Type) bool {
+	switch t := prune(t).(type) {
+	case *Var:
+		return t == v
+	case *Array:
+		return occurs(v, t.Element)
+	case *Hash:
+		return occurs(v, t.Key) || occurs(v, t.Value)
+	case *Function:
+		for _, p := range t.Params {
+			if occurs(v, p) {
+				return true
+			}
+		}
+		return (t.Rest != nil && occurs(v, t.Rest)) || occurs(v, t.Result)
+	}
+	return false
+}
+
+// freeVars adds the unbound variables of t to vars.
+func freeVars(t Type, vars map[*Var]bool) {
+	switch t := prune(t).(type) {
+	case *Var:
+		vars[t] = true
+	case *Array:
+		freeVars(t.Element, vars)
+	case *Hash:
+		freeVars(t.Key, vars)
+		freeVars(t.Value, vars)
+	case *Function:
+		for _, p := range t.Params {
+			freeVars(p, vars)
+		}
+		if t.Rest != nil {
+			freeVars(t.Rest, vars)
+		}
+		freeVars(t.Result, vars)
+	}
+}
+
+// scheme is a type that may be polymorphic in some of its variables,
+// which are replaced by fresh ones every time it is used.
+type scheme struct {
+	vars []*Var
+	t    Type
+
+	// a placeholder stands for a let that is later in the same scope,
+	// so that functions may refer to it, and to themselves
+	placeholder bool
+
+	// bound by const, so that it cannot be bound again in its scope
+	constant bool
+}
+
+func substitute(t Type, s map[*Var]Type) Type {
+	switch t := prune(t).(type) {
+	case *Var:
+		if r, ok := s[t]; ok {
+			return r
+		}
+		return t
+	case *Array:
+		return &Array{Element: substitute(t.Element, s)}
+	case *Hash:
+		return &Hash{Key: substitute(t.Key, s), Value: substitute(t.Value, s)}
+	case *Function:
+		res := &Function{Names: t.Names, Required: t.Required, Result: substitute(t.Result, s)}
+		for _, p := range t.Params {
+			res.Params = append(res.Params, substitute(p, s))
+		}
+		if t.Rest != nil {
+			res.Rest = substitute(t.Rest, s)
+		}
+		return res
+	default:
+		return t
+	}
+}